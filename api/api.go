@@ -0,0 +1,208 @@
+// Package api embeds the OpenAPI description of the HTTP API and validates
+// requests and responses against it. The server's tests run their traffic
+// through a Validator and compare the spec's operations with the registered
+// routes, so the document cannot drift from the handlers.
+package api
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+)
+
+//go:embed openapi.yaml
+var spec []byte
+
+func init() {
+	// Merge patches are JSON documents
+	openapi3filter.RegisterBodyDecoder("application/merge-patch+json", openapi3filter.RegisteredBodyDecoder("application/json"))
+}
+
+// Spec returns the OpenAPI document as YAML
+func Spec() []byte {
+	return spec
+}
+
+// Load parses and validates the OpenAPI document
+func Load() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse openapi.yaml: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid openapi.yaml: %w", err)
+	}
+	return doc, nil
+}
+
+// Operation is a method and path of the document
+type Operation struct {
+	Method string
+	Path   string
+}
+
+// Operations returns the operations served under the document's server,
+// such as /api/v1, ordered by path and method. Paths with servers of their
+// own, like the health checks, are left out.
+func Operations(doc *openapi3.T) []Operation {
+	var ops []Operation
+	for path, item := range doc.Paths.Map() {
+		if len(item.Servers) > 0 {
+			continue
+		}
+		for method := range item.Operations() {
+			ops = append(ops, Operation{Method: method, Path: path})
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Path != ops[j].Path {
+			return ops[i].Path < ops[j].Path
+		}
+		return ops[i].Method < ops[j].Method
+	})
+	return ops
+}
+
+// Validator checks requests and responses against the document
+type Validator struct {
+	doc   *openapi3.T
+	paths []specPath
+}
+
+// specPath is a path of the document, split into segments under its server
+type specPath struct {
+	path     string
+	item     *openapi3.PathItem
+	server   *openapi3.Server
+	segments []string
+}
+
+// NewValidator returns a validator for doc
+func NewValidator(doc *openapi3.T) *Validator {
+	v := &Validator{doc: doc}
+	for path, item := range doc.Paths.Map() {
+		server := doc.Servers[0]
+		if len(item.Servers) > 0 {
+			server = item.Servers[0]
+		}
+		full := strings.TrimSuffix(server.URL, "/") + path
+		v.paths = append(v.paths, specPath{path: path, item: item, server: server, segments: strings.Split(full, "/")})
+	}
+	return v
+}
+
+// Route finds the operation of the document r is sent to, and the values of
+// its path parameters
+func (v *Validator) Route(r *http.Request) (*routers.Route, map[string]string, error) {
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	segments := strings.Split(r.URL.Path, "/")
+	var best *specPath
+	var bestParams map[string]string
+	bestLiterals := -1
+	for i := range v.paths {
+		p := &v.paths[i]
+		params, literals, ok := p.match(segments)
+		if ok && literals > bestLiterals {
+			best, bestParams, bestLiterals = p, params, literals
+		}
+	}
+	if best == nil {
+		return nil, nil, fmt.Errorf("%s is not in the spec", r.URL.Path)
+	}
+	op := best.item.GetOperation(method)
+	if op == nil {
+		return nil, nil, fmt.Errorf("%s %s is not in the spec", r.Method, best.path)
+	}
+	route := &routers.Route{
+		Spec:      v.doc,
+		Server:    best.server,
+		Path:      best.path,
+		PathItem:  best.item,
+		Method:    method,
+		Operation: op,
+	}
+	return route, bestParams, nil
+}
+
+// match reports whether the path segments match p, with the values of the
+// path parameters and the number of literal segments matched
+func (p *specPath) match(segments []string) (map[string]string, int, bool) {
+	if len(segments) != len(p.segments) {
+		return nil, 0, false
+	}
+	params := map[string]string{}
+	literals := 0
+	for i, s := range p.segments {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			if segments[i] == "" {
+				return nil, 0, false
+			}
+			params[s[1:len(s)-1]] = segments[i]
+			continue
+		}
+		if s != segments[i] {
+			return nil, 0, false
+		}
+		literals++
+	}
+	return params, literals, true
+}
+
+// ValidateRequest checks the parameters and body of r. The body is read and
+// restored, so r can be served afterwards. Credentials are not checked.
+func (v *Validator) ValidateRequest(r *http.Request) error {
+	route, params, err := v.Route(r)
+	if err != nil {
+		return err
+	}
+	if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		defer func() { r.Body = io.NopCloser(bytes.NewReader(body)) }()
+	}
+	return openapi3filter.ValidateRequest(r.Context(), v.requestInput(r, route, params))
+}
+
+// ValidateResponse checks that the status, headers and body of the response
+// to r are documented for its operation
+func (v *Validator) ValidateResponse(r *http.Request, status int, header http.Header, body []byte) error {
+	route, params, err := v.Route(r)
+	if err != nil {
+		return err
+	}
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: v.requestInput(r, route, params),
+		Status:                 status,
+		Header:                 header,
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true, MultiError: true},
+	}
+	input.SetBodyBytes(body)
+	return openapi3filter.ValidateResponse(r.Context(), input)
+}
+
+func (v *Validator) requestInput(r *http.Request, route *routers.Route, params map[string]string) *openapi3filter.RequestValidationInput {
+	return &openapi3filter.RequestValidationInput{
+		Request:    r,
+		PathParams: params,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			MultiError:         true,
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func load(t *testing.T) *Validator {
+	t.Helper()
+	doc, err := Load()
+	require.NoError(t, err)
+	return NewValidator(doc)
+}
+
+func TestLoad(t *testing.T) {
+	doc, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "/api/v1", doc.Servers[0].URL)
+
+	ops := Operations(doc)
+	assert.Contains(t, ops, Operation{Method: http.MethodGet, Path: "/trips/{id}"})
+	assert.NotContains(t, ops, Operation{Method: http.MethodGet, Path: "/health/live"}, "served outside /api/v1")
+
+	// Every operation documents its errors, except those that never fail
+	for path, item := range doc.Paths.Map() {
+		if len(item.Servers) > 0 {
+			continue
+		}
+		for method, op := range item.Operations() {
+			assert.NotNil(t, op.Responses.Default(), method+" "+path+" documents no problem response")
+			assert.NotEmpty(t, op.OperationID, method+" "+path)
+		}
+	}
+}
+
+func TestValidator_Route(t *testing.T) {
+	v := load(t)
+	tests := []struct {
+		method, url string
+		path        string
+		params      map[string]string
+	}{
+		{"GET", "/api/v1/trips", "/trips", map[string]string{}},
+		{"HEAD", "/api/v1/trips/64b7f0000000000000000001", "/trips/{id}", map[string]string{"id": "64b7f0000000000000000001"}},
+		{"POST", "/api/v1/tenants/acme/suspend", "/tenants/{id}/suspend", map[string]string{"id": "acme"}},
+		{"GET", "/api/v1/telemetry/metrics", "/telemetry/metrics", map[string]string{}},
+		{"GET", "/health/ready", "/health/ready", map[string]string{}},
+	}
+	for _, tt := range tests {
+		route, params, err := v.Route(httptest.NewRequest(tt.method, tt.url, nil))
+		require.NoError(t, err, tt.url)
+		assert.Equal(t, tt.path, route.Path)
+		assert.Equal(t, tt.params, params)
+	}
+
+	_, _, err := v.Route(httptest.NewRequest(http.MethodGet, "/api/v1/unknown", nil))
+	assert.Error(t, err)
+	_, _, err = v.Route(httptest.NewRequest(http.MethodPost, "/api/v1/vehicles/64b7f0000000000000000001", nil))
+	assert.Error(t, err, "vehicles are not created by ID")
+	_, _, err = v.Route(httptest.NewRequest(http.MethodGet, "/health/live/extra", nil))
+	assert.Error(t, err)
+}
+
+func TestValidator_ValidateRequest(t *testing.T) {
+	v := load(t)
+	request := func(method, url, body string) *http.Request {
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		return r
+	}
+
+	valid := `{"vehicle_id":"64b7f0000000000000000001","timestamp":"2024-01-01T00:00:00Z","type":"EV","status":"active"}`
+	r := request(http.MethodPost, "/api/v1/telemetry", valid)
+	require.NoError(t, v.ValidateRequest(r))
+	rest, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, valid, string(rest), "the body is restored")
+
+	assert.Error(t, v.ValidateRequest(request(http.MethodPost, "/api/v1/telemetry", `{"type":"hybrid"}`)))
+	assert.Error(t, v.ValidateRequest(request(http.MethodGet, "/api/v1/trips/not-an-id", "")))
+	assert.Error(t, v.ValidateRequest(request(http.MethodGet, "/api/v1/trips?page_size=0", "")))
+	assert.Error(t, v.ValidateRequest(request(http.MethodGet, "/api/v1/alerts?from=yesterday", "")))
+
+	patch := httptest.NewRequest(http.MethodPatch, "/api/v1/trips/64b7f0000000000000000001", strings.NewReader(`{"notes":null}`))
+	patch.Header.Set("Content-Type", "application/merge-patch+json")
+	assert.NoError(t, v.ValidateRequest(patch))
+}
+
+func TestValidator_ValidateResponse(t *testing.T) {
+	v := load(t)
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/telemetry/metrics", nil)
+	json := http.Header{"Content-Type": {"application/json"}}
+
+	assert.NoError(t, v.ValidateResponse(r, http.StatusOK, json, []byte(`{"total_emissions":1.5,"ev_percent":50,"total_records":2}`)))
+	assert.Error(t, v.ValidateResponse(r, http.StatusOK, json, []byte(`{"total_emissions":"many"}`)))
+	assert.Error(t, v.ValidateResponse(r, http.StatusOK, http.Header{"Content-Type": {"text/html"}}, []byte(`<html>`)))
+
+	problem := http.Header{"Content-Type": {"application/problem+json"}}
+	assert.NoError(t, v.ValidateResponse(r, http.StatusUnauthorized, problem,
+		[]byte(`{"type":"about:blank","title":"Unauthorized","status":401,"code":"unauthorized"}`)))
+	assert.Error(t, v.ValidateResponse(r, http.StatusUnauthorized, problem,
+		[]byte(`{"type":"about:blank","title":"Unauthorized","status":401,"code":"nope"}`)), "codes are an enum")
+}
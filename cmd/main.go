@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
@@ -16,34 +18,99 @@ import (
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/gorilla/websocket"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	"github.com/ukydev/fleet-sustainability/internal/auth"
 	"github.com/ukydev/fleet-sustainability/internal/db"
 	"github.com/ukydev/fleet-sustainability/internal/handlers"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/mail"
+	"github.com/ukydev/fleet-sustainability/internal/metrics"
 	"github.com/ukydev/fleet-sustainability/internal/middleware"
 	"github.com/ukydev/fleet-sustainability/internal/models"
+	"github.com/ukydev/fleet-sustainability/internal/problem"
+	"github.com/ukydev/fleet-sustainability/internal/query"
+	"github.com/ukydev/fleet-sustainability/internal/router"
+	"github.com/ukydev/fleet-sustainability/internal/tracing"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// corsMiddleware adds CORS headers to allow frontend requests
+// corsMiddleware applies the CORS policy. Without one, as in tests, no
+// cross-origin requests are allowed.
 func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Allow requests from any origin (for development)
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
+	if corsPolicy == nil {
+		return next
+	}
+	return corsPolicy.Handler(next)
 }
 
+// List parameters of the collection endpoints, see package query
+var (
+	telemetryListSpec = query.Spec{
+		Filters: map[string]query.Filter{
+			"vehicle_id": {Field: "vehicle_id", Kind: query.ObjectID},
+			"type":       {Field: "type"},
+			"status":     {Field: "status"},
+		},
+		Sorts:       []string{"timestamp", "vehicle_id", "speed", "emissions", "type", "status"},
+		DefaultSort: "-timestamp",
+		TimeRange:   true,
+	}
+	vehicleListSpec = query.Spec{
+		Filters: map[string]query.Filter{
+			"type":   {Field: "type"},
+			"status": {Field: "status"},
+			"make":   {Field: "make"},
+			"model":  {Field: "model"},
+			"year":   {Field: "year", Kind: query.Int},
+		},
+		Sorts:       []string{"created_at", "type", "make", "model", "year", "status"},
+		DefaultSort: "id",
+		TimeRange:   true,
+	}
+	tripListSpec = query.Spec{
+		Filters: map[string]query.Filter{
+			"vehicle_id": {Field: "vehicle_id"},
+			"driver_id":  {Field: "driver_id"},
+			"status":     {Field: "status"},
+			"purpose":    {Field: "purpose"},
+		},
+		Sorts:       []string{"start_time", "end_time", "distance", "duration", "cost", "status", "created_at"},
+		DefaultSort: "-start_time",
+		TimeRange:   true,
+	}
+	maintenanceListSpec = query.Spec{
+		Filters: map[string]query.Filter{
+			"vehicle_id":   {Field: "vehicle_id"},
+			"service_type": {Field: "service_type"},
+			"status":       {Field: "status"},
+			"priority":     {Field: "priority"},
+			"technician":   {Field: "technician"},
+		},
+		Sorts:       []string{"service_date", "next_service_date", "mileage", "cost", "status", "priority", "created_at"},
+		DefaultSort: "-service_date",
+		TimeRange:   true,
+	}
+	costListSpec = query.Spec{
+		Filters: map[string]query.Filter{
+			"vehicle_id":     {Field: "vehicle_id"},
+			"category":       {Field: "category"},
+			"status":         {Field: "status"},
+			"vendor":         {Field: "vendor"},
+			"payment_method": {Field: "payment_method"},
+		},
+		Sorts:       []string{"date", "amount", "category", "vendor", "status", "created_at"},
+		DefaultSort: "-date",
+		TimeRange:   true,
+	}
+)
+
 // TelemetryHandler handles telemetry API requests with injected collection.
 type TelemetryHandler struct {
 	Collection db.TelemetryCollection
@@ -53,9 +120,11 @@ type TelemetryHandler struct {
 func (h *TelemetryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
+		outcome := "invalid"
+		defer func() { metrics.TelemetryIngested.WithLabelValues("http", outcome).Inc() }()
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read body")
 			return
 		}
 		var teleIn struct {
@@ -69,33 +138,38 @@ func (h *TelemetryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			Type         string          `json:"type"`
 			Status       string          `json:"status"`
 		}
-		if err := json.Unmarshal(body, &teleIn); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		_, decodeSpan := tracing.Start(r.Context(), "telemetry.decode")
+		err = json.Unmarshal(body, &teleIn)
+		tracing.End(decodeSpan, &err)
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
 			return
 		}
 		// Input validation and sanitization
+		var invalid models.ValidationError
 		if teleIn.VehicleID == "" {
-			http.Error(w, "vehicle_id is required", http.StatusBadRequest)
-			return
+			invalid.Add("vehicle_id", models.FieldRequired, "vehicle_id is required")
 		}
+		timestamp, err := time.Parse(time.RFC3339, teleIn.Timestamp)
 		if teleIn.Timestamp == "" {
-			http.Error(w, "timestamp is required", http.StatusBadRequest)
-			return
+			invalid.Add("timestamp", models.FieldRequired, "timestamp is required")
+		} else if err != nil {
+			invalid.Add("timestamp", models.FieldInvalid, "Invalid timestamp format")
 		}
 		if teleIn.Type != "ICE" && teleIn.Type != "EV" {
-			http.Error(w, "type must be 'ICE' or 'EV'", http.StatusBadRequest)
-			return
+			invalid.Add("type", models.FieldInvalid, "type must be 'ICE' or 'EV'")
 		}
 		if teleIn.Status != "active" && teleIn.Status != "inactive" {
-			http.Error(w, "status must be 'active' or 'inactive'", http.StatusBadRequest)
-			return
+			invalid.Add("status", models.FieldInvalid, "status must be 'active' or 'inactive'")
 		}
 		if teleIn.Speed < 0 || teleIn.Speed > 300 {
-			http.Error(w, "speed out of range", http.StatusBadRequest)
-			return
+			invalid.Add("speed", models.FieldOutOfRange, "speed out of range")
 		}
 		if teleIn.Emissions < 0 {
-			http.Error(w, "emissions must be non-negative", http.StatusBadRequest)
+			invalid.Add("emissions", models.FieldOutOfRange, "emissions must be non-negative")
+		}
+		if err := invalid.Err(); err != nil {
+			problem.Validation(w, r, err)
 			return
 		}
 		// Enforce EV emissions to zero server-side to prevent bad client data
@@ -103,11 +177,6 @@ func (h *TelemetryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			teleIn.Emissions = 0
 		}
 		// Optionally, add more checks for FuelLevel, BatteryLevel, Location, etc.
-		timestamp, err := time.Parse(time.RFC3339, teleIn.Timestamp)
-		if err != nil {
-			http.Error(w, "Invalid timestamp format", http.StatusBadRequest)
-			return
-		}
 		// Preserve explicit zeros by using pointers from input
 		var fuelPtr, batteryPtr *float64
 		if teleIn.FuelLevel != nil {
@@ -144,206 +213,207 @@ func (h *TelemetryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
         }
 		err = h.Collection.InsertTelemetry(r.Context(), tele)
 		if err != nil {
-			http.Error(w, "Failed to store telemetry", http.StatusInternalServerError)
+			outcome = "error"
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to store telemetry")
 			return
 		}
-		log.WithFields(log.Fields{"vehicle_id": tele.VehicleID}).Info("Stored telemetry")
+		outcome = "stored"
+		logging.FromContext(r.Context()).WithFields(log.Fields{"vehicle_id": tele.VehicleID}).Info("Stored telemetry")
 
 		// Broadcast to SSE subscribers (use original string vehicle_id for clients)
-        if telemetrySSEHub != nil {
-			eventPayload := map[string]interface{}{
-				"vehicle_id":    teleIn.VehicleID,
-				"timestamp":     teleIn.Timestamp,
-				"location":      teleIn.Location,
-				"speed":         teleIn.Speed,
-				"fuel_level":    teleIn.FuelLevel,
-				"battery_level": teleIn.BatteryLevel,
-				"emissions":     teleIn.Emissions,
-				"type":          teleIn.Type,
-				"status":        teleIn.Status,
-			}
-			if data, err := json.Marshal(eventPayload); err == nil {
-                if claims, ok := middleware.GetUserFromContext(r.Context()); ok && claims.TenantID != "" {
-                    // Send to tenant-scoped listeners and also to global listeners (unauth SSE clients in dev)
-                    telemetrySSEHub.BroadcastToTenant(claims.TenantID, data)
-                    telemetrySSEHub.Broadcast(data)
-                } else {
-                    telemetrySSEHub.Broadcast(data)
-                }
-			}
-		}
+		broadcastTelemetry(r.Context(), tele.TenantID, map[string]interface{}{
+			"vehicle_id":    teleIn.VehicleID,
+			"timestamp":     teleIn.Timestamp,
+			"location":      teleIn.Location,
+			"speed":         teleIn.Speed,
+			"fuel_level":    teleIn.FuelLevel,
+			"battery_level": teleIn.BatteryLevel,
+			"emissions":     teleIn.Emissions,
+			"type":          teleIn.Type,
+			"status":        teleIn.Status,
+		})
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok"))
 	case http.MethodGet:
-		// Support time range and vehicle_id filtering
-		fromStr := r.URL.Query().Get("from")
-		toStr := r.URL.Query().Get("to")
-		veh := r.URL.Query().Get("vehicle_id")
-        var filter bson.M = bson.M{}
-        if claims, ok := middleware.GetUserFromContext(r.Context()); ok && claims.TenantID != "" {
-            filter["tenant_id"] = claims.TenantID
-        }
-		if fromStr != "" || toStr != "" {
-			filter["timestamp"] = bson.M{}
-			if fromStr != "" {
-				from, err := time.Parse(time.RFC3339, fromStr)
-				if err != nil {
-					http.Error(w, "Invalid 'from' time format", http.StatusBadRequest)
-					return
-				}
-				filter["timestamp"].(bson.M)["$gte"] = from
-			}
-			if toStr != "" {
-				to, err := time.Parse(time.RFC3339, toStr)
-				if err != nil {
-					http.Error(w, "Invalid 'to' time format", http.StatusBadRequest)
-					return
-				}
-				filter["timestamp"].(bson.M)["$lte"] = to
-			}
-		}
-		if veh != "" {
-			if len(veh) == 24 {
-				if oid, err := primitive.ObjectIDFromHex(veh); err == nil {
-					filter["vehicle_id"] = oid
-				}
-			}
-		}
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		// Filter, sort and page the tenant's telemetry
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
-		// Allow client to control sort and limit; when a time range is provided, do not cap by default
-		sortOrder := int32(-1)
-		if strings.ToLower(r.URL.Query().Get("sort")) == "asc" {
-			sortOrder = 1
-		}
-		var limit int64 = 100
-		if fromStr != "" || toStr != "" {
-			limit = 0 // no limit when a time window is specified
-		}
-		if l := r.URL.Query().Get("limit"); l != "" {
-			if l == "0" {
-				limit = 0
-			} else if n, err := strconv.ParseInt(l, 10, 64); err == nil && n >= 0 {
-				limit = n
+		values := r.URL.Query()
+		// sort=asc|desc and limit predate the shared list parameters; limit=0
+		// asks for the largest page
+		switch strings.ToLower(values.Get("sort")) {
+		case "asc":
+			values.Set("sort", "timestamp")
+		case "desc":
+			values.Set("sort", "-timestamp")
+		}
+		if limit := values.Get("limit"); limit != "" && values.Get("page_size") == "" {
+			if limit == "0" {
+				limit = strconv.Itoa(query.MaxPageSize)
 			}
+			values.Set("page_size", limit)
 		}
-		opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: sortOrder}})
-		if limit > 0 {
-			opts = opts.SetLimit(limit)
-		}
-		cursor, err := h.Collection.Find(ctx, filter, opts)
+		list, err := query.Parse(telemetryListSpec, values)
 		if err != nil {
-			http.Error(w, "Failed to query telemetry", http.StatusInternalServerError)
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, err.Error())
 			return
 		}
-		defer cursor.Close(ctx)
-		var results []models.Telemetry
-		if err := cursor.All(ctx, &results); err != nil {
-			http.Error(w, "Failed to decode telemetry", http.StatusInternalServerError)
+		results, err := h.Collection.FindTelemetry(ctx, list.Query)
+		if err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to query telemetry")
 			return
 		}
-		// Ensure we return an empty array [] instead of null when there are no results
-		if results == nil {
-			results = make([]models.Telemetry, 0)
+		if err := query.Write(w, r, list, results); err != nil {
+			logging.FromContext(r.Context()).WithError(err).Error("Failed to write telemetry")
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(results)
     case http.MethodDelete:
-        // Allow bulk delete of telemetry (tenant-scoped when available)
-        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+        // Allow bulk delete of the tenant's telemetry
+        ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
         defer cancel()
-        // Default: delete all; if tenant present, constrain
-        filter := bson.M{}
-        if claims, ok := middleware.GetUserFromContext(r.Context()); ok && claims.TenantID != "" {
-            filter["tenant_id"] = claims.TenantID
-        }
-        // Prefer direct DeleteMany on the underlying mongo collection when available
-        if mc, ok := h.Collection.(*db.MongoCollection); ok && mc.Collection != nil {
-            if _, err := mc.Collection.DeleteMany(ctx, filter); err != nil {
-                http.Error(w, "Failed to delete telemetry", http.StatusInternalServerError)
-                return
-            }
-        } else {
-            // Fallback to DeleteAll when interface does not expose filtering
-            if err := h.Collection.DeleteAll(ctx); err != nil {
-                http.Error(w, "Failed to delete telemetry", http.StatusInternalServerError)
-                return
-            }
+        if err := h.Collection.DeleteAll(ctx); err != nil {
+            problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to delete telemetry")
+            return
         }
+        middleware.AuditDetail(r.Context(), "deleted", "all")
         w.Header().Set("Content-Type", "application/json")
         w.WriteHeader(http.StatusOK)
         w.Write([]byte(`{"message":"Telemetry cleared"}`))
     default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
 	}
 }
 
-// SSEHub is a simple in-memory hub for broadcasting telemetry updates over SSE.
+// SSEHub is a simple in-memory hub for broadcasting telemetry updates over SSE
+// and WebSocket.
 type SSEHub struct {
     mu      sync.RWMutex
-    clients map[chan []byte]string // chan -> tenant_id
+    clients map[chan []byte]streamClient
+}
+
+// streamClient is a live telemetry subscriber
+type streamClient struct {
+    tenantID  string
+    transport string // "sse" or "ws"
 }
 
 // NewSSEHub creates and returns a new SSEHub.
 func NewSSEHub() *SSEHub {
-    return &SSEHub{clients: make(map[chan []byte]string)}
+    return &SSEHub{clients: make(map[chan []byte]streamClient)}
 }
 
-// Broadcast sends the given data to all connected SSE clients.
-func (h *SSEHub) Broadcast(data []byte) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	for ch := range h.clients {
-		select {
-		case ch <- data:
-		default:
-			// Drop if client is slow
-		}
-	}
+// subscribe registers a client of tenantID and returns its event channel
+func (h *SSEHub) subscribe(tenantID, transport string) chan []byte {
+    ch := make(chan []byte, 16)
+    h.mu.Lock()
+    h.clients[ch] = streamClient{tenantID: tenantID, transport: transport}
+    h.mu.Unlock()
+    metrics.StreamClients.WithLabelValues(transport).Inc()
+    return ch
+}
+
+// unsubscribe removes a client and closes its channel
+func (h *SSEHub) unsubscribe(ch chan []byte) {
+    h.mu.Lock()
+    client := h.clients[ch]
+    delete(h.clients, ch)
+    h.mu.Unlock()
+    close(ch)
+    metrics.StreamClients.WithLabelValues(client.transport).Dec()
 }
 
-// BroadcastToTenant sends data only to clients of a specific tenant.
-func (h *SSEHub) BroadcastToTenant(tenantID string, data []byte) {
+// BroadcastToTenant sends data only to clients of a specific tenant and
+// returns how many received it. There is no broadcast to all clients:
+// telemetry never leaves its tenant.
+func (h *SSEHub) BroadcastToTenant(tenantID string, data []byte) int {
     h.mu.RLock()
     defer h.mu.RUnlock()
-    for ch, t := range h.clients {
-        if t != tenantID {
+    delivered := 0
+    for ch, client := range h.clients {
+        if client.tenantID != tenantID {
             continue
         }
         select {
         case ch <- data:
+            delivered++
         default:
+            // The client is not keeping up; it misses this event
+            metrics.BroadcastsDropped.WithLabelValues(client.transport).Inc()
+        }
+    }
+    return delivered
+}
+
+// broadcastTelemetry sends a stored telemetry event to the live clients of
+// its tenant, traced as the fan-out step of ingestion
+func broadcastTelemetry(ctx context.Context, tenantID string, event map[string]interface{}) {
+    _, span := tracing.Start(ctx, "telemetry.broadcast")
+    defer span.End()
+    if telemetrySSEHub == nil {
+        return
+    }
+    data, err := json.Marshal(event)
+    if err != nil {
+        return
+    }
+    span.SetAttributes(attribute.Int("telemetry.clients", telemetrySSEHub.BroadcastToTenant(tenantID, data)))
+}
+
+// mqttTraceContext returns the trace context a publisher put in an MQTT
+// payload. MQTT 3.1.1 messages carry no user properties, so publishers send
+// traceparent and tracestate as fields of the telemetry JSON instead.
+func mqttTraceContext(payload []byte) map[string]string {
+    var carrier struct {
+        TraceParent string `json:"traceparent"`
+        TraceState  string `json:"tracestate"`
+    }
+    // Malformed payloads are reported by the full decode
+    json.Unmarshal(payload, &carrier)
+    return map[string]string{"traceparent": carrier.TraceParent, "tracestate": carrier.TraceState}
+}
+
+// mqttTopicTenant returns the tenant a telemetry message was published for:
+// the level of topic matched by the first "+" of the subscription filter,
+// e.g. "acme" for tenants/acme/telemetry under tenants/+/telemetry. Brokers
+// authorize publishers per topic, so unlike a tenant_id in the payload this
+// cannot be chosen freely by the device. It returns "" when topic does not
+// match filter or the level is empty.
+func mqttTopicTenant(filter, topic string) string {
+    filterLevels := strings.Split(filter, "/")
+    topicLevels := strings.Split(topic, "/")
+    if len(filterLevels) != len(topicLevels) {
+        return ""
+    }
+    tenant, found := "", false
+    for i, level := range filterLevels {
+        switch {
+        case level == "+" && !found:
+            tenant, found = topicLevels[i], true
+        case level == "+":
+        case level != topicLevels[i]:
+            return ""
         }
     }
+    return tenant
 }
 
 func (h *SSEHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Streaming unsupported")
 		return
 	}
 
-    clientCh := make(chan []byte, 16)
     tenantID := ""
     if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
         tenantID = claims.TenantID
     }
-    h.mu.Lock()
-    h.clients[clientCh] = tenantID
-	h.mu.Unlock()
-
-	defer func() {
-        h.mu.Lock()
-        delete(h.clients, clientCh)
-		h.mu.Unlock()
-		close(clientCh)
-	}()
+    clientCh := h.subscribe(tenantID, "sse")
+    defer h.unsubscribe(clientCh)
 
 	// Initial comment to open stream
 	_, _ = w.Write([]byte(": connected\n\n"))
@@ -371,36 +441,53 @@ func (h *SSEHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 var telemetrySSEHub *SSEHub
 
+// rotateSigningKeys periodically reloads the shared JWT key directory and
+// rotates signing keys when JWT_KEY_ROTATION is set
+func rotateSigningKeys(authService *auth.Service) {
+	ticker := time.NewTicker(auth.KeyReloadInterval)
+	defer ticker.Stop()
+
+	for now := time.Now(); ; now = <-ticker.C {
+		key, err := authService.RotateKeys(now)
+		if err != nil {
+			log.WithError(err).Error("Failed to rotate JWT signing keys")
+			continue
+		}
+		if key != nil {
+			log.WithFields(log.Fields{"kid": key.ID, "alg": key.Algorithm}).Info("Generated new JWT signing key")
+		}
+	}
+}
+
 // --- WebSocket support ---
 var wsUpgrader = websocket.Upgrader{
     ReadBufferSize:  1024,
     WriteBufferSize: 1024,
-    CheckOrigin: func(r *http.Request) bool { return true },
+    // Browsers do not preflight upgrades, so the CORS origin policy is checked here
+    CheckOrigin: func(r *http.Request) bool {
+        if corsPolicy == nil {
+            return r.Header.Get("Origin") == ""
+        }
+        return corsPolicy.AllowOrigin(r)
+    },
 }
 
 func wsTelemetryHandler(w http.ResponseWriter, r *http.Request) {
     conn, err := wsUpgrader.Upgrade(w, r, nil)
     if err != nil {
-        http.Error(w, "Upgrade failed", http.StatusBadRequest)
+        // Upgrade has already replied, e.g. 403 for an origin that is not allowed
+        logging.FromContext(r.Context()).WithError(err).Debug("WebSocket upgrade failed")
         return
     }
     defer conn.Close()
 
-    // Each WS client gets a channel and optional tenant binding
-    clientCh := make(chan []byte, 16)
+    // Each WS client gets a channel bound to its tenant
     tenantID := ""
     if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
         tenantID = claims.TenantID
     }
-    telemetrySSEHub.mu.Lock()
-    telemetrySSEHub.clients[clientCh] = tenantID
-    telemetrySSEHub.mu.Unlock()
-    defer func() {
-        telemetrySSEHub.mu.Lock()
-        delete(telemetrySSEHub.clients, clientCh)
-        telemetrySSEHub.mu.Unlock()
-        close(clientCh)
-    }()
+    clientCh := telemetrySSEHub.subscribe(tenantID, "ws")
+    defer telemetrySSEHub.unsubscribe(clientCh)
 
     // Pump: we only write server->client; read to drain pings/close
     go func() {
@@ -427,40 +514,31 @@ type TelemetryMetricsHandler struct {
 
 // ServeHTTP processes HTTP requests for telemetry metrics.
 func (h TelemetryMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 	// Optionally support time range filtering
 	fromStr := r.URL.Query().Get("from")
 	toStr := r.URL.Query().Get("to")
-	var filter bson.M = bson.M{}
-	if fromStr != "" || toStr != "" {
-		filter["timestamp"] = bson.M{}
-		if fromStr != "" {
-			from, err := time.Parse(time.RFC3339, fromStr)
-			if err != nil {
-				http.Error(w, "Invalid 'from' time format", http.StatusBadRequest)
-				return
-			}
-			filter["timestamp"].(bson.M)["$gte"] = from
+	var filter db.Query
+	if fromStr != "" {
+		from, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid 'from' time format")
+			return
 		}
-		if toStr != "" {
-			to, err := time.Parse(time.RFC3339, toStr)
-			if err != nil {
-				http.Error(w, "Invalid 'to' time format", http.StatusBadRequest)
-				return
-			}
-			filter["timestamp"].(bson.M)["$lte"] = to
+		filter.From = from
+	}
+	if toStr != "" {
+		to, err := time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid 'to' time format")
+			return
 		}
+		filter.To = to
 	}
-	cursor, err := h.Collection.Find(ctx, filter)
+	results, err := h.Collection.FindTelemetry(ctx, filter)
 	if err != nil {
-		http.Error(w, "Failed to query telemetry", http.StatusInternalServerError)
-		return
-	}
-	defer cursor.Close(ctx)
-	var results []models.Telemetry
-	if err := cursor.All(ctx, &results); err != nil {
-		http.Error(w, "Failed to decode telemetry", http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to query telemetry")
 		return
 	}
 	var totalEmissions float64
@@ -496,35 +574,28 @@ type VehicleHandler struct {
 func (h *VehicleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-        // Get all vehicles
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		// Filter, sort and page the tenant's vehicles
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
-
-        vf := bson.M{}
-        if claims, ok := middleware.GetUserFromContext(r.Context()); ok && claims.TenantID != "" {
-            vf["tenant_id"] = claims.TenantID
-        }
-        cursor, err := h.Collection.FindVehicles(ctx, vf)
+		list, err := query.Parse(vehicleListSpec, r.URL.Query())
 		if err != nil {
-			http.Error(w, "Failed to query vehicles", http.StatusInternalServerError)
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, err.Error())
 			return
 		}
-		defer cursor.Close(ctx)
-
-		var vehicles []models.Vehicle
-		if err := cursor.All(ctx, &vehicles); err != nil {
-			http.Error(w, "Failed to decode vehicles", http.StatusInternalServerError)
+		results, err := h.Collection.FindVehicles(ctx, list.Query)
+		if err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to query vehicles")
 			return
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(vehicles)
+		if err := query.Write(w, r, list, results); err != nil {
+			logging.FromContext(r.Context()).WithError(err).Error("Failed to write vehicles")
+		}
 
 	case http.MethodPost:
 		// Create new vehicle
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read body")
 			return
 		}
 
@@ -538,37 +609,7 @@ func (h *VehicleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if err := json.Unmarshal(body, &vehicleInput); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
-			return
-		}
-
-		// Input validation
-		if vehicleInput.Type == "" {
-			http.Error(w, "type is required", http.StatusBadRequest)
-			return
-		}
-		if vehicleInput.Type != "ICE" && vehicleInput.Type != "EV" {
-			http.Error(w, "type must be 'ICE' or 'EV'", http.StatusBadRequest)
-			return
-		}
-		if vehicleInput.Status == "" {
-			http.Error(w, "status is required", http.StatusBadRequest)
-			return
-		}
-		if vehicleInput.Status != "active" && vehicleInput.Status != "inactive" {
-			http.Error(w, "status must be 'active' or 'inactive'", http.StatusBadRequest)
-			return
-		}
-		if vehicleInput.Make == "" {
-			http.Error(w, "make is required", http.StatusBadRequest)
-			return
-		}
-		if vehicleInput.Model == "" {
-			http.Error(w, "model is required", http.StatusBadRequest)
-			return
-		}
-		if vehicleInput.Year < 1900 || vehicleInput.Year > 2030 {
-			http.Error(w, "year must be between 1900 and 2030", http.StatusBadRequest)
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
 			return
 		}
 
@@ -581,20 +622,26 @@ func (h *VehicleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			CurrentLocation: vehicleInput.CurrentLocation,
 			Status:          vehicleInput.Status,
 		}
+		// Input validation
+		if err := vehicle.Validate(); err != nil {
+			problem.Validation(w, r, err)
+			return
+		}
         if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
             vehicle.TenantID = claims.TenantID
         }
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
 
 		err = h.Collection.InsertVehicle(ctx, vehicle)
 		if err != nil {
-			http.Error(w, "Failed to store vehicle", http.StatusInternalServerError)
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to store vehicle")
 			return
 		}
+		middleware.AuditChange(r.Context(), vehicle.ID.Hex(), nil, vehicle)
 
-		log.WithFields(log.Fields{"vehicle_id": vehicle.ID}).Info("Created vehicle")
+		logging.FromContext(r.Context()).WithFields(log.Fields{"vehicle_id": vehicle.ID}).Info("Created vehicle")
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -603,47 +650,40 @@ func (h *VehicleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		})
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
 	}
 }
 
-// vehicleHandler handles individual vehicle operations (PUT, DELETE).
-// vehicleHandler handles individual vehicle operations (GET, PUT, DELETE).
-func vehicleHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract vehicle ID from URL path
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 3 {
-		http.Error(w, "Invalid vehicle ID", http.StatusBadRequest)
-		return
-	}
-	vehicleID := pathParts[len(pathParts)-1]
-
-	// Validate vehicle ID format
-	if len(vehicleID) != 24 {
-		http.Error(w, "Invalid vehicle ID format", http.StatusBadRequest)
-		return
-	}
+// VehicleCollectionHandler handles vehicle collection operations (GET, POST).
+type VehicleCollectionHandler struct {
+	Collection db.VehicleCollection
+}
 
+// ServeHTTP processes HTTP requests for vehicle collection operations.
+func (h *VehicleCollectionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		// Get individual vehicle
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		// Filter, sort and page the tenant's vehicles
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
-
-		vehicle, err := vehicleCollectionHandler.Collection.FindVehicleByID(ctx, vehicleID)
+		list, err := query.Parse(vehicleListSpec, r.URL.Query())
 		if err != nil {
-			http.Error(w, "Vehicle not found", http.StatusNotFound)
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, err.Error())
 			return
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(vehicle)
-
-	case http.MethodPut:
-		// Update vehicle
+		results, err := h.Collection.FindVehicles(ctx, list.Query)
+		if err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to query vehicles")
+			return
+		}
+		if err := query.Write(w, r, list, results); err != nil {
+			logging.FromContext(r.Context()).WithError(err).Error("Failed to write vehicles")
+		}
+    case http.MethodPost:
+		// Create new vehicle
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read body")
 			return
 		}
 
@@ -657,497 +697,204 @@ func vehicleHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if err := json.Unmarshal(body, &vehicleInput); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
 			return
 		}
 
-		// Input validation
-		if vehicleInput.Type != "" && vehicleInput.Type != "ICE" && vehicleInput.Type != "EV" {
-			http.Error(w, "type must be 'ICE' or 'EV'", http.StatusBadRequest)
-			return
+        // Create vehicle model with pre-assigned ID so we can return it
+		vehicle := models.Vehicle{
+			ID:              primitive.NewObjectID(),
+            TenantID:        "",
+			Type:            vehicleInput.Type,
+			Make:            vehicleInput.Make,
+			Model:           vehicleInput.Model,
+			Year:            vehicleInput.Year,
+			CurrentLocation: vehicleInput.CurrentLocation,
+			Status:          vehicleInput.Status,
+			CreatedAt:       time.Now(),
 		}
-		if vehicleInput.Status != "" && vehicleInput.Status != "active" && vehicleInput.Status != "inactive" {
-			http.Error(w, "status must be 'active' or 'inactive'", http.StatusBadRequest)
+		// Input validation
+		if err := vehicle.Validate(); err != nil {
+			problem.Validation(w, r, err)
 			return
 		}
-		if vehicleInput.Year != 0 && (vehicleInput.Year < 1900 || vehicleInput.Year > 2030) {
-			http.Error(w, "year must be between 1900 and 2030", http.StatusBadRequest)
+        if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
+            vehicle.TenantID = claims.TenantID
+        }
+
+		// Store vehicle in database
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := h.Collection.InsertVehicle(ctx, vehicle); err != nil {
+			logging.FromContext(r.Context()).WithError(err).Error("Failed to insert vehicle")
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to create vehicle")
 			return
 		}
+		middleware.AuditChange(r.Context(), vehicle.ID.Hex(), nil, vehicle)
 
-		// Get existing vehicle to merge with updates
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":      vehicle.ID.Hex(),
+			"message": "Vehicle created successfully",
+		})
+
+    case http.MethodDelete:
+        // Bulk delete the tenant's vehicles
+        ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+        defer cancel()
+        if err := h.Collection.DeleteAll(ctx); err != nil {
+            problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to delete vehicles")
+            return
+        }
+        middleware.AuditDetail(r.Context(), "deleted", "all")
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusOK)
+        json.NewEncoder(w).Encode(map[string]string{"message": "Vehicles cleared"})
+        return
+
+	default:
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// TripHandler handles trip management API requests.
+type TripHandler struct {
+	Collection db.TripCollection
+}
 
-		existingVehicle, err := vehicleCollectionHandler.Collection.FindVehicleByID(ctx, vehicleID)
+// ServeHTTP processes HTTP requests for trip management.
+func (h *TripHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// Filter, sort and page the tenant's trips
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+		list, err := query.Parse(tripListSpec, r.URL.Query())
 		if err != nil {
-			http.Error(w, "Vehicle not found", http.StatusNotFound)
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, err.Error())
 			return
 		}
-
-		// Update fields if provided
-		if vehicleInput.Type != "" {
-			existingVehicle.Type = vehicleInput.Type
+		results, err := h.Collection.FindTrips(ctx, list.Query)
+		if err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to query trips")
+			return
 		}
-		if vehicleInput.Make != "" {
-			existingVehicle.Make = vehicleInput.Make
+		if err := query.Write(w, r, list, results); err != nil {
+			logging.FromContext(r.Context()).WithError(err).Error("Failed to write trips")
 		}
-		if vehicleInput.Model != "" {
-			existingVehicle.Model = vehicleInput.Model
+
+	case http.MethodPost:
+		// Create new trip
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read body")
+			return
 		}
-		if vehicleInput.Year != 0 {
-			existingVehicle.Year = vehicleInput.Year
+
+        var trip models.Trip
+		if err := json.Unmarshal(body, &trip); err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+			return
 		}
-		if vehicleInput.Status != "" {
-			existingVehicle.Status = vehicleInput.Status
+
+		// Input validation
+		if err := trip.Validate(); err != nil {
+			problem.Validation(w, r, err)
+			return
 		}
-		if vehicleInput.CurrentLocation.Lat != 0 || vehicleInput.CurrentLocation.Lon != 0 {
-			existingVehicle.CurrentLocation = vehicleInput.CurrentLocation
+		if trip.Status == "" {
+			trip.Status = "planned"
 		}
 
-		// Update in database
-		if err := vehicleCollectionHandler.Collection.UpdateVehicle(ctx, vehicleID, *existingVehicle); err != nil {
-			log.WithError(err).Error("Failed to update vehicle")
-			http.Error(w, "Failed to update vehicle", http.StatusInternalServerError)
+        // Stamp tenant and store trip in database
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+        if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
+            trip.TenantID = claims.TenantID
+        }
+
+		trip.ID = primitive.NewObjectID()
+		if err := h.Collection.InsertTrip(ctx, trip); err != nil {
+			logging.FromContext(r.Context()).WithError(err).Error("Failed to insert trip")
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to create trip")
 			return
 		}
+		middleware.AuditChange(r.Context(), trip.ID.Hex(), nil, trip)
 
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"id":      vehicleID,
-			"message": "Vehicle updated successfully",
+			"id":      trip.ID.Hex(),
+			"message": "Trip created successfully",
 		})
 
-	case http.MethodDelete:
-		// Delete vehicle
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		// Check if vehicle exists
-		_, err := vehicleCollectionHandler.Collection.FindVehicleByID(ctx, vehicleID)
-		if err != nil {
-			http.Error(w, "Vehicle not found", http.StatusNotFound)
-			return
-		}
-
-		// Delete from database
-		if err := vehicleCollectionHandler.Collection.DeleteVehicle(ctx, vehicleID); err != nil {
-			log.WithError(err).Error("Failed to delete vehicle")
-			http.Error(w, "Failed to delete vehicle", http.StatusInternalServerError)
-			return
-		}
+    case http.MethodDelete:
+        // Delete all trip records of the current tenant (bulk)
+        ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+        defer cancel()
+        if err := h.Collection.DeleteAll(ctx); err != nil {
+            logging.FromContext(r.Context()).WithError(err).Error("Failed to delete trip records")
+            problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to delete trip records")
+            return
+        }
+        middleware.AuditDetail(r.Context(), "deleted", "all")
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"id":      vehicleID,
-			"message": "Vehicle deleted successfully",
+			"message": "All trip records deleted successfully",
 		})
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
 	}
 }
 
-// vehicleRouter handles both collection and individual vehicle operations.
-func vehicleRouter(w http.ResponseWriter, r *http.Request) {
-	// Check if this is an individual vehicle operation
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) > 3 && pathParts[3] != "" {
-		// Individual vehicle operation
-		vehicleHandler(w, r)
-		return
-	}
-
-	// Collection operation (GET, POST) - use the handler from main
-	vehicleCollectionHandler.ServeHTTP(w, r)
-}
-
-// VehicleCollectionHandler handles vehicle collection operations (GET, POST).
-type VehicleCollectionHandler struct {
-	Collection db.VehicleCollection
-}
-
-// ServeHTTP processes HTTP requests for vehicle collection operations.
-func (h *VehicleCollectionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	log.Infof("VehicleCollectionHandler: %s %s", r.Method, r.URL.Path)
-	switch r.Method {
-	case http.MethodGet:
-		// Get all vehicles with optional time filtering
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-        // Parse time range parameters; enforce tenant scoping
-		fromStr := r.URL.Query().Get("from")
-		toStr := r.URL.Query().Get("to")
-        var filter bson.M = bson.M{}
-        if claims, ok := middleware.GetUserFromContext(r.Context()); ok && claims.TenantID != "" {
-            filter["tenant_id"] = claims.TenantID
-        }
-
-		// Use ObjectID timestamp for filtering existing vehicles
-		if fromStr != "" || toStr != "" {
-			filter["_id"] = bson.M{}
-			if fromStr != "" {
-				from, err := time.Parse(time.RFC3339, fromStr)
-				if err != nil {
-					http.Error(w, "Invalid 'from' time format", http.StatusBadRequest)
-					return
-				}
-				// Convert time to ObjectID timestamp
-				fromObjectID := primitive.NewObjectIDFromTimestamp(from)
-				filter["_id"].(bson.M)["$gte"] = fromObjectID
-			}
-			if toStr != "" {
-				to, err := time.Parse(time.RFC3339, toStr)
-				if err != nil {
-					http.Error(w, "Invalid 'to' time format", http.StatusBadRequest)
-					return
-				}
-				// Convert time to ObjectID timestamp
-				toObjectID := primitive.NewObjectIDFromTimestamp(to)
-				filter["_id"].(bson.M)["$lte"] = toObjectID
-			}
-		}
-
-		cursor, err := h.Collection.FindVehicles(ctx, filter)
-		if err != nil {
-			http.Error(w, "Failed to query vehicles", http.StatusInternalServerError)
-			return
-		}
-		defer cursor.Close(ctx)
-
-		var results []models.Vehicle
-		if err := cursor.All(ctx, &results); err != nil {
-			http.Error(w, "Failed to decode vehicles", http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(results)
-
-    case http.MethodPost:
-		// Create new vehicle
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			http.Error(w, "Failed to read body", http.StatusBadRequest)
-			return
-		}
-
-		var vehicleInput struct {
-			Type            string          `json:"type"`
-			Make            string          `json:"make"`
-			Model           string          `json:"model"`
-			Year            int             `json:"year"`
-			CurrentLocation models.Location `json:"current_location,omitempty"`
-			Status          string          `json:"status"`
-		}
-
-		if err := json.Unmarshal(body, &vehicleInput); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
-			return
-		}
-
-		// Input validation
-		if vehicleInput.Type == "" {
-			http.Error(w, "type is required", http.StatusBadRequest)
-			return
-		}
-		if vehicleInput.Type != "ICE" && vehicleInput.Type != "EV" {
-			http.Error(w, "type must be 'ICE' or 'EV'", http.StatusBadRequest)
-			return
-		}
-		if vehicleInput.Status == "" {
-			http.Error(w, "status is required", http.StatusBadRequest)
-			return
-		}
-		if vehicleInput.Status != "active" && vehicleInput.Status != "inactive" {
-			http.Error(w, "status must be 'active' or 'inactive'", http.StatusBadRequest)
-			return
-		}
-		if vehicleInput.Make == "" {
-			http.Error(w, "make is required", http.StatusBadRequest)
-			return
-		}
-		if vehicleInput.Model == "" {
-			http.Error(w, "model is required", http.StatusBadRequest)
-			return
-		}
-		if vehicleInput.Year < 1900 || vehicleInput.Year > 2030 {
-			http.Error(w, "year must be between 1900 and 2030", http.StatusBadRequest)
-			return
-		}
-
-        // Create vehicle model with pre-assigned ID so we can return it
-		vehicle := models.Vehicle{
-			ID:              primitive.NewObjectID(),
-            TenantID:        "",
-			Type:            vehicleInput.Type,
-			Make:            vehicleInput.Make,
-			Model:           vehicleInput.Model,
-			Year:            vehicleInput.Year,
-			CurrentLocation: vehicleInput.CurrentLocation,
-			Status:          vehicleInput.Status,
-			CreatedAt:       time.Now(),
-		}
-        if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
-            vehicle.TenantID = claims.TenantID
-        }
-
-		// Store vehicle in database
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		if err := h.Collection.InsertVehicle(ctx, vehicle); err != nil {
-			log.WithError(err).Error("Failed to insert vehicle")
-			http.Error(w, "Failed to create vehicle", http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"id":      vehicle.ID.Hex(),
-			"message": "Vehicle created successfully",
-		})
-
-    case http.MethodDelete:
-        // Bulk delete vehicles (tenant-scoped when available)
-        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-        defer cancel()
-        filter := bson.M{}
-        if claims, ok := middleware.GetUserFromContext(r.Context()); ok && claims.TenantID != "" {
-            filter["tenant_id"] = claims.TenantID
-        }
-        // Use underlying collection for DeleteMany when possible
-        if mc, ok := h.Collection.(*db.MongoCollection); ok && mc.Collection != nil {
-            if _, err := mc.Collection.DeleteMany(ctx, filter); err != nil {
-                http.Error(w, "Failed to delete vehicles", http.StatusInternalServerError)
-                return
-            }
-        } else {
-            // Fallback to interface DeleteAll (no tenant scope)
-            if err := h.Collection.DeleteAll(ctx); err != nil {
-                http.Error(w, "Failed to delete vehicles", http.StatusInternalServerError)
-                return
-            }
-        }
-        w.Header().Set("Content-Type", "application/json")
-        w.WriteHeader(http.StatusOK)
-        json.NewEncoder(w).Encode(map[string]string{"message": "Vehicles cleared"})
-        return
-
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	}
-}
-
-// TripHandler handles trip management API requests.
-type TripHandler struct {
-	Collection db.TripCollection
-}
-
-// ServeHTTP processes HTTP requests for trip management.
-func (h *TripHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-        // Get all trips with optional time filtering and tenant scoping
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		// Parse time range parameters
-		fromStr := r.URL.Query().Get("from")
-		toStr := r.URL.Query().Get("to")
-        var filter bson.M = bson.M{}
-        if claims, ok := middleware.GetUserFromContext(r.Context()); ok && claims.TenantID != "" {
-            filter["tenant_id"] = claims.TenantID
-        }
-
-		if fromStr != "" || toStr != "" {
-			filter["start_time"] = bson.M{}
-			if fromStr != "" {
-				from, err := time.Parse(time.RFC3339, fromStr)
-				if err != nil {
-					http.Error(w, "Invalid 'from' time format", http.StatusBadRequest)
-					return
-				}
-				filter["start_time"].(bson.M)["$gte"] = from
-			}
-			if toStr != "" {
-				to, err := time.Parse(time.RFC3339, toStr)
-				if err != nil {
-					http.Error(w, "Invalid 'to' time format", http.StatusBadRequest)
-					return
-				}
-				filter["start_time"].(bson.M)["$lte"] = to
-			}
-		}
-
-		cursor, err := h.Collection.FindTrips(ctx, filter)
-		if err != nil {
-			http.Error(w, "Failed to query trips", http.StatusInternalServerError)
-			return
-		}
-		defer cursor.Close(ctx)
-
-		var results []models.Trip
-		if err := cursor.All(ctx, &results); err != nil {
-			http.Error(w, "Failed to decode trips", http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(results)
-
-	case http.MethodPost:
-		// Create new trip
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			http.Error(w, "Failed to read body", http.StatusBadRequest)
-			return
-		}
-
-        var trip models.Trip
-		if err := json.Unmarshal(body, &trip); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
-			return
-		}
-
-		// Input validation
-		if trip.VehicleID == "" {
-			http.Error(w, "vehicle_id is required", http.StatusBadRequest)
-			return
-		}
-		if trip.StartTime.IsZero() {
-			http.Error(w, "start_time is required", http.StatusBadRequest)
-			return
-		}
-		if trip.Status == "" {
-			trip.Status = "planned"
-		}
-
-        // Stamp tenant and store trip in database
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-        if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
-            trip.TenantID = claims.TenantID
-        }
-
-		if err := h.Collection.InsertTrip(ctx, trip); err != nil {
-			log.WithError(err).Error("Failed to insert trip")
-			http.Error(w, "Failed to create trip", http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"id":      primitive.NewObjectID().Hex(),
-			"message": "Trip created successfully",
-		})
-
-    case http.MethodDelete:
-        // Delete all trip records for current tenant (bulk)
-        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-        defer cancel()
-        // Note: current db interface doesn't support tenant filter in bulk delete; retain as-is or extend if needed.
-        if err := h.Collection.DeleteAll(ctx); err != nil {
-            log.WithError(err).Error("Failed to delete trip records")
-            http.Error(w, "Failed to delete trip records", http.StatusInternalServerError)
-            return
-        }
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"message": "All trip records deleted successfully",
-		})
-
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	}
-}
-
-// MaintenanceHandler handles maintenance management API requests.
-type MaintenanceHandler struct {
-	Collection db.MaintenanceCollection
+// MaintenanceHandler handles maintenance management API requests.
+type MaintenanceHandler struct {
+	Collection db.MaintenanceCollection
 }
 
 // ServeHTTP processes HTTP requests for maintenance management.
 func (h *MaintenanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	log.Infof("MaintenanceHandler: %s %s", r.Method, r.URL.Path)
 	switch r.Method {
 	case http.MethodGet:
-        // Get all maintenance records with optional time filtering and tenant scoping
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		// Filter, sort and page the tenant's maintenance records
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
-
-		// Parse time range parameters
-		fromStr := r.URL.Query().Get("from")
-		toStr := r.URL.Query().Get("to")
-        var filter bson.M = bson.M{}
-        if claims, ok := middleware.GetUserFromContext(r.Context()); ok && claims.TenantID != "" {
-            filter["tenant_id"] = claims.TenantID
-        }
-
-		if fromStr != "" || toStr != "" {
-			filter["service_date"] = bson.M{}
-			if fromStr != "" {
-				from, err := time.Parse(time.RFC3339, fromStr)
-				if err != nil {
-					http.Error(w, "Invalid 'from' time format", http.StatusBadRequest)
-					return
-				}
-				filter["service_date"].(bson.M)["$gte"] = from
-			}
-			if toStr != "" {
-				to, err := time.Parse(time.RFC3339, toStr)
-				if err != nil {
-					http.Error(w, "Invalid 'to' time format", http.StatusBadRequest)
-					return
-				}
-				filter["service_date"].(bson.M)["$lte"] = to
-			}
-		}
-
-		cursor, err := h.Collection.FindMaintenance(ctx, filter)
+		list, err := query.Parse(maintenanceListSpec, r.URL.Query())
 		if err != nil {
-			http.Error(w, "Failed to query maintenance", http.StatusInternalServerError)
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, err.Error())
 			return
 		}
-		defer cursor.Close(ctx)
-
-		var results []models.Maintenance
-		if err := cursor.All(ctx, &results); err != nil {
-			http.Error(w, "Failed to decode maintenance", http.StatusInternalServerError)
+		results, err := h.Collection.FindMaintenance(ctx, list.Query)
+		if err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to query maintenance")
 			return
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(results)
+		if err := query.Write(w, r, list, results); err != nil {
+			logging.FromContext(r.Context()).WithError(err).Error("Failed to write maintenance")
+		}
 
 	case http.MethodPost:
 		// Create new maintenance record
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read body")
 			return
 		}
 
         var maintenance models.Maintenance
 		if err := json.Unmarshal(body, &maintenance); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
 			return
 		}
 
 		// Input validation
-		if maintenance.VehicleID == "" {
-			http.Error(w, "vehicle_id is required", http.StatusBadRequest)
-			return
-		}
-		if maintenance.ServiceType == "" {
-			http.Error(w, "service_type is required", http.StatusBadRequest)
+		if err := maintenance.Validate(); err != nil {
+			problem.Validation(w, r, err)
 			return
 		}
 		if maintenance.Status == "" {
@@ -1155,34 +902,36 @@ func (h *MaintenanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
         // Stamp tenant and store maintenance in database
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
         if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
             maintenance.TenantID = claims.TenantID
         }
 
+		maintenance.ID = primitive.NewObjectID()
 		if err := h.Collection.InsertMaintenance(ctx, maintenance); err != nil {
-			log.WithError(err).Error("Failed to insert maintenance")
-			http.Error(w, "Failed to create maintenance", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).WithError(err).Error("Failed to insert maintenance")
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to create maintenance")
 			return
 		}
+		middleware.AuditChange(r.Context(), maintenance.ID.Hex(), nil, maintenance)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"id":      primitive.NewObjectID().Hex(),
+			"id":      maintenance.ID.Hex(),
 			"message": "Maintenance created successfully",
 		})
 
 	case http.MethodDelete:
-		log.Infof("MaintenanceHandler DELETE hit")
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
 		if err := h.Collection.DeleteAll(ctx); err != nil {
-			log.WithError(err).Error("Failed to delete maintenance records")
-			http.Error(w, "Failed to delete maintenance records", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).WithError(err).Error("Failed to delete maintenance records")
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to delete maintenance records")
 			return
 		}
+		middleware.AuditDetail(r.Context(), "deleted", "all")
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1191,7 +940,7 @@ func (h *MaintenanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
 	}
 }
 
@@ -1202,82 +951,42 @@ type CostHandler struct {
 
 // ServeHTTP processes HTTP requests for cost management.
 func (h *CostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	log.Infof("CostHandler: %s %s", r.Method, r.URL.Path)
 	switch r.Method {
 	case http.MethodGet:
-        // Get all cost records with optional time filtering and tenant scoping
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		// Filter, sort and page the tenant's cost records
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
-
-		// Parse time range parameters
-		fromStr := r.URL.Query().Get("from")
-		toStr := r.URL.Query().Get("to")
-        var filter bson.M = bson.M{}
-        if claims, ok := middleware.GetUserFromContext(r.Context()); ok && claims.TenantID != "" {
-            filter["tenant_id"] = claims.TenantID
-        }
-
-		if fromStr != "" || toStr != "" {
-			filter["date"] = bson.M{}
-			if fromStr != "" {
-				from, err := time.Parse(time.RFC3339, fromStr)
-				if err != nil {
-					http.Error(w, "Invalid 'from' time format", http.StatusBadRequest)
-					return
-				}
-				filter["date"].(bson.M)["$gte"] = from
-			}
-			if toStr != "" {
-				to, err := time.Parse(time.RFC3339, toStr)
-				if err != nil {
-					http.Error(w, "Invalid 'to' time format", http.StatusBadRequest)
-					return
-				}
-				filter["date"].(bson.M)["$lte"] = to
-			}
-		}
-
-		cursor, err := h.Collection.FindCosts(ctx, filter)
+		list, err := query.Parse(costListSpec, r.URL.Query())
 		if err != nil {
-			http.Error(w, "Failed to query costs", http.StatusInternalServerError)
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, err.Error())
 			return
 		}
-		defer cursor.Close(ctx)
-
-		var results []models.Cost
-		if err := cursor.All(ctx, &results); err != nil {
-			http.Error(w, "Failed to decode costs", http.StatusInternalServerError)
+		results, err := h.Collection.FindCosts(ctx, list.Query)
+		if err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to query costs")
 			return
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(results)
+		if err := query.Write(w, r, list, results); err != nil {
+			logging.FromContext(r.Context()).WithError(err).Error("Failed to write costs")
+		}
 
 	case http.MethodPost:
 		// Create new cost record
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read body")
 			return
 		}
 
         var cost models.Cost
 		if err := json.Unmarshal(body, &cost); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
 			return
 		}
 
 		// Input validation
-		if cost.VehicleID == "" {
-			http.Error(w, "vehicle_id is required", http.StatusBadRequest)
-			return
-		}
-		if cost.Category == "" {
-			http.Error(w, "category is required", http.StatusBadRequest)
-			return
-		}
-		if cost.Amount <= 0 {
-			http.Error(w, "amount must be positive", http.StatusBadRequest)
+		if err := cost.Validate(); err != nil {
+			problem.Validation(w, r, err)
 			return
 		}
 		if cost.Status == "" {
@@ -1285,34 +994,36 @@ func (h *CostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
         // Stamp tenant and store cost in database
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
         if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
             cost.TenantID = claims.TenantID
         }
 
+		cost.ID = primitive.NewObjectID()
 		if err := h.Collection.InsertCost(ctx, cost); err != nil {
-			log.WithError(err).Error("Failed to insert cost")
-			http.Error(w, "Failed to create cost", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).WithError(err).Error("Failed to insert cost")
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to create cost")
 			return
 		}
+		middleware.AuditChange(r.Context(), cost.ID.Hex(), nil, cost)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"id":      primitive.NewObjectID().Hex(),
+			"id":      cost.ID.Hex(),
 			"message": "Cost created successfully",
 		})
 
 	case http.MethodDelete:
-		log.Infof("CostHandler DELETE hit")
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
 		if err := h.Collection.DeleteAll(ctx); err != nil {
-			log.WithError(err).Error("Failed to delete cost records")
-			http.Error(w, "Failed to delete cost records", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).WithError(err).Error("Failed to delete cost records")
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to delete cost records")
 			return
 		}
+		middleware.AuditDetail(r.Context(), "deleted", "all")
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1321,72 +1032,410 @@ func (h *CostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
 	}
 }
 
 var vehicleCollectionHandler *VehicleCollectionHandler
 
-// main is the entry point for the Fleet Sustainability backend service.
-func main() {
-	// Load .env file for local development
-	if err := godotenv.Load(); err != nil {
-		log.WithError(err).Warn("No .env file found (this is fine in production)")
+// requestAudit records the mutating calls of protected routes; set in main
+var requestAudit *middleware.AuditMiddleware
+
+// corsPolicy is the origin policy of the REST, SSE and WebSocket endpoints; set in main
+var corsPolicy *middleware.CORS
+
+// rateLimiter limits protected routes and the public auth endpoints; set in
+// main unless RATE_LIMIT_ENABLED=false
+var rateLimiter *middleware.RateLimiter
+
+// defaultRateLimits are the budgets per route group, see rateLimitGroup. They
+// can be overridden with RATE_LIMIT_<GROUP>_TENANT and RATE_LIMIT_<GROUP>_CALLER.
+var defaultRateLimits = map[string]middleware.RateLimitPolicy{
+	"ingest": {
+		Tenant: db.RateLimit{Requests: 100, Period: time.Second, Burst: 200},
+		Caller: db.RateLimit{Requests: 20, Period: time.Second, Burst: 40},
+	},
+	"read": {
+		Tenant: db.RateLimit{Requests: 50, Period: time.Second, Burst: 100},
+		Caller: db.RateLimit{Requests: 10, Period: time.Second, Burst: 30},
+	},
+	"write": {
+		Tenant: db.RateLimit{Requests: 20, Period: time.Second, Burst: 40},
+		Caller: db.RateLimit{Requests: 5, Period: time.Second, Burst: 20},
+	},
+	"auth": {
+		Caller: db.RateLimit{Requests: 20, Period: time.Minute, Burst: 10},
+	},
+}
+
+// ItemHandler serves one record of a collection at a route ending in {id}: GET returns
+// it, PUT replaces it, PATCH applies a JSON merge patch in which null clears a
+// field, and DELETE removes it. Lookups are tenant-scoped, so records of other
+// tenants are not found.
+type ItemHandler[T any] struct {
+	Noun   string // record name in messages, e.g. "trip"
+	Find   func(ctx context.Context, id string) (*T, error)
+	Update func(ctx context.Context, id string, record T) error
+	Delete func(ctx context.Context, id string) error
+	// Prepare keeps the fields clients cannot change from existing, applies
+	// the defaults of create and validates an updated record
+	Prepare func(record *T, existing *T) error
+}
+
+// ServeHTTP processes HTTP requests for a single record.
+func (h *ItemHandler[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !primitive.IsValidObjectID(id) {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidID, "Invalid "+h.Noun+" ID")
+		return
 	}
-	// Connect to MongoDB
-	client, err := db.ConnectMongo()
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	existing, err := h.Find(ctx, id)
 	if err != nil {
-		log.WithError(err).Fatal("Failed to connect to MongoDB")
-	}
-	log.Info("Connected to MongoDB successfully!")
-	mongoDBName := os.Getenv("MONGO_DB")
-	if mongoDBName == "" {
-		mongoDBName = "fleet"
+		h.fail(w, r, err, "find")
+		return
 	}
-	telemetryCollection := &db.MongoCollection{Collection: client.Database(mongoDBName).Collection("telemetry")}
-	vehicleCollection := &db.MongoCollection{Collection: client.Database(mongoDBName).Collection("vehicles")}
-	tripCollection := &db.MongoCollection{Collection: client.Database(mongoDBName).Collection("trips")}
-	maintenanceCollection := &db.MongoCollection{Collection: client.Database(mongoDBName).Collection("maintenance")}
-	costCollection := &db.MongoCollection{Collection: client.Database(mongoDBName).Collection("costs")}
-	userCollection := &db.MongoUserCollection{Collection: client.Database(mongoDBName).Collection("users")}
 
-    // Ensure TTL index on telemetry to prevent unbounded growth and tenant indexes
-	ttlDays := 30
-	if v := os.Getenv("TELEMETRY_TTL_DAYS"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			ttlDays = n
-    }
-    // Secondary indexes per collection on tenant_id for scoping
-    ensureIndex := func(coll *mongo.Collection, key string) {
-        _, _ = coll.Indexes().CreateOne(context.Background(), mongo.IndexModel{
-            Keys: bson.D{{Key: key, Value: 1}},
-        })
-    }
-    ensureIndex(telemetryCollection.Collection, "tenant_id")
-    ensureIndex(vehicleCollection.Collection, "tenant_id")
-    ensureIndex(tripCollection.Collection, "tenant_id")
-    ensureIndex(maintenanceCollection.Collection, "tenant_id")
-    ensureIndex(costCollection.Collection, "tenant_id")
-	}
-	expireSeconds := int32(ttlDays * 24 * 60 * 60)
-	{
-		idxModel := mongo.IndexModel{
-			Keys:    bson.D{{Key: "timestamp", Value: 1}},
-			Options: options.Index().SetExpireAfterSeconds(expireSeconds).SetName("ttl_timestamp_seconds"),
-		}
-		if _, err := telemetryCollection.Collection.Indexes().CreateOne(context.Background(), idxModel); err != nil {
-			log.WithError(err).Warn("Failed to ensure TTL index on telemetry")
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(existing)
+
+	case http.MethodPut, http.MethodPatch:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read body")
+			return
+		}
+		// PUT replaces the record, so fields it leaves out are cleared
+		var record T
+		if r.Method == http.MethodPatch {
+			record = *existing
+			err = models.MergePatch(&record, body)
 		} else {
-			log.WithFields(log.Fields{"days": ttlDays}).Info("TTL index ensured on telemetry.timestamp")
+			err = json.Unmarshal(body, &record)
+		}
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+			return
+		}
+		if err := h.Prepare(&record, existing); err != nil {
+			problem.Validation(w, r, err)
+			return
+		}
+		if err := h.Update(ctx, id, record); err != nil {
+			h.fail(w, r, err, "update")
+			return
+		}
+		middleware.AuditChange(r.Context(), id, existing, record)
+		// Read back the stored record, with its update time
+		if updated, err := h.Find(ctx, id); err == nil {
+			record = *updated
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(record)
+
+	case http.MethodDelete:
+		if err := h.Delete(ctx, id); err != nil {
+			h.fail(w, r, err, "delete")
+			return
 		}
+		middleware.AuditChange(r.Context(), id, existing, nil)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"id": id, "message": strings.ToUpper(h.Noun[:1]) + h.Noun[1:] + " deleted"})
+
+	default:
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
 	}
+}
 
-	// Initialize authentication services
-	authService, err := auth.NewService()
-	if err != nil {
-		log.WithError(err).Fatal("Failed to initialize auth service")
+// fail answers 404 when the record is not in the tenant scope, which may
+// also happen when it is deleted concurrently, and 500 for storage errors
+func (h *ItemHandler[T]) fail(w http.ResponseWriter, r *http.Request, err error, action string) {
+	if errors.Is(err, db.ErrNotFound) {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, strings.ToUpper(h.Noun[:1])+h.Noun[1:]+" not found")
+		return
+	}
+	logging.FromContext(r.Context()).WithError(err).Error("Failed to " + action + " " + h.Noun)
+	problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to "+action+" "+h.Noun)
+}
+
+// vehicleItemHandler serves /vehicles/{id}
+func vehicleItemHandler(collection db.VehicleCollection) *ItemHandler[models.Vehicle] {
+	return &ItemHandler[models.Vehicle]{
+		Noun:   "vehicle",
+		Find: func(ctx context.Context, id string) (*models.Vehicle, error) {
+			return collection.FindVehicleByID(ctx, id)
+		},
+		Update: func(ctx context.Context, id string, record models.Vehicle) error {
+			return collection.UpdateVehicle(ctx, id, record)
+		},
+		Delete: func(ctx context.Context, id string) error {
+			return collection.DeleteVehicle(ctx, id)
+		},
+		Prepare: func(vehicle, existing *models.Vehicle) error {
+			vehicle.ID, vehicle.TenantID, vehicle.CreatedAt = existing.ID, existing.TenantID, existing.CreatedAt
+			return vehicle.Validate()
+		},
+	}
+}
+
+// tripItemHandler serves /trips/{id}
+func tripItemHandler(collection db.TripCollection) *ItemHandler[models.Trip] {
+	return &ItemHandler[models.Trip]{
+		Noun:   "trip",
+		Find: func(ctx context.Context, id string) (*models.Trip, error) {
+			return collection.FindTripByID(ctx, id)
+		},
+		Update: func(ctx context.Context, id string, record models.Trip) error {
+			return collection.UpdateTrip(ctx, id, record)
+		},
+		Delete: func(ctx context.Context, id string) error {
+			return collection.DeleteTrip(ctx, id)
+		},
+		Prepare: func(trip, existing *models.Trip) error {
+			trip.ID, trip.TenantID, trip.CreatedAt = existing.ID, existing.TenantID, existing.CreatedAt
+			if trip.Status == "" {
+				trip.Status = "planned"
+			}
+			return trip.Validate()
+		},
+	}
+}
+
+// maintenanceItemHandler serves /maintenance/{id}
+func maintenanceItemHandler(collection db.MaintenanceCollection) *ItemHandler[models.Maintenance] {
+	return &ItemHandler[models.Maintenance]{
+		Noun:   "maintenance",
+		Find: func(ctx context.Context, id string) (*models.Maintenance, error) {
+			return collection.FindMaintenanceByID(ctx, id)
+		},
+		Update: func(ctx context.Context, id string, record models.Maintenance) error {
+			return collection.UpdateMaintenance(ctx, id, record)
+		},
+		Delete: func(ctx context.Context, id string) error {
+			return collection.DeleteMaintenance(ctx, id)
+		},
+		Prepare: func(maintenance, existing *models.Maintenance) error {
+			maintenance.ID, maintenance.TenantID, maintenance.CreatedAt = existing.ID, existing.TenantID, existing.CreatedAt
+			if maintenance.Status == "" {
+				maintenance.Status = "scheduled"
+			}
+			return maintenance.Validate()
+		},
+	}
+}
+
+// costItemHandler serves /costs/{id}
+func costItemHandler(collection db.CostCollection) *ItemHandler[models.Cost] {
+	return &ItemHandler[models.Cost]{
+		Noun:   "cost record",
+		Find: func(ctx context.Context, id string) (*models.Cost, error) {
+			return collection.FindCostByID(ctx, id)
+		},
+		Update: func(ctx context.Context, id string, record models.Cost) error {
+			return collection.UpdateCost(ctx, id, record)
+		},
+		Delete: func(ctx context.Context, id string) error {
+			return collection.DeleteCost(ctx, id)
+		},
+		Prepare: func(cost, existing *models.Cost) error {
+			cost.ID, cost.TenantID, cost.CreatedAt = existing.ID, existing.TenantID, existing.CreatedAt
+			if cost.Status == "" {
+				cost.Status = "pending"
+			}
+			return cost.Validate()
+		},
+	}
+}
+
+// rateLimitGroup returns the budget a request draws from, so that telemetry
+// ingest, dashboard reads and other writes do not starve each other. Changes
+// to user accounts draw from the budget of the account routes.
+func rateLimitGroup(r *http.Request) string {
+	read := r.Method == http.MethodGet || r.Method == http.MethodHead
+	switch {
+	case strings.HasPrefix(r.URL.Path, apiPrefix+"/auth/"):
+		return "auth"
+	case strings.HasPrefix(r.URL.Path, apiPrefix+"/users") && !read:
+		return "auth"
+	case r.URL.Path == apiPrefix+"/telemetry" && r.Method == http.MethodPost:
+		return "ingest"
+	case read:
+		return "read"
+	default:
+		return "write"
+	}
+}
+
+// tenantCacheTTL is how long a tenant lookup is cached, and so how long a
+// suspension made on another instance can take to apply here
+const tenantCacheTTL = 30 * time.Second
+
+// routePermissions is the RBAC matrix: the permission each method of a
+// protected route requires, by route pattern. Routes are registered for the
+// methods listed here, so other methods are rejected with 405.
+var routePermissions = map[string]middleware.MethodPermissions{
+	"/telemetry": {
+		http.MethodGet:    models.PermViewTelemetry,
+		http.MethodPost:   models.PermCreateTelemetry,
+		http.MethodDelete: models.PermDeleteTelemetry,
+	},
+	"/telemetry/stream": {
+		http.MethodGet: models.PermViewTelemetry,
+	},
+	"/telemetry/ws": {
+		http.MethodGet: models.PermViewTelemetry,
+	},
+	"/telemetry/metrics": {
+		http.MethodGet: models.PermViewMetrics,
+	},
+	"/telemetry/metrics/advanced": {
+		http.MethodGet: models.PermViewMetrics,
+	},
+	"/alerts": {
+		http.MethodGet: models.PermViewAlerts,
+	},
+	"/vehicles": {
+		http.MethodGet:    models.PermViewVehicles,
+		http.MethodPost:   models.PermCreateVehicle,
+		http.MethodDelete: models.PermDeleteVehicle,
+	},
+	"/vehicles/{id}": {
+		http.MethodGet:    models.PermViewVehicles,
+		http.MethodPut:    models.PermUpdateVehicle,
+		http.MethodPatch:  models.PermUpdateVehicle,
+		http.MethodDelete: models.PermDeleteVehicle,
+	},
+	"/trips": {
+		http.MethodGet:    models.PermViewTrips,
+		http.MethodPost:   models.PermCreateTrip,
+		http.MethodDelete: models.PermDeleteTrip,
+	},
+	"/trips/{id}": {
+		http.MethodGet:    models.PermViewTrips,
+		http.MethodPut:    models.PermUpdateTrip,
+		http.MethodPatch:  models.PermUpdateTrip,
+		http.MethodDelete: models.PermDeleteTrip,
+	},
+	"/maintenance": {
+		http.MethodGet:    models.PermViewMaintenance,
+		http.MethodPost:   models.PermCreateMaintenance,
+		http.MethodDelete: models.PermDeleteMaintenance,
+	},
+	"/maintenance/{id}": {
+		http.MethodGet:    models.PermViewMaintenance,
+		http.MethodPut:    models.PermUpdateMaintenance,
+		http.MethodPatch:  models.PermUpdateMaintenance,
+		http.MethodDelete: models.PermDeleteMaintenance,
+	},
+	"/costs": {
+		http.MethodGet:    models.PermViewCosts,
+		http.MethodPost:   models.PermCreateCost,
+		http.MethodDelete: models.PermDeleteCost,
+	},
+	"/costs/{id}": {
+		http.MethodGet:    models.PermViewCosts,
+		http.MethodPut:    models.PermUpdateCost,
+		http.MethodPatch:  models.PermUpdateCost,
+		http.MethodDelete: models.PermDeleteCost,
+	},
+	"/api-keys": {
+		http.MethodGet:  models.PermManageAPIKeys,
+		http.MethodPost: models.PermManageAPIKeys,
+	},
+	"/api-keys/{id}": {
+		http.MethodDelete: models.PermManageAPIKeys,
+	},
+	"/auth/mfa/policy": {
+		http.MethodGet: models.PermManageUsers,
+		http.MethodPut: models.PermManageUsers,
+	},
+	"/audit": {
+		http.MethodGet: models.PermViewAudit,
+	},
+	"/audit/verify": {
+		http.MethodGet: models.PermViewAudit,
+	},
+	"/tenants": {
+		http.MethodGet:  models.PermManageTenants,
+		http.MethodPost: models.PermManageTenants,
+	},
+	"/tenants/{id}": {
+		http.MethodGet:    models.PermManageTenants,
+		http.MethodPut:    models.PermManageTenants,
+		http.MethodPatch:  models.PermManageTenants,
+		http.MethodDelete: models.PermManageTenants,
+	},
+	"/tenants/{id}/suspend": {
+		http.MethodPost: models.PermManageTenants,
+	},
+	"/tenants/{id}/activate": {
+		http.MethodPost: models.PermManageTenants,
+	},
+}
+
+// protectedRoutes registers routes behind authentication, rate limiting,
+// auditing and the permission the RBAC matrix requires for their method
+type protectedRoutes struct {
+	api            *router.Router
+	authMiddleware *middleware.AuthMiddleware
+}
+
+// protect returns the protected routes of api
+func protect(api *router.Router, authMiddleware *middleware.AuthMiddleware) protectedRoutes {
+	return protectedRoutes{api: api, authMiddleware: authMiddleware}
+}
+
+// Handle registers handler for method requests to pattern. A route missing
+// from the matrix is a programming error.
+func (p protectedRoutes) Handle(method, pattern string, handler http.Handler) {
+	permission, ok := routePermissions[pattern][method]
+	if !ok {
+		log.WithFields(log.Fields{"method": method, "route": pattern}).Fatal("No permission defined for route")
+	}
+	p.api.Handle(method, pattern, p.authMiddleware.Authenticate(rateLimited(audited(p.authMiddleware.RequirePermission(permission)(handler)))))
+}
+
+// HandleAll registers handler for every method the matrix allows on pattern
+func (p protectedRoutes) HandleAll(pattern string, handler http.Handler) {
+	for method := range routePermissions[pattern] {
+		p.Handle(method, pattern, handler)
+	}
+}
+
+// rateLimited applies the rate limiter, if enabled, to handler
+func rateLimited(handler http.Handler) http.Handler {
+	if rateLimiter == nil {
+		return handler
+	}
+	return rateLimiter.Limit(handler)
+}
+
+// audited records the mutating calls handled by handler in the audit log. It
+// runs inside Authenticate, so rejected attempts are recorded with their caller.
+func audited(handler http.Handler) http.Handler {
+	if requestAudit == nil {
+		return handler
 	}
+	return requestAudit.Audit(handler)
+}
+
+// apiPrefix is the path of the current API version
+const apiPrefix = "/api/v1"
 
+// newAPI returns the router of the versioned API, applying the CORS policy
+// to every route
+func newAPI() *router.Router {
+	api := router.New(apiPrefix)
+	api.Use(corsMiddleware)
+	return api
+}
+
+// registerDataRoutes registers the fleet data API on api. Every route is
+// authenticated, so its queries are confined to the caller's tenant.
+func registerDataRoutes(api *router.Router, authMiddleware *middleware.AuthMiddleware, telemetryCollection db.TelemetryCollection, vehicleCollection db.VehicleCollection, tripCollection db.TripCollection, maintenanceCollection db.MaintenanceCollection, costCollection db.CostCollection, tenantStore db.TenantStore) {
     // Initialize handlers
 	telemetryHandler := &TelemetryHandler{Collection: telemetryCollection}
 	vehicleCollectionHandler = &VehicleCollectionHandler{Collection: vehicleCollection}
@@ -1396,32 +1445,30 @@ func main() {
 	telemetryMetricsHandler := TelemetryMetricsHandler{Collection: telemetryCollection}
     alertsHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Threshold-based alerts from telemetry with optional time filtering
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
 		fromStr := r.URL.Query().Get("from")
 		toStr := r.URL.Query().Get("to")
-		var ts bson.M
+		var filter db.Query
 		if fromStr != "" || toStr != "" {
-			ts = bson.M{}
-			if fromStr != "" { if from, err := time.Parse(time.RFC3339, fromStr); err == nil { ts["$gte"] = from } }
-			if toStr != "" { if to, err := time.Parse(time.RFC3339, toStr); err == nil { ts["$lte"] = to } }
+			if fromStr != "" { if from, err := time.Parse(time.RFC3339, fromStr); err == nil { filter.From = from } }
+			if toStr != "" { if to, err := time.Parse(time.RFC3339, toStr); err == nil { filter.To = to } }
 		} else {
-			ts = bson.M{"$gte": time.Now().Add(-1 * time.Hour)}
+			filter.From = time.Now().Add(-1 * time.Hour)
+		}
+		rows, err := telemetryCollection.FindTelemetry(ctx, filter)
+		if err != nil { problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to query telemetry"); return }
+		thresholds := models.DefaultAlertThresholds
+		if claims, ok := middleware.GetUserFromContext(r.Context()); ok && claims.TenantID != "" {
+			if tenant, err := tenantStore.FindTenantByID(ctx, claims.TenantID); err == nil {
+				thresholds = tenant.AlertThresholds
+			}
 		}
-        filter := bson.M{"timestamp": ts}
-        if claims, ok := middleware.GetUserFromContext(r.Context()); ok && claims.TenantID != "" {
-            filter["tenant_id"] = claims.TenantID
-        }
-		cursor, err := telemetryCollection.Find(ctx, filter)
-		if err != nil { http.Error(w, "Failed to query telemetry", http.StatusInternalServerError); return }
-		defer cursor.Close(ctx)
-		var rows []models.Telemetry
-		if err := cursor.All(ctx, &rows); err != nil { http.Error(w, "Failed to decode telemetry", http.StatusInternalServerError); return }
 		alerts := []map[string]interface{}{}
 		for _, t := range rows {
-			if t.FuelLevel != nil && *t.FuelLevel <= 10 { alerts = append(alerts, map[string]interface{}{"type":"low_fuel","vehicle_id":t.VehicleID.Hex(),"value":*t.FuelLevel,"ts":t.Timestamp}) }
-			if t.BatteryLevel != nil && *t.BatteryLevel <= 10 { alerts = append(alerts, map[string]interface{}{"type":"low_battery","vehicle_id":t.VehicleID.Hex(),"value":*t.BatteryLevel,"ts":t.Timestamp}) }
-			if t.Emissions >= 50 { alerts = append(alerts, map[string]interface{}{"type":"high_emissions","vehicle_id":t.VehicleID.Hex(),"value":t.Emissions,"ts":t.Timestamp}) }
+			if t.FuelLevel != nil && *t.FuelLevel <= thresholds.LowFuelPct { alerts = append(alerts, map[string]interface{}{"type":"low_fuel","vehicle_id":t.VehicleID.Hex(),"value":*t.FuelLevel,"ts":t.Timestamp}) }
+			if t.BatteryLevel != nil && *t.BatteryLevel <= thresholds.LowBatteryPct { alerts = append(alerts, map[string]interface{}{"type":"low_battery","vehicle_id":t.VehicleID.Hex(),"value":*t.BatteryLevel,"ts":t.Timestamp}) }
+			if t.Emissions >= thresholds.HighEmissions { alerts = append(alerts, map[string]interface{}{"type":"high_emissions","vehicle_id":t.VehicleID.Hex(),"value":t.Emissions,"ts":t.Timestamp}) }
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(alerts)
@@ -1429,18 +1476,15 @@ func main() {
 
 	advancedMetricsHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Naive aggregates: fuel used (delta), cost estimate, daily emissions trend
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
 		fromStr := r.URL.Query().Get("from")
-		var filter bson.M = bson.M{}
+		var filter db.Query
 		if fromStr != "" {
-			if from, err := time.Parse(time.RFC3339, fromStr); err == nil { filter["timestamp"] = bson.M{"$gte": from} }
+			if from, err := time.Parse(time.RFC3339, fromStr); err == nil { filter.From = from }
 		}
-		cursor, err := telemetryCollection.Find(ctx, filter)
-		if err != nil { http.Error(w, "Failed to query telemetry", http.StatusInternalServerError); return }
-		defer cursor.Close(ctx)
-		var rows []models.Telemetry
-		if err := cursor.All(ctx, &rows); err != nil { http.Error(w, "Failed to decode telemetry", http.StatusInternalServerError); return }
+		rows, err := telemetryCollection.FindTelemetry(ctx, filter)
+		if err != nil { problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to query telemetry"); return }
 		// group by vehicle
 		type agg struct{ first, last *models.Telemetry }
 		m := map[string]*agg{}
@@ -1469,6 +1513,7 @@ func main() {
 		// cost estimate
 		fuelCostPerPct := 0.02; energyCostPerPct := 0.005 // placeholder unit costs
 		cost := fuelUsed*fuelCostPerPct + energyUsed*energyCostPerPct
+		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"fuel_used_pct": fuelUsed,
 			"energy_used_pct": energyUsed,
@@ -1476,126 +1521,368 @@ func main() {
 			"emissions": emissions,
 		})
 	})
-	authHandler := handlers.NewAuthHandler(authService, userCollection)
-
-	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(authService)
-	// rateLimitMiddleware := middleware.NewRateLimitMiddleware() // Temporarily disabled for development
 
-	// Authentication routes (no auth required)
-	http.HandleFunc("/api/auth/login", func(w http.ResponseWriter, r *http.Request) {
-		corsMiddleware(http.HandlerFunc(authHandler.Login)).ServeHTTP(w, r)
-	})
-	http.HandleFunc("/api/auth/register", func(w http.ResponseWriter, r *http.Request) {
-		corsMiddleware(http.HandlerFunc(authHandler.Register)).ServeHTTP(w, r)
-	})
-
-	// Protected routes (require authentication)
-	// Temporarily disable rate limiting for development
-	http.Handle("/api/telemetry", corsMiddleware(authMiddleware.Authenticate(telemetryHandler)))
-	// SSE endpoint (unauth for now; can wrap with authMiddleware if desired)
+	protected := protect(api, authMiddleware)
+	protected.HandleAll("/telemetry", telemetryHandler)
+	// SSE and WebSocket endpoints stream the caller's tenant only; browsers
+	// pass the token as ?access_token= since they cannot set headers here
 	telemetrySSEHub = NewSSEHub()
-	http.Handle("/api/telemetry/stream", corsMiddleware(telemetrySSEHub))
-	// WebSocket endpoint (auth optional; mirror SSE data)
+	streams := protect(api.With(middleware.TokenFromQuery), authMiddleware)
+	streams.Handle(http.MethodGet, "/telemetry/stream", telemetrySSEHub)
 	wsEnabled := os.Getenv("WEBSOCKETS_ENABLED")
 	if wsEnabled == "" || strings.ToLower(wsEnabled) == "true" {
-		http.Handle("/api/telemetry/ws", corsMiddleware(authMiddleware.Authenticate(http.HandlerFunc(wsTelemetryHandler))))
-	}
-	http.Handle("/api/vehicles", corsMiddleware(authMiddleware.Authenticate(http.HandlerFunc(vehicleRouter))))
-	http.Handle("/api/vehicles/", corsMiddleware(authMiddleware.Authenticate(http.HandlerFunc(vehicleRouter))))
-	http.Handle("/api/trips", corsMiddleware(authMiddleware.Authenticate(tripHandler)))
-    // Add item-level routes for tenant-scoped deletes/updates
-    http.Handle("/api/trips/", corsMiddleware(authMiddleware.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        id := strings.TrimPrefix(r.URL.Path, "/api/trips/")
-        if len(id) != 24 { http.Error(w, "Invalid trip ID", http.StatusBadRequest); return }
-        switch r.Method {
-        case http.MethodDelete:
-            ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-            defer cancel()
-            // Load trip and verify tenant
-            trip, err := tripCollection.FindTripByID(ctx, id)
-            if err != nil { http.Error(w, "Trip not found", http.StatusNotFound); return }
-            if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
-                if trip.TenantID != "" && trip.TenantID != claims.TenantID {
-                    http.Error(w, "Forbidden", http.StatusForbidden)
-                    return
-                }
-            }
-            if err := tripCollection.DeleteTrip(ctx, id); err != nil { http.Error(w, "Failed to delete trip", http.StatusInternalServerError); return }
-            w.Header().Set("Content-Type", "application/json"); w.WriteHeader(http.StatusOK)
-            json.NewEncoder(w).Encode(map[string]string{"id": id, "message": "Trip deleted"})
-        default:
-            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-        }
-    }))))
-    http.Handle("/api/maintenance", corsMiddleware(authMiddleware.Authenticate(maintenanceHandler)))
-    http.Handle("/api/maintenance/", corsMiddleware(authMiddleware.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        id := strings.TrimPrefix(r.URL.Path, "/api/maintenance/")
-        if len(id) != 24 { http.Error(w, "Invalid maintenance ID", http.StatusBadRequest); return }
-        switch r.Method {
-        case http.MethodDelete:
-            ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-            defer cancel()
-            rec, err := maintenanceCollection.FindMaintenanceByID(ctx, id)
-            if err != nil { http.Error(w, "Maintenance not found", http.StatusNotFound); return }
-            if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
-                if rec.TenantID != "" && rec.TenantID != claims.TenantID {
-                    http.Error(w, "Forbidden", http.StatusForbidden)
-                    return
-                }
-            }
-            if err := maintenanceCollection.DeleteMaintenance(ctx, id); err != nil { http.Error(w, "Failed to delete maintenance", http.StatusInternalServerError); return }
-            w.Header().Set("Content-Type", "application/json"); w.WriteHeader(http.StatusOK)
-            json.NewEncoder(w).Encode(map[string]string{"id": id, "message": "Maintenance deleted"})
-        default:
-            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-        }
-    }))))
-    http.Handle("/api/costs", corsMiddleware(authMiddleware.Authenticate(costHandler)))
-    http.Handle("/api/costs/", corsMiddleware(authMiddleware.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        id := strings.TrimPrefix(r.URL.Path, "/api/costs/")
-        if len(id) != 24 { http.Error(w, "Invalid cost ID", http.StatusBadRequest); return }
-        switch r.Method {
-        case http.MethodDelete:
-            ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-            defer cancel()
-            rec, err := costCollection.FindCostByID(ctx, id)
-            if err != nil { http.Error(w, "Cost record not found", http.StatusNotFound); return }
-            if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
-                if rec.TenantID != "" && rec.TenantID != claims.TenantID {
-                    http.Error(w, "Forbidden", http.StatusForbidden)
-                    return
-                }
-            }
-            if err := costCollection.DeleteCost(ctx, id); err != nil { http.Error(w, "Failed to delete cost record", http.StatusInternalServerError); return }
-            w.Header().Set("Content-Type", "application/json"); w.WriteHeader(http.StatusOK)
-            json.NewEncoder(w).Encode(map[string]string{"id": id, "message": "Cost deleted"})
-        default:
-            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-        }
-    }))))
-	http.Handle("/api/telemetry/metrics", corsMiddleware(authMiddleware.Authenticate(telemetryMetricsHandler)))
-	http.Handle("/api/telemetry/metrics/advanced", corsMiddleware(authMiddleware.Authenticate(advancedMetricsHandler)))
-	http.Handle("/api/alerts", corsMiddleware(authMiddleware.Authenticate(alertsHandler)))
+		streams.Handle(http.MethodGet, "/telemetry/ws", http.HandlerFunc(wsTelemetryHandler))
+	}
+	protected.HandleAll("/vehicles", vehicleCollectionHandler)
+	protected.HandleAll("/vehicles/{id}", vehicleItemHandler(vehicleCollection))
+	protected.HandleAll("/trips", tripHandler)
+	protected.HandleAll("/trips/{id}", tripItemHandler(tripCollection))
+	protected.HandleAll("/maintenance", maintenanceHandler)
+	protected.HandleAll("/maintenance/{id}", maintenanceItemHandler(maintenanceCollection))
+	protected.HandleAll("/costs", costHandler)
+	protected.HandleAll("/costs/{id}", costItemHandler(costCollection))
+	protected.HandleAll("/telemetry/metrics", telemetryMetricsHandler)
+	protected.HandleAll("/telemetry/metrics/advanced", advancedMetricsHandler)
+	protected.HandleAll("/alerts", alertsHandler)
+}
+
+// registerAccountRoutes registers authentication, account and
+// administration endpoints on api. oidcHandler is nil when single sign-on is
+// not configured.
+func registerAccountRoutes(api *router.Router, authMiddleware *middleware.AuthMiddleware, authHandler *handlers.AuthHandler, oidcHandler *handlers.OIDCHandler, userHandler *handlers.UserHandler, apiKeyHandler *handlers.APIKeyHandler, auditHandler *handlers.AuditHandler, tenantHandler *handlers.TenantHandler) {
+	// Public authentication routes
+	public := api.With(rateLimited)
+	public.HandleFunc(http.MethodPost, "/auth/login", authHandler.Login)
+	public.HandleFunc(http.MethodPost, "/auth/register", authHandler.Register)
+	public.HandleFunc(http.MethodPost, "/auth/refresh", authHandler.Refresh)
+	public.HandleFunc(http.MethodPost, "/auth/verify-email", authHandler.VerifyEmail)
+	public.HandleFunc(http.MethodPost, "/auth/forgot-password", authHandler.ForgotPassword)
+	public.HandleFunc(http.MethodPost, "/auth/reset-password", authHandler.ResetPassword)
+	public.HandleFunc(http.MethodPost, "/auth/mfa/verify", authHandler.MFAVerify)
+	if oidcHandler != nil {
+		public.HandleFunc(http.MethodGet, "/auth/oidc/login", oidcHandler.Login)
+		public.HandleFunc(http.MethodPost, "/auth/oidc/callback", oidcHandler.Callback)
+	}
+	// Enrollment accepts an access token or the enrollment challenge of a login that requires MFA
+	enrollment := api.With(authMiddleware.AuthenticateOptional)
+	enrollment.HandleFunc(http.MethodPost, "/auth/mfa/enroll", authHandler.MFAEnroll)
+	enrollment.HandleFunc(http.MethodPost, "/auth/mfa/activate", authHandler.MFAActivate)
+
+	// User profile routes (require authentication)
+	account := api.With(authMiddleware.Authenticate, rateLimited, audited, authMiddleware.RequireUser)
+	account.HandleFunc(http.MethodGet, "/auth/profile", authHandler.GetProfile)
+	account.HandleFunc(http.MethodPut, "/auth/profile", authHandler.UpdateProfile)
+	account.HandleFunc(http.MethodPost, "/auth/change-password", authHandler.ChangePassword)
+	account.HandleFunc(http.MethodPost, "/auth/logout", authHandler.Logout)
+	account.HandleFunc(http.MethodPost, "/auth/logout-all", authHandler.LogoutAll)
+	account.HandleFunc(http.MethodPost, "/auth/mfa/disable", authHandler.MFADisable)
+	account.HandleFunc(http.MethodPost, "/auth/mfa/recovery-codes", authHandler.MFARecoveryCodes)
+	api.With(authMiddleware.Authenticate, rateLimited, audited, authMiddleware.RequireRole(models.RoleAdmin)).
+		HandleFunc(http.MethodPost, "/auth/invite", authHandler.Invite)
+
+	protected := protect(api, authMiddleware)
+	protected.HandleAll("/auth/mfa/policy", http.HandlerFunc(authHandler.MFAPolicy))
+	// Tenant user administration (admins and managers)
+	userHandler.Routes(api.With(authMiddleware.Authenticate, rateLimited, audited, authMiddleware.RequireRole(models.RoleManager)))
+	// Tenant API keys for devices and integrations
+	apiKeyHandler.Routes(protected)
+	// Tenant audit trail (admins)
+	auditHandler.Routes(protected)
+	// Platform tenant administration (super-admins)
+	tenantHandler.Routes(protected)
+}
+
+// storage is the set of stores the server runs on
+type storage struct {
+	telemetry     db.TelemetryCollection
+	vehicles      db.VehicleCollection
+	trips         db.TripCollection
+	maintenance   db.MaintenanceCollection
+	costs         db.CostCollection
+	users         db.UserCollection
+	refreshTokens db.RefreshTokenCollection
+	revocations   db.RevocationStore
+	auditLog      db.AuditLog
+	apiKeys       db.APIKeyStore
+	mfaPolicies   db.MFAPolicyStore
+	tenants       db.TenantStore
+	rateLimits    db.RateLimitStore
+	checks        []handlers.HealthCheck // readiness of the database
+}
+
+// openStorage opens the storage named by STORAGE: mongo, the default, or
+// memory, which needs no database and loses everything on restart
+func openStorage() (*storage, error) {
+	switch kind := os.Getenv("STORAGE"); kind {
+	case "", "mongo":
+		return openMongoStorage()
+	case "memory":
+		log.Warn("Using in-memory storage, data is lost on restart")
+		return memoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE %q, expected mongo or memory", kind)
+	}
+}
+
+// memoryStorage returns empty in-memory stores
+func memoryStorage() *storage {
+	return &storage{
+		telemetry:     db.NewMemoryCollection(),
+		vehicles:      db.NewMemoryCollection(),
+		trips:         db.NewMemoryCollection(),
+		maintenance:   db.NewMemoryCollection(),
+		costs:         db.NewMemoryCollection(),
+		users:         db.NewMemoryUserCollection(),
+		refreshTokens: db.NewMemoryRefreshTokenCollection(),
+		revocations:   db.NewMemoryRevocationStore(),
+		auditLog:      db.NewMemoryAuditLog(),
+		apiKeys:       db.NewMemoryAPIKeyStore(),
+		mfaPolicies:   db.NewMemoryMFAPolicyStore(),
+		tenants:       db.NewMemoryTenantStore(),
+		rateLimits:    db.NewMemoryRateLimitStore(),
+	}
+}
+
+// openMongoStorage connects to MongoDB, ensures the indexes of its
+// collections and gives tenants that predate tenant records one
+func openMongoStorage() (*storage, error) {
+	client, err := db.ConnectMongo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	log.Info("Connected to MongoDB successfully!")
+	mongoDBName := os.Getenv("MONGO_DB")
+	if mongoDBName == "" {
+		mongoDBName = "fleet"
+	}
+	database := client.Database(mongoDBName)
+	telemetryCollection := &db.MongoCollection{Collection: database.Collection("telemetry")}
+	vehicleCollection := &db.MongoCollection{Collection: database.Collection("vehicles")}
+	tripCollection := &db.MongoCollection{Collection: database.Collection("trips")}
+	maintenanceCollection := &db.MongoCollection{Collection: database.Collection("maintenance")}
+	costCollection := &db.MongoCollection{Collection: database.Collection("costs")}
+	userCollection := &db.MongoUserCollection{Collection: database.Collection("users")}
+	if err := userCollection.EnsureIndexes(context.Background()); err != nil {
+		log.WithError(err).Warn("Failed to ensure user indexes")
+	}
+	refreshTokenCollection := &db.MongoRefreshTokenCollection{Collection: database.Collection("refresh_tokens")}
+	if err := refreshTokenCollection.EnsureIndexes(context.Background()); err != nil {
+		log.WithError(err).Warn("Failed to ensure refresh token indexes")
+	}
+	revocationStore := &db.MongoRevocationStore{Collection: database.Collection("revoked_tokens")}
+	if err := revocationStore.EnsureIndexes(context.Background()); err != nil {
+		log.WithError(err).Warn("Failed to ensure token revocation indexes")
+	}
+	auditLog := &db.MongoAuditLog{Collection: database.Collection("audit_log")}
+	if err := auditLog.EnsureIndexes(context.Background()); err != nil {
+		log.WithError(err).Warn("Failed to ensure audit log indexes")
+	}
+	apiKeyStore := &db.MongoAPIKeyStore{Collection: database.Collection("api_keys")}
+	if err := apiKeyStore.EnsureIndexes(context.Background()); err != nil {
+		log.WithError(err).Warn("Failed to ensure API key indexes")
+	}
+	tenantStore := db.NewCachedTenantStore(&db.MongoTenantStore{Collection: database.Collection("tenants")}, tenantCacheTTL)
+	// Tenants used to exist only as tenant_id values; give each of them a record
+	var tenantIDs []string
+	for _, coll := range []*mongo.Collection{userCollection.Collection, vehicleCollection.Collection} {
+		values, err := coll.Distinct(context.Background(), "tenant_id", bson.M{})
+		if err != nil {
+			log.WithError(err).Warn("Failed to list existing tenant IDs")
+			continue
+		}
+		for _, value := range values {
+			if id, ok := value.(string); ok {
+				tenantIDs = append(tenantIDs, id)
+			}
+		}
+	}
+	if created, err := db.EnsureTenants(context.Background(), tenantStore, tenantIDs); err != nil {
+		log.WithError(err).Warn("Failed to create records for existing tenants")
+	} else if created > 0 {
+		log.WithField("count", created).Info("Created records for existing tenants")
+	}
+
+	// Secondary indexes per collection on tenant_id for scoping
+	for _, coll := range []*db.MongoCollection{telemetryCollection, vehicleCollection, tripCollection, maintenanceCollection, costCollection} {
+		_, _ = coll.Collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+			Keys: bson.D{{Key: "tenant_id", Value: 1}},
+		})
+	}
+	// TTL index on telemetry to prevent unbounded growth
+	ttlDays := 30
+	if v := os.Getenv("TELEMETRY_TTL_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			ttlDays = n
+		}
+	}
+	idxModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "timestamp", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(ttlDays * 24 * 60 * 60)).SetName("ttl_timestamp_seconds"),
+	}
+	if _, err := telemetryCollection.Collection.Indexes().CreateOne(context.Background(), idxModel); err != nil {
+		log.WithError(err).Warn("Failed to ensure TTL index on telemetry")
+	} else {
+		log.WithFields(log.Fields{"days": ttlDays}).Info("TTL index ensured on telemetry.timestamp")
+	}
+
+	var rateLimits db.RateLimitStore = db.NewMemoryRateLimitStore()
+	if os.Getenv("RATE_LIMIT_STORE") == "mongo" {
+		mongoStore := &db.MongoRateLimitStore{Collection: database.Collection("rate_limits")}
+		if err := mongoStore.EnsureIndexes(context.Background()); err != nil {
+			log.WithError(err).Warn("Failed to ensure rate limit indexes")
+		}
+		rateLimits = mongoStore
+	}
+
+	return &storage{
+		telemetry:     telemetryCollection,
+		vehicles:      vehicleCollection,
+		trips:         tripCollection,
+		maintenance:   maintenanceCollection,
+		costs:         costCollection,
+		users:         userCollection,
+		refreshTokens: refreshTokenCollection,
+		revocations:   revocationStore,
+		auditLog:      auditLog,
+		apiKeys:       apiKeyStore,
+		mfaPolicies:   &db.MongoMFAPolicyStore{Collection: database.Collection("mfa_policies")},
+		tenants:       tenantStore,
+		rateLimits:    rateLimits,
+		checks:        []handlers.HealthCheck{{Name: "mongo", Check: func(ctx context.Context) error { return client.Ping(ctx, nil) }}},
+	}, nil
+}
+
+// main is the entry point for the Fleet Sustainability backend service.
+func main() {
+	// Load .env file for local development
+	if err := godotenv.Load(); err != nil {
+		log.WithError(err).Warn("No .env file found (this is fine in production)")
+	}
+	// Tracing is set up first so that startup queries are traced too
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		log.WithError(err).Fatal("Invalid tracing configuration")
+	}
+	// Storage is MongoDB unless STORAGE=memory
+	stores, err := openStorage()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to open storage")
+	}
+
+	// Initialize authentication services
+	authService, err := auth.NewService()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize auth service")
+	}
+	go rotateSigningKeys(authService)
+
+	mailer, err := mail.NewSenderFromEnv()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize mail sender")
+	}
+	loginThrottle := auth.NewLoginThrottle(auth.LoginPolicyFromEnv())
+	authHandler := handlers.NewAuthHandler(authService, stores.users, stores.refreshTokens, stores.revocations, mailer, loginThrottle, stores.auditLog, stores.mfaPolicies, stores.tenants)
+	userHandler := handlers.NewUserHandler(authService, stores.users, stores.refreshTokens, stores.revocations, loginThrottle, stores.auditLog)
+
+	// Initialize middleware
+	authMiddleware := middleware.NewAuthMiddleware(authService, stores.revocations, stores.apiKeys, stores.tenants)
+	requestAudit = middleware.NewAuditMiddleware(stores.auditLog)
+	// Forwarding headers are only believed from these reverse proxies
+	trustedProxies, err := middleware.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.WithError(err).Fatal("Invalid TRUSTED_PROXIES")
+	}
+	middleware.SetTrustedProxies(trustedProxies)
+	corsConfig, err := middleware.CORSPolicyFromEnv(middleware.DefaultCORSPolicy)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid CORS configuration")
+	}
+	if corsPolicy, err = middleware.NewCORS(corsConfig, stores.tenants, tenantCacheTTL); err != nil {
+		log.WithError(err).Fatal("Invalid CORS configuration")
+	}
+	log.WithField("origins", corsConfig.AllowedOrigins).Info("CORS allowed origins")
+	if strings.ToLower(os.Getenv("RATE_LIMIT_ENABLED")) != "false" {
+		rateLimiter = middleware.NewRateLimiter(stores.rateLimits, middleware.RateLimitPoliciesFromEnv(defaultRateLimits), rateLimitGroup)
+	}
+
+	// Single sign-on, only when an identity provider is configured
+	oidcConfig, err := auth.OIDCConfigFromEnv()
+	if err != nil {
+		log.WithError(err).Fatal("Invalid single sign-on configuration")
+	}
+	var oidcHandler *handlers.OIDCHandler
+	if oidcConfig != nil {
+		oidcHandler = handlers.NewOIDCHandler(authHandler, auth.NewOIDCProvider(*oidcConfig, nil))
+		log.WithField("issuer", oidcConfig.Issuer).Info("Single sign-on enabled")
+	}
+	apiKeyHandler := handlers.NewAPIKeyHandler(authService, stores.apiKeys, stores.auditLog)
+	auditHandler := handlers.NewAuditHandler(stores.auditLog)
+	tenantHandler := handlers.NewTenantHandler(stores.tenants, stores.auditLog)
+
+	// List cursors are signed; replicas share the key to accept each other's
+	if secret := os.Getenv("CURSOR_SECRET"); secret != "" {
+		query.SetCursorKey([]byte(secret))
+	}
+
+	// The versioned API. Requests to the unversioned /api of earlier
+	// releases are still served, marked deprecated.
+	api := newAPI()
+	registerAccountRoutes(api, authMiddleware, authHandler, oidcHandler, userHandler, apiKeyHandler, auditHandler, tenantHandler)
+	registerDataRoutes(api, authMiddleware, stores.telemetry, stores.vehicles, stores.trips, stores.maintenance, stores.costs, stores.tenants)
+	http.Handle(apiPrefix+"/", api)
+	http.Handle("/api/", api.Alias("/api"))
+	http.Handle("/.well-known/jwks.json", corsMiddleware(http.HandlerFunc(authHandler.JWKS)))
 
 	// --- MQTT Subscriber (optional) ---
+	var mqttClient mqtt.Client
 	mqttURL := os.Getenv("MQTT_BROKER_URL")
 	mqttTopic := os.Getenv("MQTT_TELEMETRY_TOPIC")
-	if mqttTopic == "" { mqttTopic = "fleet/telemetry" }
-	if mqttURL != "" {
+	if mqttTopic == "" { mqttTopic = "tenants/+/telemetry" }
+	if mqttURL != "" && !strings.Contains("/"+mqttTopic+"/", "/+/") {
+		log.WithField("topic", mqttTopic).Error("MQTT_TELEMETRY_TOPIC needs a + level for the tenant, e.g. tenants/+/telemetry; not subscribing")
+	} else if mqttURL != "" {
 		opts := mqtt.NewClientOptions().AddBroker(mqttURL)
 		if u := os.Getenv("MQTT_USERNAME"); u != "" { opts.SetUsername(u) }
 		if p := os.Getenv("MQTT_PASSWORD"); p != "" { opts.SetPassword(p) }
 		opts.SetClientID("fleet-backend-" + strconv.FormatInt(time.Now().UnixNano(), 10))
 		opts.SetAutoReconnect(true)
 		opts.SetConnectionLostHandler(func(c mqtt.Client, err error) { log.WithError(err).Warn("MQTT connection lost") })
-		client := mqtt.NewClient(opts)
-		if token := client.Connect(); token.Wait() && token.Error() != nil {
+		mqttClient = mqtt.NewClient(opts)
+		if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
 			log.WithError(token.Error()).Error("MQTT connect failed")
 		} else {
 			log.WithField("broker", mqttURL).Info("MQTT connected")
-			// Subscribe to telemetry topic; payload should mirror POST /api/telemetry body
+			// Subscribe to every tenant's telemetry topic; payload should mirror POST /api/v1/telemetry body
 			cb := func(_ mqtt.Client, msg mqtt.Message) {
+				// Each message gets its own correlation ID and span, like an HTTP request
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				ctx = tracing.ExtractProperties(ctx, mqttTraceContext(msg.Payload()))
+				ctx, span := tracing.Start(ctx, "process "+mqttTopic, trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(
+					attribute.String("messaging.system", "mqtt"),
+					attribute.String("messaging.destination.name", msg.Topic()),
+				))
+				outcome := "invalid"
+				defer func() {
+					metrics.TelemetryIngested.WithLabelValues("mqtt", outcome).Inc()
+					span.SetAttributes(attribute.String("telemetry.outcome", outcome))
+					if outcome == "error" {
+						span.SetStatus(codes.Error, "failed to store telemetry")
+					}
+					span.End()
+				}()
+				fields := log.Fields{"request_id": logging.NewRequestID(), "source": "mqtt", "topic": msg.Topic()}
+				if sc := span.SpanContext(); sc.IsValid() {
+					fields["trace_id"] = sc.TraceID().String()
+				}
+				ctx = logging.WithLogger(ctx, log.WithFields(fields))
+				logger := logging.FromContext(ctx)
+				tenantID := mqttTopicTenant(mqttTopic, msg.Topic())
+				if tenantID == "" {
+					outcome = "rejected"
+					logger.WithField("reason", "no tenant in topic").Warn("Dropped MQTT telemetry")
+					return
+				}
 				var teleIn struct {
 					VehicleID    string          `json:"vehicle_id"`
 					Timestamp    string          `json:"timestamp"`
@@ -1608,13 +1895,25 @@ func main() {
 					Status       string          `json:"status"`
 					TenantID     string          `json:"tenant_id,omitempty"`
 				}
-				if err := json.Unmarshal(msg.Payload(), &teleIn); err != nil {
-					log.WithError(err).Warn("Invalid MQTT telemetry JSON")
+				_, decodeSpan := tracing.Start(ctx, "telemetry.decode")
+				err := json.Unmarshal(msg.Payload(), &teleIn)
+				tracing.End(decodeSpan, &err)
+				if err != nil {
+					logger.WithError(err).Warn("Invalid MQTT telemetry JSON")
+					return
+				}
+				// The payload may repeat the tenant but never pick another one
+				if teleIn.TenantID != "" && teleIn.TenantID != tenantID {
+					outcome = "rejected"
+					logger.WithFields(log.Fields{"tenant_id": tenantID, "reason": "payload tenant_id does not match topic"}).Warn("Dropped MQTT telemetry")
 					return
 				}
 				// Normalize and store
 				timestamp, err := time.Parse(time.RFC3339, teleIn.Timestamp)
-				if err != nil { return }
+				if err != nil {
+					logger.WithError(err).Warn("Invalid MQTT telemetry timestamp")
+					return
+				}
 				var vehicleObjectID primitive.ObjectID
 				if len(teleIn.VehicleID) == 24 {
 					if oid, err := primitive.ObjectIDFromHex(teleIn.VehicleID); err == nil { vehicleObjectID = oid } else { vehicleObjectID = primitive.NewObjectID() }
@@ -1634,16 +1933,22 @@ func main() {
 					Emissions:    emissions,
 					Type:         teleIn.Type,
 					Status:       teleIn.Status,
-					TenantID:     teleIn.TenantID,
+					TenantID:     tenantID,
 				}
-				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-				defer cancel()
-				if err := telemetryCollection.InsertTelemetry(ctx, tele); err != nil {
-					log.WithError(err).Error("Failed to store MQTT telemetry")
+				if status, message := middleware.CheckTenant(ctx, stores.tenants, tele.TenantID); status != http.StatusOK {
+					outcome = "rejected"
+					logger.WithFields(log.Fields{"tenant_id": tele.TenantID, "reason": message}).Warn("Dropped MQTT telemetry")
 					return
 				}
-				// Broadcast via SSE (tenant-aware if provided)
-				eventPayload := map[string]interface{}{
+				if err := stores.telemetry.InsertTelemetry(ctx, tele); err != nil {
+					outcome = "error"
+					logger.WithError(err).Error("Failed to store MQTT telemetry")
+					return
+				}
+				outcome = "stored"
+				logger.WithFields(log.Fields{"tenant_id": tele.TenantID, "vehicle_id": teleIn.VehicleID}).Debug("Stored MQTT telemetry")
+				// Broadcast via SSE to subscribers of the telemetry's tenant
+				broadcastTelemetry(ctx, tele.TenantID, map[string]interface{}{
 					"vehicle_id":    teleIn.VehicleID,
 					"timestamp":     teleIn.Timestamp,
 					"location":      teleIn.Location,
@@ -1653,18 +1958,9 @@ func main() {
 					"emissions":     teleIn.Emissions,
 					"type":          teleIn.Type,
 					"status":        teleIn.Status,
-				}
-                if data, err := json.Marshal(eventPayload); err == nil {
-                    if telemetrySSEHub != nil && tele.TenantID != "" {
-                        // Send to tenant listeners and also to global listeners (unauth SSE clients in dev)
-                        telemetrySSEHub.BroadcastToTenant(tele.TenantID, data)
-                        telemetrySSEHub.Broadcast(data)
-                    } else if telemetrySSEHub != nil {
-                        telemetrySSEHub.Broadcast(data)
-                    }
-                }
+				})
 			}
-			if token := client.Subscribe(mqttTopic, 1, cb); token.Wait() && token.Error() != nil {
+			if token := mqttClient.Subscribe(mqttTopic, 1, cb); token.Wait() && token.Error() != nil {
 				log.WithError(token.Error()).Error("MQTT subscribe failed")
 			} else {
 				log.WithFields(log.Fields{"topic": mqttTopic}).Info("MQTT subscribed")
@@ -1672,13 +1968,22 @@ func main() {
 		}
 	}
 
-	// User profile routes (require authentication)
-	http.HandleFunc("/api/auth/profile", func(w http.ResponseWriter, r *http.Request) {
-		corsMiddleware(authMiddleware.Authenticate(http.HandlerFunc(authHandler.GetProfile))).ServeHTTP(w, r)
-	})
-	http.HandleFunc("/api/auth/change-password", func(w http.ResponseWriter, r *http.Request) {
-		corsMiddleware(authMiddleware.Authenticate(http.HandlerFunc(authHandler.ChangePassword))).ServeHTTP(w, r)
-	})
+	// Probes and Prometheus metrics (no authentication, see shouldSkipAuth)
+	healthChecks := stores.checks
+	if mqttClient != nil {
+		healthChecks = append(healthChecks, handlers.HealthCheck{Name: "mqtt", Check: func(ctx context.Context) error {
+			if !mqttClient.IsConnectionOpen() {
+				return errors.New("not connected")
+			}
+			return nil
+		}})
+	}
+	healthHandler := handlers.NewHealthHandler(healthChecks...)
+	http.HandleFunc("/health/live", healthHandler.Live)
+	http.HandleFunc("/health/ready", healthHandler.Ready)
+	http.Handle("/metrics", promhttp.Handler())
+
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -1691,7 +1996,7 @@ func main() {
 	// Create server with graceful shutdown
 	server := &http.Server{
 		Addr:    ":" + port,
-		Handler: nil, // Use default ServeMux
+		Handler: middleware.Tracing(middleware.RequestLogger(middleware.Metrics(http.DefaultServeMux))),
 	}
 
 	// Channel to listen for interrupt signal
@@ -1727,4 +2032,8 @@ func main() {
 	} else {
 		log.Info("Server exited gracefully")
 	}
+	// Export the spans still buffered
+	if err := shutdownTracing(ctx); err != nil {
+		log.WithError(err).Warn("Failed to flush traces")
+	}
 }
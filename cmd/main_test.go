@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -10,17 +11,35 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sirupsen/logrus"
+	apispec "github.com/ukydev/fleet-sustainability/api"
+	"github.com/ukydev/fleet-sustainability/internal/auth"
 	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/handlers"
+	"github.com/ukydev/fleet-sustainability/internal/metrics"
+	"github.com/ukydev/fleet-sustainability/internal/middleware"
 	"github.com/ukydev/fleet-sustainability/internal/models"
+	"github.com/ukydev/fleet-sustainability/internal/problem"
+	"github.com/ukydev/fleet-sustainability/internal/query"
+	"github.com/ukydev/fleet-sustainability/internal/router"
+	"github.com/ukydev/fleet-sustainability/internal/tracing"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 type mockTelemetryCollection struct {
@@ -34,60 +53,24 @@ func (m *mockTelemetryCollection) InsertOne(ctx context.Context, doc interface{}
 	return nil, m.insertErr
 }
 
-// Mock cursor for testing
-type mockCursor struct {
-	results []models.Telemetry
-	allErr  error
-}
-
-func (m *mockCursor) All(ctx context.Context, out interface{}) error {
-	if m.allErr != nil {
-		return m.allErr
-	}
-	ptr, ok := out.(*[]models.Telemetry)
-	if !ok {
-		return errors.New("wrong type for out")
-	}
-	*ptr = m.results
-	return nil
-}
-func (m *mockCursor) Close(ctx context.Context) error { return nil }
-
-// Update mockTelemetryCollection.Find to return (db.TelemetryCursor, error) to match the interface. Return nil as the error in the mock implementation.
-func (m *mockTelemetryCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (db.TelemetryCursor, error) {
+func (m *mockTelemetryCollection) FindTelemetry(ctx context.Context, q db.Query) ([]models.Telemetry, error) {
 	if m.findErr != nil {
 		return nil, m.findErr
 	}
-	// Debug: print the filter
-	fmt.Printf("DEBUG: filter = %#v\n", filter)
-	results := m.results
-	if f, ok := filter.(primitive.M); ok {
-		fmt.Printf("DEBUG: filter keys = %v\n", f)
-		if ts, ok := f["timestamp"].(primitive.M); ok {
-			fmt.Printf("DEBUG: timestamp filter = %v\n", ts)
-			var filtered []models.Telemetry
-			for _, t := range results {
-				inRange := true
-				if gte, ok := ts["$gte"].(time.Time); ok {
-					fmt.Printf("DEBUG: $gte = %v\n", gte)
-					if t.Timestamp.Before(gte) {
-						inRange = false
-					}
-				}
-				if lte, ok := ts["$lte"].(time.Time); ok {
-					fmt.Printf("DEBUG: $lte = %v\n", lte)
-					if t.Timestamp.After(lte) {
-						inRange = false
-					}
-				}
-				if inRange {
-					filtered = append(filtered, t)
-				}
-			}
-			results = filtered
+	if m.allErr != nil {
+		return nil, m.allErr
+	}
+	var results []models.Telemetry
+	for _, t := range m.results {
+		if !q.From.IsZero() && t.Timestamp.Before(q.From) {
+			continue
 		}
+		if !q.To.IsZero() && t.Timestamp.After(q.To) {
+			continue
+		}
+		results = append(results, t)
 	}
-	return &mockCursor{results: results, allErr: m.allErr}, nil
+	return results, nil
 }
 
 func (m *mockTelemetryCollection) InsertTelemetry(ctx context.Context, telemetry models.Telemetry) error {
@@ -343,7 +326,7 @@ func TestTelemetryHandler_GET_DatabaseError(t *testing.T) {
 }
 
 func TestTelemetryHandler_GET_CursorAllError(t *testing.T) {
-	// Test GET with cursor.All error
+	// Test GET with a failed query
 	handler := &TelemetryHandler{Collection: &mockTelemetryCollection{
 		results: []models.Telemetry{
 			{Timestamp: time.Now()},
@@ -417,7 +400,6 @@ func TestTelemetryHandler_MethodNotAllowed(t *testing.T) {
 		url    string
 	}{
 		{http.MethodPut, "/api/telemetry"},
-		{http.MethodDelete, "/api/telemetry"},
 		{http.MethodPatch, "/api/telemetry"},
 	}
 
@@ -431,6 +413,47 @@ func TestTelemetryHandler_MethodNotAllowed(t *testing.T) {
 			}
 		})
 	}
+
+	// DELETE clears the tenant's telemetry
+	checkRouteMethods(t, "/telemetry", http.MethodDelete, http.MethodGet, http.MethodPost)
+}
+
+// checkRouteMethods checks that the data routes register exactly methods for
+// pattern and refuse PUT and PATCH otherwise, listing the methods in Allow
+func checkRouteMethods(t *testing.T, pattern string, methods ...string) {
+	t.Helper()
+	t.Setenv("APP_ENV", "development")
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("auth service: %v", err)
+	}
+	tenantStore := db.NewMemoryTenantStore()
+	api := newAPI()
+	registerDataRoutes(api, middleware.NewAuthMiddleware(authService, db.NewMemoryRevocationStore(), db.NewMemoryAPIKeyStore(), tenantStore), db.NewMemoryCollection(), db.NewMemoryCollection(), db.NewMemoryCollection(), db.NewMemoryCollection(), db.NewMemoryCollection(), tenantStore)
+
+	var routes []router.Route
+	for _, route := range api.Routes() {
+		if route.Pattern == pattern {
+			routes = append(routes, route)
+		}
+	}
+	var want []router.Route
+	for _, method := range methods {
+		want = append(want, router.Route{Method: method, Pattern: pattern})
+	}
+	if fmt.Sprint(routes) != fmt.Sprint(want) {
+		t.Errorf("routes = %v, want %v", routes, want)
+	}
+	allowed := append([]string{http.MethodHead, http.MethodOptions}, methods...)
+	sort.Strings(allowed)
+	allow := strings.Join(allowed, ", ")
+	for _, method := range []string{http.MethodPut, http.MethodPatch} {
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, httptest.NewRequest(method, apiPrefix+pattern, nil))
+		if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != allow {
+			t.Errorf("%s %s = %d, Allow %q, want 405 and %q", method, pattern, w.Code, w.Header().Get("Allow"), allow)
+		}
+	}
 }
 
 func TestTelemetryMetricsHandler_Basic(t *testing.T) {
@@ -545,7 +568,7 @@ func TestVehiclesHandler_GET(t *testing.T) {
 }
 
 func TestVehiclesHandler_MethodNotAllowed(t *testing.T) {
-	testCases := []string{http.MethodPut, http.MethodDelete, http.MethodPatch}
+	testCases := []string{http.MethodPut, http.MethodPatch}
 
 	for _, method := range testCases {
 		t.Run(method, func(t *testing.T) {
@@ -562,6 +585,9 @@ func TestVehiclesHandler_MethodNotAllowed(t *testing.T) {
 			}
 		})
 	}
+
+	// DELETE clears the tenant's vehicles
+	checkRouteMethods(t, "/vehicles", http.MethodDelete, http.MethodGet, http.MethodPost)
 }
 
 func floatPtr(f float64) *float64 { return &f }
@@ -904,7 +930,7 @@ func TestTelemetryMetricsHandler_DatabaseError(t *testing.T) {
 }
 
 func TestTelemetryMetricsHandler_CursorAllError(t *testing.T) {
-	// Test metrics with cursor.All error
+	// Test metrics with a failed query
 	handler := TelemetryMetricsHandler{Collection: &mockTelemetryCollection{
 		results: []models.Telemetry{
 			{Timestamp: time.Now(), Emissions: 25.0},
@@ -1053,9 +1079,9 @@ func TestVehicleHandler_GetVehicles(t *testing.T) {
 			expectedStatus: http.StatusMethodNotAllowed,
 		},
 		{
-			name:           "DELETE vehicles not allowed",
+			name:           "DELETE vehicles deletes all of the tenant's vehicles",
 			method:         http.MethodDelete,
-			expectedStatus: http.StatusMethodNotAllowed,
+			expectedStatus: http.StatusOK,
 		},
 	}
 
@@ -1197,6 +1223,36 @@ func TestVehicleHandler_PostVehicle(t *testing.T) {
 	}
 }
 
+func TestVehicleHandler_PostVehicle_ProblemDetails(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/vehicles", strings.NewReader(`{"type":"HYBRID","year":1800}`))
+	req.Header.Set("X-Request-ID", "req-42")
+	rr := httptest.NewRecorder()
+	handler := &VehicleCollectionHandler{Collection: &mockVehicleCollection{}}
+	middleware.RequestLogger(handler).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Errorf("expected %s, got %s", problem.ContentType, ct)
+	}
+	var p problem.Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatalf("invalid problem body: %v", err)
+	}
+	if p.Code != problem.CodeValidation || p.Status != http.StatusBadRequest || p.RequestID != "req-42" || p.Instance != "/api/vehicles" {
+		t.Errorf("unexpected problem: %+v", p)
+	}
+	// Every violation is reported, not only the first
+	var fields []string
+	for _, fe := range p.Errors {
+		fields = append(fields, fe.Field)
+	}
+	if got := strings.Join(fields, ","); got != "type,status,make,model,year" {
+		t.Errorf("expected all invalid fields, got %s", got)
+	}
+}
+
 func TestVehicleHandler_PutVehicle(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -1248,14 +1304,11 @@ func TestVehicleHandler_PutVehicle(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
+			req.SetPathValue("id", tt.vehicleID)
 			req.Header.Set("Content-Type", "application/json")
 
 			rr := httptest.NewRecorder()
-			func() {
-				mockCollection := &mockVehicleCollection{results: []models.Vehicle{}}
-				vehicleCollectionHandler = &VehicleCollectionHandler{Collection: mockCollection}
-				vehicleHandler(rr, req)
-			}()
+			vehicleItemHandler(&mockVehicleCollection{}).ServeHTTP(rr, req)
 
 			if status := rr.Code; status != tt.expectedStatus {
 				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
@@ -1293,13 +1346,10 @@ func TestVehicleHandler_DeleteVehicle(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
+			req.SetPathValue("id", tt.vehicleID)
 
 			rr := httptest.NewRecorder()
-			func() {
-				mockCollection := &mockVehicleCollection{results: []models.Vehicle{}}
-				vehicleCollectionHandler = &VehicleCollectionHandler{Collection: mockCollection}
-				vehicleHandler(rr, req)
-			}()
+			vehicleItemHandler(&mockVehicleCollection{}).ServeHTTP(rr, req)
 
 			if status := rr.Code; status != tt.expectedStatus {
 				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
@@ -1308,16 +1358,39 @@ func TestVehicleHandler_DeleteVehicle(t *testing.T) {
 	}
 }
 
+func TestVehicleItemHandler_FindErrors(t *testing.T) {
+	tests := []struct {
+		method     string
+		err        error
+		wantStatus int
+	}{
+		{http.MethodGet, db.ErrNotFound, http.StatusNotFound},
+		{http.MethodPut, db.ErrNotFound, http.StatusNotFound},
+		{http.MethodGet, errors.New("connection reset"), http.StatusInternalServerError},
+		{http.MethodPut, errors.New("connection reset"), http.StatusInternalServerError},
+		{http.MethodDelete, errors.New("connection reset"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/v1/vehicles/507f1f77bcf86cd799439011", strings.NewReader(`{"type":"EV","make":"Tesla","model":"Model 3","year":2023,"status":"active"}`))
+		req.SetPathValue("id", "507f1f77bcf86cd799439011")
+		rr := httptest.NewRecorder()
+		vehicleItemHandler(&mockVehicleCollection{findErr: tt.err}).ServeHTTP(rr, req)
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s with %v = %d, want %d", tt.method, tt.err, rr.Code, tt.wantStatus)
+		}
+	}
+}
+
 type mockVehicleCollection struct {
 	results []models.Vehicle
 	findErr error
 }
 
-func (m *mockVehicleCollection) FindVehicles(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (db.VehicleCursor, error) {
+func (m *mockVehicleCollection) FindVehicles(ctx context.Context, q db.Query) ([]models.Vehicle, error) {
 	if m.findErr != nil {
 		return nil, m.findErr
 	}
-	return &mockVehicleCursor{results: m.results}, nil
+	return m.results, nil
 }
 
 func (m *mockVehicleCollection) InsertVehicle(ctx context.Context, vehicle models.Vehicle) error {
@@ -1343,16 +1416,1073 @@ func (m *mockVehicleCollection) DeleteAll(ctx context.Context) error {
 	return nil
 }
 
-type mockVehicleCursor struct {
-	results []models.Vehicle
+func TestRoutePermissions_Matrix(t *testing.T) {
+	known := make(map[string]bool, len(models.AllPermissions))
+	for _, action := range models.AllPermissions {
+		known[action] = true
+	}
+	for _, actions := range models.PlatformPermissions {
+		for _, action := range actions {
+			known[action] = true
+		}
+	}
+	for route, methods := range routePermissions {
+		if len(methods) == 0 {
+			t.Errorf("route %s has no permitted methods", route)
+		}
+		for method, action := range methods {
+			if !known[action] {
+				t.Errorf("route %s %s requires unknown action %q", method, route, action)
+			}
+			// Only reads are open to viewers
+			viewer := &models.User{Role: models.RoleViewer}
+			if method != http.MethodGet && viewer.HasPermission(action) {
+				t.Errorf("viewer may %s %s", method, route)
+			}
+			// Tenant administration stays with the platform
+			admin := &models.User{Role: models.RoleAdmin}
+			if strings.HasPrefix(route, "/tenants") && admin.HasPermission(action) {
+				t.Errorf("tenant admin may %s %s", method, route)
+			}
+		}
+	}
+}
+
+// scopedRecords is an in-memory collection that applies the tenant scope of
+// the context the same way MongoCollection does; the rest of a query is ignored
+type scopedRecords[T any] struct {
+	mu      sync.Mutex
+	records []T
+	key     func(T) (id, tenantID string)
+}
+
+func (s *scopedRecords[T]) visible(ctx context.Context, record T) bool {
+	scoped, _ := db.ScopeFilter(ctx, nil).(bson.M)
+	tenantID, ok := scoped["tenant_id"]
+	_, recordTenant := s.key(record)
+	return !ok || tenantID == recordTenant
+}
+
+func (s *scopedRecords[T]) find(ctx context.Context) []T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := []T{}
+	for _, record := range s.records {
+		if s.visible(ctx, record) {
+			found = append(found, record)
+		}
+	}
+	return found
 }
 
-func (m *mockVehicleCursor) All(ctx context.Context, out interface{}) error {
-	vehicles := out.(*[]models.Vehicle)
-	*vehicles = m.results
+func (s *scopedRecords[T]) byID(ctx context.Context, id string) (*T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range s.records {
+		if recordID, _ := s.key(record); recordID == id && s.visible(ctx, record) {
+			return &record, nil
+		}
+	}
+	return nil, db.ErrNotFound
+}
+
+func (s *scopedRecords[T]) insert(record T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
 	return nil
 }
 
-func (m *mockVehicleCursor) Close(ctx context.Context) error {
+func (s *scopedRecords[T]) update(ctx context.Context, id string, record T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.records {
+		if existingID, _ := s.key(existing); existingID == id && s.visible(ctx, existing) {
+			s.records[i] = record
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
+
+// remove deletes the record with the given id, or every visible record if id is empty
+func (s *scopedRecords[T]) remove(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.records[:0]
+	for _, record := range s.records {
+		recordID, _ := s.key(record)
+		if (id == "" || recordID == id) && s.visible(ctx, record) {
+			continue
+		}
+		kept = append(kept, record)
+	}
+	s.records = kept
 	return nil
 }
+
+// count returns the number of records of tenantID, ignoring any scope
+func (s *scopedRecords[T]) count(tenantID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, record := range s.records {
+		if _, recordTenant := s.key(record); recordTenant == tenantID {
+			n++
+		}
+	}
+	return n
+}
+
+type scopedTelemetry struct {
+	*scopedRecords[models.Telemetry]
+}
+
+func (s scopedTelemetry) InsertTelemetry(ctx context.Context, telemetry models.Telemetry) error {
+	return s.insert(telemetry)
+}
+func (s scopedTelemetry) FindTelemetry(ctx context.Context, q db.Query) ([]models.Telemetry, error) {
+	return s.find(ctx), nil
+}
+func (s scopedTelemetry) DeleteAll(ctx context.Context) error { return s.remove(ctx, "") }
+
+type scopedVehicles struct{ *scopedRecords[models.Vehicle] }
+
+func (s scopedVehicles) InsertVehicle(ctx context.Context, vehicle models.Vehicle) error {
+	return s.insert(vehicle)
+}
+func (s scopedVehicles) FindVehicles(ctx context.Context, q db.Query) ([]models.Vehicle, error) {
+	return s.find(ctx), nil
+}
+func (s scopedVehicles) FindVehicleByID(ctx context.Context, id string) (*models.Vehicle, error) {
+	return s.byID(ctx, id)
+}
+func (s scopedVehicles) UpdateVehicle(ctx context.Context, id string, vehicle models.Vehicle) error {
+	return s.update(ctx, id, vehicle)
+}
+func (s scopedVehicles) DeleteVehicle(ctx context.Context, id string) error { return s.remove(ctx, id) }
+func (s scopedVehicles) DeleteAll(ctx context.Context) error                { return s.remove(ctx, "") }
+
+type scopedTrips struct{ *scopedRecords[models.Trip] }
+
+func (s scopedTrips) InsertTrip(ctx context.Context, trip models.Trip) error { return s.insert(trip) }
+func (s scopedTrips) FindTrips(ctx context.Context, q db.Query) ([]models.Trip, error) {
+	return s.find(ctx), nil
+}
+func (s scopedTrips) FindTripByID(ctx context.Context, id string) (*models.Trip, error) {
+	return s.byID(ctx, id)
+}
+func (s scopedTrips) UpdateTrip(ctx context.Context, id string, trip models.Trip) error {
+	return s.update(ctx, id, trip)
+}
+func (s scopedTrips) DeleteTrip(ctx context.Context, id string) error { return s.remove(ctx, id) }
+func (s scopedTrips) DeleteAll(ctx context.Context) error             { return s.remove(ctx, "") }
+
+type scopedMaintenance struct {
+	*scopedRecords[models.Maintenance]
+}
+
+func (s scopedMaintenance) InsertMaintenance(ctx context.Context, maintenance models.Maintenance) error {
+	return s.insert(maintenance)
+}
+func (s scopedMaintenance) FindMaintenance(ctx context.Context, q db.Query) ([]models.Maintenance, error) {
+	return s.find(ctx), nil
+}
+func (s scopedMaintenance) FindMaintenanceByID(ctx context.Context, id string) (*models.Maintenance, error) {
+	return s.byID(ctx, id)
+}
+func (s scopedMaintenance) UpdateMaintenance(ctx context.Context, id string, maintenance models.Maintenance) error {
+	return s.update(ctx, id, maintenance)
+}
+func (s scopedMaintenance) DeleteMaintenance(ctx context.Context, id string) error {
+	return s.remove(ctx, id)
+}
+func (s scopedMaintenance) DeleteAll(ctx context.Context) error { return s.remove(ctx, "") }
+
+type scopedCosts struct{ *scopedRecords[models.Cost] }
+
+func (s scopedCosts) InsertCost(ctx context.Context, cost models.Cost) error { return s.insert(cost) }
+func (s scopedCosts) FindCosts(ctx context.Context, q db.Query) ([]models.Cost, error) {
+	return s.find(ctx), nil
+}
+func (s scopedCosts) FindCostByID(ctx context.Context, id string) (*models.Cost, error) {
+	return s.byID(ctx, id)
+}
+func (s scopedCosts) UpdateCost(ctx context.Context, id string, cost models.Cost) error {
+	return s.update(ctx, id, cost)
+}
+func (s scopedCosts) DeleteCost(ctx context.Context, id string) error { return s.remove(ctx, id) }
+func (s scopedCosts) DeleteAll(ctx context.Context) error             { return s.remove(ctx, "") }
+
+func TestDataRoutes_TenantIsolation(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("auth service: %v", err)
+	}
+	tenantStore := db.NewMemoryTenantStore()
+	for _, id := range []string{"tenant-a", "tenant-b"} {
+		tenantStore.InsertTenant(context.Background(), models.NewTenant(id, id))
+	}
+	authMiddleware := middleware.NewAuthMiddleware(authService, db.NewMemoryRevocationStore(), db.NewMemoryAPIKeyStore(), tenantStore)
+
+	// Each tenant has one record of every kind; tenant-a's would raise alerts
+	ids := map[string]string{}
+	telemetry := &scopedRecords[models.Telemetry]{key: func(r models.Telemetry) (string, string) { return r.ID.Hex(), r.TenantID }}
+	vehicles := &scopedRecords[models.Vehicle]{key: func(r models.Vehicle) (string, string) { return r.ID.Hex(), r.TenantID }}
+	trips := &scopedRecords[models.Trip]{key: func(r models.Trip) (string, string) { return r.ID.Hex(), r.TenantID }}
+	maintenance := &scopedRecords[models.Maintenance]{key: func(r models.Maintenance) (string, string) { return r.ID.Hex(), r.TenantID }}
+	costs := &scopedRecords[models.Cost]{key: func(r models.Cost) (string, string) { return r.ID.Hex(), r.TenantID }}
+	fuel, battery := 5.0, 80.0
+	for _, tenantID := range []string{"tenant-a", "tenant-b"} {
+		vehicleID := primitive.NewObjectID()
+		ids[tenantID] = vehicleID.Hex()
+		reading := models.Telemetry{ID: primitive.NewObjectID(), TenantID: tenantID, VehicleID: vehicleID, Timestamp: time.Now(), Type: "EV", BatteryLevel: &battery, Emissions: 1}
+		if tenantID == "tenant-a" {
+			reading.Type, reading.BatteryLevel, reading.FuelLevel, reading.Emissions = "ICE", nil, &fuel, 99
+		}
+		telemetry.insert(reading)
+		vehicles.insert(models.Vehicle{ID: vehicleID, TenantID: tenantID, Type: "EV", Status: "active"})
+		trips.insert(models.Trip{ID: vehicleID, TenantID: tenantID, VehicleID: vehicleID.Hex()})
+		maintenance.insert(models.Maintenance{ID: vehicleID, TenantID: tenantID, VehicleID: vehicleID.Hex()})
+		costs.insert(models.Cost{ID: vehicleID, TenantID: tenantID, VehicleID: vehicleID.Hex()})
+	}
+
+	api := newAPI()
+	registerDataRoutes(api, authMiddleware, scopedTelemetry{telemetry}, scopedVehicles{vehicles}, scopedTrips{trips}, scopedMaintenance{maintenance}, scopedCosts{costs}, tenantStore)
+	token, _ := authService.GenerateToken(&models.User{ID: primitive.NewObjectID(), Username: "intruder", Role: models.RoleAdmin, TenantID: "tenant-b"})
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w
+	}
+	other := ids["tenant-a"]
+
+	for _, path := range []string{"/api/v1/telemetry", "/api/v1/vehicles", "/api/v1/trips", "/api/v1/maintenance", "/api/v1/costs"} {
+		w := serve(http.MethodGet, path, "")
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "tenant-a") || !strings.Contains(w.Body.String(), "tenant-b") {
+			t.Errorf("GET %s = %d %s, want only tenant-b records", path, w.Code, w.Body.String())
+		}
+	}
+
+	var metrics map[string]float64
+	json.NewDecoder(serve(http.MethodGet, "/api/v1/telemetry/metrics", "").Body).Decode(&metrics)
+	if metrics["total_records"] != 1 || metrics["total_emissions"] != 1 || metrics["ev_percent"] != 100 {
+		t.Errorf("metrics include other tenants: %v", metrics)
+	}
+	metrics = nil
+	json.NewDecoder(serve(http.MethodGet, "/api/v1/telemetry/metrics/advanced", "").Body).Decode(&metrics)
+	if metrics["emissions"] != 1 {
+		t.Errorf("advanced metrics include other tenants: %v", metrics)
+	}
+	if body := strings.TrimSpace(serve(http.MethodGet, "/api/v1/alerts", "").Body.String()); body != "[]" {
+		t.Errorf("alerts include other tenants: %s", body)
+	}
+
+	itemRequests := []struct{ method, path, body string }{
+		{http.MethodGet, "/api/v1/vehicles/" + other, ""},
+		{http.MethodPut, "/api/v1/vehicles/" + other, `{"type":"EV","make":"Nissan","model":"Leaf","year":2022,"status":"active"}`},
+		{http.MethodPatch, "/api/v1/vehicles/" + other, `{"status":"inactive"}`},
+		{http.MethodDelete, "/api/v1/vehicles/" + other, ""},
+		{http.MethodGet, "/api/v1/trips/" + other, ""},
+		{http.MethodPut, "/api/v1/trips/" + other, `{"vehicle_id":"v1","start_time":"2024-01-01T00:00:00Z"}`},
+		{http.MethodPatch, "/api/v1/trips/" + other, `{"status":"cancelled"}`},
+		{http.MethodDelete, "/api/v1/trips/" + other, ""},
+		{http.MethodGet, "/api/v1/maintenance/" + other, ""},
+		{http.MethodPatch, "/api/v1/maintenance/" + other, `{"status":"cancelled"}`},
+		{http.MethodDelete, "/api/v1/maintenance/" + other, ""},
+		{http.MethodGet, "/api/v1/costs/" + other, ""},
+		{http.MethodPatch, "/api/v1/costs/" + other, `{"status":"cancelled"}`},
+		{http.MethodDelete, "/api/v1/costs/" + other, ""},
+	}
+	for _, tt := range itemRequests {
+		if w := serve(tt.method, tt.path, tt.body); w.Code != http.StatusNotFound {
+			t.Errorf("%s %s = %d, want 404", tt.method, tt.path, w.Code)
+		}
+	}
+	if v, _ := vehicles.byID(context.Background(), other); v == nil || v.Status != "active" {
+		t.Errorf("other tenant's vehicle was modified: %+v", v)
+	}
+	if trip, _ := trips.byID(context.Background(), other); trip == nil || trip.Status != "" {
+		t.Errorf("other tenant's trip was modified: %+v", trip)
+	}
+
+	// Bulk deletes only remove the caller's records
+	for _, path := range []string{"/api/v1/telemetry", "/api/v1/vehicles", "/api/v1/trips", "/api/v1/maintenance", "/api/v1/costs"} {
+		if w := serve(http.MethodDelete, path, ""); w.Code != http.StatusOK {
+			t.Errorf("DELETE %s = %d", path, w.Code)
+		}
+	}
+	counts := map[string][2]int{
+		"telemetry":   {telemetry.count("tenant-a"), telemetry.count("tenant-b")},
+		"vehicles":    {vehicles.count("tenant-a"), vehicles.count("tenant-b")},
+		"trips":       {trips.count("tenant-a"), trips.count("tenant-b")},
+		"maintenance": {maintenance.count("tenant-a"), maintenance.count("tenant-b")},
+		"costs":       {costs.count("tenant-a"), costs.count("tenant-b")},
+	}
+	for kind, n := range counts {
+		if n != [2]int{1, 0} {
+			t.Errorf("%s after bulk delete: tenant-a %d, tenant-b %d; want 1, 0", kind, n[0], n[1])
+		}
+	}
+
+	// Records created by the caller belong to the caller's tenant
+	w := serve(http.MethodPost, "/api/v1/vehicles", `{"type":"EV","make":"Nissan","model":"Leaf","year":2022,"status":"active"}`)
+	if w.Code != http.StatusCreated || vehicles.count("tenant-b") != 1 {
+		t.Errorf("POST /api/vehicles = %d, tenant-b vehicles %d", w.Code, vehicles.count("tenant-b"))
+	}
+}
+
+func TestDataItemRoutes(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("auth service: %v", err)
+	}
+	tenantStore := db.NewMemoryTenantStore()
+	tenantStore.InsertTenant(context.Background(), models.NewTenant("tenant-a", "tenant-a"))
+	authMiddleware := middleware.NewAuthMiddleware(authService, db.NewMemoryRevocationStore(), db.NewMemoryAPIKeyStore(), tenantStore)
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tripID, costID := primitive.NewObjectID(), primitive.NewObjectID()
+	trips := &scopedRecords[models.Trip]{key: func(r models.Trip) (string, string) { return r.ID.Hex(), r.TenantID }}
+	trips.insert(models.Trip{ID: tripID, TenantID: "tenant-a", VehicleID: "v1", DriverID: "d1", StartTime: created, Status: "planned", Notes: "first leg", CreatedAt: created})
+	costs := &scopedRecords[models.Cost]{key: func(r models.Cost) (string, string) { return r.ID.Hex(), r.TenantID }}
+	costs.insert(models.Cost{ID: costID, TenantID: "tenant-a", VehicleID: "v1", Category: "fuel", Amount: 50, Vendor: "Shell", Status: "paid", CreatedAt: created})
+	maintenance := &scopedRecords[models.Maintenance]{key: func(r models.Maintenance) (string, string) { return r.ID.Hex(), r.TenantID }}
+	telemetry := &scopedRecords[models.Telemetry]{key: func(r models.Telemetry) (string, string) { return r.ID.Hex(), r.TenantID }}
+	vehicles := &scopedRecords[models.Vehicle]{key: func(r models.Vehicle) (string, string) { return r.ID.Hex(), r.TenantID }}
+
+	api := newAPI()
+	registerDataRoutes(api, authMiddleware, scopedTelemetry{telemetry}, scopedVehicles{vehicles}, scopedTrips{trips}, scopedMaintenance{maintenance}, scopedCosts{costs}, tenantStore)
+	serve := func(role models.Role, method, path, body string) *httptest.ResponseRecorder {
+		token, _ := authService.GenerateToken(&models.User{ID: primitive.NewObjectID(), Username: string(role), Role: role, TenantID: "tenant-a"})
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w
+	}
+	tripPath, costPath := "/api/v1/trips/"+tripID.Hex(), "/api/v1/costs/"+costID.Hex()
+
+	var trip models.Trip
+	w := serve(models.RoleViewer, http.MethodGet, tripPath, "")
+	json.NewDecoder(w.Body).Decode(&trip)
+	if w.Code != http.StatusOK || trip.ID != tripID || trip.Notes != "first leg" {
+		t.Errorf("GET %s = %d %+v", tripPath, w.Code, trip)
+	}
+
+	// PATCH changes and clears only the fields it names
+	w = serve(models.RoleOperator, http.MethodPatch, tripPath, `{"status":"in_progress","notes":null,"tenant_id":"tenant-b"}`)
+	stored, _ := trips.byID(context.Background(), tripID.Hex())
+	if w.Code != http.StatusOK || stored == nil {
+		t.Fatalf("PATCH %s = %d %s", tripPath, w.Code, w.Body.String())
+	}
+	if stored.Status != "in_progress" || stored.Notes != "" || stored.DriverID != "d1" || stored.TenantID != "tenant-a" || !stored.CreatedAt.Equal(created) {
+		t.Errorf("patched trip = %+v", stored)
+	}
+
+	// PUT replaces the record, so omitted fields are cleared and defaults applied
+	w = serve(models.RoleOperator, http.MethodPut, tripPath, `{"vehicle_id":"v2","start_time":"2024-02-01T00:00:00Z"}`)
+	stored, _ = trips.byID(context.Background(), tripID.Hex())
+	if w.Code != http.StatusOK || stored.VehicleID != "v2" || stored.DriverID != "" || stored.Status != "planned" || stored.ID != tripID {
+		t.Errorf("PUT %s = %d, stored %+v", tripPath, w.Code, stored)
+	}
+
+	invalid := []struct{ method, path, body, want string }{
+		{http.MethodPut, tripPath, `{"vehicle_id":"v2"}`, "start_time is required"},
+		{http.MethodPatch, tripPath, `{"vehicle_id":null}`, "vehicle_id is required"},
+		{http.MethodPatch, costPath, `{"amount":0}`, "amount must be positive"},
+		{http.MethodPatch, costPath, `[]`, "Invalid JSON"},
+	}
+	for _, tt := range invalid {
+		if w := serve(models.RoleManager, tt.method, tt.path, tt.body); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("%s %s %s = %d %q, want 400 %q", tt.method, tt.path, tt.body, w.Code, w.Body.String(), tt.want)
+		}
+	}
+	if cost, _ := costs.byID(context.Background(), costID.Hex()); cost.Amount != 50 || cost.Vendor != "Shell" {
+		t.Errorf("invalid update was stored: %+v", cost)
+	}
+
+	if w := serve(models.RoleViewer, http.MethodPatch, costPath, `{"status":"disputed"}`); w.Code != http.StatusForbidden {
+		t.Errorf("viewer PATCH %s = %d, want 403", costPath, w.Code)
+	}
+	if w := serve(models.RoleManager, http.MethodPost, costPath, `{}`); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST %s = %d, want 405", costPath, w.Code)
+	}
+	if w := serve(models.RoleManager, http.MethodGet, "/api/v1/maintenance/not-an-id", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("GET invalid maintenance ID = %d, want 400", w.Code)
+	}
+	if w := serve(models.RoleManager, http.MethodGet, "/api/v1/maintenance/"+primitive.NewObjectID().Hex(), ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET missing maintenance = %d, want 404", w.Code)
+	}
+}
+
+func TestItemHandler_StorageErrors(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+	}{
+		{db.ErrNotFound, http.StatusNotFound},
+		{fmt.Errorf("find trip: %w", db.ErrNotFound), http.StatusNotFound},
+		{context.DeadlineExceeded, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		handler := &ItemHandler[models.Trip]{
+			Noun: "trip",
+			Find: func(ctx context.Context, id string) (*models.Trip, error) { return nil, tt.err },
+		}
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/trips/x", nil)
+		req.SetPathValue("id", primitive.NewObjectID().Hex())
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.wantStatus {
+			t.Errorf("GET with %v = %d, want %d", tt.err, w.Code, tt.wantStatus)
+		}
+	}
+
+	// Records deleted between the lookup and the change are not found
+	trip := &models.Trip{ID: primitive.NewObjectID()}
+	handler := &ItemHandler[models.Trip]{
+		Noun:   "trip",
+		Find:   func(ctx context.Context, id string) (*models.Trip, error) { return trip, nil },
+		Delete: func(ctx context.Context, id string) error { return db.ErrNotFound },
+	}
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/trips/x", nil)
+	req.SetPathValue("id", trip.ID.Hex())
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("DELETE of a vanished trip = %d, want 404", w.Code)
+	}
+}
+
+// recordingTrips records the query of the last FindTrips call
+type recordingTrips struct {
+	scopedTrips
+	query db.Query
+}
+
+func (r *recordingTrips) FindTrips(ctx context.Context, q db.Query) ([]models.Trip, error) {
+	r.query = q
+	return r.scopedTrips.FindTrips(ctx, q)
+}
+
+// recordingTelemetry records the query of the last FindTelemetry call
+type recordingTelemetry struct {
+	*mockTelemetryCollection
+	query db.Query
+}
+
+func (r *recordingTelemetry) FindTelemetry(ctx context.Context, q db.Query) ([]models.Telemetry, error) {
+	r.query = q
+	return r.mockTelemetryCollection.FindTelemetry(ctx, q)
+}
+
+func TestListHandlers_QueryParameters(t *testing.T) {
+	trips := &recordingTrips{scopedTrips: scopedTrips{&scopedRecords[models.Trip]{key: func(r models.Trip) (string, string) { return r.ID.Hex(), r.TenantID }}}}
+	for _, cost := range []float64{30, 20, 10} {
+		trips.insert(models.Trip{ID: primitive.NewObjectID(), VehicleID: "v1", Status: "planned", Cost: cost})
+	}
+	handler := &TripHandler{Collection: trips}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/trips?status=planned,completed&vehicle_id=v1&sort=-cost&page_size=2&fields=status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/trips = %d %s", w.Code, w.Body.String())
+	}
+	wantMatch := map[string][]interface{}{"status": {"planned", "completed"}}
+	if fmt.Sprint(trips.query.Match) != fmt.Sprint(wantMatch) || fmt.Sprint(trips.query.VehicleIDs) != "[v1]" {
+		t.Errorf("match %v vehicles %v, want %v vehicles [v1]", trips.query.Match, trips.query.VehicleIDs, wantMatch)
+	}
+	if wantSort := []db.SortKey{{Field: "cost", Descending: true}, {Field: "_id", Descending: true}}; fmt.Sprint(trips.query.Sort) != fmt.Sprint(wantSort) || trips.query.Limit != 3 {
+		t.Errorf("sort %v limit %d, want %v limit 3", trips.query.Sort, trips.query.Limit, wantSort)
+	}
+	var page []map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&page)
+	if len(page) != 2 || len(page[0]) != 2 || page[0]["status"] != "planned" {
+		t.Errorf("page = %v, want 2 trips with id and status only", page)
+	}
+	next := w.Header().Get(query.NextCursorHeader)
+	if next == "" || !strings.Contains(w.Header().Get("Link"), "cursor="+next) {
+		t.Fatalf("next cursor %q, Link %q", next, w.Header().Get("Link"))
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/trips?status=planned,completed&vehicle_id=v1&sort=-cost&page_size=2&cursor="+next, nil))
+	if w.Code != http.StatusOK || len(trips.query.After) != 2 {
+		t.Errorf("GET next page = %d, after %v", w.Code, trips.query.After)
+	}
+
+	for _, rawQuery := range []string{"sort=notes", "page_size=-1", "cursor=bogus", "from=yesterday"} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/trips?"+rawQuery, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET /api/trips?%s = %d, want 400", rawQuery, w.Code)
+		}
+	}
+
+	// Telemetry keeps accepting sort=asc|desc and limit
+	telemetry := &recordingTelemetry{mockTelemetryCollection: &mockTelemetryCollection{}}
+	tests := []struct {
+		rawQuery  string
+		wantDesc  bool
+		wantLimit int
+	}{
+		{"", true, query.DefaultPageSize + 1},
+		{"limit=1&sort=desc", true, 2},
+		{"limit=0&sort=asc", false, query.MaxPageSize + 1},
+		{"page_size=5&sort=timestamp", false, 6},
+	}
+	for _, tt := range tests {
+		w = httptest.NewRecorder()
+		(&TelemetryHandler{Collection: telemetry}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/telemetry?"+tt.rawQuery, nil))
+		sort := telemetry.query.Sort
+		if w.Code != http.StatusOK || len(sort) == 0 || sort[0].Field != "timestamp" || sort[0].Descending != tt.wantDesc || telemetry.query.Limit != tt.wantLimit {
+			t.Errorf("GET /api/telemetry?%s = %d, sort %v limit %d", tt.rawQuery, w.Code, sort, telemetry.query.Limit)
+		}
+	}
+}
+
+func TestOpenStorage(t *testing.T) {
+	t.Setenv("STORAGE", "memory")
+	if stores, err := openStorage(); err != nil || stores.trips == nil || stores.users == nil || len(stores.checks) != 0 {
+		t.Errorf("memory storage = %+v, %v", stores, err)
+	}
+	t.Setenv("STORAGE", "sqlite")
+	if _, err := openStorage(); err == nil {
+		t.Error("expected an error for an unknown STORAGE")
+	}
+}
+
+func TestDataRoutes_MemoryStorage(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("auth service: %v", err)
+	}
+	stores := memoryStorage()
+	for _, id := range []string{"tenant-a", "tenant-b"} {
+		stores.tenants.InsertTenant(context.Background(), models.NewTenant(id, id))
+	}
+	api := newAPI()
+	registerDataRoutes(api, middleware.NewAuthMiddleware(authService, stores.revocations, stores.apiKeys, stores.tenants), stores.telemetry, stores.vehicles, stores.trips, stores.maintenance, stores.costs, stores.tenants)
+	serve := func(tenantID, method, path, body string) *httptest.ResponseRecorder {
+		token, _ := authService.GenerateToken(&models.User{ID: primitive.NewObjectID(), Username: "manager", Role: models.RoleManager, TenantID: tenantID})
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w
+	}
+
+	var ids []string
+	for i, status := range []string{"completed", "planned", "completed"} {
+		body := fmt.Sprintf(`{"vehicle_id":"v1","status":%q,"start_time":"2024-01-0%dT08:00:00Z","cost":%d}`, status, i+1, (i+1)*10)
+		w := serve("tenant-a", http.MethodPost, "/api/v1/trips", body)
+		var created map[string]string
+		json.NewDecoder(w.Body).Decode(&created)
+		if w.Code != http.StatusCreated || created["id"] == "" {
+			t.Fatalf("POST trip = %d %v", w.Code, created)
+		}
+		ids = append(ids, created["id"])
+	}
+	serve("tenant-b", http.MethodPost, "/api/v1/trips", `{"vehicle_id":"v1","status":"completed","start_time":"2024-01-01T08:00:00Z"}`)
+
+	// Filters, sorting and cursors are applied by the store
+	var page []models.Trip
+	w := serve("tenant-a", http.MethodGet, "/api/v1/trips?status=completed&sort=-cost&page_size=1", "")
+	json.NewDecoder(w.Body).Decode(&page)
+	next := w.Header().Get(query.NextCursorHeader)
+	if w.Code != http.StatusOK || len(page) != 1 || page[0].ID.Hex() != ids[2] || next == "" {
+		t.Fatalf("GET first page = %d %v, cursor %q", w.Code, page, next)
+	}
+	page = nil
+	w = serve("tenant-a", http.MethodGet, "/api/v1/trips?status=completed&sort=-cost&page_size=1&cursor="+next, "")
+	json.NewDecoder(w.Body).Decode(&page)
+	if w.Code != http.StatusOK || len(page) != 1 || page[0].ID.Hex() != ids[0] || w.Header().Get(query.NextCursorHeader) != "" {
+		t.Errorf("GET last page = %d %v", w.Code, page)
+	}
+	page = nil
+	json.NewDecoder(serve("tenant-a", http.MethodGet, "/api/v1/trips?from=2024-01-02T00:00:00Z", "").Body).Decode(&page)
+	if len(page) != 2 {
+		t.Errorf("GET trips from Jan 2 = %v, want 2", page)
+	}
+
+	tripPath := "/api/v1/trips/" + ids[1]
+	if w := serve("tenant-a", http.MethodPatch, tripPath, `{"status":"in_progress"}`); w.Code != http.StatusOK {
+		t.Errorf("PATCH %s = %d %s", tripPath, w.Code, w.Body.String())
+	}
+	var trip models.Trip
+	json.NewDecoder(serve("tenant-a", http.MethodGet, tripPath, "").Body).Decode(&trip)
+	if trip.Status != "in_progress" || trip.Cost != 20 || trip.TenantID != "tenant-a" {
+		t.Errorf("GET %s = %+v", tripPath, trip)
+	}
+	if w := serve("tenant-b", http.MethodGet, tripPath, ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET %s from another tenant = %d, want 404", tripPath, w.Code)
+	}
+	if w := serve("tenant-a", http.MethodDelete, tripPath, ""); w.Code != http.StatusOK {
+		t.Errorf("DELETE %s = %d", tripPath, w.Code)
+	}
+	if w := serve("tenant-a", http.MethodGet, tripPath, ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET deleted %s = %d, want 404", tripPath, w.Code)
+	}
+	page = nil
+	json.NewDecoder(serve("tenant-b", http.MethodGet, "/api/v1/trips", "").Body).Decode(&page)
+	if len(page) != 1 {
+		t.Errorf("GET trips of tenant-b = %v, want 1", page)
+	}
+}
+
+func TestTelemetryStream_TenantIsolation(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("auth service: %v", err)
+	}
+	tenantStore := db.NewMemoryTenantStore()
+	for _, id := range []string{"tenant-a", "tenant-b"} {
+		tenantStore.InsertTenant(context.Background(), models.NewTenant(id, id))
+	}
+	authMiddleware := middleware.NewAuthMiddleware(authService, db.NewMemoryRevocationStore(), db.NewMemoryAPIKeyStore(), tenantStore)
+	telemetry := &scopedRecords[models.Telemetry]{key: func(r models.Telemetry) (string, string) { return r.ID.Hex(), r.TenantID }}
+	api := newAPI()
+	registerDataRoutes(api, authMiddleware, scopedTelemetry{telemetry}, &mockVehicleCollection{}, nil, nil, nil, tenantStore)
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	tokens := map[string]string{}
+	for _, tenantID := range []string{"tenant-a", "tenant-b"} {
+		tokens[tenantID], _ = authService.GenerateToken(&models.User{ID: primitive.NewObjectID(), Username: "user-" + tenantID, Role: models.RoleAdmin, TenantID: tenantID})
+	}
+
+	resp, err := http.Get(server.URL + "/api/v1/telemetry/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("anonymous stream = %d, want 401", resp.StatusCode)
+	}
+
+	// subscribe returns the data lines the stream of tenantID receives
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subscribe := func(tenantID string) <-chan string {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/telemetry/stream?access_token="+tokens[tenantID], nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("stream for %s = %d", tenantID, resp.StatusCode)
+		}
+		reader := bufio.NewReader(resp.Body)
+		reader.ReadString('\n') // ": connected"
+		lines := make(chan string, 4)
+		go func() {
+			defer resp.Body.Close()
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if strings.HasPrefix(line, "data: ") {
+					lines <- line
+				}
+			}
+		}()
+		return lines
+	}
+	streamA, streamB := subscribe("tenant-a"), subscribe("tenant-b")
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/telemetry", strings.NewReader(`{"vehicle_id":"truck-1","timestamp":"2023-01-01T00:00:00Z","location":{"lat":51,"lon":0},"speed":50,"emissions":10,"type":"ICE","status":"active"}`))
+	req.Header.Set("Authorization", "Bearer "+tokens["tenant-a"])
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /api/telemetry = %d", resp.StatusCode)
+	}
+
+	select {
+	case line := <-streamA:
+		if !strings.Contains(line, "truck-1") {
+			t.Errorf("unexpected event %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("tenant-a did not receive its telemetry")
+	}
+	select {
+	case line := <-streamB:
+		t.Errorf("tenant-b received tenant-a telemetry: %q", line)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestCORS_OriginPolicySharedByAllEndpoints(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+	t.Setenv("WEBSOCKETS_ENABLED", "true")
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("auth service: %v", err)
+	}
+	tenantStore := db.NewMemoryTenantStore()
+	tenant := models.NewTenant("tenant-a", "Tenant A")
+	tenant.AllowedOrigins = []string{"https://fleet.tenant-a.com"}
+	tenantStore.InsertTenant(context.Background(), tenant)
+	policy := middleware.DefaultCORSPolicy
+	policy.AllowedOrigins = []string{"http://localhost:3000"}
+	corsPolicy, err = middleware.NewCORS(policy, tenantStore, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { corsPolicy = nil }()
+
+	authMiddleware := middleware.NewAuthMiddleware(authService, db.NewMemoryRevocationStore(), db.NewMemoryAPIKeyStore(), tenantStore)
+	telemetry := &scopedRecords[models.Telemetry]{key: func(r models.Telemetry) (string, string) { return r.ID.Hex(), r.TenantID }}
+	api := newAPI()
+	registerDataRoutes(api, authMiddleware, scopedTelemetry{telemetry}, &mockVehicleCollection{}, nil, nil, nil, tenantStore)
+	server := httptest.NewServer(api)
+	defer server.Close()
+	token, _ := authService.GenerateToken(&models.User{ID: primitive.NewObjectID(), Username: "user-a", Role: models.RoleAdmin, TenantID: "tenant-a"})
+
+	origins := map[string]bool{
+		"http://localhost:3000":      true,
+		"https://fleet.tenant-a.com": true,
+		"https://evil.example.com":   false,
+	}
+	for origin, allowed := range origins {
+		// REST preflight
+		req, _ := http.NewRequest(http.MethodOptions, server.URL+"/api/v1/vehicles", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want := map[bool]int{true: http.StatusNoContent, false: http.StatusForbidden}[allowed]; resp.StatusCode != want {
+			t.Errorf("preflight from %s = %d, want %d", origin, resp.StatusCode, want)
+		}
+
+		// SSE
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ = http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/telemetry/stream?access_token="+token, nil)
+		req.Header.Set("Origin", origin)
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Origin"); (got == origin) != allowed || (!allowed && got != "") {
+			t.Errorf("stream from %s allows origin %q", origin, got)
+		}
+		cancel()
+		resp.Body.Close()
+
+		// WebSocket
+		wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/telemetry/ws?access_token=" + token
+		conn, resp, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {origin}})
+		if (err == nil) != allowed {
+			t.Errorf("websocket from %s connected = %v, want %v", origin, err == nil, allowed)
+		}
+		if conn != nil {
+			conn.Close()
+		} else if resp != nil && resp.StatusCode != http.StatusForbidden {
+			t.Errorf("websocket from %s = %d, want 403", origin, resp.StatusCode)
+		}
+	}
+}
+
+func TestSSEHub_Metrics(t *testing.T) {
+	hub := NewSSEHub()
+	clients := testutil.ToFloat64(metrics.StreamClients.WithLabelValues("ws"))
+	dropped := testutil.ToFloat64(metrics.BroadcastsDropped.WithLabelValues("ws"))
+
+	ch := hub.subscribe("tenant-a", "ws")
+	other := hub.subscribe("tenant-b", "ws")
+	if got := testutil.ToFloat64(metrics.StreamClients.WithLabelValues("ws")); got != clients+2 {
+		t.Errorf("ws clients = %v, want %v", got, clients+2)
+	}
+
+	// The channel buffers 16 events; the rest are dropped for the slow client
+	for i := 0; i < 20; i++ {
+		hub.BroadcastToTenant("tenant-a", []byte("{}"))
+	}
+	if got := testutil.ToFloat64(metrics.BroadcastsDropped.WithLabelValues("ws")); got != dropped+4 {
+		t.Errorf("dropped broadcasts = %v, want %v", got, dropped+4)
+	}
+	if len(other) != 0 {
+		t.Errorf("tenant-b received %d events of tenant-a", len(other))
+	}
+
+	hub.unsubscribe(ch)
+	hub.unsubscribe(other)
+	if got := testutil.ToFloat64(metrics.StreamClients.WithLabelValues("ws")); got != clients {
+		t.Errorf("ws clients after unsubscribe = %v, want %v", got, clients)
+	}
+}
+
+func TestTelemetryHandler_IngestMetrics(t *testing.T) {
+	stored := testutil.ToFloat64(metrics.TelemetryIngested.WithLabelValues("http", "stored"))
+	invalid := testutil.ToFloat64(metrics.TelemetryIngested.WithLabelValues("http", "invalid"))
+	handler := &TelemetryHandler{Collection: &mockTelemetryCollection{}}
+
+	for _, body := range []string{
+		`{"vehicle_id":"truck-1","timestamp":"2023-01-01T00:00:00Z","speed":50,"emissions":10,"type":"ICE","status":"active"}`,
+		`{"vehicle_id":"truck-1","timestamp":"2023-01-01T00:00:00Z","speed":50,"emissions":10,"type":"diesel","status":"active"}`,
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/telemetry", strings.NewReader(body)))
+	}
+
+	if got := testutil.ToFloat64(metrics.TelemetryIngested.WithLabelValues("http", "stored")); got != stored+1 {
+		t.Errorf("stored = %v, want %v", got, stored+1)
+	}
+	if got := testutil.ToFloat64(metrics.TelemetryIngested.WithLabelValues("http", "invalid")); got != invalid+1 {
+		t.Errorf("invalid = %v, want %v", got, invalid+1)
+	}
+}
+
+func TestTelemetryHandler_Spans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+	previousHub := telemetrySSEHub
+	telemetrySSEHub = NewSSEHub()
+	defer func() { telemetrySSEHub = previousHub }()
+	defer telemetrySSEHub.unsubscribe(telemetrySSEHub.subscribe("", "sse"))
+
+	ctx, parent := tracing.Start(context.Background(), "POST /api/telemetry")
+	body := `{"vehicle_id":"truck-1","timestamp":"2023-01-01T00:00:00Z","speed":50,"emissions":10,"type":"ICE","status":"active"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/telemetry", strings.NewReader(body)).WithContext(ctx)
+	(&TelemetryHandler{Collection: &mockTelemetryCollection{}}).ServeHTTP(httptest.NewRecorder(), req)
+	parent.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	for _, name := range []string{"telemetry.decode", "telemetry.broadcast"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("no %s span", name)
+			continue
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("%s is not a child of the request span", name)
+		}
+	}
+	if span, ok := spans["telemetry.broadcast"]; ok {
+		for _, attr := range span.Attributes() {
+			if attr.Key == "telemetry.clients" && attr.Value.AsInt64() != 1 {
+				t.Errorf("telemetry.clients = %d, want 1", attr.Value.AsInt64())
+			}
+		}
+	}
+}
+
+func TestMQTTTraceContext(t *testing.T) {
+	payload := `{"vehicle_id":"truck-1","traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}`
+	if got := mqttTraceContext([]byte(payload))["traceparent"]; got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("traceparent = %q", got)
+	}
+	if got := mqttTraceContext([]byte("not json"))["traceparent"]; got != "" {
+		t.Errorf("traceparent of malformed payload = %q, want none", got)
+	}
+}
+
+func TestMQTTTopicTenant(t *testing.T) {
+	tests := []struct {
+		filter, topic, tenant string
+	}{
+		{"tenants/+/telemetry", "tenants/acme/telemetry", "acme"},
+		{"fleet/+/+/telemetry", "fleet/acme/truck-1/telemetry", "acme"},
+		{"tenants/+/telemetry", "tenants//telemetry", ""},
+		{"tenants/+/telemetry", "tenants/acme/alerts", ""},
+		{"tenants/+/telemetry", "tenants/acme/telemetry/extra", ""},
+		{"tenants/+/telemetry", "fleet/telemetry", ""},
+		{"fleet/telemetry", "fleet/telemetry", ""},
+	}
+	for _, tt := range tests {
+		if got := mqttTopicTenant(tt.filter, tt.topic); got != tt.tenant {
+			t.Errorf("mqttTopicTenant(%q, %q) = %q, want %q", tt.filter, tt.topic, got, tt.tenant)
+		}
+	}
+}
+
+func TestRateLimitGroup(t *testing.T) {
+	tests := []struct {
+		method, path, group string
+	}{
+		{http.MethodPost, "/api/v1/telemetry", "ingest"},
+		{http.MethodGet, "/api/v1/telemetry", "read"},
+		{http.MethodGet, "/api/v1/telemetry/metrics", "read"},
+		{http.MethodDelete, "/api/v1/telemetry", "write"},
+		{http.MethodPost, "/api/v1/vehicles", "write"},
+		{http.MethodPost, "/api/v1/auth/login", "auth"},
+		{http.MethodPost, "/api/v1/auth/invite", "auth"},
+		{http.MethodPost, "/api/v1/users", "auth"},
+		{http.MethodDelete, "/api/v1/users/u1", "auth"},
+		{http.MethodGet, "/api/v1/users", "read"},
+	}
+	for _, tt := range tests {
+		group := rateLimitGroup(httptest.NewRequest(tt.method, tt.path, nil))
+		if group != tt.group {
+			t.Errorf("%s %s is in group %q, want %q", tt.method, tt.path, group, tt.group)
+		}
+		if _, ok := defaultRateLimits[group]; !ok {
+			t.Errorf("group %q has no default limits", group)
+		}
+	}
+}
+
+func TestAPI_RoutesMatchSpec(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+	doc, err := apispec.Load()
+	if err != nil {
+		t.Fatalf("openapi.yaml: %v", err)
+	}
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("auth service: %v", err)
+	}
+	authMiddleware := middleware.NewAuthMiddleware(authService, db.NewMemoryRevocationStore(), db.NewMemoryAPIKeyStore(), db.NewMemoryTenantStore())
+
+	// Every optional route is registered: single sign-on and WebSockets are enabled
+	v1 := newAPI()
+	registerDataRoutes(v1, authMiddleware, &mockTelemetryCollection{}, &mockVehicleCollection{}, nil, nil, nil, nil)
+	registerAccountRoutes(v1, authMiddleware, &handlers.AuthHandler{}, &handlers.OIDCHandler{}, &handlers.UserHandler{}, &handlers.APIKeyHandler{}, &handlers.AuditHandler{}, &handlers.TenantHandler{})
+
+	routes := map[string]bool{}
+	for _, route := range v1.Routes() {
+		routes[route.Method+" "+route.Pattern] = true
+	}
+	documented := map[string]bool{}
+	for _, op := range apispec.Operations(doc) {
+		documented[op.Method+" "+op.Path] = true
+		if !routes[op.Method+" "+op.Path] {
+			t.Errorf("%s %s is documented in api/openapi.yaml but not served", op.Method, op.Path)
+		}
+	}
+	for route := range routes {
+		if !documented[route] {
+			t.Errorf("%s is served but not documented in api/openapi.yaml", route)
+		}
+	}
+}
+
+func TestAPI_ConformsToSpec(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+	doc, err := apispec.Load()
+	if err != nil {
+		t.Fatalf("openapi.yaml: %v", err)
+	}
+	validator := apispec.NewValidator(doc)
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("auth service: %v", err)
+	}
+	tenantStore := db.NewMemoryTenantStore()
+	tenantStore.InsertTenant(context.Background(), models.NewTenant("tenant-a", "tenant-a"))
+	revocations, auditLog := db.NewMemoryRevocationStore(), db.NewMemoryAuditLog()
+	authMiddleware := middleware.NewAuthMiddleware(authService, revocations, db.NewMemoryAPIKeyStore(), tenantStore)
+
+	fuel := 10.0
+	vehicleID, tripID := primitive.NewObjectID(), primitive.NewObjectID()
+	telemetry := &scopedRecords[models.Telemetry]{key: func(r models.Telemetry) (string, string) { return r.ID.Hex(), r.TenantID }}
+	telemetry.insert(models.Telemetry{ID: primitive.NewObjectID(), TenantID: "tenant-a", VehicleID: vehicleID, Timestamp: time.Now(), Type: "ICE", Status: "active", FuelLevel: &fuel, Emissions: 120})
+	vehicles := &scopedRecords[models.Vehicle]{key: func(r models.Vehicle) (string, string) { return r.ID.Hex(), r.TenantID }}
+	vehicles.insert(models.Vehicle{ID: vehicleID, TenantID: "tenant-a", Type: "ICE", Make: "Ford", Model: "Transit", Year: 2021, Status: "active", CreatedAt: time.Now()})
+	trips := &scopedRecords[models.Trip]{key: func(r models.Trip) (string, string) { return r.ID.Hex(), r.TenantID }}
+	trips.insert(models.Trip{ID: tripID, TenantID: "tenant-a", VehicleID: vehicleID.Hex(), StartTime: time.Now(), Status: "planned"})
+	maintenance := &scopedRecords[models.Maintenance]{key: func(r models.Maintenance) (string, string) { return r.ID.Hex(), r.TenantID }}
+	costs := &scopedRecords[models.Cost]{key: func(r models.Cost) (string, string) { return r.ID.Hex(), r.TenantID }}
+
+	v1 := newAPI()
+	registerDataRoutes(v1, authMiddleware, scopedTelemetry{telemetry}, scopedVehicles{vehicles}, scopedTrips{trips}, scopedMaintenance{maintenance}, scopedCosts{costs}, tenantStore)
+	authHandler := handlers.NewAuthHandler(authService, nil, nil, revocations, nil, nil, auditLog, db.NewMemoryMFAPolicyStore(), tenantStore)
+	registerAccountRoutes(v1, authMiddleware, authHandler, nil,
+		handlers.NewUserHandler(authService, nil, nil, revocations, nil, auditLog),
+		handlers.NewAPIKeyHandler(authService, db.NewMemoryAPIKeyStore(), auditLog),
+		handlers.NewAuditHandler(auditLog),
+		handlers.NewTenantHandler(tenantStore, auditLog))
+
+	tokens := map[models.Role]string{}
+	for _, role := range []models.Role{models.RoleViewer, models.RoleOperator, models.RoleManager, models.RoleAdmin} {
+		tokens[role], _ = authService.GenerateToken(&models.User{ID: primitive.NewObjectID(), Username: string(role), Role: role, TenantID: "tenant-a"})
+	}
+	tokens[models.RoleSuperAdmin], _ = authService.GenerateToken(&models.User{ID: primitive.NewObjectID(), Username: "root", Role: models.RoleSuperAdmin})
+
+	vehiclePath, tripPath := "/api/v1/vehicles/"+vehicleID.Hex(), "/api/v1/trips/"+tripID.Hex()
+	telemetryBody := fmt.Sprintf(`{"vehicle_id":%q,"timestamp":"2024-01-01T00:00:00Z","location":{"lat":52.5,"lon":13.4},"speed":50,"fuel_level":60,"emissions":110,"type":"ICE","status":"active"}`, vehicleID.Hex())
+	requests := []struct {
+		role         models.Role
+		method, path string
+		contentType  string
+		body         string
+		status       int
+	}{
+		{models.RoleViewer, http.MethodGet, "/api/v1/telemetry", "", "", http.StatusOK},
+		{models.RoleViewer, http.MethodGet, "/api/v1/telemetry?sort=-speed&page_size=1&fields=speed,type&type=ICE,EV", "", "", http.StatusOK},
+		{models.RoleOperator, http.MethodPost, "/api/v1/telemetry", "application/json", telemetryBody, http.StatusOK},
+		{models.RoleViewer, http.MethodGet, "/api/v1/telemetry/metrics?from=2024-01-01T00:00:00Z", "", "", http.StatusOK},
+		{models.RoleViewer, http.MethodGet, "/api/v1/telemetry/metrics/advanced", "", "", http.StatusOK},
+		{models.RoleViewer, http.MethodGet, "/api/v1/alerts", "", "", http.StatusOK},
+		{models.RoleViewer, http.MethodGet, "/api/v1/vehicles?year=2021", "", "", http.StatusOK},
+		{models.RoleViewer, http.MethodGet, vehiclePath, "", "", http.StatusOK},
+		{models.RoleManager, http.MethodPost, "/api/v1/vehicles", "application/json", `{"type":"EV","make":"Nissan","model":"Leaf","year":2022,"status":"active"}`, http.StatusCreated},
+		{models.RoleManager, http.MethodPut, vehiclePath, "application/json", `{"type":"EV","make":"Nissan","model":"Leaf","year":2022,"status":"active"}`, http.StatusOK},
+		{models.RoleManager, http.MethodPatch, vehiclePath, "application/merge-patch+json", `{"status":"inactive"}`, http.StatusOK},
+		{models.RoleViewer, http.MethodGet, "/api/v1/trips?sort=-distance", "", "", http.StatusOK},
+		{models.RoleViewer, http.MethodGet, tripPath, "", "", http.StatusOK},
+		{models.RoleOperator, http.MethodPost, "/api/v1/trips", "application/json", `{"vehicle_id":"v1","start_time":"2024-01-01T08:00:00Z","distance":12.5}`, http.StatusCreated},
+		{models.RoleOperator, http.MethodPut, tripPath, "application/json", `{"vehicle_id":"v1","start_time":"2024-01-01T08:00:00Z"}`, http.StatusOK},
+		{models.RoleOperator, http.MethodPatch, tripPath, "application/merge-patch+json", `{"status":"completed","notes":null}`, http.StatusOK},
+		{models.RoleViewer, http.MethodGet, "/api/v1/maintenance", "", "", http.StatusOK},
+		{models.RoleOperator, http.MethodPost, "/api/v1/maintenance", "application/json", `{"vehicle_id":"v1","service_type":"oil_change","service_date":"2024-01-01T00:00:00Z"}`, http.StatusCreated},
+		{models.RoleViewer, http.MethodGet, "/api/v1/costs", "", "", http.StatusOK},
+		{models.RoleManager, http.MethodPost, "/api/v1/costs", "application/json", `{"vehicle_id":"v1","category":"fuel","amount":50,"date":"2024-01-01T00:00:00Z"}`, http.StatusCreated},
+		{models.RoleAdmin, http.MethodGet, "/api/v1/auth/mfa/policy", "", "", http.StatusOK},
+		{models.RoleAdmin, http.MethodPut, "/api/v1/auth/mfa/policy", "application/json", `{"required_roles":["admin"]}`, http.StatusOK},
+		{models.RoleAdmin, http.MethodGet, "/api/v1/api-keys", "", "", http.StatusOK},
+		{models.RoleAdmin, http.MethodPost, "/api/v1/api-keys", "application/json", `{"name":"sensor","scopes":["telemetry:write"]}`, http.StatusCreated},
+		{models.RoleAdmin, http.MethodGet, "/api/v1/audit?limit=10", "", "", http.StatusOK},
+		{models.RoleAdmin, http.MethodGet, "/api/v1/audit/verify", "", "", http.StatusOK},
+		{models.RoleSuperAdmin, http.MethodGet, "/api/v1/tenants?status=active", "", "", http.StatusOK},
+		{models.RoleSuperAdmin, http.MethodPost, "/api/v1/tenants", "application/json", `{"name":"Globex","plan":"pro"}`, http.StatusCreated},
+		{models.RoleSuperAdmin, http.MethodPatch, "/api/v1/tenants/tenant-a", "application/json", `{"timezone":"Europe/Berlin"}`, http.StatusOK},
+		{models.RoleManager, http.MethodDelete, tripPath, "", "", http.StatusOK},
+		{models.RoleViewer, http.MethodDelete, "/api/v1/telemetry", "", "", http.StatusForbidden},
+		{models.RoleViewer, http.MethodGet, "/api/v1/trips/" + primitive.NewObjectID().Hex(), "", "", http.StatusNotFound},
+		{models.RoleManager, http.MethodPost, "/api/v1/costs", "application/json", `{"vehicle_id":"v1","category":"fuel","amount":-5}`, http.StatusBadRequest},
+		{"", http.MethodGet, "/api/v1/vehicles", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range requests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		if tt.role != "" {
+			req.Header.Set("Authorization", "Bearer "+tokens[tt.role])
+		}
+		if err := validator.ValidateRequest(req); err != nil {
+			t.Errorf("%s %s does not match the spec: %v", tt.method, tt.path, err)
+			continue
+		}
+		w := httptest.NewRecorder()
+		v1.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s %s = %d %s, want %d", tt.method, tt.path, w.Code, w.Body.String(), tt.status)
+		}
+		if route, _, _ := validator.Route(req); req.Pattern != apiPrefix+route.Path {
+			t.Errorf("%s %s was routed to %q, documented as %q", tt.method, tt.path, req.Pattern, route.Path)
+		}
+		if err := validator.ValidateResponse(req, w.Code, w.Header(), w.Body.Bytes()); err != nil {
+			t.Errorf("response to %s %s does not match the spec: %v", tt.method, tt.path, err)
+		}
+	}
+}
@@ -202,15 +202,28 @@ func randomLocation() Location {
 
 var authToken string
 
+// apiKey is a long-lived tenant API key; preferred over authToken when set
+var apiKey string
+
+// simTenantID fills the tenant level of the MQTT telemetry topic
+var simTenantID string
+
+// setAuthHeader adds the configured credentials to a request
+func setAuthHeader(req *http.Request) {
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	} else if authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+authToken)
+	}
+}
+
 func authorizedPost(url string, contentType string, body *bytes.Buffer) (*http.Response, error) {
 	req, err := http.NewRequest(http.MethodPost, url, body)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", contentType)
-	if authToken != "" {
-		req.Header.Set("Authorization", "Bearer "+authToken)
-	}
+	setAuthHeader(req)
 	client := &http.Client{Timeout: 10 * time.Second}
 	return client.Do(req)
 }
@@ -317,9 +330,7 @@ type existingVehicle struct {
 func fetchExistingVehicles(apiURL string) ([]existingVehicle, error) {
     req, err := http.NewRequest(http.MethodGet, apiURL+"/vehicles", nil)
     if err != nil { return nil, err }
-    if authToken != "" {
-        req.Header.Set("Authorization", "Bearer "+authToken)
-    }
+    setAuthHeader(req)
     client := &http.Client{ Timeout: 10 * time.Second }
     resp, err := client.Do(req)
     if err != nil { return nil, err }
@@ -494,7 +505,9 @@ func sendTelemetry(apiURL string, tele Telemetry) {
 			return
 		}
 		topic := os.Getenv("MQTT_TELEMETRY_TOPIC")
-		if topic == "" { topic = "fleet/telemetry" }
+		if topic == "" { topic = "tenants/+/telemetry" }
+		// The backend takes the tenant from the topic, not from the payload
+		topic = strings.Replace(topic, "+", simTenantID, 1)
 		if token := client.Publish(topic, 1, false, data); token.Wait() && token.Error() != nil {
 			log.WithError(token.Error()).Error("MQTT publish failed")
 		}
@@ -618,8 +631,14 @@ func simulateVehicle(apiURL string, s *VehicleState, interval time.Duration) {
 }
 
 func main() {
-	// Optional JWT for protected API
+	// Optional credentials for the protected API: a tenant API key with the
+	// telemetry:write, vehicles:read and vehicles:write scopes, or a user JWT
+	apiKey = os.Getenv("SIM_API_KEY")
 	authToken = os.Getenv("SIM_AUTH_TOKEN")
+	simTenantID = os.Getenv("SIM_TENANT_ID")
+	if os.Getenv("SIM_USE_MQTT") == "1" && simTenantID == "" {
+		log.Warn("SIM_TENANT_ID is not set; the backend drops MQTT telemetry without a tenant")
+	}
 
 	fleetSize := 50
 	if val := os.Getenv("FLEET_SIZE"); val != "" {
@@ -630,7 +649,7 @@ func main() {
 
 	apiURL := os.Getenv("API_BASE_URL")
 	if apiURL == "" {
-		apiURL = "http://localhost:8081/api"
+		apiURL = "http://localhost:8081/api/v1"
 	}
 
 	interval := 2 * time.Second
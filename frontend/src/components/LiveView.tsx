@@ -66,8 +66,9 @@ const LiveView: React.FC<LiveViewProps> = ({ onNavigateToVehicleDetail }) => {
       }
     })();
 
-    // SSE stream (best-effort)
-    const url = `${API_BASE_URL}/api/telemetry/stream`;
+    // SSE stream (best-effort); EventSource cannot send headers, so the token goes in the query
+    const token = localStorage.getItem('auth_token') || '';
+    const url = `${API_BASE_URL}/api/v1/telemetry/stream?access_token=${encodeURIComponent(token)}`;
     const es = new EventSource(url);
     eventSourceRef.current = es;
 
@@ -38,7 +38,7 @@ const Login: React.FC<LoginProps> = ({ onLoginSuccess }) => {
       localStorage.setItem('user', JSON.stringify(response.user));
       onLoginSuccess(formData.username, formData.password);
     } catch (err: any) {
-      setError(err.response?.data || 'Login failed. Please try again.');
+      setError(err.response?.data?.detail || 'Login failed. Please try again.');
     } finally {
       setLoading(false);
     }
@@ -49,16 +49,28 @@ class ApiService {
     );
   }
 
+  // List endpoints return one page at a time; follow X-Next-Cursor to the last one
+  private async getAllPages<T>(path: string, params: URLSearchParams): Promise<T[]> {
+    const items: T[] = [];
+    let cursor: string | undefined;
+    do {
+      if (cursor) params.set('cursor', cursor);
+      const response = await this.api.get(`${path}?${params.toString()}`);
+      items.push(...(response.data || []));
+      cursor = response.headers['x-next-cursor'];
+    } while (cursor);
+    return items;
+  }
+
   // Telemetry endpoints
   async getTelemetry(timeRange?: TimeRange): Promise<Telemetry[]> {
     const params = new URLSearchParams();
     if (timeRange?.from) params.append('from', timeRange.from);
     if (timeRange?.to) params.append('to', timeRange.to);
-    params.append('sort', 'asc');
-    params.append('limit', '0');
+    params.append('sort', 'timestamp');
+    params.append('page_size', '1000');
 
-    const response = await this.api.get(`/api/telemetry?${params.toString()}`);
-    return response.data || [];
+    return this.getAllPages<Telemetry>('/api/v1/telemetry', params);
   }
 
   async getTelemetryByVehicle(vehicleId: string, timeRange?: TimeRange): Promise<Telemetry[]> {
@@ -66,14 +78,13 @@ class ApiService {
     if (timeRange?.from) params.append('from', timeRange.from);
     if (timeRange?.to) params.append('to', timeRange.to);
     params.append('vehicle_id', vehicleId);
-    params.append('sort', 'asc');
-    params.append('limit', '0');
-    const response = await this.api.get(`/api/telemetry?${params.toString()}`);
-    return response.data || [];
+    params.append('sort', 'timestamp');
+    params.append('page_size', '1000');
+    return this.getAllPages<Telemetry>('/api/v1/telemetry', params);
   }
 
   async postTelemetry(telemetry: Omit<Telemetry, 'id'>): Promise<void> {
-    await this.api.post('/api/telemetry', telemetry);
+    await this.api.post('/api/v1/telemetry', telemetry);
   }
 
   // Metrics endpoints
@@ -82,14 +93,14 @@ class ApiService {
     if (timeRange?.from) params.append('from', timeRange.from);
     if (timeRange?.to) params.append('to', timeRange.to);
 
-    const response = await this.api.get(`/api/telemetry/metrics?${params.toString()}`);
+    const response = await this.api.get(`/api/v1/telemetry/metrics?${params.toString()}`);
     return response.data || { total_emissions: 0, ev_percent: 0, total_records: 0 };
   }
 
   async getAdvancedMetrics(timeRange?: TimeRange): Promise<any> {
     const params = new URLSearchParams();
     if (timeRange?.from) params.append('from', timeRange.from);
-    const response = await this.api.get(`/api/telemetry/metrics/advanced?${params.toString()}`);
+    const response = await this.api.get(`/api/v1/telemetry/metrics/advanced?${params.toString()}`);
     return response.data || {};
   }
 
@@ -99,8 +110,7 @@ class ApiService {
     if (timeRange?.from) params.append('from', timeRange.from);
     if (timeRange?.to) params.append('to', timeRange.to);
     
-    const response = await this.api.get(`/api/vehicles?${params.toString()}`);
-    return response.data || [];
+    return this.getAllPages<Vehicle>('/api/v1/vehicles', params);
   }
 
   // Alerts
@@ -108,114 +118,117 @@ class ApiService {
     const params = new URLSearchParams();
     if (timeRange?.from) params.append('from', timeRange.from);
     if (timeRange?.to) params.append('to', timeRange.to);
-    const response = await this.api.get(`/api/alerts?${params.toString()}`);
+    const response = await this.api.get(`/api/v1/alerts?${params.toString()}`);
     return response.data || [];
   }
 
   async createVehicle(vehicle: Omit<Vehicle, 'id'>): Promise<{ id: string; message: string }> {
-    const response = await this.api.post('/api/vehicles', vehicle);
+    const response = await this.api.post('/api/v1/vehicles', vehicle);
     return response.data;
   }
 
-  async updateVehicle(id: string, vehicle: Partial<Vehicle>): Promise<{ id: string; message: string }> {
-    const response = await this.api.put(`/api/vehicles/${id}`, vehicle);
+  async updateVehicle(id: string, vehicle: Omit<Vehicle, 'id'>): Promise<Vehicle> {
+    const response = await this.api.put(`/api/v1/vehicles/${id}`, vehicle);
     return response.data;
   }
 
   async deleteVehicle(id: string): Promise<{ id: string; message: string }> {
-    const response = await this.api.delete(`/api/vehicles/${id}`);
+    const response = await this.api.delete(`/api/v1/vehicles/${id}`);
     return response.data;
   }
 
   // Trip methods
   async getTrips(timeRange?: TimeRange): Promise<Trip[]> {
-    const params = timeRange ? { from: timeRange.from, to: timeRange.to } : {};
-    const response = await this.api.get('/api/trips', { params });
-    return response.data || [];
+    const params = new URLSearchParams();
+    if (timeRange?.from) params.append('from', timeRange.from);
+    if (timeRange?.to) params.append('to', timeRange.to);
+    return this.getAllPages<Trip>('/api/v1/trips', params);
   }
 
   async postTrip(trip: Omit<Trip, 'id'>): Promise<{ id: string; message: string }> {
-    const response = await this.api.post('/api/trips', trip);
+    const response = await this.api.post('/api/v1/trips', trip);
     return response.data;
   }
 
   async updateTrip(id: string, trip: Partial<Trip>): Promise<{ id: string; message: string }> {
-    const response = await this.api.put(`/api/trips/${id}`, trip);
+    const response = await this.api.put(`/api/v1/trips/${id}`, trip);
     return response.data;
   }
 
   async deleteTrip(id: string): Promise<{ id: string; message: string }> {
-    const response = await this.api.delete(`/api/trips/${id}`);
+    const response = await this.api.delete(`/api/v1/trips/${id}`);
     return response.data;
   }
 
   // Maintenance methods
   async getMaintenance(timeRange?: TimeRange): Promise<Maintenance[]> {
-    const params = timeRange ? { from: timeRange.from, to: timeRange.to } : {};
-    const response = await this.api.get('/api/maintenance', { params });
-    return response.data || [];
+    const params = new URLSearchParams();
+    if (timeRange?.from) params.append('from', timeRange.from);
+    if (timeRange?.to) params.append('to', timeRange.to);
+    return this.getAllPages<Maintenance>('/api/v1/maintenance', params);
   }
 
   async postMaintenance(maintenance: Omit<Maintenance, 'id'>): Promise<{ id: string; message: string }> {
-    const response = await this.api.post('/api/maintenance', maintenance);
+    const response = await this.api.post('/api/v1/maintenance', maintenance);
     return response.data;
   }
 
   async updateMaintenance(id: string, maintenance: Partial<Maintenance>): Promise<{ id: string; message: string }> {
-    const response = await this.api.put(`/api/maintenance/${id}`, maintenance);
+    const response = await this.api.put(`/api/v1/maintenance/${id}`, maintenance);
     return response.data;
   }
 
   async deleteMaintenance(id: string): Promise<{ id: string; message: string }> {
-    const response = await this.api.delete(`/api/maintenance/${id}`);
+    const response = await this.api.delete(`/api/v1/maintenance/${id}`);
     return response.data;
   }
 
   // Cost methods
   async getCosts(timeRange?: TimeRange): Promise<Cost[]> {
-    const params = timeRange ? { from: timeRange.from, to: timeRange.to } : {};
-    const response = await this.api.get('/api/costs', { params });
-    return response.data || [];
+    const params = new URLSearchParams();
+    if (timeRange?.from) params.append('from', timeRange.from);
+    if (timeRange?.to) params.append('to', timeRange.to);
+    return this.getAllPages<Cost>('/api/v1/costs', params);
   }
 
   async postCost(cost: Omit<Cost, 'id'>): Promise<{ id: string; message: string }> {
-    const response = await this.api.post('/api/costs', cost);
+    const response = await this.api.post('/api/v1/costs', cost);
     return response.data;
   }
 
   async updateCost(id: string, cost: Partial<Cost>): Promise<{ id: string; message: string }> {
-    const response = await this.api.put(`/api/costs/${id}`, cost);
+    const response = await this.api.put(`/api/v1/costs/${id}`, cost);
     return response.data;
   }
 
   async deleteCost(id: string): Promise<{ id: string; message: string }> {
-    const response = await this.api.delete(`/api/costs/${id}`);
+    const response = await this.api.delete(`/api/v1/costs/${id}`);
     return response.data;
   }
 
   // Authentication
   async login(username: string, password: string): Promise<{ token: string; user: any }> {
-    const response = await this.api.post('/api/auth/login', { username, password });
+    const response = await this.api.post('/api/v1/auth/login', { username, password });
     return response.data;
   }
 
   async register(userData: any): Promise<{ token: string; user: any }> {
-    const response = await this.api.post('/api/auth/register', userData);
+    const response = await this.api.post('/api/v1/auth/register', userData);
     return response.data;
   }
 
   async getProfile(): Promise<any> {
-    const response = await this.api.get('/api/auth/profile');
+    const response = await this.api.get('/api/v1/auth/profile');
     return response.data;
   }
 
   async updateProfile(profileData: any): Promise<any> {
-    const response = await this.api.put('/api/auth/profile', profileData);
+    const response = await this.api.put('/api/v1/auth/profile', profileData);
     return response.data;
   }
 
   async changePassword(currentPassword: string, newPassword: string): Promise<any> {
-    const response = await this.api.post('/api/auth/change-password', {
+    const response = await this.api.post('/api/v1/auth/change-password', {
       current_password: currentPassword,
       new_password: newPassword,
     });
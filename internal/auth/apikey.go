@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// apiKeyPrefix marks API keys so they are recognisable in configs and secret scanners
+const apiKeyPrefix = "fsk"
+
+// GenerateAPIKey returns a new API key of the form fsk_<prefix>_<secret>
+// together with its lookup prefix and the hash of the key to store
+func (s *Service) GenerateAPIKey() (string, string, string, error) {
+	prefixBytes := make([]byte, 6)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	prefix := hex.EncodeToString(prefixBytes)
+	key := apiKeyPrefix + "_" + prefix + "_" + base64.RawURLEncoding.EncodeToString(secretBytes)
+	return key, prefix, s.HashAPIKey(key), nil
+}
+
+// ParseAPIKey returns the lookup prefix of an API key
+func (s *Service) ParseAPIKey(key string) (string, error) {
+	parts := strings.SplitN(strings.TrimSpace(key), "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || len(parts[1]) != 12 || parts[2] == "" {
+		return "", ErrInvalidAPIKey
+	}
+	return parts[1], nil
+}
+
+// HashAPIKey returns the hex SHA-256 digest under which an API key is stored
+func (s *Service) HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(key)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService_APIKey(t *testing.T) {
+	service, _ := NewService()
+
+	key, prefix, hash, err := service.GenerateAPIKey()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, "fsk_"+prefix+"_"), key)
+	assert.NotContains(t, hash, key)
+	assert.Equal(t, hash, service.HashAPIKey(key))
+
+	parsed, err := service.ParseAPIKey(key)
+	assert.NoError(t, err)
+	assert.Equal(t, prefix, parsed)
+
+	other, otherPrefix, _, _ := service.GenerateAPIKey()
+	assert.NotEqual(t, key, other)
+	assert.NotEqual(t, prefix, otherPrefix)
+
+	for _, invalid := range []string{"", "fsk_", "fsk_abc_secret", "xyz_" + prefix + "_secret", "fsk_" + prefix + "_"} {
+		_, err := service.ParseAPIKey(invalid)
+		assert.ErrorIs(t, err, ErrInvalidAPIKey, invalid)
+	}
+}
@@ -2,7 +2,9 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
@@ -25,19 +27,78 @@ var (
 	ErrUserNotFound       = errors.New("user not found")
 	// ErrUserInactive indicates the user account is inactive.
 	ErrUserInactive       = errors.New("user is inactive")
+	// ErrInvalidInvite indicates the invitation token is malformed, expired or not an invite.
+	ErrInvalidInvite      = errors.New("invalid invitation")
+	// ErrInvalidEmailChange indicates the email verification token is malformed, expired or of the wrong type.
+	ErrInvalidEmailChange = errors.New("invalid email verification token")
+	// ErrInvalidPasswordReset indicates the password reset token is malformed, expired or of the wrong type.
+	ErrInvalidPasswordReset = errors.New("invalid password reset token")
+	// ErrInvalidMFAChallenge indicates the MFA challenge token is malformed, expired or of the wrong type.
+	ErrInvalidMFAChallenge = errors.New("invalid MFA challenge")
+	// ErrInvalidAPIKey indicates the API key is not in the fsk_<prefix>_<secret> format.
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrInvalidOIDCState indicates the single sign-on state token is malformed, expired or of the wrong type.
+	ErrInvalidOIDCState = errors.New("invalid single sign-on state")
+	// ErrOIDCAccessDenied indicates no OIDC rule grants the identity provider account a role and tenant.
+	ErrOIDCAccessDenied = errors.New("no single sign-on rule matches the account")
+)
+
+// Token types carried in the "typ" claim. Access tokens predate the claim and
+// may omit it; every other signed token must set it so it cannot be replayed
+// as an access token.
+const (
+	tokenTypeAccess        = "access"
+	tokenTypeInvite        = "invite"
+	tokenTypeEmailChange   = "email_change"
+	tokenTypePasswordReset = "password_reset"
+	tokenTypeMFAChallenge  = "mfa_challenge"
+	tokenTypeOIDCState     = "oidc_state"
+)
+
+// RegistrationMode controls who may create accounts via /api/v1/auth/register.
+type RegistrationMode string
+
+const (
+	// RegistrationInvite only allows sign-up with an invitation issued by a tenant admin.
+	RegistrationInvite RegistrationMode = "invite"
+	// RegistrationOpen additionally lets anyone sign up; each sign-up creates a new tenant.
+	RegistrationOpen RegistrationMode = "open"
 )
 
 // Service handles authentication operations
 type Service struct {
-	jwtSecret []byte
-	tokenExp  time.Duration
+	keys             *KeyRing
+	legacySecret     []byte
+	keyRotation      time.Duration
+	tokenExp         time.Duration
+	refreshExp       time.Duration
+	inviteExp        time.Duration
+	emailChangeExp   time.Duration
+	passwordResetExp time.Duration
+	mfaChallengeExp  time.Duration
+	mfaIssuer        string
+	registrationMode RegistrationMode
+	passwordPolicy   PasswordPolicy
+	// breachedPasswords is nil unless PASSWORD_BREACHED_FILE is set
+	breachedPasswords BreachedPasswords
 }
 
-// NewService creates a new authentication service
+// NewService creates a new authentication service. Tokens are signed with
+// the asymmetric keys in JWT_KEYS_DIR; outside development mode
+// (APP_ENV=development) the service refuses to start without them.
 func NewService() (*Service, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "default-secret-key-change-in-production"
+	keys, err := keyRingFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	var keyRotation time.Duration // disabled by default
+	if v := os.Getenv("JWT_KEY_ROTATION"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid JWT_KEY_ROTATION %q", v)
+		}
+		keyRotation = parsed
 	}
 
 	expStr := os.Getenv("JWT_EXPIRY")
@@ -48,9 +109,74 @@ func NewService() (*Service, error) {
 		}
 	}
 
+	refreshExp := 30 * 24 * time.Hour // default 30 days
+	if v := os.Getenv("JWT_REFRESH_EXPIRY"); v != "" {
+		if parsed, err := time.ParseDuration(v); err == nil {
+			refreshExp = parsed
+		}
+	}
+
+	inviteExp := 7 * 24 * time.Hour // default 7 days
+	if v := os.Getenv("INVITE_EXPIRY"); v != "" {
+		if parsed, err := time.ParseDuration(v); err == nil {
+			inviteExp = parsed
+		}
+	}
+
+	emailChangeExp := 24 * time.Hour // default 24 hours
+	if v := os.Getenv("EMAIL_VERIFICATION_EXPIRY"); v != "" {
+		if parsed, err := time.ParseDuration(v); err == nil {
+			emailChangeExp = parsed
+		}
+	}
+
+	passwordResetExp := time.Hour // default 1 hour
+	if v := os.Getenv("PASSWORD_RESET_EXPIRY"); v != "" {
+		if parsed, err := time.ParseDuration(v); err == nil {
+			passwordResetExp = parsed
+		}
+	}
+
+	mfaChallengeExp := 5 * time.Minute // default 5 minutes
+	if v := os.Getenv("MFA_CHALLENGE_EXPIRY"); v != "" {
+		if parsed, err := time.ParseDuration(v); err == nil {
+			mfaChallengeExp = parsed
+		}
+	}
+
+	mfaIssuer := os.Getenv("MFA_ISSUER")
+	if mfaIssuer == "" {
+		mfaIssuer = "Fleet Sustainability"
+	}
+
+	mode := RegistrationInvite
+	if strings.ToLower(os.Getenv("REGISTRATION_MODE")) == string(RegistrationOpen) {
+		mode = RegistrationOpen
+	}
+
+	var breached BreachedPasswords
+	if path := os.Getenv("PASSWORD_BREACHED_FILE"); path != "" {
+		file, err := NewHashPrefixFile(path)
+		if err != nil {
+			return nil, err
+		}
+		breached = file
+	}
+
 	return &Service{
-		jwtSecret: []byte(secret),
-		tokenExp:  exp,
+		keys:             keys,
+		legacySecret:     []byte(os.Getenv("JWT_SECRET")),
+		keyRotation:      keyRotation,
+		tokenExp:         exp,
+		refreshExp:       refreshExp,
+		inviteExp:        inviteExp,
+		emailChangeExp:   emailChangeExp,
+		passwordResetExp: passwordResetExp,
+		mfaChallengeExp:  mfaChallengeExp,
+		mfaIssuer:        mfaIssuer,
+		registrationMode: mode,
+		passwordPolicy:   PasswordPolicyFromEnv(),
+		breachedPasswords: breached,
 	}, nil
 }
 
@@ -71,7 +197,14 @@ func (s *Service) CheckPassword(password, hash string) bool {
 
 // GenerateToken generates a JWT token for a user
 func (s *Service) GenerateToken(user *models.User) (string, error) {
+	jti, err := generateTokenID()
+	if err != nil {
+		return "", err
+	}
+
 	claims := jwt.MapClaims{
+		"typ":      tokenTypeAccess,
+		"jti":      jti,
 		"user_id":  user.ID.Hex(),
 		"username": user.Username,
 		"role":     string(user.Role),
@@ -80,8 +213,7 @@ func (s *Service) GenerateToken(user *models.User) (string, error) {
 		"iat":      time.Now().Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.jwtSecret)
+	return s.sign(claims)
 }
 
 // GenerateRefreshToken generates a refresh token
@@ -93,17 +225,46 @@ func (s *Service) GenerateRefreshToken() (string, error) {
 	return base64.URLEncoding.EncodeToString(bytes), nil
 }
 
+// generateTokenID returns a random identifier for the jti claim
+func generateTokenID() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// TokenExpiry returns how long an access token stays valid
+func (s *Service) TokenExpiry() time.Duration {
+	return s.tokenExp
+}
+
+// GenerateTemporaryPassword generates a random password for admin-initiated resets
+func (s *Service) GenerateTemporaryPassword() (string, error) {
+	bytes := make([]byte, 12)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate temporary password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// HashRefreshToken returns the hex SHA-256 digest under which a refresh token is stored
+func (s *Service) HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RefreshTokenExpiry returns how long a refresh token stays valid
+func (s *Service) RefreshTokenExpiry() time.Duration {
+	return s.refreshExp
+}
+
 // ValidateToken validates a JWT token and returns the claims
 func (s *Service) ValidateToken(tokenString string) (*models.Claims, error) {
 	// Remove "Bearer " prefix if present
 	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.jwtSecret, nil
-	})
+	token, err := jwt.Parse(tokenString, s.verificationKey)
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -120,6 +281,9 @@ func (s *Service) ValidateToken(tokenString string) (*models.Claims, error) {
 	if !ok {
 		return nil, ErrInvalidToken
 	}
+	if typ, _ := claims["typ"].(string); typ != "" && typ != tokenTypeAccess {
+		return nil, ErrInvalidToken
+	}
 
 	// Extract claims
 	userID, ok := claims["user_id"].(string)
@@ -143,16 +307,171 @@ func (s *Service) ValidateToken(tokenString string) (*models.Claims, error) {
 	}
 
     tenantID, _ := claims["tenant_id"].(string)
+	// Tokens issued before revocation support carry no jti; they can still be
+	// revoked through the per-user cutoff.
+	jti, _ := claims["jti"].(string)
+	iat, _ := claims["iat"].(float64)
 
     return &models.Claims{
         UserID:   userID,
         Username: username,
         Role:     models.Role(roleStr),
         TenantID: tenantID,
+		JTI:      jti,
+		IssuedAt: int64(iat),
         Exp:      int64(exp),
     }, nil
 }
 
+// RegistrationMode returns the configured self-registration mode
+func (s *Service) RegistrationMode() RegistrationMode {
+	return s.registrationMode
+}
+
+// GenerateInviteToken signs an invitation binding a new user to a tenant and role
+func (s *Service) GenerateInviteToken(invite models.InviteClaims) (string, time.Time, error) {
+	expiresAt := time.Now().Add(s.inviteExp)
+	signed, err := s.signTypedToken(tokenTypeInvite, expiresAt, jwt.MapClaims{
+		"tenant_id":  invite.TenantID,
+		"role":       string(invite.Role),
+		"email":      invite.Email,
+		"invited_by": invite.InvitedBy,
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// ValidateInviteToken validates an invitation token and returns its claims
+func (s *Service) ValidateInviteToken(tokenString string) (*models.InviteClaims, error) {
+	claims, err := s.parseTypedToken(tokenString, tokenTypeInvite)
+	if err != nil {
+		return nil, ErrInvalidInvite
+	}
+
+	tenantID, _ := claims["tenant_id"].(string)
+	roleStr, _ := claims["role"].(string)
+	email, _ := claims["email"].(string)
+	invitedBy, _ := claims["invited_by"].(string)
+	exp, _ := claims["exp"].(float64)
+	if tenantID == "" || email == "" || !models.IsValidRole(models.Role(roleStr)) {
+		return nil, ErrInvalidInvite
+	}
+
+	return &models.InviteClaims{
+		TenantID:  tenantID,
+		Role:      models.Role(roleStr),
+		Email:     email,
+		InvitedBy: invitedBy,
+		Exp:       int64(exp),
+	}, nil
+}
+
+// GenerateEmailChangeToken signs a token confirming that the user owns the new email address
+func (s *Service) GenerateEmailChangeToken(change models.EmailChangeClaims) (string, time.Time, error) {
+	expiresAt := time.Now().Add(s.emailChangeExp)
+	signed, err := s.signTypedToken(tokenTypeEmailChange, expiresAt, jwt.MapClaims{
+		"user_id":   change.UserID,
+		"old_email": change.OldEmail,
+		"new_email": change.NewEmail,
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// ValidateEmailChangeToken validates an email verification token and returns its claims
+func (s *Service) ValidateEmailChangeToken(tokenString string) (*models.EmailChangeClaims, error) {
+	claims, err := s.parseTypedToken(tokenString, tokenTypeEmailChange)
+	if err != nil {
+		return nil, ErrInvalidEmailChange
+	}
+
+	userID, _ := claims["user_id"].(string)
+	oldEmail, _ := claims["old_email"].(string)
+	newEmail, _ := claims["new_email"].(string)
+	exp, _ := claims["exp"].(float64)
+	if userID == "" || newEmail == "" {
+		return nil, ErrInvalidEmailChange
+	}
+
+	return &models.EmailChangeClaims{
+		UserID:   userID,
+		OldEmail: oldEmail,
+		NewEmail: newEmail,
+		Exp:      int64(exp),
+	}, nil
+}
+
+// GeneratePasswordResetToken signs a password reset token for the user. The
+// token is bound to the current password hash, so it stops working once the
+// password has been changed.
+func (s *Service) GeneratePasswordResetToken(user *models.User) (string, time.Time, error) {
+	expiresAt := time.Now().Add(s.passwordResetExp)
+	signed, err := s.signTypedToken(tokenTypePasswordReset, expiresAt, jwt.MapClaims{
+		"user_id": user.ID.Hex(),
+		"pwd":     s.PasswordFingerprint(user.PasswordHash),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// ValidatePasswordResetToken validates a password reset token and returns its claims
+func (s *Service) ValidatePasswordResetToken(tokenString string) (*models.PasswordResetClaims, error) {
+	claims, err := s.parseTypedToken(tokenString, tokenTypePasswordReset)
+	if err != nil {
+		return nil, ErrInvalidPasswordReset
+	}
+
+	userID, _ := claims["user_id"].(string)
+	fingerprint, _ := claims["pwd"].(string)
+	exp, _ := claims["exp"].(float64)
+	if userID == "" || fingerprint == "" {
+		return nil, ErrInvalidPasswordReset
+	}
+
+	return &models.PasswordResetClaims{
+		UserID:              userID,
+		PasswordFingerprint: fingerprint,
+		Exp:                 int64(exp),
+	}, nil
+}
+
+// PasswordFingerprint returns a short digest of a password hash for binding single-use tokens to it
+func (s *Service) PasswordFingerprint(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:8])
+}
+
+// signTypedToken signs claims of the given token type expiring at expiresAt
+func (s *Service) signTypedToken(typ string, expiresAt time.Time, claims jwt.MapClaims) (string, error) {
+	claims["typ"] = typ
+	claims["exp"] = expiresAt.Unix()
+	claims["iat"] = time.Now().Unix()
+	return s.sign(claims)
+}
+
+// parseTypedToken verifies a signed token and checks that it has the given type
+func (s *Service) parseTypedToken(tokenString, typ string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, s.verificationKey)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	if claimTyp, _ := claims["typ"].(string); claimTyp != typ {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
 // ExtractTokenFromHeader extracts token from Authorization header
 func (s *Service) ExtractTokenFromHeader(authHeader string) (string, error) {
 	if authHeader == "" {
@@ -167,22 +486,6 @@ func (s *Service) ExtractTokenFromHeader(authHeader string) (string, error) {
 	return parts[1], nil
 }
 
-// ValidatePassword validates password strength
-func (s *Service) ValidatePassword(password string) error {
-	if len(password) < 8 {
-		return errors.New("password must be at least 8 characters long")
-	}
-	return nil
-}
-
-// ValidateEmail validates email format
-func (s *Service) ValidateEmail(email string) error {
-	if !strings.Contains(email, "@") || !strings.Contains(email, ".") {
-		return errors.New("invalid email format")
-	}
-	return nil
-}
-
 // ValidateUsername validates username format
 func (s *Service) ValidateUsername(username string) error {
 	if len(username) < 3 {
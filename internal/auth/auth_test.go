@@ -13,7 +13,7 @@ func TestNewService(t *testing.T) {
 	service, err := NewService()
 	assert.NoError(t, err)
 	assert.NotNil(t, service)
-	assert.NotEmpty(t, service.jwtSecret)
+	assert.NotNil(t, service.keys.SigningKey(time.Now()))
 	assert.Equal(t, 24*time.Hour, service.tokenExp)
 }
 
@@ -55,6 +55,28 @@ func TestService_GenerateToken(t *testing.T) {
 	assert.NotEmpty(t, token)
 }
 
+func TestService_GenerateToken_UniqueJTI(t *testing.T) {
+	service, _ := NewService()
+
+	user := &models.User{
+		ID:       primitive.NewObjectID(),
+		Username: "testuser",
+		Role:     models.RoleAdmin,
+	}
+
+	first, _ := service.GenerateToken(user)
+	second, _ := service.GenerateToken(user)
+
+	firstClaims, err := service.ValidateToken(first)
+	assert.NoError(t, err)
+	secondClaims, err := service.ValidateToken(second)
+	assert.NoError(t, err)
+
+	assert.NotEmpty(t, firstClaims.JTI)
+	assert.NotEqual(t, firstClaims.JTI, secondClaims.JTI)
+	assert.NotZero(t, firstClaims.IssuedAt)
+}
+
 func TestService_ValidateToken(t *testing.T) {
 	service, _ := NewService()
 
@@ -120,7 +142,7 @@ func TestService_ValidatePassword(t *testing.T) {
 	// Test too short password
 	err = service.ValidatePassword("short")
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "at least 8 characters")
+	assert.Contains(t, err.Error(), "at least 10 characters")
 }
 
 func TestService_ValidateEmail(t *testing.T) {
@@ -177,6 +199,29 @@ func TestService_GenerateRefreshToken(t *testing.T) {
 	assert.Len(t, token, 44) // base64 encoded 32 bytes (32 * 4/3 = 42.67, rounded up to 44)
 }
 
+func TestService_HashRefreshToken(t *testing.T) {
+	service, _ := NewService()
+
+	token, _ := service.GenerateRefreshToken()
+	hash := service.HashRefreshToken(token)
+	assert.Len(t, hash, 64)
+	assert.NotEqual(t, token, hash)
+	assert.Equal(t, hash, service.HashRefreshToken(token))
+
+	other, _ := service.GenerateRefreshToken()
+	assert.NotEqual(t, hash, service.HashRefreshToken(other))
+}
+
+func TestService_RefreshTokenExpiry(t *testing.T) {
+	t.Setenv("JWT_REFRESH_EXPIRY", "")
+	service, _ := NewService()
+	assert.Equal(t, 30*24*time.Hour, service.RefreshTokenExpiry())
+
+	t.Setenv("JWT_REFRESH_EXPIRY", "72h")
+	service, _ = NewService()
+	assert.Equal(t, 72*time.Hour, service.RefreshTokenExpiry())
+}
+
 func TestService_TokenExpiration(t *testing.T) {
 	service, _ := NewService()
 
@@ -198,3 +243,88 @@ func TestService_TokenExpiration(t *testing.T) {
 	assert.Greater(t, claims.Exp, now)
 	assert.LessOrEqual(t, claims.Exp, now+int64(service.tokenExp.Seconds())+1)
 }
+
+func TestService_InviteToken(t *testing.T) {
+	service, _ := NewService()
+
+	token, expiresAt, err := service.GenerateInviteToken(models.InviteClaims{
+		TenantID:  "tenant-a",
+		Role:      models.RoleViewer,
+		Email:     "invitee@example.com",
+		InvitedBy: "admin-id",
+	})
+	assert.NoError(t, err)
+	assert.True(t, expiresAt.After(time.Now()))
+
+	claims, err := service.ValidateInviteToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "tenant-a", claims.TenantID)
+	assert.Equal(t, models.RoleViewer, claims.Role)
+	assert.Equal(t, "invitee@example.com", claims.Email)
+
+	// An invitation must never be accepted as an access token, nor vice versa
+	_, err = service.ValidateToken(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	accessToken, _ := service.GenerateToken(&models.User{ID: primitive.NewObjectID(), Username: "u", Role: models.RoleAdmin})
+	_, err = service.ValidateInviteToken(accessToken)
+	assert.ErrorIs(t, err, ErrInvalidInvite)
+
+	_, err = service.ValidateInviteToken(token + "x")
+	assert.ErrorIs(t, err, ErrInvalidInvite)
+}
+
+func TestService_EmailChangeToken(t *testing.T) {
+	service, _ := NewService()
+
+	token, expiresAt, err := service.GenerateEmailChangeToken(models.EmailChangeClaims{
+		UserID:   "user-id",
+		OldEmail: "old@example.com",
+		NewEmail: "new@example.com",
+	})
+	assert.NoError(t, err)
+	assert.True(t, expiresAt.After(time.Now()))
+
+	claims, err := service.ValidateEmailChangeToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-id", claims.UserID)
+	assert.Equal(t, "old@example.com", claims.OldEmail)
+	assert.Equal(t, "new@example.com", claims.NewEmail)
+
+	_, err = service.ValidateToken(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	invite, _, _ := service.GenerateInviteToken(models.InviteClaims{TenantID: "t", Role: models.RoleViewer, Email: "new@example.com"})
+	_, err = service.ValidateEmailChangeToken(invite)
+	assert.ErrorIs(t, err, ErrInvalidEmailChange)
+}
+
+func TestService_PasswordResetToken(t *testing.T) {
+	service, _ := NewService()
+	user := &models.User{ID: primitive.NewObjectID(), PasswordHash: "hash-1"}
+
+	token, _, err := service.GeneratePasswordResetToken(user)
+	assert.NoError(t, err)
+
+	claims, err := service.ValidatePasswordResetToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID.Hex(), claims.UserID)
+	assert.Equal(t, service.PasswordFingerprint("hash-1"), claims.PasswordFingerprint)
+	assert.NotEqual(t, service.PasswordFingerprint("hash-2"), claims.PasswordFingerprint)
+
+	_, err = service.ValidateToken(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = service.ValidatePasswordResetToken(token + "x")
+	assert.ErrorIs(t, err, ErrInvalidPasswordReset)
+}
+
+func TestService_RegistrationMode(t *testing.T) {
+	t.Setenv("REGISTRATION_MODE", "")
+	service, _ := NewService()
+	assert.Equal(t, RegistrationInvite, service.RegistrationMode())
+
+	t.Setenv("REGISTRATION_MODE", "open")
+	service, _ = NewService()
+	assert.Equal(t, RegistrationOpen, service.RegistrationMode())
+}
@@ -0,0 +1,421 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported asymmetric signing algorithms
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// keyPropagationDelay is how long a new key is only published before it is
+// used for signing, so every instance sharing the key directory has loaded it
+// and services caching the JWKS document have refreshed it
+const keyPropagationDelay = 10 * time.Minute
+
+// ErrNoSigningKey is returned when no signing key is configured outside development mode.
+var ErrNoSigningKey = errors.New("no JWT signing key configured: set JWT_KEYS_DIR or APP_ENV=development")
+
+// SigningKey is a private key used to sign tokens, identified by its kid
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+	private   crypto.Signer
+}
+
+// method returns the JWT signing method for the key
+func (k *SigningKey) method() jwt.SigningMethod {
+	if k.Algorithm == AlgorithmEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKSet is the document published at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeyRing holds the keys tokens are signed and verified with. Keys live as
+// PKCS#8 PEM files named <kid>.pem in a directory that may be shared by
+// several instances; without a directory they are kept in memory only.
+type KeyRing struct {
+	mu        sync.RWMutex
+	dir       string
+	algorithm string
+	keys      map[string]*SigningKey
+}
+
+// NewKeyRing loads the keys in dir, or starts an empty in-memory ring when dir is empty
+func NewKeyRing(dir, algorithm string) (*KeyRing, error) {
+	if algorithm != AlgorithmRS256 && algorithm != AlgorithmEdDSA {
+		return nil, fmt.Errorf("unsupported JWT signing algorithm %q", algorithm)
+	}
+	ring := &KeyRing{dir: dir, algorithm: algorithm, keys: make(map[string]*SigningKey)}
+	if dir != "" {
+		if err := ring.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	return ring, nil
+}
+
+// Reload re-reads the key directory so keys rotated by other instances are picked up
+func (r *KeyRing) Reload() error {
+	if r.dir == "" {
+		return nil
+	}
+	paths, err := filepath.Glob(filepath.Join(r.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*SigningKey, len(paths))
+	for _, path := range paths {
+		key, err := loadSigningKey(path)
+		if err != nil {
+			return err
+		}
+		keys[key.ID] = key
+	}
+
+	r.mu.Lock()
+	r.keys = keys
+	r.mu.Unlock()
+	return nil
+}
+
+// Rotate generates a new key with the ring's algorithm and adds it to the ring
+func (r *KeyRing) Rotate(now time.Time) (*SigningKey, error) {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("failed to generate key id: %w", err)
+	}
+	key := &SigningKey{
+		ID:        now.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix),
+		Algorithm: r.algorithm,
+		CreatedAt: now,
+	}
+
+	var err error
+	if r.algorithm == AlgorithmEdDSA {
+		_, key.private, err = ed25519.GenerateKey(rand.Reader)
+	} else {
+		key.private, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	if r.dir != "" {
+		if err := writeSigningKey(r.dir, key); err != nil {
+			return nil, err
+		}
+	}
+
+	r.mu.Lock()
+	r.keys[key.ID] = key
+	r.mu.Unlock()
+	return key, nil
+}
+
+// Prune drops keys that were superseded by a newer key created before cutoff.
+// The newest key is always kept.
+func (r *KeyRing) Prune(cutoff time.Time) error {
+	keys := r.sorted()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := 1; i < len(keys); i++ {
+		if !keys[i-1].CreatedAt.Before(cutoff) {
+			continue
+		}
+		id := keys[i].ID
+		if r.dir != "" {
+			if err := os.Remove(filepath.Join(r.dir, id+".pem")); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		delete(r.keys, id)
+	}
+	return nil
+}
+
+// SigningKey returns the key new tokens are signed with: the newest key that
+// has been published for keyPropagationDelay, or the newest key if none has
+func (r *KeyRing) SigningKey(now time.Time) *SigningKey {
+	keys := r.sorted()
+	if len(keys) == 0 {
+		return nil
+	}
+	for _, key := range keys {
+		if !key.CreatedAt.After(now.Add(-keyPropagationDelay)) {
+			return key
+		}
+	}
+	return keys[0]
+}
+
+// Newest returns the most recently created key
+func (r *KeyRing) Newest() *SigningKey {
+	keys := r.sorted()
+	if len(keys) == 0 {
+		return nil
+	}
+	return keys[0]
+}
+
+// Lookup returns the key with the given kid
+func (r *KeyRing) Lookup(kid string) (*SigningKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.keys[kid]
+	return key, ok
+}
+
+// JWKS returns the public keys of the ring, newest first
+func (r *KeyRing) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range r.sorted() {
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Algorithm}
+		switch pub := key.private.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// sorted returns the keys newest first
+func (r *KeyRing) sorted() []*SigningKey {
+	r.mu.RLock()
+	keys := make([]*SigningKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].ID > keys[j].ID
+		}
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// loadSigningKey reads a PKCS#8 PEM private key; its kid is the file name and
+// its creation time the file's modification time
+func loadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key %s: %w", path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key %s: %w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s is not PEM encoded", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+	}
+
+	key := &SigningKey{
+		ID:        strings.TrimSuffix(filepath.Base(path), ".pem"),
+		CreatedAt: info.ModTime(),
+	}
+	switch private := parsed.(type) {
+	case ed25519.PrivateKey:
+		key.Algorithm = AlgorithmEdDSA
+		key.private = private
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA signing key %s must be at least 2048 bits", path)
+		}
+		key.Algorithm = AlgorithmRS256
+		key.private = private
+	default:
+		return nil, fmt.Errorf("signing key %s must be an RSA or Ed25519 key", path)
+	}
+	return key, nil
+}
+
+// writeSigningKey stores a key as <kid>.pem, atomically so other instances never read a partial file
+func writeSigningKey(dir string, key *SigningKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		return fmt.Errorf("failed to encode signing key: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".key-*")
+	if err != nil {
+		return fmt.Errorf("failed to write signing key: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := pem.Encode(tmp, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write signing key: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write signing key: %w", err)
+	}
+	path := filepath.Join(dir, key.ID+".pem")
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write signing key: %w", err)
+	}
+	return os.Chtimes(path, key.CreatedAt, key.CreatedAt)
+}
+
+// KeyReloadInterval is how often callers of RotateKeys should run it; it is
+// well below keyPropagationDelay so every instance sees a key before it signs
+const KeyReloadInterval = time.Minute
+
+// IsDevelopment reports whether APP_ENV selects development mode
+func IsDevelopment() bool {
+	return strings.EqualFold(os.Getenv("APP_ENV"), "development")
+}
+
+// keyRingFromEnv loads the keys in JWT_KEYS_DIR, signing new ones with
+// JWT_SIGNING_ALG (default EdDSA). An empty directory is seeded with a first
+// key; without a directory an in-memory key is only allowed in development.
+func keyRingFromEnv() (*KeyRing, error) {
+	algorithm := os.Getenv("JWT_SIGNING_ALG")
+	if algorithm == "" {
+		algorithm = AlgorithmEdDSA
+	}
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" && !IsDevelopment() {
+		return nil, ErrNoSigningKey
+	}
+
+	ring, err := NewKeyRing(dir, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if ring.Newest() == nil {
+		if _, err := ring.Rotate(time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return ring, nil
+}
+
+// RotateKeys picks up keys added by other instances and, when JWT_KEY_ROTATION
+// is set, adds a new key once the newest is older than the rotation period and
+// drops keys no unexpired token can have been signed with. It returns the new
+// key, if any.
+func (s *Service) RotateKeys(now time.Time) (*SigningKey, error) {
+	if err := s.keys.Reload(); err != nil {
+		return nil, err
+	}
+	if s.keyRotation <= 0 {
+		return nil, nil
+	}
+
+	var rotated *SigningKey
+	if newest := s.keys.Newest(); newest == nil || now.Sub(newest.CreatedAt) >= s.keyRotation {
+		key, err := s.keys.Rotate(now)
+		if err != nil {
+			return nil, err
+		}
+		rotated = key
+	}
+
+	// A superseded key signs until its successor has propagated, and its
+	// tokens must stay verifiable for as long as they can be valid
+	return rotated, s.keys.Prune(now.Add(-keyPropagationDelay - s.maxTokenLifetime()))
+}
+
+// JWKS returns the public keys tokens may be signed with
+func (s *Service) JWKS() JWKSet {
+	return s.keys.JWKS()
+}
+
+// maxTokenLifetime returns the longest lifetime of any signed token type
+func (s *Service) maxTokenLifetime() time.Duration {
+	longest := s.tokenExp
+	for _, exp := range []time.Duration{s.inviteExp, s.emailChangeExp, s.passwordResetExp, s.mfaChallengeExp, oidcStateExp} {
+		if exp > longest {
+			longest = exp
+		}
+	}
+	return longest
+}
+
+// sign signs claims with the current signing key and names it in the kid header
+func (s *Service) sign(claims jwt.MapClaims) (string, error) {
+	key := s.keys.SigningKey(time.Now())
+	if key == nil {
+		return "", ErrNoSigningKey
+	}
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+// verificationKey resolves the public key a token was signed with from its
+// kid header. Tokens without a kid were signed with JWT_SECRET before the
+// switch to asymmetric keys and are only accepted while it is still set.
+func (s *Service) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && len(s.legacySecret) > 0 {
+			return s.legacySecret, nil
+		}
+		return nil, fmt.Errorf("token has no key id")
+	}
+
+	key, ok := s.keys.Lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.method().Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.private.Public(), nil
+}
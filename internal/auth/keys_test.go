@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewService_RequiresSigningKey(t *testing.T) {
+	t.Setenv("APP_ENV", "production")
+	t.Setenv("JWT_KEYS_DIR", "")
+	_, err := NewService()
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+
+	// An empty key directory is seeded with a first key
+	dir := t.TempDir()
+	t.Setenv("JWT_KEYS_DIR", dir)
+	service, err := NewService()
+	assert.NoError(t, err)
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.pem"))
+	assert.Len(t, paths, 1)
+	assert.Len(t, service.JWKS().Keys, 1)
+
+	t.Setenv("JWT_SIGNING_ALG", "HS256")
+	_, err = NewService()
+	assert.Error(t, err)
+
+	t.Setenv("JWT_SIGNING_ALG", "")
+	t.Setenv("JWT_KEY_ROTATION", "soon")
+	_, err = NewService()
+	assert.Error(t, err)
+}
+
+func TestKeyRing_SharedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	first, err := NewKeyRing(dir, AlgorithmEdDSA)
+	assert.NoError(t, err)
+	key, err := first.Rotate(time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+
+	second, err := NewKeyRing(dir, AlgorithmEdDSA)
+	assert.NoError(t, err)
+	loaded, ok := second.Lookup(key.ID)
+	assert.True(t, ok)
+	assert.Equal(t, key.CreatedAt.Unix(), loaded.CreatedAt.Unix())
+	assert.Equal(t, key.private.Public(), loaded.private.Public())
+
+	rotated, err := first.Rotate(time.Now())
+	assert.NoError(t, err)
+	_, ok = second.Lookup(rotated.ID)
+	assert.False(t, ok)
+	assert.NoError(t, second.Reload())
+	_, ok = second.Lookup(rotated.ID)
+	assert.True(t, ok)
+}
+
+func TestKeyRing_SigningKeyPropagation(t *testing.T) {
+	ring, _ := NewKeyRing("", AlgorithmEdDSA)
+	now := time.Now()
+	assert.Nil(t, ring.SigningKey(now))
+
+	// A lone key signs immediately
+	old, _ := ring.Rotate(now.Add(-time.Hour))
+	assert.Equal(t, old.ID, ring.SigningKey(now).ID)
+
+	// A new key is published first and only signs once it has propagated
+	fresh, _ := ring.Rotate(now)
+	assert.Equal(t, fresh.ID, ring.Newest().ID)
+	assert.Equal(t, old.ID, ring.SigningKey(now).ID)
+	assert.Equal(t, fresh.ID, ring.SigningKey(now.Add(keyPropagationDelay)).ID)
+	assert.Len(t, ring.JWKS().Keys, 2)
+}
+
+func TestKeyRing_JWKS(t *testing.T) {
+	ed, _ := NewKeyRing("", AlgorithmEdDSA)
+	edKey, _ := ed.Rotate(time.Now())
+	jwk := ed.JWKS().Keys[0]
+	assert.Equal(t, "OKP", jwk.KeyType)
+	assert.Equal(t, "Ed25519", jwk.Curve)
+	assert.Equal(t, edKey.ID, jwk.KeyID)
+	assert.Equal(t, AlgorithmEdDSA, jwk.Algorithm)
+	assert.Equal(t, "sig", jwk.Use)
+	assert.NotEmpty(t, jwk.X)
+
+	rs, _ := NewKeyRing("", AlgorithmRS256)
+	rs.Rotate(time.Now())
+	jwk = rs.JWKS().Keys[0]
+	assert.Equal(t, "RSA", jwk.KeyType)
+	assert.Equal(t, AlgorithmRS256, jwk.Algorithm)
+	assert.Equal(t, "AQAB", jwk.E)
+	assert.NotEmpty(t, jwk.N)
+
+	_, err := NewKeyRing("", "HS256")
+	assert.Error(t, err)
+}
+
+func TestService_RotateKeys(t *testing.T) {
+	t.Setenv("JWT_KEYS_DIR", t.TempDir())
+	t.Setenv("JWT_KEY_ROTATION", "24h")
+	service, err := NewService()
+	assert.NoError(t, err)
+	user := &models.User{ID: primitive.NewObjectID(), Username: "testuser", Role: models.RoleViewer}
+
+	first := service.keys.Newest()
+	token, _ := service.GenerateToken(user)
+
+	// Nothing to do until the rotation period has passed
+	key, err := service.RotateKeys(time.Now())
+	assert.NoError(t, err)
+	assert.Nil(t, key)
+
+	now := time.Now().Add(25 * time.Hour)
+	key, err = service.RotateKeys(now)
+	assert.NoError(t, err)
+	assert.NotNil(t, key)
+	assert.Equal(t, key.ID, service.keys.SigningKey(now.Add(keyPropagationDelay)).ID)
+
+	// Tokens signed with the previous key stay valid
+	_, err = service.ValidateToken(token)
+	assert.NoError(t, err)
+
+	// Another instance sharing the directory verifies tokens signed with the new key
+	other, _ := NewService()
+	_, ok := other.keys.Lookup(key.ID)
+	assert.True(t, ok)
+
+	// Once no token signed with the previous key can be valid it is dropped
+	later := key.CreatedAt.Add(keyPropagationDelay + service.maxTokenLifetime() + time.Minute)
+	_, err = service.RotateKeys(later)
+	assert.NoError(t, err)
+	_, ok = service.keys.Lookup(first.ID)
+	assert.False(t, ok)
+	_, ok = service.keys.Lookup(key.ID)
+	assert.True(t, ok)
+}
+
+func TestService_ValidateToken_SigningKeys(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	service, _ := NewService()
+	claims := jwt.MapClaims{
+		"user_id":  primitive.NewObjectID().Hex(),
+		"username": "legacy",
+		"role":     string(models.RoleViewer),
+		"exp":      time.Now().Add(time.Hour).Unix(),
+	}
+	legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("old-secret"))
+
+	// Tokens signed with JWT_SECRET are only accepted while it is configured
+	_, err := service.ValidateToken(legacy)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	t.Setenv("JWT_SECRET", "old-secret")
+	service, _ = NewService()
+	_, err = service.ValidateToken(legacy)
+	assert.NoError(t, err)
+
+	// A kid cannot be paired with a different algorithm
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = service.keys.Newest().ID
+	forgedString, _ := forged.SignedString([]byte("old-secret"))
+	_, err = service.ValidateToken(forgedString)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Unknown key ids are rejected
+	unknown := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	unknown.Header["kid"] = "unknown"
+	ring, _ := NewKeyRing("", AlgorithmEdDSA)
+	key, _ := ring.Rotate(time.Now())
+	unknownString, _ := unknown.SignedString(key.private)
+	_, err = service.ValidateToken(unknownString)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
@@ -0,0 +1,492 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+)
+
+// oidcStateExp is how long a user has to complete a single sign-on login at the identity provider
+const oidcStateExp = 10 * time.Minute
+
+// oidcKeyRefreshInterval limits how often an unknown kid triggers a refetch of the provider's keys
+const oidcKeyRefreshInterval = time.Minute
+
+// OIDCRule maps identity provider accounts to a role and tenant. A rule
+// matches when the ID token claim Claim equals Value or, for list claims such
+// as groups, contains it; a rule without a claim matches every account.
+// Tenant may be left empty when OIDC_TENANT_CLAIM supplies it.
+type OIDCRule struct {
+	Claim  string      `json:"claim,omitempty"`
+	Value  string      `json:"value,omitempty"`
+	Role   models.Role `json:"role"`
+	Tenant string      `json:"tenant,omitempty"`
+}
+
+// OIDCConfig configures single sign-on against an OpenID Connect identity provider
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// Rules are evaluated in order; the first match decides role and tenant
+	Rules []OIDCRule
+	// TenantClaim names the claim carrying the tenant for rules without one
+	TenantClaim string
+}
+
+// OIDCConfigFromEnv reads the OIDC_* environment variables. It returns nil
+// when OIDC_ISSUER is unset, i.e. single sign-on is disabled.
+func OIDCConfigFromEnv() (*OIDCConfig, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	config := &OIDCConfig{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+		TenantClaim:  os.Getenv("OIDC_TENANT_CLAIM"),
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	if v := os.Getenv("OIDC_RULES"); v != "" {
+		if err := json.Unmarshal([]byte(v), &config.Rules); err != nil {
+			return nil, fmt.Errorf("invalid OIDC_RULES: %w", err)
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks that the configuration is complete and every rule yields a valid role and a tenant
+func (c *OIDCConfig) Validate() error {
+	if c.ClientID == "" || c.RedirectURL == "" {
+		return errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ISSUER is set")
+	}
+	if len(c.Rules) == 0 {
+		return errors.New("OIDC_RULES must map at least one group or claim to a role")
+	}
+	for i, rule := range c.Rules {
+		if !models.IsValidRole(rule.Role) {
+			return fmt.Errorf("OIDC rule %d has invalid role %q", i, rule.Role)
+		}
+		if rule.Tenant == "" && c.TenantClaim == "" {
+			return fmt.Errorf("OIDC rule %d has no tenant and OIDC_TENANT_CLAIM is not set", i)
+		}
+	}
+	return nil
+}
+
+// MapClaims returns the role and tenant of the first rule matching the ID token claims
+func (c *OIDCConfig) MapClaims(claims map[string]interface{}) (models.Role, string, error) {
+	for _, rule := range c.Rules {
+		if rule.Claim != "" && !claimContains(claims[rule.Claim], rule.Value) {
+			continue
+		}
+		tenant := rule.Tenant
+		if tenant == "" {
+			tenant, _ = claims[c.TenantClaim].(string)
+		}
+		if tenant == "" {
+			return "", "", ErrOIDCAccessDenied
+		}
+		return rule.Role, tenant, nil
+	}
+	return "", "", ErrOIDCAccessDenied
+}
+
+// claimContains reports whether a claim equals value or, for a list claim, contains it
+func claimContains(claim interface{}, value string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == value
+	case bool:
+		return fmt.Sprint(v) == value
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OIDCIdentity is the account an identity provider authenticated, taken from a verified ID token
+type OIDCIdentity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	GivenName         string
+	FamilyName        string
+	Claims            map[string]interface{}
+}
+
+// oidcEndpoints is the part of the provider's discovery document we use
+type oidcEndpoints struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider runs the authorization code flow with PKCE against an
+// OpenID Connect identity provider. Endpoints and signing keys are discovered
+// lazily from the issuer, so the provider may be down when the server starts.
+type OIDCProvider struct {
+	config     OIDCConfig
+	client     *http.Client
+	mu         sync.Mutex
+	endpoints  *oidcEndpoints
+	keys       map[string]crypto.PublicKey
+	keysLoaded time.Time
+}
+
+// NewOIDCProvider creates a provider client; a nil client uses one with a 10 second timeout
+func NewOIDCProvider(config OIDCConfig, client *http.Client) *OIDCProvider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &OIDCProvider{config: config, client: client}
+}
+
+// Config returns the provider configuration
+func (p *OIDCProvider) Config() *OIDCConfig {
+	return &p.config
+}
+
+// AuthCodeURL returns the identity provider URL to send the user to. The
+// code challenge is derived from codeVerifier, which is only sent on exchange.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(endpoints.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return endpoints.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the identity from the
+// verified ID token, which must carry the nonce of the login
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoints.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed with status %d: %s %s", resp.StatusCode, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	return p.verifyIDToken(ctx, tokens.IDToken, nonce)
+}
+
+// verifyIDToken checks the ID token's signature, issuer, audience, expiry and nonce
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, rawToken, nonce string) (*OIDCIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); nonce == "" || tokenNonce != nonce {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+	// With several audiences the token must have been issued to us
+	if audiences, _ := claims.GetAudience(); len(audiences) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.config.ClientID {
+			return nil, errors.New("invalid ID token: unexpected authorized party")
+		}
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("invalid ID token: missing subject")
+	}
+	identity := &OIDCIdentity{
+		Issuer:  p.config.Issuer,
+		Subject: subject,
+		Claims:  claims,
+	}
+	identity.Email, _ = claims["email"].(string)
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+	identity.PreferredUsername, _ = claims["preferred_username"].(string)
+	identity.GivenName, _ = claims["given_name"].(string)
+	identity.FamilyName, _ = claims["family_name"].(string)
+	return identity, nil
+}
+
+// discover fetches and caches the provider's discovery document
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcEndpoints, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.endpoints != nil {
+		return p.endpoints, nil
+	}
+
+	var endpoints oidcEndpoints
+	if err := p.getJSON(ctx, strings.TrimRight(p.config.Issuer, "/")+"/.well-known/openid-configuration", &endpoints); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if endpoints.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("OIDC discovery returned issuer %q, expected %q", endpoints.Issuer, p.config.Issuer)
+	}
+	if endpoints.AuthorizationEndpoint == "" || endpoints.TokenEndpoint == "" || endpoints.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is missing endpoints")
+	}
+	p.endpoints = &endpoints
+	return p.endpoints, nil
+}
+
+// publicKey returns the provider key with the given kid, refetching the
+// provider's key set when the kid is unknown so its key rotations are picked up
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if !p.keysLoaded.IsZero() && time.Since(p.keysLoaded) < oidcKeyRefreshInterval {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	var set struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := p.getJSON(ctx, endpoints.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch provider keys: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.KeyID] = key
+		}
+	}
+	p.keys = keys
+	p.keysLoaded = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// lookupKey finds a cached key; a token without a kid matches a provider's only key
+func (p *OIDCProvider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// getJSON fetches url and decodes its JSON body into v
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// publicKey decodes an RSA, P-256/P-384 EC or Ed25519 JWK
+func (k JWK) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.KeyType {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decode(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
+
+// GenerateOIDCStateToken starts a single sign-on login: it generates the
+// state, nonce and PKCE code verifier and signs them into a token the client
+// keeps until the identity provider redirects back
+func (s *Service) GenerateOIDCStateToken() (string, *models.OIDCStateClaims, error) {
+	values := make([]string, 3)
+	for i := range values {
+		bytes := make([]byte, 32)
+		if _, err := rand.Read(bytes); err != nil {
+			return "", nil, fmt.Errorf("failed to generate login state: %w", err)
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(bytes)
+	}
+
+	expiresAt := time.Now().Add(oidcStateExp)
+	state := &models.OIDCStateClaims{State: values[0], Nonce: values[1], CodeVerifier: values[2], Exp: expiresAt.Unix()}
+	signed, err := s.signTypedToken(tokenTypeOIDCState, expiresAt, jwt.MapClaims{
+		"state":         state.State,
+		"nonce":         state.Nonce,
+		"code_verifier": state.CodeVerifier,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, state, nil
+}
+
+// ValidateOIDCStateToken validates a single sign-on state token and returns its claims
+func (s *Service) ValidateOIDCStateToken(tokenString string) (*models.OIDCStateClaims, error) {
+	claims, err := s.parseTypedToken(tokenString, tokenTypeOIDCState)
+	if err != nil {
+		return nil, ErrInvalidOIDCState
+	}
+
+	state, _ := claims["state"].(string)
+	nonce, _ := claims["nonce"].(string)
+	verifier, _ := claims["code_verifier"].(string)
+	exp, _ := claims["exp"].(float64)
+	if state == "" || nonce == "" || verifier == "" {
+		return nil, ErrInvalidOIDCState
+	}
+
+	return &models.OIDCStateClaims{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		Exp:          int64(exp),
+	}, nil
+}
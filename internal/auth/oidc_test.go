@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/auth/oidctest"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+)
+
+func newTestOIDCProvider(t *testing.T) (*oidctest.Provider, *OIDCProvider) {
+	idp := oidctest.NewProvider("fleet", "s3cret")
+	t.Cleanup(idp.Close)
+	config := OIDCConfig{
+		Issuer:       idp.Issuer(),
+		ClientID:     "fleet",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost:3000/auth/callback",
+		Scopes:       []string{"openid", "email"},
+		Rules:        []OIDCRule{{Claim: "groups", Value: "fleet-admins", Role: models.RoleAdmin, Tenant: "acme"}},
+	}
+	return idp, NewOIDCProvider(config, nil)
+}
+
+func TestOIDCProvider_AuthorizationCodeFlow(t *testing.T) {
+	idp, provider := newTestOIDCProvider(t)
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+	assert.NoError(t, err)
+	parsed, _ := url.Parse(authURL)
+	assert.Equal(t, idp.URL+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+	assert.Equal(t, "openid email", parsed.Query().Get("scope"))
+	assert.Equal(t, "S256", parsed.Query().Get("code_challenge_method"))
+	assert.NotContains(t, authURL, "verifier-1")
+
+	code, state, err := idp.Authorize(authURL, map[string]interface{}{
+		"sub":            "user-1",
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"groups":         []string{"fleet-admins"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "state-1", state)
+
+	identity, err := provider.Exchange(ctx, code, "verifier-1", "nonce-1")
+	assert.NoError(t, err)
+	assert.Equal(t, idp.Issuer(), identity.Issuer)
+	assert.Equal(t, "user-1", identity.Subject)
+	assert.Equal(t, "jane@example.com", identity.Email)
+	assert.True(t, identity.EmailVerified)
+
+	// Codes are single use
+	_, err = provider.Exchange(ctx, code, "verifier-1", "nonce-1")
+	assert.Error(t, err)
+
+	// The code verifier must match the challenge
+	authURL, _ = provider.AuthCodeURL(ctx, "state-2", "nonce-2", "verifier-2")
+	code, _, _ = idp.Authorize(authURL, map[string]interface{}{"sub": "user-1"})
+	_, err = provider.Exchange(ctx, code, "another-verifier", "nonce-2")
+	assert.Error(t, err)
+
+	// The ID token must carry the login's nonce
+	authURL, _ = provider.AuthCodeURL(ctx, "state-3", "nonce-3", "verifier-3")
+	code, _, _ = idp.Authorize(authURL, map[string]interface{}{"sub": "user-1"})
+	_, err = provider.Exchange(ctx, code, "verifier-3", "another-nonce")
+	assert.Error(t, err)
+}
+
+func TestOIDCProvider_VerifyIDToken(t *testing.T) {
+	idp, provider := newTestOIDCProvider(t)
+	ctx := context.Background()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   idp.Issuer(),
+			"aud":   "fleet",
+			"sub":   "user-1",
+			"nonce": "nonce",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		}
+	}
+
+	_, err := provider.verifyIDToken(ctx, idp.SignIDToken(valid()), "nonce")
+	assert.NoError(t, err)
+
+	tests := map[string]func(jwt.MapClaims){
+		"wrong issuer":        func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"wrong audience":      func(c jwt.MapClaims) { c["aud"] = "other-client" },
+		"expired":             func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"no expiry":           func(c jwt.MapClaims) { delete(c, "exp") },
+		"no subject":          func(c jwt.MapClaims) { delete(c, "sub") },
+		"foreign azp":         func(c jwt.MapClaims) { c["aud"] = []string{"fleet", "other"}; c["azp"] = "other" },
+		"missing nonce claim": func(c jwt.MapClaims) { delete(c, "nonce") },
+	}
+	for name, mutate := range tests {
+		claims := valid()
+		mutate(claims)
+		_, err := provider.verifyIDToken(ctx, idp.SignIDToken(claims), "nonce")
+		assert.Error(t, err, name)
+	}
+
+	// Tokens signed by anyone else are rejected
+	other := oidctest.NewProvider("fleet", "s3cret")
+	defer other.Close()
+	_, err = provider.verifyIDToken(ctx, other.SignIDToken(valid()), "nonce")
+	assert.Error(t, err)
+}
+
+func TestOIDCConfig_MapClaims(t *testing.T) {
+	config := OIDCConfig{
+		ClientID:    "fleet",
+		RedirectURL: "http://localhost:3000/auth/callback",
+		TenantClaim: "org",
+		Rules: []OIDCRule{
+			{Claim: "groups", Value: "fleet-admins", Role: models.RoleAdmin, Tenant: "acme"},
+			{Claim: "department", Value: "logistics", Role: models.RoleOperator},
+			{Role: models.RoleViewer, Tenant: "acme"},
+		},
+	}
+	assert.NoError(t, config.Validate())
+
+	role, tenant, err := config.MapClaims(map[string]interface{}{"groups": []interface{}{"staff", "fleet-admins"}})
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, role)
+	assert.Equal(t, "acme", tenant)
+
+	role, tenant, err = config.MapClaims(map[string]interface{}{"department": "logistics", "org": "globex"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleOperator, role)
+	assert.Equal(t, "globex", tenant)
+
+	// A matching rule without a tenant denies access when the tenant claim is missing
+	_, _, err = config.MapClaims(map[string]interface{}{"department": "logistics"})
+	assert.ErrorIs(t, err, ErrOIDCAccessDenied)
+
+	role, _, err = config.MapClaims(map[string]interface{}{"groups": []interface{}{"staff"}})
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleViewer, role)
+
+	config.Rules = config.Rules[:1]
+	_, _, err = config.MapClaims(map[string]interface{}{"groups": []interface{}{"staff"}})
+	assert.ErrorIs(t, err, ErrOIDCAccessDenied)
+
+	config.Rules = []OIDCRule{{Role: "owner", Tenant: "acme"}}
+	assert.Error(t, config.Validate())
+	config.Rules = nil
+	assert.Error(t, config.Validate())
+}
+
+func TestOIDCConfigFromEnv(t *testing.T) {
+	t.Setenv("OIDC_ISSUER", "")
+	config, err := OIDCConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+
+	t.Setenv("OIDC_ISSUER", "https://idp.example.com")
+	t.Setenv("OIDC_CLIENT_ID", "fleet")
+	t.Setenv("OIDC_REDIRECT_URL", "http://localhost:3000/auth/callback")
+	t.Setenv("OIDC_RULES", `[{"claim":"groups","value":"fleet-admins","role":"admin","tenant":"acme"}]`)
+	config, err = OIDCConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"openid", "email", "profile"}, config.Scopes)
+	assert.Equal(t, models.RoleAdmin, config.Rules[0].Role)
+
+	t.Setenv("OIDC_RULES", `not json`)
+	_, err = OIDCConfigFromEnv()
+	assert.Error(t, err)
+}
+
+func TestService_OIDCStateToken(t *testing.T) {
+	service, _ := NewService()
+
+	token, state, err := service.GenerateOIDCStateToken()
+	assert.NoError(t, err)
+	assert.NotEqual(t, state.State, state.Nonce)
+	assert.NotEqual(t, state.Nonce, state.CodeVerifier)
+
+	claims, err := service.ValidateOIDCStateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, state, claims)
+
+	// A state token is not an access token, nor vice versa
+	_, err = service.ValidateToken(token)
+	assert.Error(t, err)
+	_, err = service.ValidateOIDCStateToken("invalid")
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+}
@@ -0,0 +1,322 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ukydev/fleet-sustainability/internal/models"
+)
+
+// maxPasswordBytes is the longest password bcrypt accepts
+const maxPasswordBytes = 72
+
+// ErrPasswordReused is returned when a new password matches one of the user's recent passwords.
+var ErrPasswordReused = errors.New("password was used recently, choose a different one")
+
+// PasswordPolicy holds the rules new passwords must satisfy
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters
+	MinLength int
+	// MinClasses is how many of lowercase, uppercase, digits and symbols must appear
+	MinClasses int
+	// RequireLower, RequireUpper, RequireDigit and RequireSymbol demand a specific class
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// HistorySize is how many of the user's most recent passwords, including the current one, cannot be reused
+	HistorySize int
+}
+
+// PasswordPolicyFromEnv reads the password policy from PASSWORD_* environment variables
+func PasswordPolicyFromEnv() PasswordPolicy {
+	history := 5
+	if v := os.Getenv("PASSWORD_HISTORY"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed >= 0 {
+			history = parsed
+		}
+	}
+	return PasswordPolicy{
+		MinLength:     envInt("PASSWORD_MIN_LENGTH", 10),
+		MinClasses:    envInt("PASSWORD_MIN_CLASSES", 2),
+		RequireLower:  envBool("PASSWORD_REQUIRE_LOWER"),
+		RequireUpper:  envBool("PASSWORD_REQUIRE_UPPER"),
+		RequireDigit:  envBool("PASSWORD_REQUIRE_DIGIT"),
+		RequireSymbol: envBool("PASSWORD_REQUIRE_SYMBOL"),
+		HistorySize:   history,
+	}
+}
+
+// envBool reads a boolean environment variable, false when unset or invalid
+func envBool(name string) bool {
+	parsed, _ := strconv.ParseBool(os.Getenv(name))
+	return parsed
+}
+
+// check returns the first rule the password breaks
+func (p PasswordPolicy) check(password string) error {
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("password must be at most %d bytes long", maxPasswordBytes)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	switch {
+	case p.RequireLower && !lower:
+		return errors.New("password must contain a lowercase letter")
+	case p.RequireUpper && !upper:
+		return errors.New("password must contain an uppercase letter")
+	case p.RequireDigit && !digit:
+		return errors.New("password must contain a digit")
+	case p.RequireSymbol && !symbol:
+		return errors.New("password must contain a symbol")
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	if classes < p.MinClasses {
+		return fmt.Errorf("password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinClasses)
+	}
+	return nil
+}
+
+// BreachedPasswords reports whether a password appears in a corpus of breached passwords
+type BreachedPasswords interface {
+	IsBreached(password string) (bool, error)
+}
+
+// HashPrefixFile checks passwords against a local copy of a breached password
+// corpus: a file of "<SHA-1 hex>:<count>" lines sorted by hash, as in the
+// Pwned Passwords "ordered by hash" download. Lookups use k-anonymity ranges:
+// only the hashes sharing the password hash's 5 character prefix are read
+// from disk, found by binary search, and compared in memory.
+type HashPrefixFile struct {
+	path string
+}
+
+// NewHashPrefixFile opens the breached password file at path
+func NewHashPrefixFile(path string) (*HashPrefixFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("breached password file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("breached password file %s is a directory", path)
+	}
+	return &HashPrefixFile{path: path}, nil
+}
+
+// IsBreached reports whether the SHA-1 of password is in the file
+func (f *HashPrefixFile) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := f.Range(hash[:5])
+	if err != nil {
+		return false, err
+	}
+	for _, suffix := range suffixes {
+		if suffix == hash[5:] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Range returns the hash suffixes of every entry whose hash starts with the 5 character prefix
+func (f *HashPrefixFile) Range(prefix string) ([]string, error) {
+	prefix = strings.ToUpper(prefix)
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	// Find the first line whose hash sorts at or after the prefix
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, err := lineStart(file, mid, size)
+		if err != nil {
+			return nil, err
+		}
+		line, err := readLine(file, start, size)
+		if err != nil {
+			return nil, err
+		}
+		if start >= size || strings.ToUpper(line) >= prefix {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	start, err := lineStart(file, lo, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var suffixes []string
+	scanner := bufio.NewScanner(io.NewSectionReader(file, start, size-start))
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		hash = strings.ToUpper(hash)
+		if !strings.HasPrefix(hash, prefix) {
+			break
+		}
+		suffixes = append(suffixes, hash[len(prefix):])
+	}
+	return suffixes, scanner.Err()
+}
+
+// lineStart returns the offset of the first line starting at or after off
+func lineStart(r io.ReaderAt, off, size int64) (int64, error) {
+	if off == 0 {
+		return 0, nil
+	}
+	buf := make([]byte, 128)
+	for pos := off - 1; pos < size; {
+		n, err := r.ReadAt(buf, pos)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return pos + int64(i) + 1, nil
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		pos += int64(n)
+	}
+	return size, nil
+}
+
+// readLine returns the line starting at off, without its line ending
+func readLine(r io.ReaderAt, off, size int64) (string, error) {
+	if off >= size {
+		return "", nil
+	}
+	line, err := bufio.NewReader(io.NewSectionReader(r, off, size-off)).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// ValidatePassword checks a new password against the password policy and the
+// breached password corpus. personal holds the username, email and similar
+// values of the account, none of which may appear in the password.
+func (s *Service) ValidatePassword(password string, personal ...string) error {
+	if err := s.passwordPolicy.check(password); err != nil {
+		return err
+	}
+
+	lowered := strings.ToLower(password)
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+		candidates := []string{value}
+		if local, _, ok := strings.Cut(value, "@"); ok {
+			candidates = append(candidates, local)
+		}
+		for _, candidate := range candidates {
+			if len(candidate) >= 3 && strings.Contains(lowered, candidate) {
+				return errors.New("password must not contain your username or email")
+			}
+		}
+	}
+
+	if s.breachedPasswords != nil {
+		breached, err := s.breachedPasswords.IsBreached(password)
+		if err != nil {
+			return fmt.Errorf("failed to check password: %w", err)
+		}
+		if breached {
+			return errors.New("password has appeared in a data breach, choose a different one")
+		}
+	}
+	return nil
+}
+
+// SetPassword hashes password into user.PasswordHash, unless it matches one
+// of the user's last PasswordPolicy.HistorySize passwords, and keeps the
+// replaced hash in the user's password history
+func (s *Service) SetPassword(user *models.User, password string) error {
+	history := s.passwordPolicy.HistorySize
+	if history > 0 {
+		recent := append([]string{user.PasswordHash}, user.PasswordHistory...)
+		if len(recent) > history {
+			recent = recent[:history]
+		}
+		for _, hash := range recent {
+			if hash != "" && s.CheckPassword(password, hash) {
+				return ErrPasswordReused
+			}
+		}
+	}
+
+	hash, err := s.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash != "" && history > 1 {
+		user.PasswordHistory = append([]string{user.PasswordHash}, user.PasswordHistory...)
+	}
+	if len(user.PasswordHistory) > history-1 {
+		user.PasswordHistory = user.PasswordHistory[:max(history-1, 0)]
+	}
+	user.PasswordHash = hash
+	return nil
+}
+
+// ValidateEmail checks that email is a bare RFC 5322 address (no display
+// name) whose domain has at least two labels
+func (s *Service) ValidateEmail(email string) error {
+	invalid := errors.New("invalid email format")
+	if len(email) > 254 {
+		return invalid
+	}
+	address, err := mail.ParseAddress(email)
+	// String re-quotes the local part where needed, so quoted local parts round-trip
+	if err != nil || address.Name != "" || address.String() != "<"+email+">" {
+		return invalid
+	}
+	at := strings.LastIndex(address.Address, "@")
+	domain := address.Address[at+1:]
+	if at < 1 || len(address.Address[:at]) > 64 || !strings.Contains(domain, ".") ||
+		strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") || strings.Contains(domain, "..") {
+		return invalid
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+)
+
+// writeBreachedFile writes a sorted hash prefix file containing the given passwords and filler hashes
+func writeBreachedFile(t *testing.T, passwords ...string) string {
+	var lines []string
+	for _, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		lines = append(lines, strings.ToUpper(hex.EncodeToString(sum[:]))+":42")
+	}
+	for i := 0; i < 500; i++ {
+		sum := sha1.Sum([]byte{byte(i), byte(i >> 8), 'x'})
+		lines = append(lines, strings.ToUpper(hex.EncodeToString(sum[:]))+":1")
+	}
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPasswordPolicy_Check(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 10, MinClasses: 3}
+
+	assert.NoError(t, policy.check("correct-Horse7"))
+	assert.ErrorContains(t, policy.check("Sh0rt!"), "at least 10 characters")
+	assert.ErrorContains(t, policy.check("alllowercaseletters"), "at least 3 of")
+	assert.ErrorContains(t, policy.check("lowercase123456"), "at least 3 of")
+	assert.ErrorContains(t, policy.check(strings.Repeat("aB3", 25)), "at most 72 bytes")
+
+	policy = PasswordPolicy{MinLength: 8, RequireSymbol: true, RequireUpper: true}
+	assert.ErrorContains(t, policy.check("Password123"), "symbol")
+	assert.ErrorContains(t, policy.check("password!23"), "uppercase")
+	assert.NoError(t, policy.check("Password!23"))
+}
+
+func TestPasswordPolicyFromEnv(t *testing.T) {
+	policy := PasswordPolicyFromEnv()
+	assert.Equal(t, 10, policy.MinLength)
+	assert.Equal(t, 2, policy.MinClasses)
+	assert.Equal(t, 5, policy.HistorySize)
+
+	t.Setenv("PASSWORD_MIN_LENGTH", "14")
+	t.Setenv("PASSWORD_REQUIRE_DIGIT", "true")
+	t.Setenv("PASSWORD_HISTORY", "0")
+	policy = PasswordPolicyFromEnv()
+	assert.Equal(t, 14, policy.MinLength)
+	assert.True(t, policy.RequireDigit)
+	assert.Equal(t, 0, policy.HistorySize)
+}
+
+func TestService_ValidatePassword_PersonalInfo(t *testing.T) {
+	service, _ := NewService()
+
+	assert.NoError(t, service.ValidatePassword("fleet-manager-42", "jane", "jane.doe@example.com"))
+	assert.ErrorContains(t, service.ValidatePassword("Jane-secret-42", "jane", "jane.doe@example.com"), "username or email")
+	assert.ErrorContains(t, service.ValidatePassword("my JANE.DOE 2024", "jdoe", "jane.doe@example.com"), "username or email")
+	// Values too short to be meaningful are ignored
+	assert.NoError(t, service.ValidatePassword("jo-secret-2024", "jo"))
+}
+
+func TestHashPrefixFile(t *testing.T) {
+	path := writeBreachedFile(t, "password123", "Summer2024!")
+	breached, err := NewHashPrefixFile(path)
+	assert.NoError(t, err)
+
+	for _, password := range []string{"password123", "Summer2024!"} {
+		found, err := breached.IsBreached(password)
+		assert.NoError(t, err)
+		assert.True(t, found, password)
+	}
+	found, err := breached.IsBreached("not-in-the-corpus-9")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	// Lowercase prefixes match the uppercase file
+	sum := sha1.Sum([]byte("password123"))
+	suffixes, err := breached.Range(hex.EncodeToString(sum[:])[:5])
+	assert.NoError(t, err)
+	assert.Contains(t, suffixes, strings.ToUpper(hex.EncodeToString(sum[:]))[5:])
+
+	_, err = NewHashPrefixFile(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+
+	service, _ := NewService()
+	service.breachedPasswords = breached
+	assert.ErrorContains(t, service.ValidatePassword("password123"), "data breach")
+	assert.NoError(t, service.ValidatePassword("not-in-the-corpus-9"))
+}
+
+func TestService_SetPassword(t *testing.T) {
+	service, _ := NewService()
+	service.passwordPolicy.HistorySize = 3
+	user := &models.User{}
+
+	for _, password := range []string{"first-pass-1", "second-pass-2", "third-pass-3"} {
+		assert.NoError(t, service.SetPassword(user, password))
+	}
+	assert.True(t, service.CheckPassword("third-pass-3", user.PasswordHash))
+	assert.Len(t, user.PasswordHistory, 2)
+
+	// The current password and the two before it cannot be reused
+	for _, password := range []string{"first-pass-1", "second-pass-2", "third-pass-3"} {
+		assert.ErrorIs(t, service.SetPassword(user, password), ErrPasswordReused)
+	}
+
+	// Once pushed out of the history a password may be used again
+	assert.NoError(t, service.SetPassword(user, "fourth-pass-4"))
+	assert.NoError(t, service.SetPassword(user, "first-pass-1"))
+	assert.Len(t, user.PasswordHistory, 2)
+
+	service.passwordPolicy.HistorySize = 0
+	assert.NoError(t, service.SetPassword(user, "first-pass-1"))
+	assert.Empty(t, user.PasswordHistory)
+}
+
+func TestService_ValidateEmail_RFC5322(t *testing.T) {
+	service, _ := NewService()
+
+	for _, email := range []string{"jane@example.com", "jane.doe+fleet@mail.example.co.uk", `"jane doe"@example.com`, "o'brien@example.ie"} {
+		assert.NoError(t, service.ValidateEmail(email), email)
+	}
+	for _, email := range []string{
+		"", "jane", "jane@", "@example.com", "jane@localhost", "jane@@example.com",
+		"Jane <jane@example.com>", " jane@example.com", "jane..doe@example.com",
+		"jane@example..com", "jane@.example.com", "jane@example.com.",
+		strings.Repeat("a", 65) + "@example.com",
+	} {
+		assert.Error(t, service.ValidateEmail(email), email)
+	}
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LoginPolicy holds the brute-force protection thresholds for logins
+type LoginPolicy struct {
+	// BackoffThreshold is the number of failures per key before backoff starts
+	BackoffThreshold int
+	// BackoffBase is the delay imposed after the first failure beyond the threshold; it doubles with each further failure
+	BackoffBase time.Duration
+	// BackoffMax caps the backoff delay
+	BackoffMax time.Duration
+	// FailureWindow is how long a failure counts against a key
+	FailureWindow time.Duration
+	// LockoutThreshold is the number of consecutive failures that locks the account
+	LockoutThreshold int
+	// LockoutDuration is how long an account stays locked
+	LockoutDuration time.Duration
+}
+
+// LoginPolicyFromEnv reads the login policy from LOGIN_* environment variables
+func LoginPolicyFromEnv() LoginPolicy {
+	return LoginPolicy{
+		BackoffThreshold: envInt("LOGIN_BACKOFF_THRESHOLD", 3),
+		BackoffBase:      envDuration("LOGIN_BACKOFF_BASE", time.Second),
+		BackoffMax:       envDuration("LOGIN_BACKOFF_MAX", 5*time.Minute),
+		FailureWindow:    envDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LockoutThreshold: envInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+		LockoutDuration:  envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+	}
+}
+
+// LoginThrottle tracks failed login attempts per key (username or client IP)
+// in memory and imposes an exponential backoff once a key keeps failing.
+type LoginThrottle struct {
+	policy   LoginPolicy
+	mu       sync.Mutex
+	failures map[string]*failureRecord
+}
+
+type failureRecord struct {
+	count       int
+	lastFailure time.Time
+}
+
+// NewLoginThrottle creates a login throttle enforcing the given policy
+func NewLoginThrottle(policy LoginPolicy) *LoginThrottle {
+	return &LoginThrottle{
+		policy:   policy,
+		failures: make(map[string]*failureRecord),
+	}
+}
+
+// Policy returns the policy enforced by the throttle
+func (t *LoginThrottle) Policy() LoginPolicy {
+	return t.policy
+}
+
+// RetryAfter returns how long the caller must wait before another attempt for
+// any of the keys is allowed; zero means the attempt may proceed.
+func (t *LoginThrottle) RetryAfter(keys ...string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		record := t.current(key, now)
+		if record == nil {
+			continue
+		}
+		if remaining := record.lastFailure.Add(t.delay(record.count)).Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait
+}
+
+// RecordFailure counts a failed attempt against every key
+func (t *LoginThrottle) RecordFailure(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		record := t.current(key, now)
+		if record == nil {
+			record = &failureRecord{}
+			t.failures[key] = record
+		}
+		record.count++
+		record.lastFailure = now
+	}
+	t.purge(now)
+}
+
+// Reset forgets the failures of the given keys
+func (t *LoginThrottle) Reset(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range keys {
+		delete(t.failures, key)
+	}
+}
+
+// current returns the live failure record of a key, dropping it once it falls out of the window
+func (t *LoginThrottle) current(key string, now time.Time) *failureRecord {
+	record, ok := t.failures[key]
+	if !ok {
+		return nil
+	}
+	if now.Sub(record.lastFailure) > t.policy.FailureWindow {
+		delete(t.failures, key)
+		return nil
+	}
+	return record
+}
+
+// delay returns the backoff imposed after count failures
+func (t *LoginThrottle) delay(count int) time.Duration {
+	excess := count - t.policy.BackoffThreshold
+	if excess <= 0 {
+		return 0
+	}
+	delay := t.policy.BackoffBase
+	for i := 1; i < excess && delay < t.policy.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > t.policy.BackoffMax {
+		delay = t.policy.BackoffMax
+	}
+	return delay
+}
+
+// purge drops records outside the failure window so the map stays bounded
+func (t *LoginThrottle) purge(now time.Time) {
+	for key, record := range t.failures {
+		if now.Sub(record.lastFailure) > t.policy.FailureWindow {
+			delete(t.failures, key)
+		}
+	}
+}
+
+// envInt reads a positive integer environment variable
+func envInt(name string, fallback int) int {
+	if v := os.Getenv(name); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return fallback
+}
+
+// envDuration reads a positive duration environment variable
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if v := os.Getenv(name); v != "" {
+		if parsed, err := time.ParseDuration(v); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return fallback
+}
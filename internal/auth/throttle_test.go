@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testLoginPolicy() LoginPolicy {
+	return LoginPolicy{
+		BackoffThreshold: 2,
+		BackoffBase:      time.Second,
+		BackoffMax:       4 * time.Second,
+		FailureWindow:    time.Minute,
+		LockoutThreshold: 5,
+		LockoutDuration:  time.Minute,
+	}
+}
+
+func TestLoginThrottle_Backoff(t *testing.T) {
+	throttle := NewLoginThrottle(testLoginPolicy())
+
+	throttle.RecordFailure("user:alice", "ip:1.2.3.4")
+	throttle.RecordFailure("user:alice", "ip:1.2.3.4")
+	assert.Zero(t, throttle.RetryAfter("user:alice", "ip:1.2.3.4"), "no backoff up to the threshold")
+
+	throttle.RecordFailure("user:alice")
+	wait := throttle.RetryAfter("user:alice")
+	assert.True(t, wait > 0 && wait <= time.Second, "first backoff is the base delay, got %v", wait)
+
+	throttle.RecordFailure("user:alice")
+	wait = throttle.RetryAfter("user:alice")
+	assert.True(t, wait > time.Second && wait <= 2*time.Second, "backoff doubles, got %v", wait)
+
+	for i := 0; i < 5; i++ {
+		throttle.RecordFailure("user:alice")
+	}
+	assert.LessOrEqual(t, throttle.RetryAfter("user:alice"), 4*time.Second, "backoff is capped")
+
+	// Any throttled key blocks the attempt
+	assert.True(t, throttle.RetryAfter("user:bob", "user:alice") > 0)
+	assert.Zero(t, throttle.RetryAfter("user:bob", "ip:1.2.3.4"))
+}
+
+func TestLoginThrottle_Reset(t *testing.T) {
+	throttle := NewLoginThrottle(testLoginPolicy())
+	for i := 0; i < 4; i++ {
+		throttle.RecordFailure("user:alice")
+	}
+	assert.True(t, throttle.RetryAfter("user:alice") > 0)
+
+	throttle.Reset("user:alice")
+	assert.Zero(t, throttle.RetryAfter("user:alice"))
+}
+
+func TestLoginThrottle_FailureWindow(t *testing.T) {
+	policy := testLoginPolicy()
+	policy.FailureWindow = 10 * time.Millisecond
+	throttle := NewLoginThrottle(policy)
+	for i := 0; i < 4; i++ {
+		throttle.RecordFailure("user:alice")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Zero(t, throttle.RetryAfter("user:alice"))
+}
+
+func TestLoginPolicyFromEnv(t *testing.T) {
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "7")
+	t.Setenv("LOGIN_LOCKOUT_DURATION", "1h")
+	t.Setenv("LOGIN_BACKOFF_BASE", "invalid")
+
+	policy := LoginPolicyFromEnv()
+	assert.Equal(t, 7, policy.LockoutThreshold)
+	assert.Equal(t, time.Hour, policy.LockoutDuration)
+	assert.Equal(t, time.Second, policy.BackoffBase)
+}
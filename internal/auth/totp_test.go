@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	// SHA-1 test vectors from RFC 6238 appendix B, truncated to six digits
+	key := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		assert.Equal(t, want, totpCode(key, unix/30), "T=%d", unix)
+	}
+}
+
+func TestService_ValidateTOTPCode(t *testing.T) {
+	service, _ := NewService()
+	secret, err := service.GenerateTOTPSecret()
+	assert.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	code, err := service.GenerateTOTPCode(secret, now)
+	assert.NoError(t, err)
+
+	step, ok := service.ValidateTOTPCode(secret, code, 0, now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Unix()/30, step)
+
+	// One step of clock skew is tolerated, more is not
+	_, ok = service.ValidateTOTPCode(secret, code, 0, now.Add(30*time.Second))
+	assert.True(t, ok)
+	_, ok = service.ValidateTOTPCode(secret, code, 0, now.Add(90*time.Second))
+	assert.False(t, ok)
+
+	// A code whose step was already used cannot be replayed
+	_, ok = service.ValidateTOTPCode(secret, code, step, now)
+	assert.False(t, ok)
+
+	_, ok = service.ValidateTOTPCode(secret, "12345", 0, now)
+	assert.False(t, ok)
+	_, ok = service.ValidateTOTPCode("not base32!", code, 0, now)
+	assert.False(t, ok)
+}
+
+func TestService_TOTPProvisioningURI(t *testing.T) {
+	service, _ := NewService()
+	uri := service.TOTPProvisioningURI("alice@example.com", "JBSWY3DPEHPK3PXP")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Fleet%20Sustainability:alice@example.com?"), uri)
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=Fleet+Sustainability")
+}
+
+func TestService_RecoveryCodes(t *testing.T) {
+	service, _ := NewService()
+	codes, hashes, err := service.GenerateRecoveryCodes()
+	assert.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+	assert.Len(t, hashes, recoveryCodeCount)
+
+	for i, code := range codes {
+		assert.Len(t, code, 11)
+		assert.NotContains(t, hashes[i], code)
+		assert.Equal(t, hashes[i], service.HashRecoveryCode(code))
+	}
+	// Codes are matched regardless of case, dashes and surrounding spaces
+	assert.Equal(t, hashes[0], service.HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))+" "))
+}
+
+func TestService_MFAChallengeToken(t *testing.T) {
+	service, _ := NewService()
+
+	token, expiresAt, err := service.GenerateMFAChallengeToken("user-id", MFAPurposeVerify)
+	assert.NoError(t, err)
+	assert.True(t, expiresAt.After(time.Now()))
+
+	claims, err := service.ValidateMFAChallengeToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-id", claims.UserID)
+	assert.Equal(t, MFAPurposeVerify, claims.Purpose)
+
+	// A challenge is not an access token, nor vice versa
+	_, err = service.ValidateToken(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	accessToken, _ := service.GenerateToken(&models.User{ID: primitive.NewObjectID(), Username: "u", Role: models.RoleAdmin})
+	_, err = service.ValidateMFAChallengeToken(accessToken)
+	assert.ErrorIs(t, err, ErrInvalidMFAChallenge)
+}
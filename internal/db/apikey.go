@@ -0,0 +1,204 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrAPIKeyNotFound is returned when no API key matches the lookup.
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// APIKeyStore defines the storage operations for tenant API keys
+type APIKeyStore interface {
+	InsertAPIKey(ctx context.Context, key models.APIKey) error
+	FindAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context, tenantID string) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, tenantID, id string, at time.Time) error
+	TouchAPIKey(ctx context.Context, id string, at time.Time) error
+}
+
+// MongoAPIKeyStore implements APIKeyStore for MongoDB
+type MongoAPIKeyStore struct {
+	Collection *mongo.Collection
+}
+
+// EnsureIndexes creates the unique prefix index used for lookups and a tenant index for listings.
+func (s *MongoAPIKeyStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.Collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "prefix", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	return err
+}
+
+// InsertAPIKey stores a new API key
+func (s *MongoAPIKeyStore) InsertAPIKey(ctx context.Context, key models.APIKey) error {
+	if key.ID.IsZero() {
+		key.ID = primitive.NewObjectID()
+	}
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	_, err := s.Collection.InsertOne(ctx, key)
+	return err
+}
+
+// FindAPIKeyByPrefix finds an API key by its public prefix
+func (s *MongoAPIKeyStore) FindAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := s.Collection.FindOne(ctx, bson.M{"prefix": prefix}).Decode(&key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListAPIKeys returns a tenant's API keys, newest first
+func (s *MongoAPIKeyStore) ListAPIKeys(ctx context.Context, tenantID string) ([]models.APIKey, error) {
+	cursor, err := s.Collection.Find(ctx, bson.M{"tenant_id": tenantID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []models.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes one of a tenant's API keys. It returns
+// ErrAPIKeyNotFound when the tenant has no such key.
+func (s *MongoAPIKeyStore) RevokeAPIKey(ctx context.Context, tenantID, id string, at time.Time) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrAPIKeyNotFound
+	}
+
+	result, err := s.Collection.UpdateOne(
+		ctx,
+		bson.M{"_id": objectID, "tenant_id": tenantID},
+		bson.M{"$set": bson.M{"revoked_at": at}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (s *MongoAPIKeyStore) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	_, err = s.Collection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": bson.M{"last_used_at": at}})
+	return err
+}
+
+// MemoryAPIKeyStore is an in-process APIKeyStore, suitable for tests
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[primitive.ObjectID]models.APIKey
+}
+
+// NewMemoryAPIKeyStore creates an empty in-memory API key store
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{keys: make(map[primitive.ObjectID]models.APIKey)}
+}
+
+// InsertAPIKey stores a new API key
+func (s *MemoryAPIKeyStore) InsertAPIKey(ctx context.Context, key models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key.ID.IsZero() {
+		key.ID = primitive.NewObjectID()
+	}
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	for _, existing := range s.keys {
+		if existing.Prefix == key.Prefix {
+			return errors.New("duplicate API key prefix")
+		}
+	}
+	s.keys[key.ID] = key
+	return nil
+}
+
+// FindAPIKeyByPrefix finds an API key by its public prefix
+func (s *MemoryAPIKeyStore) FindAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, key := range s.keys {
+		if key.Prefix == prefix {
+			return &key, nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+// ListAPIKeys returns a tenant's API keys, newest first
+func (s *MemoryAPIKeyStore) ListAPIKeys(ctx context.Context, tenantID string) ([]models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := []models.APIKey{}
+	for _, key := range s.keys {
+		if key.TenantID == tenantID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+// RevokeAPIKey revokes one of a tenant's API keys
+func (s *MemoryAPIKeyStore) RevokeAPIKey(ctx context.Context, tenantID, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrAPIKeyNotFound
+	}
+	key, ok := s.keys[objectID]
+	if !ok || key.TenantID != tenantID {
+		return ErrAPIKeyNotFound
+	}
+	key.RevokedAt = &at
+	s.keys[objectID] = key
+	return nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (s *MemoryAPIKeyStore) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	if key, ok := s.keys[objectID]; ok {
+		key.LastUsedAt = &at
+		s.keys[objectID] = key
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryAPIKeyStore(t *testing.T) {
+	store := NewMemoryAPIKeyStore()
+	ctx := context.Background()
+
+	key := models.APIKey{ID: primitive.NewObjectID(), TenantID: "tenant-a", Name: "gateway", Prefix: "abc123def456", SecretHash: "hash"}
+	assert.NoError(t, store.InsertAPIKey(ctx, key))
+	assert.Error(t, store.InsertAPIKey(ctx, models.APIKey{TenantID: "tenant-b", Prefix: "abc123def456"}), "prefixes are unique")
+
+	found, err := store.FindAPIKeyByPrefix(ctx, "abc123def456")
+	assert.NoError(t, err)
+	assert.Equal(t, key.ID, found.ID)
+	_, err = store.FindAPIKeyByPrefix(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+
+	keys, _ := store.ListAPIKeys(ctx, "tenant-a")
+	assert.Len(t, keys, 1)
+	keys, _ = store.ListAPIKeys(ctx, "tenant-b")
+	assert.Empty(t, keys)
+
+	now := time.Now()
+	assert.NoError(t, store.TouchAPIKey(ctx, key.ID.Hex(), now))
+
+	// Revocation is tenant-scoped
+	assert.ErrorIs(t, store.RevokeAPIKey(ctx, "tenant-b", key.ID.Hex(), now), ErrAPIKeyNotFound)
+	assert.NoError(t, store.RevokeAPIKey(ctx, "tenant-a", key.ID.Hex(), now))
+
+	found, _ = store.FindAPIKeyByPrefix(ctx, "abc123def456")
+	assert.NotNil(t, found.LastUsedAt)
+	assert.False(t, found.IsActive(now))
+}
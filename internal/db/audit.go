@@ -0,0 +1,397 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// DefaultAuditQueryLimit and MaxAuditQueryLimit bound the events returned by Query
+	DefaultAuditQueryLimit = 100
+	MaxAuditQueryLimit     = 1000
+
+	// auditAppendAttempts is how often Record retries when another writer claims the same sequence number
+	auditAppendAttempts = 10
+)
+
+// errAuditContention is returned when an event cannot be appended because of concurrent writers
+var errAuditContention = errors.New("audit log: too many concurrent appends")
+
+// AuditLog is an append-only store of audit events. Each tenant's events form
+// a hash chain that Verify checks end to end.
+type AuditLog interface {
+	Record(ctx context.Context, event models.AuditEvent) error
+	Query(ctx context.Context, query AuditQuery) ([]models.AuditEvent, error)
+	Verify(ctx context.Context, tenantID string) (*models.AuditChainStatus, error)
+}
+
+// AuditQuery selects a tenant's audit events; empty fields do not filter
+type AuditQuery struct {
+	TenantID string
+	ActorID  string
+	// TargetID matches the target of security events and any target of API calls
+	TargetID string
+	Action   string
+	Method   string
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+// limit returns the effective number of events to return
+func (q AuditQuery) limit() int {
+	if q.Limit <= 0 {
+		return DefaultAuditQueryLimit
+	}
+	return min(q.Limit, MaxAuditQueryLimit)
+}
+
+// matches reports whether event satisfies the query
+func (q AuditQuery) matches(event models.AuditEvent) bool {
+	if event.TenantID != q.TenantID ||
+		(q.ActorID != "" && event.ActorID != q.ActorID) ||
+		(q.Action != "" && event.Action != q.Action) ||
+		(q.Method != "" && event.Method != q.Method) ||
+		(!q.From.IsZero() && event.CreatedAt.Before(q.From)) ||
+		(!q.To.IsZero() && event.CreatedAt.After(q.To)) {
+		return false
+	}
+	if q.TargetID == "" || event.TargetID == q.TargetID {
+		return true
+	}
+	for _, id := range event.TargetIDs {
+		if id == q.TargetID {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareAuditEvent fills in the ID and timestamp and reduces the free-form
+// fields to their JSON form, so the event hashes the same after a database
+// round trip
+func prepareAuditEvent(event *models.AuditEvent) {
+	if event.ID.IsZero() {
+		event.ID = primitive.NewObjectID()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	// Stored timestamps have millisecond precision
+	event.CreatedAt = event.CreatedAt.UTC().Truncate(time.Millisecond)
+	event.Details = normalizeAuditMap(event.Details)
+	event.Before = normalizeAuditMap(event.Before)
+	event.After = normalizeAuditMap(event.After)
+	if len(event.TargetIDs) == 0 {
+		event.TargetIDs = nil
+	}
+}
+
+// normalizeAuditMap converts values to what JSON decoding produces, dropping empty maps
+func normalizeAuditMap(m map[string]interface{}) map[string]interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return map[string]interface{}{"error": "unserializable audit data"}
+	}
+	var normalized map[string]interface{}
+	json.Unmarshal(data, &normalized)
+	return normalized
+}
+
+// canonicalAuditValue converts BSON documents and arrays read back from the
+// database into the maps and slices they were written from
+func canonicalAuditValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case primitive.D:
+		m := make(map[string]interface{}, len(t))
+		for _, e := range t {
+			m[e.Key] = canonicalAuditValue(e.Value)
+		}
+		return m
+	case primitive.M:
+		return canonicalAuditValue(map[string]interface{}(t))
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, value := range t {
+			m[k] = canonicalAuditValue(value)
+		}
+		return m
+	case primitive.A:
+		return canonicalAuditValue([]interface{}(t))
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, value := range t {
+			s[i] = canonicalAuditValue(value)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+// auditHash returns the SHA-256 over the event's content and its predecessor's hash
+func auditHash(event models.AuditEvent) string {
+	content, _ := json.Marshal(struct {
+		ID        string      `json:"id"`
+		TenantID  string      `json:"tenant_id"`
+		Seq       int64       `json:"seq"`
+		Action    string      `json:"action"`
+		ActorID   string      `json:"actor_id"`
+		TargetID  string      `json:"target_id"`
+		TargetIDs []string    `json:"target_ids"`
+		Method    string      `json:"method"`
+		Route     string      `json:"route"`
+		Status    int         `json:"status"`
+		IPAddress string      `json:"ip_address"`
+		Details   interface{} `json:"details"`
+		Before    interface{} `json:"before"`
+		After     interface{} `json:"after"`
+		CreatedAt string      `json:"created_at"`
+		PrevHash  string      `json:"prev_hash"`
+	}{
+		ID:        event.ID.Hex(),
+		TenantID:  event.TenantID,
+		Seq:       event.Seq,
+		Action:    event.Action,
+		ActorID:   event.ActorID,
+		TargetID:  event.TargetID,
+		TargetIDs: event.TargetIDs,
+		Method:    event.Method,
+		Route:     event.Route,
+		Status:    event.Status,
+		IPAddress: event.IPAddress,
+		Details:   canonicalAuditValue(event.Details),
+		Before:    canonicalAuditValue(event.Before),
+		After:     canonicalAuditValue(event.After),
+		CreatedAt: event.CreatedAt.UTC().Format(time.RFC3339Nano),
+		PrevHash:  event.PrevHash,
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// chainAuditEvent links event to the chain head of its tenant
+func chainAuditEvent(event *models.AuditEvent, head *models.AuditEvent) {
+	event.Seq, event.PrevHash = 1, ""
+	if head != nil {
+		event.Seq, event.PrevHash = head.Seq+1, head.Hash
+	}
+	event.Hash = auditHash(*event)
+}
+
+// auditChainVerifier checks a tenant's events one at a time in sequence order
+type auditChainVerifier struct {
+	status models.AuditChainStatus
+}
+
+// add verifies the next event and reports whether the chain is still intact
+func (v *auditChainVerifier) add(event models.AuditEvent) bool {
+	switch {
+	case event.Seq != v.status.Entries+1:
+		v.status.Reason = "entry missing or out of order"
+	case event.PrevHash != v.status.HeadHash:
+		v.status.Reason = "previous hash does not match"
+	case auditHash(event) != event.Hash:
+		v.status.Reason = "entry content does not match its hash"
+	default:
+		v.status.Entries++
+		v.status.HeadHash = event.Hash
+		return true
+	}
+	v.status.Valid = false
+	v.status.BrokenAt = v.status.Entries + 1
+	return false
+}
+
+// MongoAuditLog implements AuditLog for MongoDB. Writers append by claiming
+// the next sequence number of the tenant's chain; a unique index makes
+// concurrent writers retry instead of forking the chain.
+type MongoAuditLog struct {
+	Collection *mongo.Collection
+}
+
+// EnsureIndexes creates the chain index and the indexes used to browse a tenant's audit trail
+func (l *MongoAuditLog) EnsureIndexes(ctx context.Context) error {
+	_, err := l.Collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "target_id", Value: 1}}},
+		{Keys: bson.D{{Key: "target_ids", Value: 1}}},
+		{
+			// Events recorded before hash chaining have no sequence number
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "seq", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"seq": bson.M{"$gt": 0}}),
+		},
+	})
+	return err
+}
+
+// Record appends an audit event to its tenant's chain
+func (l *MongoAuditLog) Record(ctx context.Context, event models.AuditEvent) error {
+	prepareAuditEvent(&event)
+	for attempt := 0; attempt < auditAppendAttempts; attempt++ {
+		var head models.AuditEvent
+		err := l.Collection.FindOne(ctx,
+			bson.M{"tenant_id": event.TenantID, "seq": bson.M{"$gt": 0}},
+			options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}}),
+		).Decode(&head)
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			chainAuditEvent(&event, nil)
+		case err != nil:
+			return err
+		default:
+			chainAuditEvent(&event, &head)
+		}
+
+		_, err = l.Collection.InsertOne(ctx, event)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		return err
+	}
+	return errAuditContention
+}
+
+// Query returns a tenant's audit events matching the query, newest first
+func (l *MongoAuditLog) Query(ctx context.Context, query AuditQuery) ([]models.AuditEvent, error) {
+	filter := bson.M{"tenant_id": query.TenantID}
+	if query.ActorID != "" {
+		filter["actor_id"] = query.ActorID
+	}
+	if query.TargetID != "" {
+		filter["$or"] = bson.A{bson.M{"target_id": query.TargetID}, bson.M{"target_ids": query.TargetID}}
+	}
+	if query.Action != "" {
+		filter["action"] = query.Action
+	}
+	if query.Method != "" {
+		filter["method"] = query.Method
+	}
+	if !query.From.IsZero() || !query.To.IsZero() {
+		createdAt := bson.M{}
+		if !query.From.IsZero() {
+			createdAt["$gte"] = query.From
+		}
+		if !query.To.IsZero() {
+			createdAt["$lte"] = query.To
+		}
+		filter["created_at"] = createdAt
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "seq", Value: -1}}).
+		SetLimit(int64(query.limit()))
+	cursor, err := l.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []models.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Verify walks a tenant's chain from the first event and reports the first break
+func (l *MongoAuditLog) Verify(ctx context.Context, tenantID string) (*models.AuditChainStatus, error) {
+	cursor, err := l.Collection.Find(ctx,
+		bson.M{"tenant_id": tenantID, "seq": bson.M{"$gt": 0}},
+		options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	verifier := auditChainVerifier{status: models.AuditChainStatus{TenantID: tenantID, Valid: true}}
+	for cursor.Next(ctx) {
+		var event models.AuditEvent
+		if err := cursor.Decode(&event); err != nil {
+			return nil, err
+		}
+		if !verifier.add(event) {
+			break
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return &verifier.status, nil
+}
+
+// MemoryAuditLog is an in-process AuditLog, suitable for tests
+type MemoryAuditLog struct {
+	mu     sync.Mutex
+	events []models.AuditEvent
+}
+
+// NewMemoryAuditLog creates an empty in-memory audit log
+func NewMemoryAuditLog() *MemoryAuditLog {
+	return &MemoryAuditLog{}
+}
+
+// Record appends an audit event to its tenant's chain
+func (l *MemoryAuditLog) Record(ctx context.Context, event models.AuditEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	prepareAuditEvent(&event)
+	var head *models.AuditEvent
+	for i := len(l.events) - 1; i >= 0; i-- {
+		if l.events[i].TenantID == event.TenantID {
+			head = &l.events[i]
+			break
+		}
+	}
+	chainAuditEvent(&event, head)
+	l.events = append(l.events, event)
+	return nil
+}
+
+// Query returns a tenant's audit events matching the query, newest first
+func (l *MemoryAuditLog) Query(ctx context.Context, query AuditQuery) ([]models.AuditEvent, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	events := []models.AuditEvent{}
+	for i := len(l.events) - 1; i >= 0 && len(events) < query.limit(); i-- {
+		if query.matches(l.events[i]) {
+			events = append(events, l.events[i])
+		}
+	}
+	return events, nil
+}
+
+// Verify walks a tenant's chain from the first event and reports the first break
+func (l *MemoryAuditLog) Verify(ctx context.Context, tenantID string) (*models.AuditChainStatus, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	verifier := auditChainVerifier{status: models.AuditChainStatus{TenantID: tenantID, Valid: true}}
+	for _, event := range l.events {
+		if event.TenantID == tenantID && !verifier.add(event) {
+			break
+		}
+	}
+	return &verifier.status, nil
+}
+
+// Events returns a copy of the recorded events
+func (l *MemoryAuditLog) Events() []models.AuditEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]models.AuditEvent(nil), l.events...)
+}
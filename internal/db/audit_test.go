@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMemoryAuditLog_Record(t *testing.T) {
+	auditLog := NewMemoryAuditLog()
+
+	err := auditLog.Record(context.Background(), models.AuditEvent{TenantID: "tenant-a", Action: models.AuditAccountLocked, TargetID: "user-1"})
+	assert.NoError(t, err)
+
+	events := auditLog.Events()
+	assert.Len(t, events, 1)
+	assert.False(t, events[0].ID.IsZero())
+	assert.False(t, events[0].CreatedAt.IsZero())
+	assert.Equal(t, models.AuditAccountLocked, events[0].Action)
+}
+
+func TestMemoryAuditLog_HashChain(t *testing.T) {
+	ctx := context.Background()
+	auditLog := NewMemoryAuditLog()
+	for i := 0; i < 3; i++ {
+		auditLog.Record(ctx, models.AuditEvent{TenantID: "tenant-a", Action: models.AuditAPIRequest, Method: "DELETE", Route: "/api/trips"})
+		auditLog.Record(ctx, models.AuditEvent{TenantID: "tenant-b", Action: models.AuditAPIRequest, Method: "POST", Route: "/api/vehicles"})
+	}
+
+	events := auditLog.Events()
+	assert.Equal(t, int64(1), events[0].Seq)
+	assert.Empty(t, events[0].PrevHash)
+	// Each tenant has its own chain
+	assert.Equal(t, int64(2), events[2].Seq)
+	assert.Equal(t, events[0].Hash, events[2].PrevHash)
+	assert.Equal(t, events[1].Hash, events[3].PrevHash)
+
+	status, err := auditLog.Verify(ctx, "tenant-a")
+	assert.NoError(t, err)
+	assert.True(t, status.Valid)
+	assert.Equal(t, int64(3), status.Entries)
+	assert.Equal(t, events[4].Hash, status.HeadHash)
+
+	t.Run("edited entries break the chain", func(t *testing.T) {
+		auditLog.mu.Lock()
+		original := auditLog.events[2]
+		auditLog.events[2].Method = "GET"
+		auditLog.mu.Unlock()
+
+		status, _ := auditLog.Verify(ctx, "tenant-a")
+		assert.False(t, status.Valid)
+		assert.Equal(t, int64(2), status.BrokenAt)
+		assert.Contains(t, status.Reason, "content")
+
+		// Rehashing the edited entry does not help, its successor still points at the old hash
+		auditLog.mu.Lock()
+		auditLog.events[2].Hash = auditHash(auditLog.events[2])
+		auditLog.mu.Unlock()
+		status, _ = auditLog.Verify(ctx, "tenant-a")
+		assert.False(t, status.Valid)
+		assert.Equal(t, int64(3), status.BrokenAt)
+
+		auditLog.mu.Lock()
+		auditLog.events[2] = original
+		auditLog.mu.Unlock()
+	})
+
+	t.Run("removed entries break the chain", func(t *testing.T) {
+		auditLog.mu.Lock()
+		saved := append([]models.AuditEvent(nil), auditLog.events...)
+		auditLog.events = append(auditLog.events[:2:2], auditLog.events[3:]...)
+		auditLog.mu.Unlock()
+
+		status, _ := auditLog.Verify(ctx, "tenant-a")
+		assert.False(t, status.Valid)
+		assert.Equal(t, int64(2), status.BrokenAt)
+		status, _ = auditLog.Verify(ctx, "tenant-b")
+		assert.True(t, status.Valid)
+
+		auditLog.mu.Lock()
+		auditLog.events = saved
+		auditLog.mu.Unlock()
+	})
+}
+
+func TestAuditHash_SurvivesBSONRoundTrip(t *testing.T) {
+	event := models.AuditEvent{
+		TenantID:  "tenant-a",
+		Action:    models.AuditAPIRequest,
+		TargetIDs: []string{"64b7f0c2e1a4b2c3d4e5f601"},
+		Status:    200,
+		Details:   map[string]interface{}{"deleted": int64(3), "roles": []models.Role{models.RoleAdmin}},
+		Before:    map[string]interface{}{"location": map[string]interface{}{"lat": 52.1, "lon": 4.3}, "year": 2020},
+		After:     map[string]interface{}{"location": map[string]interface{}{"lat": 52.2, "lon": 4.3}, "year": 2021},
+		CreatedAt: time.Now(),
+	}
+	prepareAuditEvent(&event)
+	chainAuditEvent(&event, nil)
+
+	data, err := bson.Marshal(event)
+	assert.NoError(t, err)
+	var stored models.AuditEvent
+	assert.NoError(t, bson.Unmarshal(data, &stored))
+
+	assert.Equal(t, event.Hash, auditHash(stored))
+}
+
+func TestMemoryAuditLog_Query(t *testing.T) {
+	ctx := context.Background()
+	auditLog := NewMemoryAuditLog()
+	start := time.Now()
+	auditLog.Record(ctx, models.AuditEvent{TenantID: "tenant-a", Action: models.AuditAPIRequest, ActorID: "alice", Method: "DELETE", TargetIDs: []string{"trip-1"}, CreatedAt: start})
+	auditLog.Record(ctx, models.AuditEvent{TenantID: "tenant-a", Action: models.AuditAccountLocked, TargetID: "bob", CreatedAt: start.Add(time.Minute)})
+	auditLog.Record(ctx, models.AuditEvent{TenantID: "tenant-a", Action: models.AuditAPIRequest, ActorID: "bob", Method: "POST", CreatedAt: start.Add(2 * time.Minute)})
+	auditLog.Record(ctx, models.AuditEvent{TenantID: "tenant-b", Action: models.AuditAPIRequest, ActorID: "alice", Method: "DELETE"})
+
+	events, err := auditLog.Query(ctx, AuditQuery{TenantID: "tenant-a"})
+	assert.NoError(t, err)
+	assert.Len(t, events, 3)
+	assert.Equal(t, "bob", events[0].ActorID, "newest first")
+
+	events, _ = auditLog.Query(ctx, AuditQuery{TenantID: "tenant-a", ActorID: "alice"})
+	assert.Len(t, events, 1)
+	events, _ = auditLog.Query(ctx, AuditQuery{TenantID: "tenant-a", TargetID: "trip-1"})
+	assert.Len(t, events, 1)
+	events, _ = auditLog.Query(ctx, AuditQuery{TenantID: "tenant-a", TargetID: "bob"})
+	assert.Len(t, events, 1)
+	events, _ = auditLog.Query(ctx, AuditQuery{TenantID: "tenant-a", Method: "DELETE"})
+	assert.Len(t, events, 1)
+	events, _ = auditLog.Query(ctx, AuditQuery{TenantID: "tenant-a", From: start.Add(30 * time.Second), To: start.Add(90 * time.Second)})
+	assert.Len(t, events, 1)
+	events, _ = auditLog.Query(ctx, AuditQuery{TenantID: "tenant-a", Limit: 2})
+	assert.Len(t, events, 2)
+}
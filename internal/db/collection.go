@@ -2,83 +2,100 @@ package db
 
 import (
 	"context"
+	"errors"
+	"time"
+
 	"github.com/ukydev/fleet-sustainability/internal/models"
-	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrNotFound is returned when no record in the tenant scope has the requested ID.
+var ErrNotFound = errors.New("record not found")
+
+// Query selects, orders and limits the records of a collection. Fields are
+// named as they are stored, after the bson tags of the models, e.g.
+// "vehicle_id" or "_id". A query has no tenant: it is always confined to the
+// tenant scope of its context (see WithTenant).
+type Query struct {
+	// VehicleIDs selects the records of any of these vehicles
+	VehicleIDs []string
+	// From and To bound the time of the records, inclusively. Each
+	// collection documents the time it bounds. Zero values leave the range open.
+	From, To time.Time
+	// Match selects the records whose field equals any of the values
+	Match map[string][]interface{}
+	// Sort orders the records; end it with _id for a total order
+	Sort []SortKey
+	// After selects the records that follow these values of the Sort fields,
+	// which are those of the last record of the previous page
+	After []interface{}
+	// Limit caps the number of records; 0 returns them all
+	Limit int
+}
+
+// SortKey is a field to sort by
+type SortKey struct {
+	Field      string
+	Descending bool
+}
+
+// The times bounded by Query.From and Query.To. The time of a vehicle is its
+// creation, read from its ObjectID.
+const (
+	telemetryTime   = "timestamp"
+	vehicleTime     = "_id"
+	tripTime        = "start_time"
+	maintenanceTime = "service_date"
+	costTime        = "date"
 )
 
 // TelemetryCollection defines the interface for telemetry data operations.
 type TelemetryCollection interface {
 	InsertTelemetry(ctx context.Context, telemetry models.Telemetry) error
-	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (TelemetryCursor, error)
+	// FindTelemetry bounds the time of the records by their timestamp
+	FindTelemetry(ctx context.Context, q Query) ([]models.Telemetry, error)
 	DeleteAll(ctx context.Context) error
 }
 
-// TelemetryCursor defines the interface for telemetry cursor operations.
-type TelemetryCursor interface {
-	All(ctx context.Context, out interface{}) error
-	Close(ctx context.Context) error
-}
-
 // VehicleCollection defines the interface for vehicle data operations.
 type VehicleCollection interface {
 	InsertVehicle(ctx context.Context, vehicle models.Vehicle) error
-	FindVehicles(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (VehicleCursor, error)
+	// FindVehicles bounds the time of the vehicles by their creation
+	FindVehicles(ctx context.Context, q Query) ([]models.Vehicle, error)
 	FindVehicleByID(ctx context.Context, id string) (*models.Vehicle, error)
 	UpdateVehicle(ctx context.Context, id string, vehicle models.Vehicle) error
 	DeleteVehicle(ctx context.Context, id string) error
 	DeleteAll(ctx context.Context) error
 }
 
-// VehicleCursor defines the interface for vehicle cursor operations.
-type VehicleCursor interface {
-	All(ctx context.Context, out interface{}) error
-	Close(ctx context.Context) error
-}
-
 // TripCollection defines the interface for trip data operations.
 type TripCollection interface {
 	InsertTrip(ctx context.Context, trip models.Trip) error
-	FindTrips(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (TripCursor, error)
+	// FindTrips bounds the time of the trips by their start time
+	FindTrips(ctx context.Context, q Query) ([]models.Trip, error)
 	FindTripByID(ctx context.Context, id string) (*models.Trip, error)
 	UpdateTrip(ctx context.Context, id string, trip models.Trip) error
 	DeleteTrip(ctx context.Context, id string) error
 	DeleteAll(ctx context.Context) error
 }
 
-// TripCursor defines the interface for trip cursor operations.
-type TripCursor interface {
-	All(ctx context.Context, out interface{}) error
-	Close(ctx context.Context) error
-}
-
 // MaintenanceCollection defines the interface for maintenance data operations.
 type MaintenanceCollection interface {
 	InsertMaintenance(ctx context.Context, maintenance models.Maintenance) error
-	FindMaintenance(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (MaintenanceCursor, error)
+	// FindMaintenance bounds the time of the records by their service date
+	FindMaintenance(ctx context.Context, q Query) ([]models.Maintenance, error)
 	FindMaintenanceByID(ctx context.Context, id string) (*models.Maintenance, error)
 	UpdateMaintenance(ctx context.Context, id string, maintenance models.Maintenance) error
 	DeleteMaintenance(ctx context.Context, id string) error
 	DeleteAll(ctx context.Context) error
 }
 
-// MaintenanceCursor defines the interface for maintenance cursor operations.
-type MaintenanceCursor interface {
-	All(ctx context.Context, out interface{}) error
-	Close(ctx context.Context) error
-}
-
 // CostCollection defines the interface for cost data operations.
 type CostCollection interface {
 	InsertCost(ctx context.Context, cost models.Cost) error
-	FindCosts(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (CostCursor, error)
+	// FindCosts bounds the time of the records by their date
+	FindCosts(ctx context.Context, q Query) ([]models.Cost, error)
 	FindCostByID(ctx context.Context, id string) (*models.Cost, error)
 	UpdateCost(ctx context.Context, id string, cost models.Cost) error
 	DeleteCost(ctx context.Context, id string) error
 	DeleteAll(ctx context.Context) error
 }
-
-// CostCursor defines the interface for cost cursor operations.
-type CostCursor interface {
-	All(ctx context.Context, out interface{}) error
-	Close(ctx context.Context) error
-}
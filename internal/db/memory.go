@@ -0,0 +1,532 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryCollection is an in-process collection of telemetry, vehicles,
+// trips, maintenance or cost records, like MongoCollection, for running the
+// server and its tests without a database. Records are kept as BSON
+// documents, so they read back as they would from MongoDB, with times in
+// milliseconds. Queries are confined to the tenant scope of their context.
+type MemoryCollection struct {
+	mu    sync.RWMutex
+	docs  []bson.D                   // in insertion order
+	index map[primitive.ObjectID]int // position in docs by _id
+}
+
+// NewMemoryCollection creates an empty in-memory collection
+func NewMemoryCollection() *MemoryCollection {
+	return &MemoryCollection{index: map[primitive.ObjectID]int{}}
+}
+
+// InsertTelemetry stores a telemetry record
+func (c *MemoryCollection) InsertTelemetry(ctx context.Context, telemetry models.Telemetry) error {
+	telemetry.TenantID = scopedTenantID(ctx, telemetry.TenantID)
+	return c.insert(telemetry)
+}
+
+// FindTelemetry queries telemetry records
+func (c *MemoryCollection) FindTelemetry(ctx context.Context, q Query) ([]models.Telemetry, error) {
+	return memoryFind[models.Telemetry](ctx, c, q, telemetryTime)
+}
+
+// InsertVehicle stores a vehicle
+func (c *MemoryCollection) InsertVehicle(ctx context.Context, vehicle models.Vehicle) error {
+	vehicle.TenantID = scopedTenantID(ctx, vehicle.TenantID)
+	return c.insert(vehicle)
+}
+
+// FindVehicles queries vehicles
+func (c *MemoryCollection) FindVehicles(ctx context.Context, q Query) ([]models.Vehicle, error) {
+	return memoryFind[models.Vehicle](ctx, c, q, vehicleTime)
+}
+
+// FindVehicleByID finds a vehicle by its ID
+func (c *MemoryCollection) FindVehicleByID(ctx context.Context, id string) (*models.Vehicle, error) {
+	return memoryFindByID[models.Vehicle](ctx, c, id)
+}
+
+// UpdateVehicle updates a vehicle by its ID
+func (c *MemoryCollection) UpdateVehicle(ctx context.Context, id string, vehicle models.Vehicle) error {
+	vehicle.TenantID = scopedTenantID(ctx, vehicle.TenantID)
+	return c.update(ctx, id, vehicle)
+}
+
+// DeleteVehicle deletes a vehicle by its ID
+func (c *MemoryCollection) DeleteVehicle(ctx context.Context, id string) error {
+	return c.delete(ctx, id)
+}
+
+// InsertTrip stores a trip
+func (c *MemoryCollection) InsertTrip(ctx context.Context, trip models.Trip) error {
+	trip.CreatedAt = time.Now()
+	trip.UpdatedAt = time.Now()
+	trip.TenantID = scopedTenantID(ctx, trip.TenantID)
+	return c.insert(trip)
+}
+
+// FindTrips queries trips
+func (c *MemoryCollection) FindTrips(ctx context.Context, q Query) ([]models.Trip, error) {
+	return memoryFind[models.Trip](ctx, c, q, tripTime)
+}
+
+// FindTripByID finds a trip by its ID
+func (c *MemoryCollection) FindTripByID(ctx context.Context, id string) (*models.Trip, error) {
+	return memoryFindByID[models.Trip](ctx, c, id)
+}
+
+// UpdateTrip updates a trip by its ID
+func (c *MemoryCollection) UpdateTrip(ctx context.Context, id string, trip models.Trip) error {
+	trip.UpdatedAt = time.Now()
+	trip.TenantID = scopedTenantID(ctx, trip.TenantID)
+	return c.update(ctx, id, trip)
+}
+
+// DeleteTrip deletes a trip by its ID
+func (c *MemoryCollection) DeleteTrip(ctx context.Context, id string) error {
+	return c.delete(ctx, id)
+}
+
+// InsertMaintenance stores a maintenance record
+func (c *MemoryCollection) InsertMaintenance(ctx context.Context, maintenance models.Maintenance) error {
+	maintenance.CreatedAt = time.Now()
+	maintenance.UpdatedAt = time.Now()
+	maintenance.TenantID = scopedTenantID(ctx, maintenance.TenantID)
+	return c.insert(maintenance)
+}
+
+// FindMaintenance queries maintenance records
+func (c *MemoryCollection) FindMaintenance(ctx context.Context, q Query) ([]models.Maintenance, error) {
+	return memoryFind[models.Maintenance](ctx, c, q, maintenanceTime)
+}
+
+// FindMaintenanceByID finds a maintenance record by its ID
+func (c *MemoryCollection) FindMaintenanceByID(ctx context.Context, id string) (*models.Maintenance, error) {
+	return memoryFindByID[models.Maintenance](ctx, c, id)
+}
+
+// UpdateMaintenance updates a maintenance record by its ID
+func (c *MemoryCollection) UpdateMaintenance(ctx context.Context, id string, maintenance models.Maintenance) error {
+	maintenance.UpdatedAt = time.Now()
+	maintenance.TenantID = scopedTenantID(ctx, maintenance.TenantID)
+	return c.update(ctx, id, maintenance)
+}
+
+// DeleteMaintenance deletes a maintenance record by its ID
+func (c *MemoryCollection) DeleteMaintenance(ctx context.Context, id string) error {
+	return c.delete(ctx, id)
+}
+
+// InsertCost stores a cost record
+func (c *MemoryCollection) InsertCost(ctx context.Context, cost models.Cost) error {
+	cost.CreatedAt = time.Now()
+	cost.UpdatedAt = time.Now()
+	cost.TenantID = scopedTenantID(ctx, cost.TenantID)
+	return c.insert(cost)
+}
+
+// FindCosts queries cost records
+func (c *MemoryCollection) FindCosts(ctx context.Context, q Query) ([]models.Cost, error) {
+	return memoryFind[models.Cost](ctx, c, q, costTime)
+}
+
+// FindCostByID finds a cost record by its ID
+func (c *MemoryCollection) FindCostByID(ctx context.Context, id string) (*models.Cost, error) {
+	return memoryFindByID[models.Cost](ctx, c, id)
+}
+
+// UpdateCost updates a cost record by its ID
+func (c *MemoryCollection) UpdateCost(ctx context.Context, id string, cost models.Cost) error {
+	cost.UpdatedAt = time.Now()
+	cost.TenantID = scopedTenantID(ctx, cost.TenantID)
+	return c.update(ctx, id, cost)
+}
+
+// DeleteCost deletes a cost record by its ID
+func (c *MemoryCollection) DeleteCost(ctx context.Context, id string) error {
+	return c.delete(ctx, id)
+}
+
+// DeleteAll deletes all records of the collection within the tenant scope
+func (c *MemoryCollection) DeleteAll(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kept := c.docs[:0]
+	for _, doc := range c.docs {
+		if !inScope(ctx, doc) {
+			kept = append(kept, doc)
+		}
+	}
+	clear(c.docs[len(kept):])
+	c.docs = kept
+	c.reindex(0)
+	return nil
+}
+
+// insert stores record, giving it an ObjectID when it has no _id
+func (c *MemoryCollection) insert(record interface{}) error {
+	doc, err := toDocument(record)
+	if err != nil {
+		return err
+	}
+	value, ok := lookup(doc, "_id")
+	if !ok {
+		value = primitive.NewObjectID()
+		doc = append(bson.D{{Key: "_id", Value: value}}, doc...)
+	}
+	id, ok := value.(primitive.ObjectID)
+	if !ok {
+		return fmt.Errorf("_id must be an ObjectID, not %T", value)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.index[id]; exists {
+		return errors.New("duplicate _id")
+	}
+	c.index[id] = len(c.docs)
+	c.docs = append(c.docs, doc)
+	return nil
+}
+
+// update sets the fields of record on the document with the hex id
+func (c *MemoryCollection) update(ctx context.Context, id string, record interface{}) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	set, err := toDocument(record)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.indexOf(ctx, objectID)
+	if i < 0 {
+		return ErrNotFound
+	}
+	doc := append(bson.D{}, c.docs[i]...)
+	for _, field := range set {
+		replaced := false
+		for j := range doc {
+			if doc[j].Key == field.Key {
+				doc[j].Value, replaced = field.Value, true
+				break
+			}
+		}
+		if !replaced {
+			doc = append(doc, field)
+		}
+	}
+	c.docs[i] = doc
+	return nil
+}
+
+// delete removes the document with the hex id
+func (c *MemoryCollection) delete(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.indexOf(ctx, objectID)
+	if i < 0 {
+		return ErrNotFound
+	}
+	delete(c.index, objectID)
+	c.docs = append(c.docs[:i], c.docs[i+1:]...)
+	c.reindex(i)
+	return nil
+}
+
+// reindex indexes the positions of the documents from i on, which moved.
+// The caller holds the lock.
+func (c *MemoryCollection) reindex(i int) {
+	if i == 0 {
+		clear(c.index)
+	}
+	for ; i < len(c.docs); i++ {
+		id, _ := lookup(c.docs[i], "_id")
+		c.index[id.(primitive.ObjectID)] = i
+	}
+}
+
+// indexOf returns the position of the document with the ID in the tenant
+// scope of ctx, or -1. The caller holds the lock.
+func (c *MemoryCollection) indexOf(ctx context.Context, id primitive.ObjectID) int {
+	if i, ok := c.index[id]; ok && inScope(ctx, c.docs[i]) {
+		return i
+	}
+	return -1
+}
+
+// memoryFindByID finds the record with the hex id in c
+func memoryFindByID[T any](ctx context.Context, c *MemoryCollection, id string) (*T, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	i := c.indexOf(ctx, objectID)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	var record T
+	if err := fromDocument(c.docs[i], &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// memoryFind runs q against c, with timeField bounded by its time range
+func memoryFind[T any](ctx context.Context, c *MemoryCollection, q Query, timeField string) ([]T, error) {
+	if len(q.After) > 0 && len(q.After) != len(q.Sort) {
+		return nil, errors.New("query has a different number of sort fields and values to follow")
+	}
+	c.mu.RLock()
+	var docs []bson.D
+	for _, doc := range c.docs {
+		if inScope(ctx, doc) && matches(doc, q, timeField) {
+			docs = append(docs, doc)
+		}
+	}
+	c.mu.RUnlock()
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		return compareDocuments(docs[i], docs[j], q.Sort) < 0
+	})
+	if q.Limit > 0 && len(docs) > q.Limit {
+		docs = docs[:q.Limit]
+	}
+	records := make([]T, len(docs))
+	for i, doc := range docs {
+		if err := fromDocument(doc, &records[i]); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// matches reports whether doc is selected by q
+func matches(doc bson.D, q Query, timeField string) bool {
+	if len(q.VehicleIDs) > 0 {
+		value, _ := lookup(doc, "vehicle_id")
+		if id, ok := value.(primitive.ObjectID); ok {
+			value = id.Hex()
+		}
+		found := false
+		for _, id := range q.VehicleIDs {
+			if value == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for field, values := range q.Match {
+		value, _ := lookup(doc, field)
+		found := false
+		for _, want := range values {
+			if compareValues(value, want) == 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !q.From.IsZero() || !q.To.IsZero() {
+		value, ok := lookup(doc, timeField)
+		var t time.Time
+		switch v := value.(type) {
+		case primitive.DateTime:
+			t = v.Time()
+		case primitive.ObjectID:
+			t = v.Timestamp()
+		default:
+			ok = false
+		}
+		if !ok {
+			return false
+		}
+		from, to := q.From, q.To
+		if timeField == "_id" {
+			// ObjectIDs hold their creation time in seconds
+			from = from.Truncate(time.Second)
+		}
+		if !from.IsZero() && compareValues(t, from) < 0 {
+			return false
+		}
+		if !to.IsZero() && compareValues(t, to) > 0 {
+			return false
+		}
+	}
+	if len(q.After) > 0 {
+		// Only the records following the keyset in sort order
+		after := make(bson.D, len(q.Sort))
+		for i, key := range q.Sort {
+			after[i] = bson.E{Key: key.Field, Value: q.After[i]}
+		}
+		if compareDocuments(doc, after, q.Sort) <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// compareDocuments orders a before b by the sort keys
+func compareDocuments(a, b bson.D, keys []SortKey) int {
+	for _, key := range keys {
+		x, _ := lookup(a, key.Field)
+		y, _ := lookup(b, key.Field)
+		if c := compareValues(x, y); c != 0 {
+			if key.Descending {
+				return -c
+			}
+			return c
+		}
+	}
+	return 0
+}
+
+// compareValues orders two field values as MongoDB does: missing values and
+// nulls, then numbers, strings, ObjectIDs, booleans and times
+func compareValues(a, b interface{}) int {
+	x, y := canonical(a), canonical(b)
+	if x.rank != y.rank {
+		return x.rank - y.rank
+	}
+	switch x.rank {
+	case rankNumber:
+		switch {
+		case x.number < y.number:
+			return -1
+		case x.number > y.number:
+			return 1
+		}
+	case rankString:
+		return strings.Compare(x.text, y.text)
+	case rankObjectID:
+		return bytes.Compare(x.id[:], y.id[:])
+	case rankBool:
+		if x.flag != y.flag {
+			if x.flag {
+				return 1
+			}
+			return -1
+		}
+	case rankTime:
+		switch {
+		case x.millis < y.millis:
+			return -1
+		case x.millis > y.millis:
+			return 1
+		}
+	}
+	return 0
+}
+
+// Ranks of value types in the sort order
+const (
+	rankNull = iota
+	rankNumber
+	rankString
+	rankOther
+	rankObjectID
+	rankBool
+	rankTime
+)
+
+// canonicalValue is a field value reduced to what orders it
+type canonicalValue struct {
+	rank   int
+	number float64
+	text   string
+	id     primitive.ObjectID
+	flag   bool
+	millis int64
+}
+
+// canonical reduces a stored or queried value to its sort rank and key
+func canonical(value interface{}) canonicalValue {
+	switch v := value.(type) {
+	case nil:
+		return canonicalValue{rank: rankNull}
+	case int:
+		return canonicalValue{rank: rankNumber, number: float64(v)}
+	case int32:
+		return canonicalValue{rank: rankNumber, number: float64(v)}
+	case int64:
+		return canonicalValue{rank: rankNumber, number: float64(v)}
+	case float64:
+		return canonicalValue{rank: rankNumber, number: v}
+	case string:
+		return canonicalValue{rank: rankString, text: v}
+	case primitive.ObjectID:
+		return canonicalValue{rank: rankObjectID, id: v}
+	case bool:
+		return canonicalValue{rank: rankBool, flag: v}
+	case primitive.DateTime:
+		return canonicalValue{rank: rankTime, millis: int64(v)}
+	case time.Time:
+		return canonicalValue{rank: rankTime, millis: int64(primitive.NewDateTimeFromTime(v))}
+	default:
+		return canonicalValue{rank: rankOther}
+	}
+}
+
+// inScope reports whether doc belongs to the tenant scope of ctx
+func inScope(ctx context.Context, doc bson.D) bool {
+	tenantID, ok := TenantFromContext(ctx)
+	if !ok {
+		return true
+	}
+	value, _ := lookup(doc, "tenant_id")
+	return value == tenantID
+}
+
+// lookup returns the value of a top-level field of doc
+func lookup(doc bson.D, key string) (interface{}, bool) {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// toDocument encodes record as MongoDB would store it
+func toDocument(record interface{}) (bson.D, error) {
+	data, err := bson.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.D
+	err = bson.Unmarshal(data, &doc)
+	return doc, err
+}
+
+// fromDocument decodes doc into out
+func fromDocument(doc bson.D, out interface{}) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, out)
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryCollection_Trips(t *testing.T) {
+	coll := NewMemoryCollection()
+	acme := WithTenant(context.Background(), "acme")
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	var ids []primitive.ObjectID
+	for i, status := range []string{"completed", "planned", "completed", "planned"} {
+		trip := models.Trip{ID: primitive.NewObjectID(), VehicleID: "v1", Status: status, StartTime: start.Add(time.Duration(i) * time.Hour), TenantID: "beta"}
+		require.NoError(t, coll.InsertTrip(acme, trip))
+		ids = append(ids, trip.ID)
+	}
+	require.NoError(t, coll.InsertTrip(WithTenant(context.Background(), "beta"), models.Trip{VehicleID: "v1", Status: "planned", StartTime: start}))
+	require.NoError(t, coll.InsertTrip(acme, models.Trip{VehicleID: "v2", Status: "planned", StartTime: start}))
+
+	all, err := coll.FindTrips(acme, Query{VehicleIDs: []string{"v1"}})
+	require.NoError(t, err)
+	assert.Len(t, all, 4, "other tenants and vehicles are left out")
+	assert.Equal(t, "acme", all[0].TenantID, "records are stamped with the scope")
+	assert.False(t, all[0].CreatedAt.IsZero())
+
+	byStatus := Query{
+		VehicleIDs: []string{"v1"},
+		From:       start.Add(time.Hour),
+		Match:      map[string][]interface{}{"status": {"planned", "completed"}},
+		Sort:       []SortKey{{Field: "status"}, {Field: "start_time", Descending: true}, {Field: "_id", Descending: true}},
+		Limit:      2,
+	}
+	page, err := coll.FindTrips(acme, byStatus)
+	require.NoError(t, err)
+	if assert.Len(t, page, 2) {
+		assert.Equal(t, ids[2], page[0].ID)
+		assert.Equal(t, ids[3], page[1].ID)
+	}
+
+	// The next page follows the keyset of the last record
+	last := page[1]
+	byStatus.After = []interface{}{last.Status, last.StartTime, last.ID}
+	page, err = coll.FindTrips(acme, byStatus)
+	require.NoError(t, err)
+	if assert.Len(t, page, 1) {
+		assert.Equal(t, ids[1], page[0].ID)
+	}
+
+	found, err := coll.FindTripByID(acme, ids[0].Hex())
+	require.NoError(t, err)
+	found.Notes = "late"
+	require.NoError(t, coll.UpdateTrip(acme, ids[0].Hex(), *found))
+	found, err = coll.FindTripByID(acme, ids[0].Hex())
+	require.NoError(t, err)
+	assert.Equal(t, "late", found.Notes)
+	assert.Equal(t, start, found.StartTime)
+
+	other := WithTenant(context.Background(), "beta")
+	_, err = coll.FindTripByID(other, ids[0].Hex())
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, coll.UpdateTrip(other, ids[0].Hex(), *found), ErrNotFound)
+	assert.ErrorIs(t, coll.DeleteTrip(other, ids[0].Hex()), ErrNotFound)
+
+	require.NoError(t, coll.DeleteTrip(acme, ids[0].Hex()))
+	assert.ErrorIs(t, coll.DeleteTrip(acme, ids[0].Hex()), ErrNotFound)
+
+	require.NoError(t, coll.DeleteAll(acme))
+	left, err := coll.FindTrips(context.Background(), Query{})
+	require.NoError(t, err)
+	if assert.Len(t, left, 1, "only the scope is cleared") {
+		assert.Equal(t, "beta", left[0].TenantID)
+	}
+}
+
+func TestMemoryCollection_Telemetry(t *testing.T) {
+	coll := NewMemoryCollection()
+	ctx := context.Background()
+	vehicleID := primitive.NewObjectID()
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, coll.InsertTelemetry(ctx, models.Telemetry{VehicleID: vehicleID, Timestamp: at.Add(time.Duration(i) * time.Minute), Speed: float64(i * 10)}))
+	}
+	require.NoError(t, coll.InsertTelemetry(ctx, models.Telemetry{VehicleID: primitive.NewObjectID(), Timestamp: at}))
+
+	telemetry, err := coll.FindTelemetry(ctx, Query{
+		VehicleIDs: []string{vehicleID.Hex()},
+		To:         at.Add(time.Minute),
+		Sort:       []SortKey{{Field: "timestamp", Descending: true}},
+	})
+	require.NoError(t, err)
+	if assert.Len(t, telemetry, 2) {
+		assert.Equal(t, 10.0, telemetry[0].Speed)
+		assert.False(t, telemetry[0].ID.IsZero(), "IDs are assigned on insert")
+	}
+
+	// The years of vehicles are stored as integers
+	require.NoError(t, coll.InsertVehicle(ctx, models.Vehicle{Make: "Volvo", Year: 2022}))
+	vehicles, err := coll.FindVehicles(ctx, Query{Match: map[string][]interface{}{"year": {2022}}, From: time.Now().Add(-time.Minute)})
+	require.NoError(t, err)
+	assert.Len(t, vehicles, 1)
+	vehicles, err = coll.FindVehicles(ctx, Query{To: time.Now().Add(-time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, vehicles, "vehicles are bounded by their creation")
+}
+
+func TestMemoryCollection_Index(t *testing.T) {
+	coll := NewMemoryCollection()
+	ctx := context.Background()
+	var ids []primitive.ObjectID
+	for i := 0; i < 5; i++ {
+		id := primitive.NewObjectID()
+		require.NoError(t, coll.InsertCost(ctx, models.Cost{ID: id, VehicleID: "v1", Amount: float64(i + 1)}))
+		ids = append(ids, id)
+	}
+	assert.Error(t, coll.InsertCost(ctx, models.Cost{ID: ids[0], VehicleID: "v1"}), "IDs are unique")
+
+	// Records after a deleted one are still found by ID
+	require.NoError(t, coll.DeleteCost(ctx, ids[1].Hex()))
+	for i, id := range ids {
+		cost, err := coll.FindCostByID(ctx, id.Hex())
+		if i == 1 {
+			assert.ErrorIs(t, err, ErrNotFound)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, float64(i+1), cost.Amount)
+	}
+	require.NoError(t, coll.InsertCost(ctx, models.Cost{ID: ids[1], VehicleID: "v1", Amount: 9}), "deleted IDs can be reused")
+
+	require.NoError(t, coll.DeleteAll(WithTenant(ctx, "acme")))
+	cost, err := coll.FindCostByID(ctx, ids[4].Hex())
+	require.NoError(t, err, "records outside the scope are kept and reindexed")
+	assert.Equal(t, 5.0, cost.Amount)
+	require.NoError(t, coll.DeleteAll(ctx))
+	_, err = coll.FindCostByID(ctx, ids[4].Hex())
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCompareValues(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 0, compareValues(int32(3), 3))
+	assert.Equal(t, -1, compareValues(2.5, int64(3)))
+	assert.Equal(t, 0, compareValues(primitive.NewDateTimeFromTime(at), at))
+	assert.Negative(t, compareValues(nil, 0))
+	assert.Negative(t, compareValues(99, "a"), "numbers sort before strings")
+	assert.Negative(t, compareValues("b", primitive.NewObjectID()))
+}
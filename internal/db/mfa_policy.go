@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MFAPolicyStore stores per-tenant MFA policies. Tenants without a stored
+// policy get an empty one that requires MFA for nobody.
+type MFAPolicyStore interface {
+	GetMFAPolicy(ctx context.Context, tenantID string) (*models.MFAPolicy, error)
+	SetMFAPolicy(ctx context.Context, policy models.MFAPolicy) error
+}
+
+// MongoMFAPolicyStore implements MFAPolicyStore for MongoDB, keyed by tenant ID
+type MongoMFAPolicyStore struct {
+	Collection *mongo.Collection
+}
+
+// GetMFAPolicy returns the tenant's MFA policy
+func (s *MongoMFAPolicyStore) GetMFAPolicy(ctx context.Context, tenantID string) (*models.MFAPolicy, error) {
+	var policy models.MFAPolicy
+	err := s.Collection.FindOne(ctx, bson.M{"_id": tenantID}).Decode(&policy)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &models.MFAPolicy{TenantID: tenantID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// SetMFAPolicy stores the tenant's MFA policy
+func (s *MongoMFAPolicyStore) SetMFAPolicy(ctx context.Context, policy models.MFAPolicy) error {
+	_, err := s.Collection.ReplaceOne(ctx, bson.M{"_id": policy.TenantID}, policy, options.Replace().SetUpsert(true))
+	return err
+}
+
+// MemoryMFAPolicyStore is an in-process MFAPolicyStore, suitable for tests
+type MemoryMFAPolicyStore struct {
+	mu       sync.RWMutex
+	policies map[string]models.MFAPolicy
+}
+
+// NewMemoryMFAPolicyStore creates an empty in-memory MFA policy store
+func NewMemoryMFAPolicyStore() *MemoryMFAPolicyStore {
+	return &MemoryMFAPolicyStore{policies: make(map[string]models.MFAPolicy)}
+}
+
+// GetMFAPolicy returns the tenant's MFA policy
+func (s *MemoryMFAPolicyStore) GetMFAPolicy(ctx context.Context, tenantID string) (*models.MFAPolicy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	policy, ok := s.policies[tenantID]
+	if !ok {
+		return &models.MFAPolicy{TenantID: tenantID}, nil
+	}
+	policy.RequiredRoles = append([]models.Role(nil), policy.RequiredRoles...)
+	return &policy, nil
+}
+
+// SetMFAPolicy stores the tenant's MFA policy
+func (s *MemoryMFAPolicyStore) SetMFAPolicy(ctx context.Context, policy models.MFAPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	policy.RequiredRoles = append([]models.Role(nil), policy.RequiredRoles...)
+	s.policies[policy.TenantID] = policy
+	return nil
+}
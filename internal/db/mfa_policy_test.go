@@ -0,0 +1,30 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+)
+
+func TestMemoryMFAPolicyStore(t *testing.T) {
+	store := NewMemoryMFAPolicyStore()
+
+	policy, err := store.GetMFAPolicy(context.Background(), "tenant-a")
+	assert.NoError(t, err)
+	assert.Equal(t, "tenant-a", policy.TenantID)
+	assert.False(t, policy.Requires(models.RoleAdmin))
+
+	err = store.SetMFAPolicy(context.Background(), models.MFAPolicy{TenantID: "tenant-a", RequiredRoles: []models.Role{models.RoleAdmin, models.RoleManager}})
+	assert.NoError(t, err)
+
+	policy, err = store.GetMFAPolicy(context.Background(), "tenant-a")
+	assert.NoError(t, err)
+	assert.True(t, policy.Requires(models.RoleAdmin))
+	assert.True(t, policy.Requires(models.RoleManager))
+	assert.False(t, policy.Requires(models.RoleViewer))
+
+	other, _ := store.GetMFAPolicy(context.Background(), "tenant-b")
+	assert.False(t, other.Requires(models.RoleAdmin))
+}
@@ -6,8 +6,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/ukydev/fleet-sustainability/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -57,65 +60,14 @@ func TestInsertTelemetry_ValidTelemetry(t *testing.T) {
 	}
 }
 
-func TestMongoCollection_Find_NilCollection(t *testing.T) {
+func TestMongoCollection_FindTelemetry_NilCollection(t *testing.T) {
 	coll := &MongoCollection{Collection: nil}
-	ctx := context.Background()
-
-	// This should panic due to nil collection, which is expected behavior
-	defer func() {
-		if r := recover(); r == nil {
-			t.Error("expected panic with nil collection")
-		}
-	}()
-
-	cursor, err := coll.Find(ctx, map[string]interface{}{})
-	// This line should not be reached due to panic
+	telemetry, err := coll.FindTelemetry(context.Background(), Query{Limit: 10})
 	if err == nil {
 		t.Error("expected error when collection is nil")
 	}
-	if cursor != nil {
-		t.Error("expected nil cursor when collection is nil")
-	}
-}
-
-func TestMongoTelemetryCursor_All(t *testing.T) {
-	// Test cursor All method with nil cursor
-	cursor := &mongoTelemetryCursor{
-		cursor: nil, // This will cause a panic, which is expected
-	}
-
-	// This should panic due to nil cursor
-	defer func() {
-		if r := recover(); r == nil {
-			t.Error("expected panic with nil cursor")
-		}
-	}()
-
-	var results []models.Telemetry
-	err := cursor.All(context.Background(), &results)
-	// This line should not be reached due to panic
-	if err == nil {
-		t.Error("expected error with nil cursor")
-	}
-}
-
-func TestMongoTelemetryCursor_Close(t *testing.T) {
-	// Test cursor Close method with nil cursor
-	cursor := &mongoTelemetryCursor{
-		cursor: nil, // This will cause a panic, which is expected
-	}
-
-	// This should panic due to nil cursor
-	defer func() {
-		if r := recover(); r == nil {
-			t.Error("expected panic with nil cursor")
-		}
-	}()
-
-	err := cursor.Close(context.Background())
-	// This line should not be reached due to panic
-	if err == nil {
-		t.Error("expected error with nil cursor")
+	if len(telemetry) != 0 {
+		t.Error("expected no telemetry when collection is nil")
 	}
 }
 
@@ -246,68 +198,6 @@ func TestInsertTelemetry_WithPointerFields(t *testing.T) {
 	}
 }
 
-func TestMongoCollection_Find_WithOptions(t *testing.T) {
-	coll := &MongoCollection{Collection: nil}
-	ctx := context.Background()
-
-	// This should panic due to nil collection, which is expected behavior
-	defer func() {
-		if r := recover(); r == nil {
-			t.Error("expected panic with nil collection")
-		}
-	}()
-
-	// Test with find options
-	opts := []*options.FindOptions{
-		options.Find().SetLimit(10),
-		options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}),
-	}
-
-	cursor, err := coll.Find(ctx, map[string]interface{}{}, opts...)
-	// This line should not be reached due to panic
-	if err == nil {
-		t.Error("expected error when collection is nil")
-	}
-	if cursor != nil {
-		t.Error("expected nil cursor when collection is nil")
-	}
-}
-
-func TestMongoCollection_Find_WithComplexFilter(t *testing.T) {
-	coll := &MongoCollection{Collection: nil}
-	ctx := context.Background()
-
-	// This should panic due to nil collection, which is expected behavior
-	defer func() {
-		if r := recover(); r == nil {
-			t.Error("expected panic with nil collection")
-		}
-	}()
-
-	// Test with complex filter
-	complexFilter := map[string]interface{}{
-		"timestamp": map[string]interface{}{
-			"$gte": time.Now().Add(-24 * time.Hour),
-			"$lte": time.Now(),
-		},
-		"speed": map[string]interface{}{
-			"$gt": 0,
-		},
-		"emissions": map[string]interface{}{
-			"$lt": 100,
-		},
-	}
-
-	cursor, err := coll.Find(ctx, complexFilter)
-	// This line should not be reached due to panic
-	if err == nil {
-		t.Error("expected error when collection is nil")
-	}
-	if cursor != nil {
-		t.Error("expected nil cursor when collection is nil")
-	}
-}
-
 func TestConnectMongo_EnvironmentVariableHandling(t *testing.T) {
 	// Test various environment variable scenarios
 	testCases := []struct {
@@ -357,43 +247,47 @@ func TestConnectMongo_EnvironmentVariableHandling(t *testing.T) {
 	}
 }
 
-func TestMongoTelemetryCursor_WithNilCursor(t *testing.T) {
-	// Test cursor methods with nil cursor
-	cursor := &mongoTelemetryCursor{
-		cursor: nil,
-	}
-
-	// Test All method
-	defer func() {
-		if r := recover(); r == nil {
-			t.Error("expected panic with nil cursor")
-		}
-	}()
-
-	var results []models.Telemetry
-	err := cursor.All(context.Background(), &results)
-	// This line should not be reached due to panic
-	if err == nil {
-		t.Error("expected error with nil cursor")
-	}
-}
-
-func TestMongoTelemetryCursor_WithNilCursorClose(t *testing.T) {
-	// Test Close method with nil cursor
-	cursor := &mongoTelemetryCursor{
-		cursor: nil,
-	}
-
-	// This should panic due to nil cursor
-	defer func() {
-		if r := recover(); r == nil {
-			t.Error("expected panic with nil cursor")
-		}
-	}()
-
-	err := cursor.Close(context.Background())
-	// This line should not be reached due to panic
-	if err == nil {
-		t.Error("expected error with nil cursor")
-	}
+func TestMongoFilter(t *testing.T) {
+	vehicleID := primitive.NewObjectID()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	last := primitive.NewObjectID()
+	q := Query{
+		VehicleIDs: []string{vehicleID.Hex()},
+		From:       from,
+		Match:      map[string][]interface{}{"status": {"planned", "completed"}},
+		Sort:       []SortKey{{Field: "status"}, {Field: "_id", Descending: true}},
+		After:      []interface{}{"planned", last},
+		Limit:      3,
+	}
+	filter, err := mongoFilter(q, "timestamp", true)
+	require.NoError(t, err)
+	assert.Equal(t, bson.M{
+		"vehicle_id": vehicleID,
+		"status":     bson.M{"$in": bson.A{"planned", "completed"}},
+		"timestamp":  bson.M{"$gte": from},
+		"$or": bson.A{
+			bson.M{"status": bson.M{"$gt": "planned"}},
+			bson.M{"status": "planned", "_id": bson.M{"$lt": last}},
+		},
+	}, filter)
+	opts := mongoFindOptions(q)
+	assert.Equal(t, bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: -1}}, opts.Sort)
+	assert.Equal(t, int64(3), *opts.Limit)
+
+	// Vehicles are bounded by the creation time in their ObjectIDs
+	filter, err = mongoFilter(Query{To: from}, "_id", false)
+	require.NoError(t, err)
+	upper, _ := primitive.ObjectIDFromHex("65920080ffffffffffffffff")
+	assert.Equal(t, bson.M{"_id": bson.M{"$lte": upper}}, filter)
+
+	_, err = mongoFilter(Query{VehicleIDs: []string{"nope"}}, "timestamp", true)
+	assert.Error(t, err)
+	filter, err = mongoFilter(Query{VehicleIDs: []string{"v1", "v2"}}, "start_time", false)
+	require.NoError(t, err)
+	assert.Equal(t, bson.M{"vehicle_id": bson.M{"$in": bson.A{"v1", "v2"}}}, filter)
+
+	// Keyset values are never read as operators
+	q.After = []interface{}{bson.M{"$ne": nil}, last}
+	_, err = mongoFilter(q, "timestamp", true)
+	assert.Error(t, err)
 }
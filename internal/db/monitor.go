@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/metrics"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// slowCommandThreshold is the latency above which a command is logged
+const slowCommandThreshold = 500 * time.Millisecond
+
+// commandMonitor records the latency of every MongoDB command in
+// metrics.MongoCommandDuration and as an event of the operation's trace span,
+// and logs slow and failed commands with the logger of the operation's
+// context, so they carry its request ID
+func commandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			metrics.MongoCommandDuration.WithLabelValues(e.CommandName, "success").Observe(e.Duration.Seconds())
+			addCommandEvent(ctx, e.CommandName, e.Duration, "success")
+			if e.Duration >= slowCommandThreshold {
+				logging.FromContext(ctx).WithFields(log.Fields{"command": e.CommandName, "duration_ms": e.Duration.Milliseconds()}).Warn("Slow MongoDB command")
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			metrics.MongoCommandDuration.WithLabelValues(e.CommandName, "failure").Observe(e.Duration.Seconds())
+			addCommandEvent(ctx, e.CommandName, e.Duration, "failure")
+			logging.FromContext(ctx).WithFields(log.Fields{"command": e.CommandName, "duration_ms": e.Duration.Milliseconds(), "failure": e.Failure}).Debug("MongoDB command failed")
+		},
+	}
+}
+
+// addCommandEvent records a command on the span of ctx, if it has one
+func addCommandEvent(ctx context.Context, command string, duration time.Duration, outcome string) {
+	trace.SpanFromContext(ctx).AddEvent("mongodb.command", trace.WithAttributes(
+		attribute.String("db.command.name", command),
+		attribute.Float64("duration_ms", float64(duration.Microseconds())/1000),
+		attribute.String("outcome", outcome),
+	))
+}
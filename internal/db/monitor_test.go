@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/metrics"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestCommandMonitor(t *testing.T) {
+	monitor := commandMonitor()
+	succeeded := observations(metrics.MongoCommandDuration, "find", "success")
+	failed := observations(metrics.MongoCommandDuration, "insert", "failure")
+
+	monitor.Succeeded(context.Background(), &event.CommandSucceededEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", Duration: 3 * time.Millisecond},
+	})
+	monitor.Failed(context.Background(), &event.CommandFailedEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "insert", Duration: time.Millisecond},
+		Failure:              "duplicate key",
+	})
+
+	assert.Equal(t, succeeded+1, observations(metrics.MongoCommandDuration, "find", "success"))
+	assert.Equal(t, failed+1, observations(metrics.MongoCommandDuration, "insert", "failure"))
+
+	t.Run("slow commands are logged with the request ID", func(t *testing.T) {
+		logger, hook := logtest.NewNullLogger()
+		ctx := logging.WithLogger(context.Background(), logger.WithField("request_id", "req-1"))
+		monitor.Succeeded(ctx, &event.CommandSucceededEvent{
+			CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "aggregate", Duration: time.Second},
+		})
+		if assert.Len(t, hook.Entries, 1) {
+			assert.Equal(t, "req-1", hook.LastEntry().Data["request_id"])
+			assert.Equal(t, "aggregate", hook.LastEntry().Data["command"])
+		}
+	})
+}
+
+// observations returns the number of observations in the series of vec with
+// the given label values
+func observations(vec *prometheus.HistogramVec, labels ...string) uint64 {
+	var m dto.Metric
+	vec.WithLabelValues(labels...).(prometheus.Histogram).Write(&m)
+	return m.GetHistogram().GetSampleCount()
+}
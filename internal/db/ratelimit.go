@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RateLimit is a token bucket holding Burst tokens that refills at Requests
+// per Period. The zero value is no limit.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// Enabled reports whether the limit restricts anything
+func (l RateLimit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0 && l.Burst > 0
+}
+
+// interval is the time it takes to refill one token
+func (l RateLimit) interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// RateLimitResult is the outcome of taking a token from a bucket
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration // until a token is available, when not allowed
+	ResetAfter time.Duration // until the bucket is full again
+}
+
+// RateLimitStore keeps token buckets. Buckets are tracked with the generic
+// cell rate algorithm: a bucket is only its theoretical arrival time (TAT),
+// the moment it will be full again, so one atomic update takes a token.
+type RateLimitStore interface {
+	// Take removes a token from the bucket named key
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (RateLimitResult, error)
+}
+
+// rateLimitResult derives the outcome of a request at now from the bucket's
+// TAT after the request
+func rateLimitResult(limit RateLimit, tat time.Time, allowed bool, now time.Time) RateLimitResult {
+	interval := limit.interval()
+	tolerance := interval * time.Duration(limit.Burst)
+	result := RateLimitResult{Allowed: allowed, ResetAfter: tat.Sub(now)}
+	if result.ResetAfter < 0 {
+		result.ResetAfter = 0
+	}
+	if allowed {
+		result.Remaining = int((tolerance - result.ResetAfter) / interval)
+	} else {
+		result.RetryAfter = tat.Add(interval - tolerance).Sub(now)
+	}
+	return result
+}
+
+// takeToken applies a request at now to a bucket with the given TAT and
+// returns the new TAT and whether the request fits
+func takeToken(limit RateLimit, tat, now time.Time) (time.Time, bool) {
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(limit.interval())
+	if next.Sub(now) > limit.interval()*time.Duration(limit.Burst) {
+		return tat, false
+	}
+	return next, true
+}
+
+// MongoRateLimitStore implements RateLimitStore for MongoDB so that every
+// instance draws from the same buckets
+type MongoRateLimitStore struct {
+	Collection *mongo.Collection
+}
+
+// EnsureIndexes creates a TTL index so buckets disappear once they are full again.
+func (s *MongoRateLimitStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.Collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tat", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// Take removes a token from the bucket named key in a single pipeline update
+func (s *MongoRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (RateLimitResult, error) {
+	now = now.Truncate(time.Millisecond)
+	interval := limit.interval().Milliseconds()
+	if interval < 1 {
+		interval = 1
+	}
+	latest := now.Add(time.Duration(interval*int64(limit.Burst)) * time.Millisecond)
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"tat": bson.M{"$max": bson.A{bson.M{"$ifNull": bson.A{"$tat", now}}, now}}}}},
+		{{Key: "$set", Value: bson.M{"allowed": bson.M{"$lte": bson.A{bson.M{"$add": bson.A{"$tat", interval}}, latest}}}}},
+		{{Key: "$set", Value: bson.M{"tat": bson.M{"$cond": bson.A{"$allowed", bson.M{"$add": bson.A{"$tat", interval}}, "$tat"}}}}},
+	}
+
+	var doc struct {
+		TAT     time.Time `bson:"tat"`
+		Allowed bool      `bson:"allowed"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := s.Collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&doc); err != nil {
+		return RateLimitResult{}, err
+	}
+	return rateLimitResult(limit, doc.TAT, doc.Allowed, now), nil
+}
+
+// rateLimitSweepInterval is how often the in-memory store drops full buckets
+const rateLimitSweepInterval = time.Minute
+
+// MemoryRateLimitStore is an in-process RateLimitStore, suitable for tests
+// and single-instance setups. Buckets that have refilled are dropped, so idle
+// callers take no memory.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]time.Time // key -> TAT
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory rate limit store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]time.Time)}
+}
+
+// Take removes a token from the bucket named key
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= rateLimitSweepInterval {
+		for k, tat := range s.buckets {
+			if !tat.After(now) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	tat, allowed := takeToken(limit, s.buckets[key], now)
+	s.buckets[key] = tat
+	return rateLimitResult(limit, tat, allowed, now), nil
+}
+
+// Len returns the number of buckets currently tracked
+func (s *MemoryRateLimitStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
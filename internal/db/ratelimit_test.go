@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRateLimitStore_Take(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	ctx := context.Background()
+	limit := RateLimit{Requests: 60, Period: time.Minute, Burst: 3}
+	now := time.Now()
+
+	// A full bucket allows a burst
+	for remaining := 2; remaining >= 0; remaining-- {
+		result, err := store.Take(ctx, "caller", limit, now)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, remaining, result.Remaining)
+	}
+	result, _ := store.Take(ctx, "caller", limit, now)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 3*time.Second, result.ResetAfter)
+
+	// Then refills at the sustained rate
+	result, _ = store.Take(ctx, "caller", limit, now.Add(time.Second))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	result, _ = store.Take(ctx, "caller", limit, now.Add(10*time.Second))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining, "the bucket never holds more than the burst")
+
+	// Buckets are independent
+	result, _ = store.Take(ctx, "other", limit, now)
+	assert.Equal(t, 2, result.Remaining)
+}
+
+func TestMemoryRateLimitStore_EvictsIdleBuckets(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	ctx := context.Background()
+	limit := RateLimit{Requests: 10, Period: time.Second, Burst: 10}
+	now := time.Now()
+
+	store.Take(ctx, "idle", limit, now)
+	store.Take(ctx, "busy", limit, now.Add(2*time.Minute))
+	assert.Equal(t, 1, store.Len(), "refilled buckets are dropped")
+}
+
+func TestRateLimit_Enabled(t *testing.T) {
+	assert.False(t, RateLimit{}.Enabled())
+	assert.True(t, RateLimit{Requests: 1, Period: time.Second, Burst: 1}.Enabled())
+}
@@ -0,0 +1,212 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrRefreshTokenUsed is returned when a refresh token has already been rotated or revoked.
+	ErrRefreshTokenUsed = errors.New("refresh token already used")
+	// ErrRefreshTokenNotFound is returned when no refresh token has the requested hash.
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+)
+
+// RefreshTokenCollection defines the interface for refresh token database operations
+type RefreshTokenCollection interface {
+	InsertRefreshToken(ctx context.Context, token models.RefreshToken) error
+	FindRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, id string) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID string) error
+}
+
+// MongoRefreshTokenCollection implements RefreshTokenCollection for MongoDB
+type MongoRefreshTokenCollection struct {
+	Collection *mongo.Collection
+}
+
+// EnsureIndexes creates the unique token hash index and a TTL index so expired tokens are purged.
+func (c *MongoRefreshTokenCollection) EnsureIndexes(ctx context.Context) error {
+	_, err := c.Collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "family_id", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
+
+// InsertRefreshToken stores a new refresh token
+func (c *MongoRefreshTokenCollection) InsertRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	if token.ID.IsZero() {
+		token.ID = primitive.NewObjectID()
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	_, err := c.Collection.InsertOne(ctx, token)
+	return err
+}
+
+// FindRefreshTokenByHash finds a refresh token by the hash of its raw value
+func (c *MongoRefreshTokenCollection) FindRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := c.Collection.FindOne(ctx, bson.M{"token_hash": hash}).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed atomically marks a token as used. It returns
+// ErrRefreshTokenUsed when the token was already used or revoked, which lets
+// callers detect two concurrent refreshes racing on the same token.
+func (c *MongoRefreshTokenCollection) MarkRefreshTokenUsed(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := c.Collection.UpdateOne(
+		ctx,
+		bson.M{"_id": objectID, "used_at": nil, "revoked_at": nil},
+		bson.M{"$set": bson.M{"used_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrRefreshTokenUsed
+	}
+	return nil
+}
+
+// RevokeRefreshTokenFamily revokes every token that shares the given family
+func (c *MongoRefreshTokenCollection) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	_, err := c.Collection.UpdateMany(
+		ctx,
+		bson.M{"family_id": familyID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+// RevokeUserRefreshTokens revokes every outstanding refresh token of a user
+func (c *MongoRefreshTokenCollection) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	_, err := c.Collection.UpdateMany(
+		ctx,
+		bson.M{"user_id": userID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+// MemoryRefreshTokenCollection is an in-process RefreshTokenCollection,
+// suitable for tests and for running without a database. Expired tokens are
+// kept; they are rejected when presented.
+type MemoryRefreshTokenCollection struct {
+	mu     sync.Mutex
+	tokens []models.RefreshToken
+}
+
+// NewMemoryRefreshTokenCollection creates an empty in-memory refresh token collection
+func NewMemoryRefreshTokenCollection() *MemoryRefreshTokenCollection {
+	return &MemoryRefreshTokenCollection{}
+}
+
+// InsertRefreshToken stores a new refresh token
+func (c *MemoryRefreshTokenCollection) InsertRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	if token.ID.IsZero() {
+		token.ID = primitive.NewObjectID()
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, existing := range c.tokens {
+		if existing.TokenHash == token.TokenHash {
+			return errors.New("refresh token hash already stored")
+		}
+	}
+	c.tokens = append(c.tokens, token)
+	return nil
+}
+
+// FindRefreshTokenByHash finds a refresh token by the hash of its raw value
+func (c *MemoryRefreshTokenCollection) FindRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, token := range c.tokens {
+		if token.TokenHash == hash {
+			return &token, nil
+		}
+	}
+	return nil, ErrRefreshTokenNotFound
+}
+
+// MarkRefreshTokenUsed marks a token as used, returning ErrRefreshTokenUsed
+// when it was already used or revoked
+func (c *MemoryRefreshTokenCollection) MarkRefreshTokenUsed(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.tokens {
+		token := &c.tokens[i]
+		if token.ID != objectID {
+			continue
+		}
+		if token.UsedAt != nil || token.RevokedAt != nil {
+			break
+		}
+		now := time.Now()
+		token.UsedAt = &now
+		return nil
+	}
+	return ErrRefreshTokenUsed
+}
+
+// RevokeRefreshTokenFamily revokes every token that shares the given family
+func (c *MemoryRefreshTokenCollection) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	c.revoke(func(token *models.RefreshToken) bool { return token.FamilyID == familyID })
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every outstanding refresh token of a user
+func (c *MemoryRefreshTokenCollection) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	c.revoke(func(token *models.RefreshToken) bool { return token.UserID == userID })
+	return nil
+}
+
+// revoke revokes the outstanding tokens for which match is true
+func (c *MemoryRefreshTokenCollection) revoke(match func(*models.RefreshToken) bool) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.tokens {
+		if token := &c.tokens[i]; token.RevokedAt == nil && match(token) {
+			token.RevokedAt = &now
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMongoRefreshTokenCollection_MarkRefreshTokenUsed(t *testing.T) {
+	client, err := ConnectMongo()
+	if err != nil {
+		t.Skipf("failed to create client: %v, skipping integration test", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	collection := client.Database("test_fleet").Collection("refresh_tokens")
+	collection.Drop(context.Background())
+
+	tokens := &MongoRefreshTokenCollection{Collection: collection}
+	assert.NoError(t, tokens.EnsureIndexes(context.Background()))
+
+	token := models.RefreshToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    primitive.NewObjectID().Hex(),
+		FamilyID:  "family-1",
+		TokenHash: "hash-1",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	assert.NoError(t, tokens.InsertRefreshToken(context.Background(), token))
+
+	found, err := tokens.FindRefreshTokenByHash(context.Background(), "hash-1")
+	assert.NoError(t, err)
+	assert.Equal(t, token.FamilyID, found.FamilyID)
+	assert.Nil(t, found.UsedAt)
+
+	// First use succeeds, second use is reported as reuse
+	assert.NoError(t, tokens.MarkRefreshTokenUsed(context.Background(), token.ID.Hex()))
+	assert.ErrorIs(t, tokens.MarkRefreshTokenUsed(context.Background(), token.ID.Hex()), ErrRefreshTokenUsed)
+}
+
+func TestMongoRefreshTokenCollection_RevokeRefreshTokenFamily(t *testing.T) {
+	client, err := ConnectMongo()
+	if err != nil {
+		t.Skipf("failed to create client: %v, skipping integration test", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	collection := client.Database("test_fleet").Collection("refresh_tokens")
+	collection.Drop(context.Background())
+
+	tokens := &MongoRefreshTokenCollection{Collection: collection}
+
+	for _, hash := range []string{"hash-a", "hash-b"} {
+		assert.NoError(t, tokens.InsertRefreshToken(context.Background(), models.RefreshToken{
+			FamilyID:  "family-1",
+			TokenHash: hash,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}))
+	}
+	assert.NoError(t, tokens.InsertRefreshToken(context.Background(), models.RefreshToken{
+		FamilyID:  "family-2",
+		TokenHash: "hash-c",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}))
+
+	assert.NoError(t, tokens.RevokeRefreshTokenFamily(context.Background(), "family-1"))
+
+	for _, hash := range []string{"hash-a", "hash-b"} {
+		found, err := tokens.FindRefreshTokenByHash(context.Background(), hash)
+		assert.NoError(t, err)
+		assert.NotNil(t, found.RevokedAt)
+	}
+	found, err := tokens.FindRefreshTokenByHash(context.Background(), "hash-c")
+	assert.NoError(t, err)
+	assert.Nil(t, found.RevokedAt)
+}
+
+func TestMemoryRefreshTokenCollection(t *testing.T) {
+	tokens := NewMemoryRefreshTokenCollection()
+	ctx := context.Background()
+
+	first := models.RefreshToken{UserID: "u1", FamilyID: "f1", TokenHash: "hash-1", ExpiresAt: time.Now().Add(time.Hour)}
+	assert.NoError(t, tokens.InsertRefreshToken(ctx, first))
+	assert.NoError(t, tokens.InsertRefreshToken(ctx, models.RefreshToken{UserID: "u1", FamilyID: "f2", TokenHash: "hash-2"}))
+	assert.Error(t, tokens.InsertRefreshToken(ctx, first), "hashes are unique")
+
+	stored, err := tokens.FindRefreshTokenByHash(ctx, "hash-1")
+	assert.NoError(t, err)
+	assert.False(t, stored.ID.IsZero())
+	_, err = tokens.FindRefreshTokenByHash(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+
+	assert.NoError(t, tokens.MarkRefreshTokenUsed(ctx, stored.ID.Hex()))
+	assert.ErrorIs(t, tokens.MarkRefreshTokenUsed(ctx, stored.ID.Hex()), ErrRefreshTokenUsed)
+
+	assert.NoError(t, tokens.RevokeUserRefreshTokens(ctx, "u1"))
+	other, _ := tokens.FindRefreshTokenByHash(ctx, "hash-2")
+	assert.NotNil(t, other.RevokedAt)
+	assert.ErrorIs(t, tokens.MarkRefreshTokenUsed(ctx, other.ID.Hex()), ErrRefreshTokenUsed)
+}
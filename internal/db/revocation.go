@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RevocationStore records revoked access tokens. Single tokens are revoked by
+// their jti claim; all of a user's tokens are revoked by recording a cutoff so
+// that any token issued at or before it is rejected.
+type RevocationStore interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	RevokeUserTokens(ctx context.Context, userID string, issuedBefore, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error)
+}
+
+// revocationDoc is the stored form of a revocation. Token entries are keyed by
+// "jti:<id>" and user cutoffs by "user:<id>" so both share one TTL collection.
+type revocationDoc struct {
+	ID           string    `bson:"_id"`
+	UserID       string    `bson:"user_id,omitempty"`
+	IssuedBefore time.Time `bson:"issued_before,omitempty"`
+	ExpiresAt    time.Time `bson:"expires_at"`
+}
+
+// MongoRevocationStore implements RevocationStore for MongoDB
+type MongoRevocationStore struct {
+	Collection *mongo.Collection
+}
+
+// EnsureIndexes creates a TTL index so entries disappear once the tokens they cover have expired.
+func (s *MongoRevocationStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.Collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// RevokeToken revokes a single token until it expires
+func (s *MongoRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	doc := revocationDoc{ID: "jti:" + jti, ExpiresAt: expiresAt}
+	_, err := s.Collection.ReplaceOne(ctx, bson.M{"_id": doc.ID}, doc, options.Replace().SetUpsert(true))
+	return err
+}
+
+// RevokeUserTokens revokes every token of a user issued at or before issuedBefore.
+// The cutoff only ever moves forward, so an older cutoff never weakens a newer one.
+func (s *MongoRevocationStore) RevokeUserTokens(ctx context.Context, userID string, issuedBefore, expiresAt time.Time) error {
+	_, err := s.Collection.UpdateOne(
+		ctx,
+		bson.M{"_id": "user:" + userID},
+		bson.M{
+			"$set": bson.M{"user_id": userID},
+			"$max": bson.M{"issued_before": issuedBefore, "expires_at": expiresAt},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// IsRevoked reports whether a token was revoked individually or by a user-wide cutoff
+func (s *MongoRevocationStore) IsRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error) {
+	ids := bson.A{"user:" + userID}
+	if jti != "" {
+		ids = append(ids, "jti:"+jti)
+	}
+	cursor, err := s.Collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return false, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []revocationDoc
+	if err := cursor.All(ctx, &docs); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	for _, doc := range docs {
+		if now.After(doc.ExpiresAt) {
+			// TTL monitor has not purged it yet
+			continue
+		}
+		if doc.UserID == "" || !issuedAt.After(doc.IssuedBefore) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// MemoryRevocationStore is an in-process RevocationStore, suitable for tests
+// and single-instance development setups.
+type MemoryRevocationStore struct {
+	mu      sync.RWMutex
+	tokens  map[string]time.Time // jti -> expiry
+	cutoffs map[string]revocationDoc
+}
+
+// NewMemoryRevocationStore creates an empty in-memory revocation store
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens:  make(map[string]time.Time),
+		cutoffs: make(map[string]revocationDoc),
+	}
+}
+
+// RevokeToken revokes a single token until it expires
+func (s *MemoryRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purgeLocked(time.Now())
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+// RevokeUserTokens revokes every token of a user issued at or before issuedBefore.
+// The cutoff only ever moves forward, so an older cutoff never weakens a newer one.
+func (s *MemoryRevocationStore) RevokeUserTokens(ctx context.Context, userID string, issuedBefore, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purgeLocked(time.Now())
+	cutoff := s.cutoffs[userID]
+	cutoff.UserID = userID
+	if issuedBefore.After(cutoff.IssuedBefore) {
+		cutoff.IssuedBefore = issuedBefore
+	}
+	if expiresAt.After(cutoff.ExpiresAt) {
+		cutoff.ExpiresAt = expiresAt
+	}
+	s.cutoffs[userID] = cutoff
+	return nil
+}
+
+// IsRevoked reports whether a token was revoked individually or by a user-wide cutoff
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	if exp, ok := s.tokens[jti]; ok && jti != "" && !now.After(exp) {
+		return true, nil
+	}
+	if cutoff, ok := s.cutoffs[userID]; ok && !now.After(cutoff.ExpiresAt) && !issuedAt.After(cutoff.IssuedBefore) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// purgeLocked drops entries whose tokens can no longer be valid anyway
+func (s *MemoryRevocationStore) purgeLocked(now time.Time) {
+	for jti, exp := range s.tokens {
+		if now.After(exp) {
+			delete(s.tokens, jti)
+		}
+	}
+	for userID, cutoff := range s.cutoffs {
+		if now.After(cutoff.ExpiresAt) {
+			delete(s.cutoffs, userID)
+		}
+	}
+}
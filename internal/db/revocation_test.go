@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRevocationStore_RevokeToken(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	ctx := context.Background()
+	issuedAt := time.Now().Add(-time.Minute)
+
+	revoked, err := store.IsRevoked(ctx, "jti-1", "user-1", issuedAt)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	assert.NoError(t, store.RevokeToken(ctx, "jti-1", time.Now().Add(time.Hour)))
+
+	revoked, _ = store.IsRevoked(ctx, "jti-1", "user-1", issuedAt)
+	assert.True(t, revoked)
+	revoked, _ = store.IsRevoked(ctx, "jti-2", "user-1", issuedAt)
+	assert.False(t, revoked)
+}
+
+func TestMemoryRevocationStore_RevokeUserTokens(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	ctx := context.Background()
+	cutoff := time.Now()
+
+	assert.NoError(t, store.RevokeUserTokens(ctx, "user-1", cutoff, cutoff.Add(time.Hour)))
+
+	revoked, _ := store.IsRevoked(ctx, "jti-1", "user-1", cutoff.Add(-time.Second))
+	assert.True(t, revoked, "token issued before cutoff should be revoked")
+	revoked, _ = store.IsRevoked(ctx, "jti-2", "user-1", cutoff.Add(time.Second))
+	assert.False(t, revoked, "token issued after cutoff should be valid")
+	revoked, _ = store.IsRevoked(ctx, "jti-3", "user-2", cutoff.Add(-time.Second))
+	assert.False(t, revoked, "other users are unaffected")
+
+	// An older cutoff must not weaken the newer one
+	assert.NoError(t, store.RevokeUserTokens(ctx, "user-1", cutoff.Add(-time.Hour), cutoff))
+	revoked, _ = store.IsRevoked(ctx, "jti-1", "user-1", cutoff.Add(-time.Second))
+	assert.True(t, revoked)
+}
+
+func TestMemoryRevocationStore_ExpiredEntries(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	ctx := context.Background()
+
+	assert.NoError(t, store.RevokeToken(ctx, "jti-1", time.Now().Add(-time.Second)))
+	assert.NoError(t, store.RevokeUserTokens(ctx, "user-1", time.Now(), time.Now().Add(-time.Second)))
+
+	revoked, _ := store.IsRevoked(ctx, "jti-1", "user-1", time.Now().Add(-time.Minute))
+	assert.False(t, revoked)
+
+	// Writes purge entries that have outlived the tokens they cover
+	assert.NoError(t, store.RevokeToken(ctx, "jti-2", time.Now().Add(time.Hour)))
+	assert.Len(t, store.tokens, 1)
+	assert.Empty(t, store.cutoffs)
+}
+
+func TestMongoRevocationStore_Integration(t *testing.T) {
+	client, err := ConnectMongo()
+	if err != nil {
+		t.Skipf("failed to create client: %v, skipping integration test", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	collection := client.Database("test_fleet").Collection("revoked_tokens")
+	collection.Drop(context.Background())
+
+	store := &MongoRevocationStore{Collection: collection}
+	assert.NoError(t, store.EnsureIndexes(context.Background()))
+	ctx := context.Background()
+	cutoff := time.Now().Truncate(time.Millisecond)
+
+	assert.NoError(t, store.RevokeToken(ctx, "jti-1", time.Now().Add(time.Hour)))
+	revoked, err := store.IsRevoked(ctx, "jti-1", "user-1", cutoff)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	assert.NoError(t, store.RevokeUserTokens(ctx, "user-2", cutoff, cutoff.Add(time.Hour)))
+	assert.NoError(t, store.RevokeUserTokens(ctx, "user-2", cutoff.Add(-time.Hour), cutoff))
+	revoked, _ = store.IsRevoked(ctx, "jti-2", "user-2", cutoff.Add(-time.Second))
+	assert.True(t, revoked)
+	revoked, _ = store.IsRevoked(ctx, "jti-3", "user-2", cutoff.Add(time.Second))
+	assert.False(t, revoked)
+}
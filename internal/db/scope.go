@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// tenantScopeKey is the context key for the tenant that queries are confined to
+type tenantScopeKey struct{}
+
+// WithTenant confines every query made with the returned context to records
+// of tenantID. An empty tenantID is a scope too: it matches only records
+// without a tenant. Authentication sets the scope for every API request.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantScopeKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant scope of ctx, if it has one. Contexts
+// without a scope, such as those of background ingestion, are unrestricted.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantScopeKey{}).(string)
+	return tenantID, ok
+}
+
+// ScopeFilter returns filter restricted to the tenant scope of ctx. A
+// tenant_id in the filter itself never widens or changes the scope.
+func ScopeFilter(ctx context.Context, filter interface{}) interface{} {
+	tenantID, ok := TenantFromContext(ctx)
+	if !ok {
+		if filter == nil {
+			return bson.M{}
+		}
+		return filter
+	}
+	switch f := filter.(type) {
+	case nil:
+		return bson.M{"tenant_id": tenantID}
+	case bson.M:
+		scoped := make(bson.M, len(f)+1)
+		for key, value := range f {
+			scoped[key] = value
+		}
+		scoped["tenant_id"] = tenantID
+		return scoped
+	default:
+		return bson.M{"$and": bson.A{filter, bson.M{"tenant_id": tenantID}}}
+	}
+}
+
+// scopedTenantID returns the tenant a new record must belong to: the scope of
+// ctx when it has one, otherwise the tenant the caller set
+func scopedTenantID(ctx context.Context, tenantID string) string {
+	if scope, ok := TenantFromContext(ctx); ok {
+		return scope
+	}
+	return tenantID
+}
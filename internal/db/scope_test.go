@@ -0,0 +1,33 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestScopeFilter(t *testing.T) {
+	unscoped := context.Background()
+	scoped := WithTenant(unscoped, "tenant-a")
+
+	assert.Equal(t, bson.M{}, ScopeFilter(unscoped, nil))
+	assert.Equal(t, bson.M{"status": "active"}, ScopeFilter(unscoped, bson.M{"status": "active"}))
+
+	assert.Equal(t, bson.M{"tenant_id": "tenant-a"}, ScopeFilter(scoped, nil))
+	filter := bson.M{"status": "active", "tenant_id": "tenant-b"}
+	assert.Equal(t, bson.M{"status": "active", "tenant_id": "tenant-a"}, ScopeFilter(scoped, filter), "the scope wins over the filter")
+	assert.Equal(t, "tenant-b", filter["tenant_id"], "the caller's filter is not modified")
+
+	other := bson.D{{Key: "status", Value: "active"}}
+	assert.Equal(t, bson.M{"$and": bson.A{other, bson.M{"tenant_id": "tenant-a"}}}, ScopeFilter(scoped, other))
+
+	// An empty scope only matches records without a tenant
+	assert.Equal(t, bson.M{"tenant_id": ""}, ScopeFilter(WithTenant(unscoped, ""), nil))
+}
+
+func TestScopedTenantID(t *testing.T) {
+	assert.Equal(t, "tenant-b", scopedTenantID(context.Background(), "tenant-b"))
+	assert.Equal(t, "tenant-a", scopedTenantID(WithTenant(context.Background(), "tenant-a"), "tenant-b"))
+}
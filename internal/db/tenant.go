@@ -0,0 +1,273 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrTenantNotFound is returned when no tenant has the requested ID.
+	ErrTenantNotFound = errors.New("tenant not found")
+	// ErrTenantExists is returned when creating a tenant whose ID is taken.
+	ErrTenantExists = errors.New("tenant already exists")
+)
+
+// TenantStore defines the storage operations for tenants
+type TenantStore interface {
+	InsertTenant(ctx context.Context, tenant models.Tenant) error
+	FindTenantByID(ctx context.Context, id string) (*models.Tenant, error)
+	// ListTenants returns the tenants with the given status, or all of them when status is empty
+	ListTenants(ctx context.Context, status models.TenantStatus) ([]models.Tenant, error)
+	UpdateTenant(ctx context.Context, tenant models.Tenant) error
+	DeleteTenant(ctx context.Context, id string) error
+}
+
+// EnsureTenants creates a tenant with default settings for every ID that has
+// none yet, so records created before tenants were stored keep working. It
+// returns how many tenants were created.
+func EnsureTenants(ctx context.Context, store TenantStore, ids []string) (int, error) {
+	created := 0
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if _, err := store.FindTenantByID(ctx, id); !errors.Is(err, ErrTenantNotFound) {
+			if err != nil {
+				return created, err
+			}
+			continue
+		}
+		err := store.InsertTenant(ctx, models.NewTenant(id, id))
+		if err != nil && !errors.Is(err, ErrTenantExists) {
+			return created, err
+		}
+		if err == nil {
+			created++
+		}
+	}
+	return created, nil
+}
+
+// MongoTenantStore implements TenantStore for MongoDB, keyed by tenant ID
+type MongoTenantStore struct {
+	Collection *mongo.Collection
+}
+
+// InsertTenant stores a new tenant
+func (s *MongoTenantStore) InsertTenant(ctx context.Context, tenant models.Tenant) error {
+	_, err := s.Collection.InsertOne(ctx, tenant)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrTenantExists
+	}
+	return err
+}
+
+// FindTenantByID finds a tenant by its ID
+func (s *MongoTenantStore) FindTenantByID(ctx context.Context, id string) (*models.Tenant, error) {
+	var tenant models.Tenant
+	err := s.Collection.FindOne(ctx, bson.M{"_id": id}).Decode(&tenant)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrTenantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+// ListTenants returns tenants ordered by name
+func (s *MongoTenantStore) ListTenants(ctx context.Context, status models.TenantStatus) ([]models.Tenant, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	cursor, err := s.Collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tenants := []models.Tenant{}
+	if err := cursor.All(ctx, &tenants); err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+// UpdateTenant replaces a stored tenant
+func (s *MongoTenantStore) UpdateTenant(ctx context.Context, tenant models.Tenant) error {
+	result, err := s.Collection.ReplaceOne(ctx, bson.M{"_id": tenant.ID}, tenant)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrTenantNotFound
+	}
+	return nil
+}
+
+// DeleteTenant removes a tenant
+func (s *MongoTenantStore) DeleteTenant(ctx context.Context, id string) error {
+	result, err := s.Collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrTenantNotFound
+	}
+	return nil
+}
+
+// MemoryTenantStore is an in-process TenantStore, suitable for tests
+type MemoryTenantStore struct {
+	mu      sync.RWMutex
+	tenants map[string]models.Tenant
+}
+
+// NewMemoryTenantStore creates an empty in-memory tenant store
+func NewMemoryTenantStore() *MemoryTenantStore {
+	return &MemoryTenantStore{tenants: make(map[string]models.Tenant)}
+}
+
+// InsertTenant stores a new tenant
+func (s *MemoryTenantStore) InsertTenant(ctx context.Context, tenant models.Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[tenant.ID]; ok {
+		return ErrTenantExists
+	}
+	s.tenants[tenant.ID] = tenant
+	return nil
+}
+
+// FindTenantByID finds a tenant by its ID
+func (s *MemoryTenantStore) FindTenantByID(ctx context.Context, id string) (*models.Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tenant, ok := s.tenants[id]
+	if !ok {
+		return nil, ErrTenantNotFound
+	}
+	return &tenant, nil
+}
+
+// ListTenants returns tenants ordered by name
+func (s *MemoryTenantStore) ListTenants(ctx context.Context, status models.TenantStatus) ([]models.Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tenants := []models.Tenant{}
+	for _, tenant := range s.tenants {
+		if status == "" || tenant.Status == status {
+			tenants = append(tenants, tenant)
+		}
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Name < tenants[j].Name })
+	return tenants, nil
+}
+
+// UpdateTenant replaces a stored tenant
+func (s *MemoryTenantStore) UpdateTenant(ctx context.Context, tenant models.Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[tenant.ID]; !ok {
+		return ErrTenantNotFound
+	}
+	s.tenants[tenant.ID] = tenant
+	return nil
+}
+
+// DeleteTenant removes a tenant
+func (s *MemoryTenantStore) DeleteTenant(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[id]; !ok {
+		return ErrTenantNotFound
+	}
+	delete(s.tenants, id)
+	return nil
+}
+
+// cachedTenant is a cached lookup result; tenant is nil for unknown IDs
+type cachedTenant struct {
+	tenant  *models.Tenant
+	expires time.Time
+}
+
+// CachedTenantStore caches tenant lookups, which authentication performs on
+// every request. Writes through the cache take effect here at once; writes
+// made by other instances are seen once the cached entry expires.
+type CachedTenantStore struct {
+	store   TenantStore
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cachedTenant
+}
+
+// NewCachedTenantStore wraps store with a lookup cache holding entries for ttl
+func NewCachedTenantStore(store TenantStore, ttl time.Duration) *CachedTenantStore {
+	return &CachedTenantStore{
+		store:   store,
+		ttl:     ttl,
+		entries: make(map[string]cachedTenant),
+	}
+}
+
+// InsertTenant stores a new tenant
+func (s *CachedTenantStore) InsertTenant(ctx context.Context, tenant models.Tenant) error {
+	defer s.forget(tenant.ID)
+	return s.store.InsertTenant(ctx, tenant)
+}
+
+// FindTenantByID finds a tenant by its ID, from the cache when possible
+func (s *CachedTenantStore) FindTenantByID(ctx context.Context, id string) (*models.Tenant, error) {
+	s.mu.Lock()
+	entry, ok := s.entries[id]
+	s.mu.Unlock()
+	if !ok || time.Now().After(entry.expires) {
+		tenant, err := s.store.FindTenantByID(ctx, id)
+		if err != nil && !errors.Is(err, ErrTenantNotFound) {
+			return nil, err
+		}
+		entry = cachedTenant{tenant: tenant, expires: time.Now().Add(s.ttl)}
+		s.mu.Lock()
+		s.entries[id] = entry
+		s.mu.Unlock()
+	}
+	if entry.tenant == nil {
+		return nil, ErrTenantNotFound
+	}
+	tenant := *entry.tenant
+	return &tenant, nil
+}
+
+// ListTenants returns tenants from the underlying store
+func (s *CachedTenantStore) ListTenants(ctx context.Context, status models.TenantStatus) ([]models.Tenant, error) {
+	return s.store.ListTenants(ctx, status)
+}
+
+// UpdateTenant replaces a stored tenant
+func (s *CachedTenantStore) UpdateTenant(ctx context.Context, tenant models.Tenant) error {
+	defer s.forget(tenant.ID)
+	return s.store.UpdateTenant(ctx, tenant)
+}
+
+// DeleteTenant removes a tenant
+func (s *CachedTenantStore) DeleteTenant(ctx context.Context, id string) error {
+	defer s.forget(id)
+	return s.store.DeleteTenant(ctx, id)
+}
+
+// forget drops the cached lookup of a tenant
+func (s *CachedTenantStore) forget(id string) {
+	s.mu.Lock()
+	delete(s.entries, id)
+	s.mu.Unlock()
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+)
+
+func TestMemoryTenantStore(t *testing.T) {
+	store := NewMemoryTenantStore()
+	ctx := context.Background()
+
+	acme := models.NewTenant("acme", "Acme")
+	assert.NoError(t, store.InsertTenant(ctx, acme))
+	assert.ErrorIs(t, store.InsertTenant(ctx, acme), ErrTenantExists)
+	assert.NoError(t, store.InsertTenant(ctx, models.NewTenant("beta", "Beta")))
+
+	found, err := store.FindTenantByID(ctx, "acme")
+	assert.NoError(t, err)
+	assert.Equal(t, "Acme", found.Name)
+	_, err = store.FindTenantByID(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrTenantNotFound)
+
+	acme.Status = models.TenantSuspended
+	assert.NoError(t, store.UpdateTenant(ctx, acme))
+	assert.ErrorIs(t, store.UpdateTenant(ctx, models.NewTenant("unknown", "Unknown")), ErrTenantNotFound)
+
+	all, _ := store.ListTenants(ctx, "")
+	assert.Len(t, all, 2)
+	assert.Equal(t, "Acme", all[0].Name, "ordered by name")
+	suspended, _ := store.ListTenants(ctx, models.TenantSuspended)
+	if assert.Len(t, suspended, 1) {
+		assert.Equal(t, "acme", suspended[0].ID)
+	}
+
+	assert.NoError(t, store.DeleteTenant(ctx, "acme"))
+	assert.ErrorIs(t, store.DeleteTenant(ctx, "acme"), ErrTenantNotFound)
+}
+
+// countingTenantStore counts lookups reaching the wrapped store
+type countingTenantStore struct {
+	*MemoryTenantStore
+	finds int
+	err   error
+}
+
+func (s *countingTenantStore) FindTenantByID(ctx context.Context, id string) (*models.Tenant, error) {
+	s.finds++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.MemoryTenantStore.FindTenantByID(ctx, id)
+}
+
+func TestCachedTenantStore(t *testing.T) {
+	ctx := context.Background()
+	backing := &countingTenantStore{MemoryTenantStore: NewMemoryTenantStore()}
+	backing.InsertTenant(ctx, models.NewTenant("acme", "Acme"))
+	store := NewCachedTenantStore(backing, time.Minute)
+
+	store.FindTenantByID(ctx, "acme")
+	found, err := store.FindTenantByID(ctx, "acme")
+	assert.NoError(t, err)
+	assert.True(t, found.IsActive())
+	assert.Equal(t, 1, backing.finds, "second lookup is cached")
+
+	// Cached copies cannot be modified by callers
+	found.Status = models.TenantSuspended
+	found, _ = store.FindTenantByID(ctx, "acme")
+	assert.True(t, found.IsActive())
+
+	// Writes through the cache apply at once
+	suspended := *found
+	suspended.Status = models.TenantSuspended
+	assert.NoError(t, store.UpdateTenant(ctx, suspended))
+	found, _ = store.FindTenantByID(ctx, "acme")
+	assert.False(t, found.IsActive())
+
+	// Unknown tenants are cached too, until one is created
+	_, err = store.FindTenantByID(ctx, "beta")
+	assert.ErrorIs(t, err, ErrTenantNotFound)
+	finds := backing.finds
+	_, err = store.FindTenantByID(ctx, "beta")
+	assert.ErrorIs(t, err, ErrTenantNotFound)
+	assert.Equal(t, finds, backing.finds)
+	assert.NoError(t, store.InsertTenant(ctx, models.NewTenant("beta", "Beta")))
+	_, err = store.FindTenantByID(ctx, "beta")
+	assert.NoError(t, err)
+
+	// Store failures are returned and not cached
+	backing.err = errors.New("unreachable")
+	_, err = store.FindTenantByID(ctx, "gamma")
+	assert.EqualError(t, err, "unreachable")
+	backing.err = nil
+	_, err = store.FindTenantByID(ctx, "gamma")
+	assert.ErrorIs(t, err, ErrTenantNotFound)
+}
+
+func TestEnsureTenants(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTenantStore()
+	existing := models.NewTenant("acme", "Acme Fleet")
+	existing.Plan = models.PlanPro
+	store.InsertTenant(ctx, existing)
+
+	created, err := EnsureTenants(ctx, store, []string{"acme", "", "beta", "beta"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created)
+
+	acme, _ := store.FindTenantByID(ctx, "acme")
+	assert.Equal(t, models.PlanPro, acme.Plan, "existing tenants are left alone")
+	beta, err := store.FindTenantByID(ctx, "beta")
+	assert.NoError(t, err)
+	assert.True(t, beta.IsActive())
+}
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"context"
+
+	"github.com/ukydev/fleet-sustainability/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan starts a client span named after a MongoCollection operation,
+// e.g. db.InsertTelemetry. End it with tracing.End.
+func (c *MongoCollection) startSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "mongodb"),
+		attribute.String("db.operation.name", operation),
+	}
+	if c.Collection != nil {
+		attrs = append(attrs,
+			attribute.String("db.namespace", c.Collection.Database().Name()),
+			attribute.String("db.collection.name", c.Collection.Name()))
+	}
+	if tenantID, ok := TenantFromContext(ctx); ok {
+		attrs = append(attrs, attribute.String("tenant.id", tenantID))
+	}
+	return tracing.Start(ctx, "db."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestMongoCollection_Spans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	collection := &MongoCollection{}
+	err := collection.InsertTelemetry(WithTenant(context.Background(), "acme"), models.Telemetry{})
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		span := spans[0]
+		assert.Equal(t, "db.InsertTelemetry", span.Name())
+		assert.Equal(t, trace.SpanKindClient, span.SpanKind())
+		assert.Equal(t, codes.Error, span.Status().Code)
+		assert.Contains(t, span.Attributes(), attribute.String("tenant.id", "acme"))
+		assert.Contains(t, span.Attributes(), attribute.String("db.system", "mongodb"))
+	}
+
+	t.Run("commands are recorded on the operation's span", func(t *testing.T) {
+		ctx, span := collection.startSpan(context.Background(), "FindTrips")
+		commandMonitor().Succeeded(ctx, &event.CommandSucceededEvent{
+			CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find"},
+		})
+		span.End()
+
+		ended := recorder.Ended()
+		events := ended[len(ended)-1].Events()
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, "mongodb.command", events[0].Name)
+			assert.Contains(t, events[0].Attributes, attribute.String("db.command.name", "find"))
+		}
+	})
+}
@@ -2,24 +2,52 @@ package db
 
 import (
 	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ukydev/fleet-sustainability/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var (
+	// ErrUserNotFound is returned when no user matches a lookup.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserExists is returned when the username, email or identity provider
+	// account of a user already belongs to another user.
+	ErrUserExists = errors.New("user already exists")
+)
+
+// UserQuery selects users; its zero value selects all of them
+type UserQuery struct {
+	TenantID string
+	Role     models.Role
+	// Active selects active or inactive users, when set
+	Active *bool
+	// Prefix selects users whose username or email starts with it, ignoring case
+	Prefix string
+}
+
 // UserCollection defines the interface for user database operations
 type UserCollection interface {
 	InsertUser(ctx context.Context, user models.User) error
 	FindUserByID(ctx context.Context, id string) (*models.User, error)
 	FindUserByUsername(ctx context.Context, username string) (*models.User, error)
 	FindUserByEmail(ctx context.Context, email string) (*models.User, error)
-	FindUsers(ctx context.Context, filter bson.M) (*mongo.Cursor, error)
+	FindUserByOIDCSubject(ctx context.Context, issuer, subject string) (*models.User, error)
+	FindUsers(ctx context.Context, q UserQuery) ([]models.User, error)
+	CountUsers(ctx context.Context, q UserQuery) (int64, error)
 	UpdateUser(ctx context.Context, id string, user models.User) error
 	DeleteUser(ctx context.Context, id string) error
 	UpdateLastLogin(ctx context.Context, id string) error
+	IncrementFailedLogins(ctx context.Context, id string) (int, error)
+	LockUser(ctx context.Context, id string, until time.Time) error
+	UnlockUser(ctx context.Context, id string) error
 }
 
 // MongoUserCollection implements UserCollection for MongoDB
@@ -27,6 +55,29 @@ type MongoUserCollection struct {
 	Collection *mongo.Collection
 }
 
+// EnsureIndexes creates unique indexes so usernames and emails are never
+// shared, even by concurrent registrations, and an identity provider account
+// is provisioned only once.
+func (c *MongoUserCollection) EnsureIndexes(ctx context.Context) error {
+	_, err := c.Collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"email": bson.M{"$gt": ""}}),
+		},
+		{
+			Keys: bson.D{{Key: "oidc_issuer", Value: 1}, {Key: "oidc_subject", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"oidc_subject": bson.M{"$exists": true}}),
+		},
+	})
+	return err
+}
+
 // InsertUser inserts a new user into the database
 func (c *MongoUserCollection) InsertUser(ctx context.Context, user models.User) error {
 	user.CreatedAt = time.Now()
@@ -34,6 +85,9 @@ func (c *MongoUserCollection) InsertUser(ctx context.Context, user models.User)
 	user.IsActive = true
 
 	_, err := c.Collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUserExists
+	}
 	return err
 }
 
@@ -46,6 +100,9 @@ func (c *MongoUserCollection) FindUserByID(ctx context.Context, id string) (*mod
 
 	var user models.User
 	err = c.Collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -57,6 +114,9 @@ func (c *MongoUserCollection) FindUserByID(ctx context.Context, id string) (*mod
 func (c *MongoUserCollection) FindUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	var user models.User
 	err := c.Collection.FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -68,6 +128,9 @@ func (c *MongoUserCollection) FindUserByUsername(ctx context.Context, username s
 func (c *MongoUserCollection) FindUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
 	err := c.Collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -75,9 +138,57 @@ func (c *MongoUserCollection) FindUserByEmail(ctx context.Context, email string)
 	return &user, nil
 }
 
-// FindUsers finds users with optional filtering
-func (c *MongoUserCollection) FindUsers(ctx context.Context, filter bson.M) (*mongo.Cursor, error) {
-	return c.Collection.Find(ctx, filter)
+// FindUserByOIDCSubject finds the user provisioned for an identity provider account
+func (c *MongoUserCollection) FindUserByOIDCSubject(ctx context.Context, issuer, subject string) (*models.User, error) {
+	var user models.User
+	err := c.Collection.FindOne(ctx, bson.M{"oidc_issuer": issuer, "oidc_subject": subject}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// FindUsers finds the users selected by q
+func (c *MongoUserCollection) FindUsers(ctx context.Context, q UserQuery) ([]models.User, error) {
+	cursor, err := c.Collection.Find(ctx, userFilter(q))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// CountUsers counts the users selected by q
+func (c *MongoUserCollection) CountUsers(ctx context.Context, q UserQuery) (int64, error) {
+	return c.Collection.CountDocuments(ctx, userFilter(q))
+}
+
+// userFilter translates q to a MongoDB filter
+func userFilter(q UserQuery) bson.M {
+	filter := bson.M{}
+	if q.TenantID != "" {
+		filter["tenant_id"] = q.TenantID
+	}
+	if q.Role != "" {
+		filter["role"] = q.Role
+	}
+	if q.Active != nil {
+		filter["is_active"] = *q.Active
+	}
+	if q.Prefix != "" {
+		pattern := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(q.Prefix), Options: "i"}
+		filter["$or"] = bson.A{bson.M{"username": pattern}, bson.M{"email": pattern}}
+	}
+	return filter
 }
 
 // UpdateUser updates a user in the database
@@ -91,6 +202,9 @@ func (c *MongoUserCollection) UpdateUser(ctx context.Context, id string, user mo
 	user.ID = objectID
 
 	_, err = c.Collection.ReplaceOne(ctx, bson.M{"_id": objectID}, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUserExists
+	}
 	return err
 }
 
@@ -105,7 +219,7 @@ func (c *MongoUserCollection) DeleteUser(ctx context.Context, id string) error {
 	return err
 }
 
-// UpdateLastLogin updates the last login time for a user
+// UpdateLastLogin updates the last login time for a user and clears their failed login attempts
 func (c *MongoUserCollection) UpdateLastLogin(ctx context.Context, id string) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -116,7 +230,271 @@ func (c *MongoUserCollection) UpdateLastLogin(ctx context.Context, id string) er
 	_, err = c.Collection.UpdateOne(
 		ctx,
 		bson.M{"_id": objectID},
-		bson.M{"$set": bson.M{"last_login": now, "updated_at": now}},
+		bson.M{
+			"$set":   bson.M{"last_login": now, "updated_at": now, "failed_login_attempts": 0},
+			"$unset": bson.M{"locked_until": ""},
+		},
 	)
 	return err
 }
+
+// IncrementFailedLogins atomically counts a failed login and returns the new number of consecutive failures
+func (c *MongoUserCollection) IncrementFailedLogins(ctx context.Context, id string) (int, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return 0, err
+	}
+
+	var user models.User
+	err = c.Collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": objectID},
+		bson.M{"$inc": bson.M{"failed_login_attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		return 0, err
+	}
+	return user.FailedLoginAttempts, nil
+}
+
+// LockUser locks a user out of logging in until the given time
+func (c *MongoUserCollection) LockUser(ctx context.Context, id string, until time.Time) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Collection.UpdateOne(
+		ctx,
+		bson.M{"_id": objectID},
+		bson.M{"$set": bson.M{"locked_until": until, "updated_at": time.Now()}},
+	)
+	return err
+}
+
+// UnlockUser lifts a lockout and clears the failed login attempts
+func (c *MongoUserCollection) UnlockUser(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Collection.UpdateOne(
+		ctx,
+		bson.M{"_id": objectID},
+		bson.M{
+			"$set":   bson.M{"failed_login_attempts": 0, "updated_at": time.Now()},
+			"$unset": bson.M{"locked_until": ""},
+		},
+	)
+	return err
+}
+
+// MemoryUserCollection is an in-process UserCollection, suitable for tests
+// and for running without a database
+type MemoryUserCollection struct {
+	mu    sync.RWMutex
+	users []models.User // in insertion order
+}
+
+// NewMemoryUserCollection creates an empty in-memory user collection
+func NewMemoryUserCollection() *MemoryUserCollection {
+	return &MemoryUserCollection{}
+}
+
+// InsertUser stores a new user
+func (c *MemoryUserCollection) InsertUser(ctx context.Context, user models.User) error {
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = time.Now()
+	user.IsActive = true
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, existing := range c.users {
+		if existing.ID == user.ID || taken(&existing, &user) {
+			return ErrUserExists
+		}
+	}
+	c.users = append(c.users, user)
+	return nil
+}
+
+// FindUserByID finds a user by their ID
+func (c *MemoryUserCollection) FindUserByID(ctx context.Context, id string) (*models.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	return c.findOne(func(u *models.User) bool { return u.ID == objectID })
+}
+
+// FindUserByUsername finds a user by their username
+func (c *MemoryUserCollection) FindUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	return c.findOne(func(u *models.User) bool { return u.Username == username })
+}
+
+// FindUserByEmail finds a user by their email
+func (c *MemoryUserCollection) FindUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return c.findOne(func(u *models.User) bool { return u.Email == email })
+}
+
+// FindUserByOIDCSubject finds the user provisioned for an identity provider account
+func (c *MemoryUserCollection) FindUserByOIDCSubject(ctx context.Context, issuer, subject string) (*models.User, error) {
+	return c.findOne(func(u *models.User) bool { return u.OIDCIssuer == issuer && u.OIDCSubject == subject })
+}
+
+// FindUsers finds the users selected by q
+func (c *MemoryUserCollection) FindUsers(ctx context.Context, q UserQuery) ([]models.User, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	users := []models.User{}
+	for _, user := range c.users {
+		if q.matches(&user) {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// CountUsers counts the users selected by q
+func (c *MemoryUserCollection) CountUsers(ctx context.Context, q UserQuery) (int64, error) {
+	users, err := c.FindUsers(ctx, q)
+	return int64(len(users)), err
+}
+
+// UpdateUser replaces a stored user
+func (c *MemoryUserCollection) UpdateUser(ctx context.Context, id string, user models.User) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	user.UpdatedAt = time.Now()
+	user.ID = objectID
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	index := -1
+	for i := range c.users {
+		if c.users[i].ID == objectID {
+			index = i
+		} else if taken(&c.users[i], &user) {
+			return ErrUserExists
+		}
+	}
+	if index < 0 {
+		return ErrUserNotFound
+	}
+	c.users[index] = user
+	return nil
+}
+
+// DeleteUser deletes a user
+func (c *MemoryUserCollection) DeleteUser(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.users {
+		if c.users[i].ID == objectID {
+			c.users = append(c.users[:i], c.users[i+1:]...)
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+// UpdateLastLogin updates the last login time for a user and clears their failed login attempts
+func (c *MemoryUserCollection) UpdateLastLogin(ctx context.Context, id string) error {
+	return c.modify(id, func(u *models.User) {
+		now := time.Now()
+		u.LastLogin, u.UpdatedAt = &now, now
+		u.FailedLoginAttempts, u.LockedUntil = 0, nil
+	})
+}
+
+// IncrementFailedLogins counts a failed login and returns the new number of consecutive failures
+func (c *MemoryUserCollection) IncrementFailedLogins(ctx context.Context, id string) (int, error) {
+	var attempts int
+	err := c.modify(id, func(u *models.User) {
+		u.FailedLoginAttempts++
+		attempts = u.FailedLoginAttempts
+	})
+	return attempts, err
+}
+
+// LockUser locks a user out of logging in until the given time
+func (c *MemoryUserCollection) LockUser(ctx context.Context, id string, until time.Time) error {
+	return c.modify(id, func(u *models.User) {
+		u.LockedUntil, u.UpdatedAt = &until, time.Now()
+	})
+}
+
+// UnlockUser lifts a lockout and clears the failed login attempts
+func (c *MemoryUserCollection) UnlockUser(ctx context.Context, id string) error {
+	return c.modify(id, func(u *models.User) {
+		u.FailedLoginAttempts, u.LockedUntil, u.UpdatedAt = 0, nil, time.Now()
+	})
+}
+
+// findOne returns a copy of the first user for which match is true
+func (c *MemoryUserCollection) findOne(match func(*models.User) bool) (*models.User, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, user := range c.users {
+		if match(&user) {
+			return &user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// taken reports whether user would share its username, email or identity
+// provider account with existing, which the unique indexes of MongoDB forbid
+func taken(existing, user *models.User) bool {
+	return existing.Username == user.Username ||
+		(user.Email != "" && existing.Email == user.Email) ||
+		(user.OIDCSubject != "" && existing.OIDCIssuer == user.OIDCIssuer && existing.OIDCSubject == user.OIDCSubject)
+}
+
+// modify applies change to the user with the hex id
+func (c *MemoryUserCollection) modify(id string, change func(*models.User)) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.users {
+		if c.users[i].ID == objectID {
+			change(&c.users[i])
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+// matches reports whether q selects user
+func (q UserQuery) matches(user *models.User) bool {
+	if q.TenantID != "" && user.TenantID != q.TenantID {
+		return false
+	}
+	if q.Role != "" && user.Role != q.Role {
+		return false
+	}
+	if q.Active != nil && user.IsActive != *q.Active {
+		return false
+	}
+	if q.Prefix != "" {
+		prefix := strings.ToLower(q.Prefix)
+		if !strings.HasPrefix(strings.ToLower(user.Username), prefix) && !strings.HasPrefix(strings.ToLower(user.Email), prefix) {
+			return false
+		}
+	}
+	return true
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -164,6 +165,46 @@ func TestMongoUserCollection_FindUserByEmail(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestMongoUserCollection_FindUserByOIDCSubject(t *testing.T) {
+	client, err := ConnectMongo()
+	if err != nil {
+		t.Skipf("failed to create client: %v, skipping integration test", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	db := client.Database("test_fleet")
+	collection := db.Collection("users")
+	collection.Drop(context.Background())
+
+	userCollection := &MongoUserCollection{Collection: collection}
+	require.NoError(t, userCollection.EnsureIndexes(context.Background()))
+
+	user := models.User{
+		Username:    "ssouser",
+		Email:       "sso@example.com",
+		Role:        models.RoleViewer,
+		OIDCIssuer:  "https://idp.example.com",
+		OIDCSubject: "subject-1",
+	}
+	require.NoError(t, userCollection.InsertUser(context.Background(), user))
+
+	// Local users are not constrained by the unique subject index
+	require.NoError(t, userCollection.InsertUser(context.Background(), models.User{Username: "local1", Email: "l1@example.com"}))
+	require.NoError(t, userCollection.InsertUser(context.Background(), models.User{Username: "local2", Email: "l2@example.com"}))
+
+	foundUser, err := userCollection.FindUserByOIDCSubject(context.Background(), "https://idp.example.com", "subject-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "ssouser", foundUser.Username)
+	assert.True(t, foundUser.IsSSO())
+
+	_, err = userCollection.FindUserByOIDCSubject(context.Background(), "https://other.example.com", "subject-1")
+	assert.Error(t, err)
+
+	// An identity provider account is provisioned only once
+	user.Username = "duplicate"
+	assert.Error(t, userCollection.InsertUser(context.Background(), user))
+}
+
 func TestMongoUserCollection_UpdateUser(t *testing.T) {
 	client, err := ConnectMongo()
 	if err != nil {
@@ -292,3 +333,92 @@ func TestMongoUserCollection_UpdateLastLogin(t *testing.T) {
 	assert.NotNil(t, updatedUser.LastLogin)
 	assert.True(t, updatedUser.LastLogin.After(insertedUser.CreatedAt))
 }
+
+func TestMongoUserCollection_FailedLogins(t *testing.T) {
+	client, err := ConnectMongo()
+	if err != nil {
+		t.Skipf("failed to create client: %v, skipping integration test", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	db := client.Database("test_fleet")
+	collection := db.Collection("users")
+	collection.Drop(context.Background())
+
+	userCollection := &MongoUserCollection{Collection: collection}
+	err = userCollection.InsertUser(context.Background(), models.User{Username: "testuser", Email: "test@example.com"})
+	require.NoError(t, err)
+	var inserted models.User
+	require.NoError(t, collection.FindOne(context.Background(), bson.M{"username": "testuser"}).Decode(&inserted))
+	id := inserted.ID.Hex()
+
+	for i := 1; i <= 3; i++ {
+		attempts, err := userCollection.IncrementFailedLogins(context.Background(), id)
+		assert.NoError(t, err)
+		assert.Equal(t, i, attempts)
+	}
+
+	until := time.Now().Add(time.Hour)
+	assert.NoError(t, userCollection.LockUser(context.Background(), id, until))
+	found, err := userCollection.FindUserByID(context.Background(), id)
+	assert.NoError(t, err)
+	assert.True(t, found.IsLocked(time.Now()))
+
+	assert.NoError(t, userCollection.UnlockUser(context.Background(), id))
+	found, err = userCollection.FindUserByID(context.Background(), id)
+	assert.NoError(t, err)
+	assert.False(t, found.IsLocked(time.Now()))
+	assert.Zero(t, found.FailedLoginAttempts)
+}
+
+func TestMemoryUserCollection(t *testing.T) {
+	users := NewMemoryUserCollection()
+	ctx := context.Background()
+
+	require.NoError(t, users.InsertUser(ctx, models.User{Username: "alice", Email: "alice@acme.test", Role: models.RoleAdmin, TenantID: "acme", OIDCIssuer: "idp", OIDCSubject: "a"}))
+	require.NoError(t, users.InsertUser(ctx, models.User{Username: "bob", Email: "bob@acme.test", Role: models.RoleOperator, TenantID: "acme"}))
+	require.NoError(t, users.InsertUser(ctx, models.User{Username: "carol", Email: "Alice.C@beta.test", Role: models.RoleAdmin, TenantID: "beta"}))
+	assert.ErrorIs(t, users.InsertUser(ctx, models.User{Username: "alice2", OIDCIssuer: "idp", OIDCSubject: "a"}), ErrUserExists)
+	assert.ErrorIs(t, users.InsertUser(ctx, models.User{Username: "alice", Email: "alice2@acme.test"}), ErrUserExists)
+	assert.ErrorIs(t, users.InsertUser(ctx, models.User{Username: "alice2", Email: "alice@acme.test"}), ErrUserExists)
+
+	alice, err := users.FindUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	assert.True(t, alice.IsActive)
+	_, err = users.FindUserByEmail(ctx, "nobody@acme.test")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	found, err := users.FindUserByOIDCSubject(ctx, "idp", "a")
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, found.ID)
+
+	matched, err := users.FindUsers(ctx, UserQuery{Prefix: "ALI"})
+	require.NoError(t, err)
+	assert.Len(t, matched, 2, "usernames and emails match, ignoring case")
+	active := true
+	count, err := users.CountUsers(ctx, UserQuery{TenantID: "acme", Role: models.RoleAdmin, Active: &active})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	attempts, err := users.IncrementFailedLogins(ctx, alice.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempts)
+	require.NoError(t, users.LockUser(ctx, alice.ID.Hex(), time.Now().Add(time.Hour)))
+	require.NoError(t, users.UpdateLastLogin(ctx, alice.ID.Hex()))
+	alice, err = users.FindUserByID(ctx, alice.ID.Hex())
+	require.NoError(t, err)
+	assert.Zero(t, alice.FailedLoginAttempts)
+	assert.Nil(t, alice.LockedUntil)
+	assert.NotNil(t, alice.LastLogin)
+
+	clash := *alice
+	clash.Email = "bob@acme.test"
+	assert.ErrorIs(t, users.UpdateUser(ctx, alice.ID.Hex(), clash), ErrUserExists)
+	alice.FirstName = "Alice"
+	require.NoError(t, users.UpdateUser(ctx, alice.ID.Hex(), *alice))
+	alice, _ = users.FindUserByID(ctx, alice.ID.Hex())
+	assert.Equal(t, "Alice", alice.FirstName)
+
+	require.NoError(t, users.DeleteUser(ctx, alice.ID.Hex()))
+	_, err = users.FindUserByID(ctx, alice.ID.Hex())
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ukydev/fleet-sustainability/internal/auth"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/middleware"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"github.com/ukydev/fleet-sustainability/internal/problem"
+	"github.com/ukydev/fleet-sustainability/internal/router"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKeyHandler handles tenant API key administration requests
+type APIKeyHandler struct {
+	authService *auth.Service
+	apiKeys     db.APIKeyStore
+	auditLog    db.AuditLog
+}
+
+// NewAPIKeyHandler creates a new API key administration handler
+func NewAPIKeyHandler(authService *auth.Service, apiKeys db.APIKeyStore, auditLog db.AuditLog) *APIKeyHandler {
+	return &APIKeyHandler{
+		authService: authService,
+		apiKeys:     apiKeys,
+		auditLog:    auditLog,
+	}
+}
+
+// Routes registers the API key endpoints
+func (h *APIKeyHandler) Routes(rt router.Routes) {
+	rt.Handle(http.MethodGet, "/api-keys", http.HandlerFunc(h.ListAPIKeys))
+	rt.Handle(http.MethodPost, "/api-keys", http.HandlerFunc(h.CreateAPIKey))
+	rt.Handle(http.MethodDelete, "/api-keys/{id}", withID(h.RevokeAPIKey))
+}
+
+// ListAPIKeys returns the API keys of the caller's tenant, without their secrets
+func (h *APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := h.apiKeys.ListAPIKeys(r.Context(), claims.TenantID)
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to list API keys")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// CreateAPIKey issues an API key for the caller's tenant. A key can only
+// carry scopes whose permissions the caller holds; the key is shown once.
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
+		return
+	}
+
+	var createReq models.CreateAPIKeyRequest
+	if err := json.Unmarshal(body, &createReq); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	createReq.Name = strings.TrimSpace(createReq.Name)
+	if createReq.Name == "" || len(createReq.Name) > 100 {
+		problem.InvalidField(w, r, "name", models.FieldInvalid, "name is required and must be at most 100 characters")
+		return
+	}
+	if len(createReq.Scopes) == 0 {
+		problem.InvalidField(w, r, "scopes", models.FieldRequired, "At least one scope is required")
+		return
+	}
+	scopes := make([]string, 0, len(createReq.Scopes))
+	seen := make(map[string]bool, len(createReq.Scopes))
+	for _, scope := range createReq.Scopes {
+		if !models.IsValidScope(scope) {
+			problem.InvalidField(w, r, "scopes", models.FieldInvalid, "Invalid scope: "+scope)
+			return
+		}
+		for _, action := range models.ScopePermissions[scope] {
+			if !claims.HasPermission(action) {
+				problem.Error(w, r, http.StatusForbidden, problem.CodeInsufficientPermissions, "Cannot grant scope beyond your own permissions: "+scope)
+				return
+			}
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if createReq.ExpiresAt != nil && !createReq.ExpiresAt.After(time.Now()) {
+		problem.InvalidField(w, r, "expires_at", models.FieldInvalid, "expires_at must be in the future")
+		return
+	}
+
+	key, prefix, hash, err := h.authService.GenerateAPIKey()
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to generate API key")
+		return
+	}
+
+	apiKey := models.APIKey{
+		ID:         primitive.NewObjectID(),
+		TenantID:   claims.TenantID,
+		Name:       createReq.Name,
+		Prefix:     prefix,
+		SecretHash: hash,
+		Scopes:     scopes,
+		CreatedBy:  claims.UserID,
+		ExpiresAt:  createReq.ExpiresAt,
+		CreatedAt:  time.Now(),
+	}
+	if err := h.apiKeys.InsertAPIKey(r.Context(), apiKey); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to store API key")
+		return
+	}
+	middleware.AuditTarget(r.Context(), apiKey.ID.Hex())
+
+	recordAudit(r.Context(), h.auditLog, models.AuditEvent{
+		TenantID:  claims.TenantID,
+		Action:    models.AuditAPIKeyCreated,
+		ActorID:   claims.UserID,
+		TargetID:  apiKey.ID.Hex(),
+		IPAddress: middleware.ClientIP(r),
+		Details:   map[string]interface{}{"name": apiKey.Name, "prefix": prefix, "scopes": scopes},
+	})
+	logging.FromContext(r.Context()).WithFields(log.Fields{"tenant_id": claims.TenantID, "api_key_id": apiKey.ID.Hex(), "actor": claims.UserID}).Info("Created API key")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.CreateAPIKeyResponse{APIKey: apiKey, Key: key})
+}
+
+// RevokeAPIKey revokes one of the caller's tenant API keys
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request, id string) {
+	claims, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.apiKeys.RevokeAPIKey(r.Context(), claims.TenantID, id, time.Now()); err != nil {
+		if errors.Is(err, db.ErrAPIKeyNotFound) {
+			problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "API key not found")
+			return
+		}
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to revoke API key")
+		return
+	}
+	middleware.AuditTarget(r.Context(), id)
+
+	recordAudit(r.Context(), h.auditLog, models.AuditEvent{
+		TenantID:  claims.TenantID,
+		Action:    models.AuditAPIKeyRevoked,
+		ActorID:   claims.UserID,
+		TargetID:  id,
+		IPAddress: middleware.ClientIP(r),
+	})
+	logging.FromContext(r.Context()).WithFields(log.Fields{"tenant_id": claims.TenantID, "api_key_id": id, "actor": claims.UserID}).Info("Revoked API key")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"id": id, "message": "API key revoked successfully"})
+}
+
+// authorize checks that the caller is a tenant user allowed to manage API keys
+func (h *APIKeyHandler) authorize(w http.ResponseWriter, r *http.Request) (*models.Claims, bool) {
+	claims, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User context not found")
+		return nil, false
+	}
+	if claims.IsAPIKey() || !claims.HasPermission(models.PermManageAPIKeys) {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeInsufficientPermissions, "Insufficient permissions")
+		return nil, false
+	}
+	if claims.TenantID == "" {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "Caller is not bound to a tenant")
+		return nil, false
+	}
+	return claims, true
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/auth"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+)
+
+func TestAPIKeyHandler(t *testing.T) {
+	authService, _ := auth.NewService()
+	store := db.NewMemoryAPIKeyStore()
+	auditLog := db.NewMemoryAuditLog()
+	handler := NewAPIKeyHandler(authService, store, auditLog)
+	manager := &models.Claims{UserID: "manager-id", TenantID: "tenant-a", Role: models.RoleManager}
+
+	serve := func(method, path string, body interface{}, claims *models.Claims) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest(method, path, body, claims))
+		return w
+	}
+
+	t.Run("creates a key shown once", func(t *testing.T) {
+		w := serve("POST", "/api/v1/api-keys", models.CreateAPIKeyRequest{Name: "gateway", Scopes: []string{models.ScopeTelemetryWrite, models.ScopeVehiclesRead, models.ScopeTelemetryWrite}}, manager)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var created models.CreateAPIKeyResponse
+		json.NewDecoder(w.Body).Decode(&created)
+		assert.NotEmpty(t, created.Key)
+		assert.Equal(t, "tenant-a", created.TenantID)
+		assert.Equal(t, []string{models.ScopeTelemetryWrite, models.ScopeVehiclesRead}, created.Scopes)
+		assert.NotContains(t, w.Body.String(), "secret_hash")
+		assert.Equal(t, models.AuditAPIKeyCreated, auditLog.Events()[0].Action)
+
+		w = serve("GET", "/api/v1/api-keys", nil, manager)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), created.Key)
+		var keys []models.APIKey
+		json.NewDecoder(w.Body).Decode(&keys)
+		assert.Len(t, keys, 1)
+	})
+
+	t.Run("validates the request", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour)
+		assert.Equal(t, http.StatusBadRequest, serve("POST", "/api/v1/api-keys", models.CreateAPIKeyRequest{Scopes: []string{models.ScopeTelemetryWrite}}, manager).Code)
+		assert.Equal(t, http.StatusBadRequest, serve("POST", "/api/v1/api-keys", models.CreateAPIKeyRequest{Name: "k"}, manager).Code)
+		assert.Equal(t, http.StatusBadRequest, serve("POST", "/api/v1/api-keys", models.CreateAPIKeyRequest{Name: "k", Scopes: []string{"users:write"}}, manager).Code)
+		assert.Equal(t, http.StatusBadRequest, serve("POST", "/api/v1/api-keys", models.CreateAPIKeyRequest{Name: "k", Scopes: []string{models.ScopeAlertsRead}, ExpiresAt: &past}, manager).Code)
+	})
+
+	t.Run("scopes cannot exceed the caller's permissions", func(t *testing.T) {
+		operator := &models.Claims{UserID: "operator-id", TenantID: "tenant-a", Role: models.RoleOperator}
+		w := serve("POST", "/api/v1/api-keys", models.CreateAPIKeyRequest{Name: "k", Scopes: []string{models.ScopeVehiclesWrite}}, operator)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("API keys cannot manage keys", func(t *testing.T) {
+		key := &models.Claims{APIKeyID: "key-id", TenantID: "tenant-a", Scopes: []string{models.ScopeTelemetryWrite}}
+		assert.Equal(t, http.StatusForbidden, serve("GET", "/api/v1/api-keys", nil, key).Code)
+	})
+
+	t.Run("revocation is tenant-scoped", func(t *testing.T) {
+		keys, _ := store.ListAPIKeys(context.Background(), "tenant-a")
+		id := keys[0].ID.Hex()
+
+		other := &models.Claims{UserID: "admin-b", TenantID: "tenant-b", Role: models.RoleAdmin}
+		assert.Equal(t, http.StatusNotFound, serve("DELETE", "/api/v1/api-keys/"+id, nil, other).Code)
+
+		assert.Equal(t, http.StatusOK, serve("DELETE", "/api/v1/api-keys/"+id, nil, manager).Code)
+		keys, _ = store.ListAPIKeys(context.Background(), "tenant-a")
+		assert.NotNil(t, keys[0].RevokedAt)
+	})
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/middleware"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"github.com/ukydev/fleet-sustainability/internal/problem"
+	"github.com/ukydev/fleet-sustainability/internal/router"
+)
+
+// AuditHandler serves a tenant's audit trail to its admins
+type AuditHandler struct {
+	auditLog db.AuditLog
+}
+
+// NewAuditHandler creates a new audit trail handler
+func NewAuditHandler(auditLog db.AuditLog) *AuditHandler {
+	return &AuditHandler{auditLog: auditLog}
+}
+
+// Routes registers the audit trail endpoints
+func (h *AuditHandler) Routes(rt router.Routes) {
+	rt.Handle(http.MethodGet, "/audit", http.HandlerFunc(h.ListEvents))
+	rt.Handle(http.MethodGet, "/audit/verify", http.HandlerFunc(h.VerifyChain))
+}
+
+// ListEvents returns the caller's tenant audit events, newest first. The
+// actor_id, target_id, action and method query parameters filter by equality,
+// from and to (RFC 3339) bound the time and limit caps the number of events.
+func (h *AuditHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	query := db.AuditQuery{
+		TenantID: claims.TenantID,
+		ActorID:  params.Get("actor_id"),
+		TargetID: params.Get("target_id"),
+		Action:   params.Get("action"),
+		Method:   strings.ToUpper(params.Get("method")),
+	}
+	for name, bound := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		if value := params.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid '"+name+"' time format")
+				return
+			}
+			*bound = parsed
+		}
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > db.MaxAuditQueryLimit {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "limit must be between 1 and "+strconv.Itoa(db.MaxAuditQueryLimit))
+			return
+		}
+		query.Limit = limit
+	}
+
+	events, err := h.auditLog.Query(r.Context(), query)
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to query audit log")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// VerifyChain recomputes the caller's tenant audit hash chain and reports
+// whether any entry was modified, removed or reordered
+func (h *AuditHandler) VerifyChain(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := h.auditLog.Verify(r.Context(), claims.TenantID)
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to verify audit log")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// authorize returns the caller's claims if they may read the audit trail
+func (h *AuditHandler) authorize(w http.ResponseWriter, r *http.Request) (*models.Claims, bool) {
+	claims, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User context not found")
+		return nil, false
+	}
+	if !claims.HasPermission(models.PermViewAudit) {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeInsufficientPermissions, "Insufficient permissions")
+		return nil, false
+	}
+	return claims, true
+}
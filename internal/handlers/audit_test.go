@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/ukydev/fleet-sustainability/internal/auth"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/middleware"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"github.com/ukydev/fleet-sustainability/internal/router"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAuditHandler(t *testing.T) {
+	ctx := context.Background()
+	auditLog := db.NewMemoryAuditLog()
+	auditLog.Record(ctx, models.AuditEvent{TenantID: "tenant-a", Action: models.AuditAPIRequest, ActorID: "alice", Method: "DELETE", Route: "/api/trips", Status: 200})
+	auditLog.Record(ctx, models.AuditEvent{TenantID: "tenant-a", Action: models.AuditAPIRequest, ActorID: "bob", Method: "POST", Route: "/api/vehicles", Status: 201, TargetIDs: []string{"vehicle-1"}})
+	auditLog.Record(ctx, models.AuditEvent{TenantID: "tenant-b", Action: models.AuditAPIRequest, ActorID: "carol", Method: "DELETE", Route: "/api/trips", Status: 200})
+	handler := NewAuditHandler(auditLog)
+	admin := &models.Claims{UserID: "admin-id", TenantID: "tenant-a", Role: models.RoleAdmin}
+
+	serve := func(path string, claims *models.Claims) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("GET", path, nil, claims))
+		return w
+	}
+
+	t.Run("lists the tenant's events with filters", func(t *testing.T) {
+		w := serve("/api/v1/audit", admin)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var events []models.AuditEvent
+		json.NewDecoder(w.Body).Decode(&events)
+		assert.Len(t, events, 2)
+		assert.Equal(t, "bob", events[0].ActorID)
+
+		w = serve("/api/v1/audit?method=delete", admin)
+		json.NewDecoder(w.Body).Decode(&events)
+		assert.Len(t, events, 1)
+		assert.Equal(t, "alice", events[0].ActorID)
+
+		w = serve("/api/v1/audit?target_id=vehicle-1&limit=10", admin)
+		json.NewDecoder(w.Body).Decode(&events)
+		assert.Len(t, events, 1)
+		assert.Equal(t, "bob", events[0].ActorID)
+	})
+
+	t.Run("rejects invalid filters", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, serve("/api/v1/audit?from=yesterday", admin).Code)
+		assert.Equal(t, http.StatusBadRequest, serve("/api/v1/audit?limit=0", admin).Code)
+	})
+
+	t.Run("verifies the chain", func(t *testing.T) {
+		w := serve("/api/v1/audit/verify", admin)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var status models.AuditChainStatus
+		json.NewDecoder(w.Body).Decode(&status)
+		assert.True(t, status.Valid)
+		assert.Equal(t, int64(2), status.Entries)
+		assert.Equal(t, "tenant-a", status.TenantID)
+	})
+
+	t.Run("only admins may read the trail", func(t *testing.T) {
+		manager := &models.Claims{UserID: "manager-id", TenantID: "tenant-a", Role: models.RoleManager}
+		assert.Equal(t, http.StatusForbidden, serve("/api/v1/audit", manager).Code)
+		assert.Equal(t, http.StatusForbidden, serve("/api/v1/audit/verify", manager).Code)
+	})
+}
+
+func TestUserHandler_UpdateUser_Audited(t *testing.T) {
+	authService, _ := auth.NewService()
+	auditLog := db.NewMemoryAuditLog()
+	mockUsers := new(MockUserCollection)
+	refreshTokens := new(MockRefreshTokenCollection)
+	handler := router.New("/api/v1")
+	NewUserHandler(authService, mockUsers, refreshTokens, db.NewMemoryRevocationStore(), newLoginThrottle(), db.NewMemoryAuditLog()).
+		Routes(handler.With(middleware.NewAuditMiddleware(auditLog).Audit))
+	admin := &models.Claims{UserID: primitive.NewObjectID().Hex(), Role: models.RoleAdmin, TenantID: "tenant-a"}
+
+	target := &models.User{ID: primitive.NewObjectID(), TenantID: "tenant-a", Username: "dave", Role: models.RoleViewer, IsActive: true, PasswordHash: "hash"}
+	mockUsers.On("FindUserByID", mock.Anything, target.ID.Hex()).Return(target, nil)
+	mockUsers.On("UpdateUser", mock.Anything, target.ID.Hex(), mock.Anything).Return(nil)
+	refreshTokens.On("RevokeUserRefreshTokens", mock.Anything, target.ID.Hex()).Return(nil)
+
+	role := models.RoleOperator
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newUserAdminRequest("PATCH", "/api/v1/users/"+target.ID.Hex(), models.UpdateUserRequest{Role: &role}, admin))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	event := auditLog.Events()[0]
+	assert.Equal(t, admin.UserID, event.ActorID)
+	assert.Equal(t, []string{target.ID.Hex()}, event.TargetIDs)
+	assert.Equal(t, map[string]interface{}{"role": "viewer"}, event.Before)
+	assert.Equal(t, map[string]interface{}{"role": "operator"}, event.After)
+}
@@ -1,15 +1,25 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/ukydev/fleet-sustainability/internal/auth"
 	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/mail"
 	"github.com/ukydev/fleet-sustainability/internal/middleware"
 	"github.com/ukydev/fleet-sustainability/internal/models"
+	"github.com/ukydev/fleet-sustainability/internal/problem"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -17,85 +27,272 @@ import (
 type AuthHandler struct {
 	authService    *auth.Service
 	userCollection db.UserCollection
+	refreshTokens  db.RefreshTokenCollection
+	revocations    db.RevocationStore
+	mailer         mail.Sender
+	throttle       *auth.LoginThrottle
+	auditLog       db.AuditLog
+	mfaPolicies    db.MFAPolicyStore
+	tenants        db.TenantStore
+	appBaseURL     string
 }
 
-// NewAuthHandler creates a new authentication handler
-func NewAuthHandler(authService *auth.Service, userCollection db.UserCollection) *AuthHandler {
+// NewAuthHandler creates a new authentication handler. Links in emails point
+// at APP_BASE_URL (default http://localhost:3000).
+func NewAuthHandler(authService *auth.Service, userCollection db.UserCollection, refreshTokens db.RefreshTokenCollection, revocations db.RevocationStore, mailer mail.Sender, throttle *auth.LoginThrottle, auditLog db.AuditLog, mfaPolicies db.MFAPolicyStore, tenants db.TenantStore) *AuthHandler {
+	appBaseURL := strings.TrimRight(os.Getenv("APP_BASE_URL"), "/")
+	if appBaseURL == "" {
+		appBaseURL = "http://localhost:3000"
+	}
 	return &AuthHandler{
 		authService:    authService,
 		userCollection: userCollection,
+		refreshTokens:  refreshTokens,
+		revocations:    revocations,
+		mailer:         mailer,
+		throttle:       throttle,
+		auditLog:       auditLog,
+		mfaPolicies:    mfaPolicies,
+		tenants:        tenants,
+		appBaseURL:     appBaseURL,
 	}
 }
 
-// Login handles user login
+// Login handles user login. Failed attempts are throttled per username and
+// per client IP with exponential backoff, and repeated failures lock the account.
+// Users with MFA, or whose tenant requires it, get an MFA challenge instead of tokens.
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
 		return
 	}
 
 	var loginReq models.LoginRequest
 	if err := json.Unmarshal(body, &loginReq); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
 	// Validate input
 	if loginReq.Username == "" || loginReq.Password == "" {
-		http.Error(w, "Username and password are required", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeValidation, "Username and password are required")
+		return
+	}
+
+	clientIP := middleware.ClientIP(r)
+	throttleKeys := []string{"user:" + strings.ToLower(loginReq.Username), "ip:" + clientIP}
+	if wait := h.throttle.RetryAfter(throttleKeys...); wait > 0 {
+		writeRetryAfter(w, wait)
+		problem.Error(w, r, http.StatusTooManyRequests, problem.CodeTooManyAttempts, "Too many failed login attempts, try again later")
 		return
 	}
 
 	// Find user by username
 	user, err := h.userCollection.FindUserByUsername(r.Context(), loginReq.Username)
 	if err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		h.throttle.RecordFailure(throttleKeys...)
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid credentials")
 		return
 	}
 
+	now := time.Now()
+	if user.IsLocked(now) {
+		writeRetryAfter(w, user.LockedUntil.Sub(now))
+		problem.Error(w, r, http.StatusLocked, problem.CodeAccountLocked, "Account is temporarily locked")
+		return
+	}
+	if user.LockedUntil != nil {
+		// The lockout has run out: start counting failures afresh
+		if err := h.userCollection.UnlockUser(r.Context(), user.ID.Hex()); err != nil {
+			logging.FromContext(r.Context()).WithError(err).WithField("user_id", user.ID.Hex()).Error("Failed to clear expired lockout")
+		}
+		recordAudit(r.Context(), h.auditLog, models.AuditEvent{
+			TenantID:  user.TenantID,
+			Action:    models.AuditAccountUnlocked,
+			TargetID:  user.ID.Hex(),
+			IPAddress: clientIP,
+			Details:   map[string]interface{}{"reason": "lockout expired"},
+		})
+	}
+
 	// Check if user is active
 	if !user.IsActive {
-		http.Error(w, "Account is deactivated", http.StatusUnauthorized)
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeAccountDisabled, "Account is deactivated")
 		return
 	}
 
 	// Verify password
 	if !h.authService.CheckPassword(loginReq.Password, user.PasswordHash) {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		h.throttle.RecordFailure(throttleKeys...)
+		h.recordFailedLogin(r, user, clientIP)
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid credentials")
 		return
 	}
+	h.throttle.Reset(throttleKeys[0])
 
-	// Generate tokens
-	token, err := h.authService.GenerateToken(user)
+	h.finishLogin(w, r, user, loginReq.DeviceName)
+}
+
+// finishLogin completes a login whose first factor has passed. Enrolled users,
+// and users whose tenant requires MFA, get an MFA challenge instead of tokens.
+func (h *AuthHandler) finishLogin(w http.ResponseWriter, r *http.Request, user *models.User, deviceName string) {
+	if user.MFAEnabled {
+		h.writeMFAChallenge(w, r, user, auth.MFAPurposeVerify)
+		return
+	}
+	required, err := h.mfaRequired(r.Context(), user)
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).WithError(err).WithField("tenant_id", user.TenantID).Error("Failed to load MFA policy")
+		problem.Error(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "Failed to load MFA policy")
+		return
+	}
+	if required {
+		h.writeMFAChallenge(w, r, user, auth.MFAPurposeEnroll)
 		return
 	}
 
-	refreshToken, err := h.authService.GenerateRefreshToken()
-	if err != nil {
-		http.Error(w, "Failed to generate refresh token", http.StatusInternalServerError)
+	h.completeLogin(w, r, user, deviceName)
+}
+
+// completeLogin issues tokens for a fully authenticated user and writes the login response
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, deviceName string) {
+	response, ok := h.loginTokens(w, r, user, deviceName)
+	if !ok {
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// loginTokens starts a new session for a fully authenticated user. On
+// failure it writes the error response and returns false.
+func (h *AuthHandler) loginTokens(w http.ResponseWriter, r *http.Request, user *models.User, deviceName string) (*models.LoginResponse, bool) {
+	response, ok := h.issueTokens(w, r, user, primitive.NewObjectID().Hex(), deviceName)
+	if !ok {
+		return nil, false
+	}
+
 	// Update last login
-	err = h.userCollection.UpdateLastLogin(r.Context(), user.ID.Hex())
-	if err != nil {
+	if err := h.userCollection.UpdateLastLogin(r.Context(), user.ID.Hex()); err != nil {
 		// Log error but don't fail the login
-		// log.WithError(err).Error("Failed to update last login")
+		logging.FromContext(r.Context()).WithError(err).WithField("user_id", user.ID.Hex()).Error("Failed to update last login")
 	}
+	return response, true
+}
 
-	// Create response
-	response := models.LoginResponse{
-		Token:        token,
-		RefreshToken: refreshToken,
-		User:         *user,
+// recordFailedLogin counts a failed password against the account and locks it once the policy threshold is reached
+func (h *AuthHandler) recordFailedLogin(r *http.Request, user *models.User, clientIP string) {
+	attempts, err := h.userCollection.IncrementFailedLogins(r.Context(), user.ID.Hex())
+	if err != nil {
+		logging.FromContext(r.Context()).WithError(err).WithField("user_id", user.ID.Hex()).Error("Failed to record failed login")
+		return
+	}
+
+	policy := h.throttle.Policy()
+	if attempts < policy.LockoutThreshold {
+		return
+	}
+	lockedUntil := time.Now().Add(policy.LockoutDuration)
+	if err := h.userCollection.LockUser(r.Context(), user.ID.Hex(), lockedUntil); err != nil {
+		logging.FromContext(r.Context()).WithError(err).WithField("user_id", user.ID.Hex()).Error("Failed to lock account")
+		return
+	}
+	logging.FromContext(r.Context()).WithFields(log.Fields{"user_id": user.ID.Hex(), "attempts": attempts, "locked_until": lockedUntil}).Warn("Locked account after repeated failed logins")
+	recordAudit(r.Context(), h.auditLog, models.AuditEvent{
+		TenantID:  user.TenantID,
+		Action:    models.AuditAccountLocked,
+		TargetID:  user.ID.Hex(),
+		IPAddress: clientIP,
+		Details:   map[string]interface{}{"failed_attempts": attempts, "locked_until": lockedUntil},
+	})
+}
+
+// writeRetryAfter sets the Retry-After header, rounded up to whole seconds
+func writeRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	seconds := int64((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", seconds))
+}
+
+// recordAudit stores an audit event; failures are logged rather than failing the request
+func recordAudit(ctx context.Context, auditLog db.AuditLog, event models.AuditEvent) {
+	if err := auditLog.Record(ctx, event); err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("action", event.Action).Error("Failed to record audit event")
+	}
+}
+
+// Refresh exchanges a refresh token for a new access token and a rotated refresh token
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
+		return
+	}
+
+	var refreshReq models.RefreshRequest
+	if err := json.Unmarshal(body, &refreshReq); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if refreshReq.RefreshToken == "" {
+		problem.InvalidField(w, r, "refresh_token", models.FieldRequired, "refresh_token is required")
+		return
+	}
+
+	stored, err := h.refreshTokens.FindRefreshTokenByHash(r.Context(), h.authService.HashRefreshToken(refreshReq.RefreshToken))
+	if err != nil {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid refresh token")
+		return
+	}
+
+	// A token that was already rotated is being replayed: assume it leaked and
+	// revoke every token descended from the same login.
+	if stored.UsedAt != nil {
+		h.revokeFamily(r, stored)
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Refresh token reuse detected")
+		return
+	}
+	if stored.RevokedAt != nil || stored.IsExpired(time.Now()) {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid refresh token")
+		return
+	}
+
+	user, err := h.userCollection.FindUserByID(r.Context(), stored.UserID)
+	if err != nil || !user.IsActive {
+		h.revokeFamily(r, stored)
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid refresh token")
+		return
+	}
+
+	if err := h.refreshTokens.MarkRefreshTokenUsed(r.Context(), stored.ID.Hex()); err != nil {
+		if errors.Is(err, db.ErrRefreshTokenUsed) {
+			h.revokeFamily(r, stored)
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Refresh token reuse detected")
+			return
+		}
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to rotate refresh token")
+		return
+	}
+
+	deviceName := refreshReq.DeviceName
+	if deviceName == "" {
+		deviceName = stored.DeviceName
+	}
+	response, ok := h.issueTokens(w, r, user, stored.FamilyID, deviceName)
+	if !ok {
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -103,83 +300,233 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// Logout revokes the caller's access token and, if supplied, the refresh token family it belongs to
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	claims, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User context not found")
+		return
+	}
+
+	// The body is optional; an empty one only revokes the access token
+	var logoutReq models.LogoutRequest
+	if body, err := io.ReadAll(r.Body); err == nil && len(body) > 0 {
+		if err := json.Unmarshal(body, &logoutReq); err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+			return
+		}
+	}
+
+	if claims.JTI != "" {
+		if err := h.revocations.RevokeToken(r.Context(), claims.JTI, time.Unix(claims.Exp, 0)); err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to revoke token")
+			return
+		}
+	} else {
+		// Legacy tokens without a jti can only be revoked through the user-wide cutoff
+		if err := h.revocations.RevokeUserTokens(r.Context(), claims.UserID, time.Unix(claims.IssuedAt, 0), time.Unix(claims.Exp, 0)); err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to revoke token")
+			return
+		}
+	}
+
+	if logoutReq.RefreshToken != "" {
+		stored, err := h.refreshTokens.FindRefreshTokenByHash(r.Context(), h.authService.HashRefreshToken(logoutReq.RefreshToken))
+		if err == nil && stored.UserID == claims.UserID {
+			h.revokeFamily(r, stored)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
+}
+
+// LogoutAll revokes every access and refresh token of the caller on all devices
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	claims, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User context not found")
+		return
+	}
+
+	if err := h.revokeAllSessions(r, claims.UserID); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to revoke sessions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out from all sessions"})
+}
+
+// revokeAllSessions revokes all access tokens issued to a user so far and all of their refresh tokens
+func (h *AuthHandler) revokeAllSessions(r *http.Request, userID string) error {
+	return revokeUserSessions(r.Context(), h.authService, h.revocations, h.refreshTokens, userID)
+}
+
+// revokeUserSessions revokes all access tokens issued to a user so far and all of their refresh tokens
+func revokeUserSessions(ctx context.Context, authService *auth.Service, revocations db.RevocationStore, refreshTokens db.RefreshTokenCollection, userID string) error {
+	now := time.Now()
+	if err := revocations.RevokeUserTokens(ctx, userID, now, now.Add(authService.TokenExpiry())); err != nil {
+		return err
+	}
+	return refreshTokens.RevokeUserRefreshTokens(ctx, userID)
+}
+
+// issueTokens generates an access token and a persisted refresh token in the
+// given family. Users of suspended tenants get none. On failure it writes the
+// error response and returns false.
+func (h *AuthHandler) issueTokens(w http.ResponseWriter, r *http.Request, user *models.User, familyID, deviceName string) (*models.LoginResponse, bool) {
+	if status, message := middleware.CheckTenant(r.Context(), h.tenants, user.TenantID); status != http.StatusOK {
+		problem.Error(w, r, status, problem.CodeFor(status), message)
+		return nil, false
+	}
+
+	token, err := h.authService.GenerateToken(user)
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to generate token")
+		return nil, false
+	}
+
+	refreshToken, err := h.authService.GenerateRefreshToken()
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to generate refresh token")
+		return nil, false
+	}
+
+	now := time.Now()
+	stored := models.RefreshToken{
+		ID:         primitive.NewObjectID(),
+		UserID:     user.ID.Hex(),
+		TenantID:   user.TenantID,
+		FamilyID:   familyID,
+		TokenHash:  h.authService.HashRefreshToken(refreshToken),
+		DeviceName: deviceName,
+		UserAgent:  r.UserAgent(),
+		IPAddress:  middleware.ClientIP(r),
+		ExpiresAt:  now.Add(h.authService.RefreshTokenExpiry()),
+		CreatedAt:  now,
+	}
+	if err := h.refreshTokens.InsertRefreshToken(r.Context(), stored); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to store refresh token")
+		return nil, false
+	}
+
+	return &models.LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		User:         *user,
+	}, true
+}
+
+// revokeFamily revokes every refresh token in the family of the given token
+func (h *AuthHandler) revokeFamily(r *http.Request, token *models.RefreshToken) {
+	if err := h.refreshTokens.RevokeRefreshTokenFamily(r.Context(), token.FamilyID); err != nil {
+		logging.FromContext(r.Context()).WithError(err).WithField("family_id", token.FamilyID).Error("Failed to revoke refresh token family")
+		return
+	}
+	logging.FromContext(r.Context()).WithFields(log.Fields{"user_id": token.UserID, "family_id": token.FamilyID}).Warn("Revoked refresh token family")
+}
+
 // Register handles user registration
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
 		return
 	}
 
     var registerReq models.RegisterRequest
 	if err := json.Unmarshal(body, &registerReq); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
 	// Validate input
-    if err := h.authService.ValidateUsername(registerReq.Username); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	if err := h.authService.ValidateEmail(registerReq.Email); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var invalid models.ValidationError
+	invalid.Check("username", h.authService.ValidateUsername(registerReq.Username))
+	invalid.Check("email", h.authService.ValidateEmail(registerReq.Email))
+	invalid.Check("password", h.authService.ValidatePassword(registerReq.Password, registerReq.Username, registerReq.Email))
+	if err := invalid.Err(); err != nil {
+		problem.Validation(w, r, err)
 		return
 	}
 
-    if err := h.authService.ValidatePassword(registerReq.Password); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+	// Tenant and role come from a signed invitation, or from a brand new tenant
+	// in open mode; never from the request body.
+	var tenantID string
+	var role models.Role
+	if registerReq.InviteToken != "" {
+		invite, err := h.authService.ValidateInviteToken(registerReq.InviteToken)
+		if err != nil {
+			problem.Error(w, r, http.StatusForbidden, problem.CodeInvalidToken, "Invalid or expired invitation")
+			return
+		}
+		if !strings.EqualFold(invite.Email, registerReq.Email) {
+			problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "Invitation was issued for a different email")
+			return
+		}
+		if status, message := middleware.CheckTenant(r.Context(), h.tenants, invite.TenantID); status != http.StatusOK {
+			problem.Error(w, r, status, problem.CodeFor(status), message)
+			return
+		}
+		tenantID = invite.TenantID
+		role = invite.Role
+	} else {
+		if h.authService.RegistrationMode() != auth.RegistrationOpen {
+			problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "Registration requires an invitation")
+			return
+		}
+		// The first user of a new tenant administers it
+		tenantID = primitive.NewObjectID().Hex()
+		role = models.RoleAdmin
 	}
 
-    // Default role if not provided by client: admin for 'admin' username, else user
-    if registerReq.Role == "" {
-        if registerReq.Username == "admin" {
-            registerReq.Role = "admin"
-        } else {
-            registerReq.Role = "user"
-        }
-    }
-    if !models.IsValidRole(registerReq.Role) {
-        http.Error(w, "Invalid role", http.StatusBadRequest)
-        return
-    }
-
 	// Check if username already exists
 	_, err = h.userCollection.FindUserByUsername(r.Context(), registerReq.Username)
 	if err == nil {
-		http.Error(w, "Username already exists", http.StatusConflict)
+		problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "Username already exists")
 		return
 	}
 
 	// Check if email already exists
 	_, err = h.userCollection.FindUserByEmail(r.Context(), registerReq.Email)
 	if err == nil {
-		http.Error(w, "Email already exists", http.StatusConflict)
+		problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "Email already exists")
 		return
 	}
 
 	// Hash password
 	passwordHash, err := h.authService.HashPassword(registerReq.Password)
 	if err != nil {
-		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to hash password")
 		return
 	}
 
 	// Create user
 	user := models.User{
 		ID:           primitive.NewObjectID(),
-        TenantID:     registerReq.TenantID,
+        TenantID:     tenantID,
 		Username:     registerReq.Username,
 		Email:        registerReq.Email,
 		PasswordHash: passwordHash,
-		Role:         registerReq.Role,
+		Role:         role,
 		FirstName:    registerReq.FirstName,
 		LastName:     registerReq.LastName,
 		IsActive:     true,
@@ -187,54 +534,154 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt:    time.Now(),
 	}
 
-	// Save user to database
+	// A brand new tenant is created alongside its first admin
+	newTenant := registerReq.InviteToken == ""
+	if newTenant {
+		tenantName := strings.TrimSpace(registerReq.TenantName)
+		if tenantName == "" {
+			tenantName = registerReq.Username
+		}
+		if err := h.tenants.InsertTenant(r.Context(), models.NewTenant(tenantID, tenantName)); err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to create tenant")
+			return
+		}
+	}
+
+	// Save user to database; the unique indexes catch registrations racing
+	// past the checks above
 	err = h.userCollection.InsertUser(r.Context(), user)
 	if err != nil {
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		// Do not leave a tenant without users behind
+		if newTenant {
+			if err := h.tenants.DeleteTenant(r.Context(), tenantID); err != nil {
+				logging.FromContext(r.Context()).WithError(err).WithField("tenant_id", tenantID).Error("Failed to remove tenant of failed registration")
+			}
+		}
+		if errors.Is(err, db.ErrUserExists) {
+			problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "Username or email already exists")
+			return
+		}
+		logging.FromContext(r.Context()).WithError(err).Error("Failed to create user")
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to create user")
 		return
 	}
 
 	// Generate tokens
-	token, err := h.authService.GenerateToken(&user)
-	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+	response, ok := h.issueTokens(w, r, &user, primitive.NewObjectID().Hex(), "")
+	if !ok {
 		return
 	}
 
-	refreshToken, err := h.authService.GenerateRefreshToken()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Invite issues a signed invitation that lets a new user join the caller's tenant with the given role
+func (h *AuthHandler) Invite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	claims, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User context not found")
+		return
+	}
+	if claims.Role != models.RoleAdmin {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeInsufficientPermissions, "Insufficient permissions")
+		return
+	}
+	if claims.TenantID == "" {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeBadRequest, "Caller is not bound to a tenant")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to generate refresh token", http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
 		return
 	}
 
-	// Create response
-	response := models.LoginResponse{
-		Token:        token,
-		RefreshToken: refreshToken,
-		User:         user,
+	var inviteReq models.InviteRequest
+	if err := json.Unmarshal(body, &inviteReq); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	var invalid models.ValidationError
+	invalid.Check("email", h.authService.ValidateEmail(inviteReq.Email))
+	if !models.IsValidRole(inviteReq.Role) {
+		invalid.Add("role", models.FieldInvalid, "Invalid role")
+	}
+	if err := invalid.Err(); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+
+	token, expiresAt, err := h.authService.GenerateInviteToken(models.InviteClaims{
+		TenantID:  claims.TenantID,
+		Role:      inviteReq.Role,
+		Email:     inviteReq.Email,
+		InvitedBy: claims.UserID,
+	})
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to generate invitation")
+		return
 	}
 
+	logging.FromContext(r.Context()).WithFields(log.Fields{"tenant_id": claims.TenantID, "role": inviteReq.Role, "invited_by": claims.UserID}).Info("Issued user invitation")
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(models.InviteResponse{
+		InviteToken: token,
+		Email:       inviteReq.Email,
+		Role:        inviteReq.Role,
+		ExpiresAt:   expiresAt,
+	})
+}
+
+// JWKS publishes the public keys access tokens are signed with so other
+// services can verify them
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.authService.JWKS())
+}
+
+// Profile routes /api/v1/auth/profile to GetProfile or UpdateProfile
+func (h *AuthHandler) Profile(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.GetProfile(w, r)
+	case http.MethodPut:
+		h.UpdateProfile(w, r)
+	default:
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+	}
 }
 
 // GetProfile returns the current user's profile
 func (h *AuthHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	claims, ok := middleware.GetUserFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User context not found", http.StatusUnauthorized)
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User context not found")
 		return
 	}
 
 	user, err := h.userCollection.FindUserByID(r.Context(), claims.UserID)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "User not found")
 		return
 	}
 
@@ -242,40 +689,36 @@ func (h *AuthHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
-// UpdateProfile updates the current user's profile
+// UpdateProfile updates the current user's profile. A changed email is not
+// applied directly; a verification link is sent to the new address instead.
 func (h *AuthHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	claims, ok := middleware.GetUserFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User context not found", http.StatusUnauthorized)
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User context not found")
 		return
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
 		return
 	}
 
-	var updateReq struct {
-		FirstName string `json:"first_name"`
-		LastName  string `json:"last_name"`
-		Email     string `json:"email"`
-	}
-
+	var updateReq models.UpdateProfileRequest
 	if err := json.Unmarshal(body, &updateReq); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
 	// Get current user
 	user, err := h.userCollection.FindUserByID(r.Context(), claims.UserID)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "User not found")
 		return
 	}
 
@@ -286,49 +729,234 @@ func (h *AuthHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	if updateReq.LastName != "" {
 		user.LastName = updateReq.LastName
 	}
-	if updateReq.Email != "" {
+	emailChanged := updateReq.Email != "" && updateReq.Email != user.Email
+	if emailChanged {
 		// Validate email
 		if err := h.authService.ValidateEmail(updateReq.Email); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.InvalidField(w, r, "email", models.FieldInvalid, err.Error())
 			return
 		}
 		// Check if email is already taken by another user
 		existingUser, err := h.userCollection.FindUserByEmail(r.Context(), updateReq.Email)
 		if err == nil && existingUser.ID.Hex() != claims.UserID {
-			http.Error(w, "Email already exists", http.StatusConflict)
+			problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "Email already exists")
 			return
 		}
-		user.Email = updateReq.Email
 	}
 
 	// Update user
 	err = h.userCollection.UpdateUser(r.Context(), claims.UserID, *user)
 	if err != nil {
-		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update user")
 		return
 	}
 
+	response := map[string]string{"message": "Profile updated successfully"}
+	if emailChanged {
+		if err := h.sendEmailVerification(r.Context(), user, updateReq.Email); err != nil {
+			logging.FromContext(r.Context()).WithError(err).WithField("user_id", claims.UserID).Error("Failed to send email verification")
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to send verification email")
+			return
+		}
+		response["message"] = "Profile updated; check the new email address to confirm the change"
+		response["pending_email"] = updateReq.Email
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Profile updated successfully"})
+	json.NewEncoder(w).Encode(response)
+}
+
+// VerifyEmail applies a pending email change confirmed through its emailed token
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
+		return
+	}
+
+	var verifyReq models.VerifyEmailRequest
+	if err := json.Unmarshal(body, &verifyReq); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	change, err := h.authService.ValidateEmailChangeToken(verifyReq.Token)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Invalid or expired verification token")
+		return
+	}
+
+	user, err := h.userCollection.FindUserByID(r.Context(), change.UserID)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Invalid or expired verification token")
+		return
+	}
+	// The token only applies to the address it was issued for
+	if user.Email != change.OldEmail {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Invalid or expired verification token")
+		return
+	}
+	if existingUser, err := h.userCollection.FindUserByEmail(r.Context(), change.NewEmail); err == nil && existingUser.ID != user.ID {
+		problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "Email already exists")
+		return
+	}
+
+	user.Email = change.NewEmail
+	if err := h.userCollection.UpdateUser(r.Context(), change.UserID, *user); err != nil {
+		if errors.Is(err, db.ErrUserExists) {
+			problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "Email already exists")
+			return
+		}
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update user")
+		return
+	}
+
+	logging.FromContext(r.Context()).WithField("user_id", change.UserID).Info("Verified email change")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email updated successfully", "email": user.Email})
+}
+
+// ForgotPassword emails a password reset link. It answers the same way whether
+// or not the address belongs to an account so that accounts cannot be enumerated.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
+		return
+	}
+
+	var forgotReq models.ForgotPasswordRequest
+	if err := json.Unmarshal(body, &forgotReq); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if err := h.authService.ValidateEmail(forgotReq.Email); err != nil {
+		problem.InvalidField(w, r, "email", models.FieldInvalid, err.Error())
+		return
+	}
+
+	// Single sign-on users have no local password to reset
+	if user, err := h.userCollection.FindUserByEmail(r.Context(), forgotReq.Email); err == nil && user.IsActive && !user.IsSSO() {
+		if err := h.sendPasswordReset(r.Context(), user); err != nil {
+			logging.FromContext(r.Context()).WithError(err).WithField("user_id", user.ID.Hex()).Error("Failed to send password reset email")
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the address belongs to an account, a reset link has been sent"})
+}
+
+// ResetPassword sets a new password using an emailed reset token and signs the user out everywhere
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
+		return
+	}
+
+	var resetReq models.ConfirmPasswordResetRequest
+	if err := json.Unmarshal(body, &resetReq); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if resetReq.Token == "" || resetReq.NewPassword == "" {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeValidation, "Token and new password are required")
+		return
+	}
+
+	reset, err := h.authService.ValidatePasswordResetToken(resetReq.Token)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Invalid or expired reset token")
+		return
+	}
+	user, err := h.userCollection.FindUserByID(r.Context(), reset.UserID)
+	// A token is spent once the password it was issued against has changed
+	if err != nil || !user.IsActive || reset.PasswordFingerprint != h.authService.PasswordFingerprint(user.PasswordHash) {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Invalid or expired reset token")
+		return
+	}
+	if err := h.authService.ValidatePassword(resetReq.NewPassword, user.Username, user.Email); err != nil {
+		problem.InvalidField(w, r, "new_password", models.FieldInvalid, err.Error())
+		return
+	}
+
+	if !h.storePassword(w, r, user, resetReq.NewPassword) {
+		return
+	}
+	if err := h.revokeAllSessions(r, reset.UserID); err != nil {
+		logging.FromContext(r.Context()).WithError(err).WithField("user_id", reset.UserID).Error("Failed to revoke sessions after password reset")
+	}
+
+	logging.FromContext(r.Context()).WithField("user_id", reset.UserID).Info("Reset password via email")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password reset successfully"})
+}
+
+// sendEmailVerification emails a link confirming that the user owns newEmail
+func (h *AuthHandler) sendEmailVerification(ctx context.Context, user *models.User, newEmail string) error {
+	token, expiresAt, err := h.authService.GenerateEmailChangeToken(models.EmailChangeClaims{
+		UserID:   user.ID.Hex(),
+		OldEmail: user.Email,
+		NewEmail: newEmail,
+	})
+	if err != nil {
+		return err
+	}
+	return h.mailer.Send(ctx, mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your new email address for Fleet Sustainability by opening:\n\n%s/verify-email?token=%s\n\nThe link expires at %s. If you did not request this change, ignore this message.\n",
+			user.Username, h.appBaseURL, url.QueryEscape(token), expiresAt.UTC().Format(time.RFC1123)),
+	})
+}
+
+// sendPasswordReset emails a password reset link to the user
+func (h *AuthHandler) sendPasswordReset(ctx context.Context, user *models.User) error {
+	token, expiresAt, err := h.authService.GeneratePasswordResetToken(user)
+	if err != nil {
+		return err
+	}
+	return h.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nReset your Fleet Sustainability password by opening:\n\n%s/reset-password?token=%s\n\nThe link expires at %s. If you did not request a reset, ignore this message.\n",
+			user.Username, h.appBaseURL, url.QueryEscape(token), expiresAt.UTC().Format(time.RFC1123)),
+	})
 }
 
 // ChangePassword changes the current user's password
 func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	claims, ok := middleware.GetUserFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User context not found", http.StatusUnauthorized)
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User context not found")
 		return
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
 		return
 	}
 
@@ -338,46 +966,35 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.Unmarshal(body, &passwordReq); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
 	if passwordReq.CurrentPassword == "" || passwordReq.NewPassword == "" {
-		http.Error(w, "Current password and new password are required", http.StatusBadRequest)
-		return
-	}
-
-	// Validate new password
-	if err := h.authService.ValidatePassword(passwordReq.NewPassword); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeValidation, "Current password and new password are required")
 		return
 	}
 
 	// Get current user
 	user, err := h.userCollection.FindUserByID(r.Context(), claims.UserID)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "User not found")
 		return
 	}
 
 	// Verify current password
 	if !h.authService.CheckPassword(passwordReq.CurrentPassword, user.PasswordHash) {
-		http.Error(w, "Current password is incorrect", http.StatusUnauthorized)
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Current password is incorrect")
 		return
 	}
 
-	// Hash new password
-	newPasswordHash, err := h.authService.HashPassword(passwordReq.NewPassword)
-	if err != nil {
-		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+	// Validate new password
+	if err := h.authService.ValidatePassword(passwordReq.NewPassword, user.Username, user.Email); err != nil {
+		problem.InvalidField(w, r, "new_password", models.FieldInvalid, err.Error())
 		return
 	}
 
-	// Update password
-	user.PasswordHash = newPasswordHash
-	err = h.userCollection.UpdateUser(r.Context(), claims.UserID, *user)
-	if err != nil {
-		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+	if !h.storePassword(w, r, user, passwordReq.NewPassword) {
 		return
 	}
 
@@ -385,3 +1002,27 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Password changed successfully"})
 }
+
+// storePassword hashes and saves an already validated new password, refusing
+// the user's recent passwords. On failure it writes the error response and returns false.
+func (h *AuthHandler) storePassword(w http.ResponseWriter, r *http.Request, user *models.User, newPassword string) bool {
+	return setUserPassword(w, r, h.authService, h.userCollection, user, newPassword)
+}
+
+// setUserPassword sets and saves a user's new password. On failure it writes
+// the error response and returns false.
+func setUserPassword(w http.ResponseWriter, r *http.Request, authService *auth.Service, userCollection db.UserCollection, user *models.User, newPassword string) bool {
+	if err := authService.SetPassword(user, newPassword); errors.Is(err, auth.ErrPasswordReused) {
+		problem.InvalidField(w, r, "new_password", models.FieldInvalid, err.Error())
+		return false
+	} else if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to hash password")
+		return false
+	}
+
+	if err := userCollection.UpdateUser(r.Context(), user.ID.Hex(), *user); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update password")
+		return false
+	}
+	return true
+}
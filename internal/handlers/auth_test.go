@@ -4,19 +4,23 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/ukydev/fleet-sustainability/internal/auth"
 	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/mail"
 	"github.com/ukydev/fleet-sustainability/internal/middleware"
 	"github.com/ukydev/fleet-sustainability/internal/models"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/ukydev/fleet-sustainability/internal/problem"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // MockUserCollection is a mock implementation of UserCollection
@@ -53,12 +57,25 @@ func (m *MockUserCollection) FindUserByEmail(ctx context.Context, email string)
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
-func (m *MockUserCollection) FindUsers(ctx context.Context, filter bson.M) (*mongo.Cursor, error) {
-	args := m.Called(ctx, filter)
+func (m *MockUserCollection) FindUserByOIDCSubject(ctx context.Context, issuer, subject string) (*models.User, error) {
+	args := m.Called(ctx, issuer, subject)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(*mongo.Cursor), args.Error(1)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserCollection) FindUsers(ctx context.Context, q db.UserQuery) ([]models.User, error) {
+	args := m.Called(ctx, q)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.User), args.Error(1)
+}
+
+func (m *MockUserCollection) CountUsers(ctx context.Context, q db.UserQuery) (int64, error) {
+	args := m.Called(ctx, q)
+	return args.Get(0).(int64), args.Error(1)
 }
 
 func (m *MockUserCollection) UpdateUser(ctx context.Context, id string, user models.User) error {
@@ -76,6 +93,75 @@ func (m *MockUserCollection) UpdateLastLogin(ctx context.Context, id string) err
 	return args.Error(0)
 }
 
+func (m *MockUserCollection) IncrementFailedLogins(ctx context.Context, id string) (int, error) {
+	args := m.Called(ctx, id)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockUserCollection) LockUser(ctx context.Context, id string, until time.Time) error {
+	args := m.Called(ctx, id, until)
+	return args.Error(0)
+}
+
+func (m *MockUserCollection) UnlockUser(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// MockRefreshTokenCollection is a mock implementation of RefreshTokenCollection
+type MockRefreshTokenCollection struct {
+	mock.Mock
+}
+
+func (m *MockRefreshTokenCollection) InsertRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenCollection) FindRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	args := m.Called(ctx, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.RefreshToken), args.Error(1)
+}
+
+func (m *MockRefreshTokenCollection) MarkRefreshTokenUsed(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenCollection) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	args := m.Called(ctx, familyID)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenCollection) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+// newMockRefreshTokenCollection returns a refresh token mock that accepts any inserted token
+func newMockRefreshTokenCollection() *MockRefreshTokenCollection {
+	m := new(MockRefreshTokenCollection)
+	m.On("InsertRefreshToken", mock.Anything, mock.AnythingOfType("models.RefreshToken")).Return(nil).Maybe()
+	return m
+}
+
+// newLoginThrottle returns a throttle with the default policy
+func newLoginThrottle() *auth.LoginThrottle {
+	return auth.NewLoginThrottle(auth.LoginPolicyFromEnv())
+}
+
+// newTenantStore returns a tenant store holding the active tenants used across the handler tests
+func newTenantStore() *db.MemoryTenantStore {
+	tenants := db.NewMemoryTenantStore()
+	for _, id := range []string{"tenant-a", "tenant-b"} {
+		tenants.InsertTenant(context.Background(), models.NewTenant(id, id))
+	}
+	return tenants
+}
+
 func TestAuthHandler_Login(t *testing.T) {
 	authService, err := auth.NewService()
 	if err != nil {
@@ -84,7 +170,7 @@ func TestAuthHandler_Login(t *testing.T) {
 
 	t.Run("successful login", func(t *testing.T) {
 		mockUserCollection := new(MockUserCollection)
-		handler := NewAuthHandler(authService, db.UserCollection(mockUserCollection))
+		handler := NewAuthHandler(authService, db.UserCollection(mockUserCollection), newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
 
 		// Create a real password hash
 		passwordHash, err := authService.HashPassword("password123")
@@ -133,7 +219,7 @@ func TestAuthHandler_Login(t *testing.T) {
 
 	t.Run("invalid credentials", func(t *testing.T) {
 		mockUserCollection := new(MockUserCollection)
-		handler := NewAuthHandler(authService, db.UserCollection(mockUserCollection))
+		handler := NewAuthHandler(authService, db.UserCollection(mockUserCollection), newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
 
 		mockUserCollection.On("FindUserByUsername", mock.Anything, "testuser").Return(nil, assert.AnError)
 
@@ -157,7 +243,7 @@ func TestAuthHandler_Login(t *testing.T) {
 
 	t.Run("inactive user", func(t *testing.T) {
 		mockUserCollection := new(MockUserCollection)
-		handler := NewAuthHandler(authService, db.UserCollection(mockUserCollection))
+		handler := NewAuthHandler(authService, db.UserCollection(mockUserCollection), newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
 
 		// Create a real password hash
 		passwordHash, err := authService.HashPassword("password123")
@@ -190,24 +276,134 @@ func TestAuthHandler_Login(t *testing.T) {
 		assert.Equal(t, http.StatusUnauthorized, w.Code)
 		mockUserCollection.AssertExpectations(t)
 	})
+
+	t.Run("suspended tenant", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		tenants := newTenantStore()
+		suspended, _ := tenants.FindTenantByID(context.Background(), "tenant-a")
+		suspended.Status = models.TenantSuspended
+		tenants.UpdateTenant(context.Background(), *suspended)
+		handler := NewAuthHandler(authService, db.UserCollection(mockUserCollection), newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), tenants)
+
+		passwordHash, _ := authService.HashPassword("password123")
+		user := &models.User{ID: primitive.NewObjectID(), TenantID: "tenant-a", Username: "testuser", PasswordHash: passwordHash, Role: models.RoleAdmin, IsActive: true}
+		mockUserCollection.On("FindUserByUsername", mock.Anything, "testuser").Return(user, nil)
+
+		body, _ := json.Marshal(models.LoginRequest{Username: "testuser", Password: "password123"})
+		w := httptest.NewRecorder()
+		handler.Login(w, httptest.NewRequest("POST", "/api/auth/login", bytes.NewBuffer(body)))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "Tenant is suspended")
+	})
+}
+
+func TestAuthHandler_Login_BruteForceProtection(t *testing.T) {
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	passwordHash, _ := authService.HashPassword("password123")
+	policy := auth.LoginPolicy{
+		BackoffThreshold: 2,
+		BackoffBase:      time.Minute,
+		BackoffMax:       time.Hour,
+		FailureWindow:    time.Hour,
+		LockoutThreshold: 3,
+		LockoutDuration:  15 * time.Minute,
+	}
+	login := func(handler *AuthHandler, password, ip string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.LoginRequest{Username: "testuser", Password: password})
+		req := httptest.NewRequest("POST", "/api/auth/login", bytes.NewBuffer(body))
+		req.RemoteAddr = ip + ":12345"
+		w := httptest.NewRecorder()
+		handler.Login(w, req)
+		return w
+	}
+
+	t.Run("backs off after repeated failures", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		handler := NewAuthHandler(authService, mockUserCollection, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), auth.NewLoginThrottle(policy), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+		mockUserCollection.On("FindUserByUsername", mock.Anything, "testuser").Return(nil, assert.AnError)
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusUnauthorized, login(handler, "wrong", "10.0.0.1").Code)
+		}
+		w := login(handler, "wrong", "10.0.0.1")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+		mockUserCollection.AssertNumberOfCalls(t, "FindUserByUsername", 3)
+	})
+
+	t.Run("locks account and records audit event", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		auditLog := db.NewMemoryAuditLog()
+		handler := NewAuthHandler(authService, mockUserCollection, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), auth.NewLoginThrottle(policy), auditLog, db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		user := &models.User{ID: primitive.NewObjectID(), TenantID: "tenant-a", Username: "testuser", PasswordHash: passwordHash, IsActive: true, FailedLoginAttempts: 2}
+		mockUserCollection.On("FindUserByUsername", mock.Anything, "testuser").Return(user, nil)
+		mockUserCollection.On("IncrementFailedLogins", mock.Anything, user.ID.Hex()).Return(3, nil)
+		mockUserCollection.On("LockUser", mock.Anything, user.ID.Hex(), mock.AnythingOfType("time.Time")).Return(nil)
+
+		assert.Equal(t, http.StatusUnauthorized, login(handler, "wrong", "10.0.0.2").Code)
+		mockUserCollection.AssertExpectations(t)
+
+		events := auditLog.Events()
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, models.AuditAccountLocked, events[0].Action)
+			assert.Equal(t, "tenant-a", events[0].TenantID)
+			assert.Equal(t, user.ID.Hex(), events[0].TargetID)
+		}
+	})
+
+	t.Run("locked account is refused even with the right password", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		handler := NewAuthHandler(authService, mockUserCollection, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), auth.NewLoginThrottle(policy), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		lockedUntil := time.Now().Add(10 * time.Minute)
+		user := &models.User{ID: primitive.NewObjectID(), Username: "testuser", PasswordHash: passwordHash, IsActive: true, LockedUntil: &lockedUntil}
+		mockUserCollection.On("FindUserByUsername", mock.Anything, "testuser").Return(user, nil)
+
+		w := login(handler, "password123", "10.0.0.3")
+		assert.Equal(t, http.StatusLocked, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	})
+
+	t.Run("expired lockout is cleared", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		auditLog := db.NewMemoryAuditLog()
+		handler := NewAuthHandler(authService, mockUserCollection, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), auth.NewLoginThrottle(policy), auditLog, db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		lockedUntil := time.Now().Add(-time.Minute)
+		user := &models.User{ID: primitive.NewObjectID(), Username: "testuser", PasswordHash: passwordHash, IsActive: true, LockedUntil: &lockedUntil}
+		mockUserCollection.On("FindUserByUsername", mock.Anything, "testuser").Return(user, nil)
+		mockUserCollection.On("UnlockUser", mock.Anything, user.ID.Hex()).Return(nil)
+		mockUserCollection.On("UpdateLastLogin", mock.Anything, user.ID.Hex()).Return(nil)
+
+		assert.Equal(t, http.StatusOK, login(handler, "password123", "10.0.0.4").Code)
+		mockUserCollection.AssertExpectations(t)
+		assert.Equal(t, models.AuditAccountUnlocked, auditLog.Events()[0].Action)
+	})
 }
 
 func TestAuthHandler_Register(t *testing.T) {
+	t.Setenv("REGISTRATION_MODE", "open")
 	authService, err := auth.NewService()
 	if err != nil {
 		t.Fatalf("Failed to create auth service: %v", err)
 	}
 	mockUserCollection := new(MockUserCollection)
-	handler := NewAuthHandler(authService, db.UserCollection(mockUserCollection))
+	tenants := newTenantStore()
+	handler := NewAuthHandler(authService, db.UserCollection(mockUserCollection), newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), tenants)
 
 	t.Run("successful registration", func(t *testing.T) {
 		registerReq := models.RegisterRequest{
-			Username:  "newuser",
-			Email:     "newuser@example.com",
-			Password:  "password123",
-			FirstName: "New",
-			LastName:  "User",
-			Role:      models.RoleViewer,
+			Username:   "newuser",
+			Email:      "newuser@example.com",
+			Password:   "password123",
+			FirstName:  "New",
+			LastName:   "User",
+			TenantName: "New Fleet",
 		}
 
 		// Mock that user doesn't exist
@@ -234,6 +430,14 @@ func TestAuthHandler_Register(t *testing.T) {
 		assert.NotEmpty(t, response.Token)
 		assert.NotEmpty(t, response.RefreshToken)
 		assert.Equal(t, registerReq.Username, response.User.Username)
+		// Open registration creates a new tenant administered by its first user
+		assert.Equal(t, models.RoleAdmin, response.User.Role)
+		assert.NotEmpty(t, response.User.TenantID)
+		tenant, err := tenants.FindTenantByID(context.Background(), response.User.TenantID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "New Fleet", tenant.Name)
+			assert.True(t, tenant.IsActive())
+		}
 
 		mockUserCollection.AssertExpectations(t)
 	})
@@ -246,7 +450,6 @@ func TestAuthHandler_Register(t *testing.T) {
 			Password:  "password123",
 			FirstName: "New",
 			LastName:  "User",
-			Role:      models.RoleViewer,
 		}
 
 		mockUserCollection.On("FindUserByUsername", mock.Anything, "existinguser").Return(existingUser, nil)
@@ -264,36 +467,218 @@ func TestAuthHandler_Register(t *testing.T) {
 		mockUserCollection.AssertExpectations(t)
 	})
 
-	t.Run("invalid role", func(t *testing.T) {
-		registerReq := models.RegisterRequest{
-			Username:  "newuser",
-			Email:     "newuser@example.com",
-			Password:  "password123",
-			FirstName: "New",
-			LastName:  "User",
-			Role:      "invalid_role",
-		}
+	t.Run("every invalid field is reported", func(t *testing.T) {
+		body := []byte(`{"username":"x","email":"not-an-email","password":"short"}`)
+		req := httptest.NewRequest("POST", "/api/auth/register", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
 
-		body, err := json.Marshal(registerReq)
-		if err != nil {
-			t.Fatalf("Failed to marshal register request: %v", err)
+		handler.Register(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+		var p problem.Problem
+		if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p)) {
+			assert.Equal(t, problem.CodeValidation, p.Code)
+			fields := []string{}
+			for _, fe := range p.Errors {
+				fields = append(fields, fe.Field)
+			}
+			assert.Equal(t, []string{"username", "email", "password"}, fields)
 		}
+	})
+
+	t.Run("role and tenant in body are ignored", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		handler := NewAuthHandler(authService, mockUserCollection, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		mockUserCollection.On("FindUserByUsername", mock.Anything, "sneaky").Return(nil, assert.AnError)
+		mockUserCollection.On("FindUserByEmail", mock.Anything, "sneaky@example.com").Return(nil, assert.AnError)
+		mockUserCollection.On("InsertUser", mock.Anything, mock.MatchedBy(func(u models.User) bool {
+			return u.TenantID != "victim-tenant"
+		})).Return(nil)
+
+		body := []byte(`{"username":"sneaky","email":"sneaky@example.com","password":"password123","role":"admin","tenant_id":"victim-tenant"}`)
+		req := httptest.NewRequest("POST", "/api/auth/register", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+
+		handler.Register(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		mockUserCollection.AssertExpectations(t)
+	})
+
+	t.Run("concurrent registration removes the new tenant", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		tenants := newTenantStore()
+		handler := NewAuthHandler(authService, mockUserCollection, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), tenants)
+
+		// Another registration took the username between the check and the insert
+		mockUserCollection.On("FindUserByUsername", mock.Anything, "racer").Return(nil, db.ErrUserNotFound)
+		mockUserCollection.On("FindUserByEmail", mock.Anything, "racer@example.com").Return(nil, db.ErrUserNotFound)
+		mockUserCollection.On("InsertUser", mock.Anything, mock.AnythingOfType("models.User")).Return(db.ErrUserExists)
+
+		body := []byte(`{"username":"racer","email":"racer@example.com","password":"password123","tenant_name":"Racing"}`)
 		req := httptest.NewRequest("POST", "/api/auth/register", bytes.NewBuffer(body))
 		w := httptest.NewRecorder()
 
 		handler.Register(w, req)
 
+		assert.Equal(t, http.StatusConflict, w.Code)
+		all, err := tenants.ListTenants(context.Background(), "")
+		assert.NoError(t, err)
+		assert.Len(t, all, 2, "tenant of the failed registration is removed")
+		mockUserCollection.AssertExpectations(t)
+	})
+}
+
+func TestAuthHandler_Register_InviteOnly(t *testing.T) {
+	t.Setenv("REGISTRATION_MODE", "")
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	invite, _, err := authService.GenerateInviteToken(models.InviteClaims{
+		TenantID:  "tenant-a",
+		Role:      models.RoleOperator,
+		Email:     "invitee@example.com",
+		InvitedBy: primitive.NewObjectID().Hex(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to generate invite: %v", err)
+	}
+
+	register := func(handler *AuthHandler, registerReq models.RegisterRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(registerReq)
+		req := httptest.NewRequest("POST", "/api/auth/register", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		handler.Register(w, req)
+		return w
+	}
+
+	t.Run("without invitation", func(t *testing.T) {
+		handler := NewAuthHandler(authService, new(MockUserCollection), newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		w := register(handler, models.RegisterRequest{Username: "newuser", Email: "newuser@example.com", Password: "password123"})
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("with invitation", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		handler := NewAuthHandler(authService, mockUserCollection, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		mockUserCollection.On("FindUserByUsername", mock.Anything, "invitee").Return(nil, assert.AnError)
+		mockUserCollection.On("FindUserByEmail", mock.Anything, "invitee@example.com").Return(nil, assert.AnError)
+		mockUserCollection.On("InsertUser", mock.Anything, mock.AnythingOfType("models.User")).Return(nil)
+
+		w := register(handler, models.RegisterRequest{Username: "invitee", Email: "invitee@example.com", Password: "password123", InviteToken: invite})
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response models.LoginResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		assert.Equal(t, "tenant-a", response.User.TenantID)
+		assert.Equal(t, models.RoleOperator, response.User.Role)
+		mockUserCollection.AssertExpectations(t)
+	})
+
+	t.Run("invitation for another email", func(t *testing.T) {
+		handler := NewAuthHandler(authService, new(MockUserCollection), newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		w := register(handler, models.RegisterRequest{Username: "other", Email: "other@example.com", Password: "password123", InviteToken: invite})
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("access token used as invitation", func(t *testing.T) {
+		handler := NewAuthHandler(authService, new(MockUserCollection), newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+		accessToken, _ := authService.GenerateToken(&models.User{ID: primitive.NewObjectID(), Username: "admin", Role: models.RoleAdmin, TenantID: "tenant-a"})
+
+		w := register(handler, models.RegisterRequest{Username: "invitee", Email: "invitee@example.com", Password: "password123", InviteToken: accessToken})
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestAuthHandler_Invite(t *testing.T) {
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	handler := NewAuthHandler(authService, new(MockUserCollection), newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+	invite := func(claims *models.Claims, inviteReq models.InviteRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(inviteReq)
+		req := httptest.NewRequest("POST", "/api/auth/invite", bytes.NewBuffer(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, claims))
+		w := httptest.NewRecorder()
+		handler.Invite(w, req)
+		return w
+	}
+	admin := &models.Claims{UserID: primitive.NewObjectID().Hex(), Username: "admin", Role: models.RoleAdmin, TenantID: "tenant-a"}
+
+	t.Run("admin invites into own tenant", func(t *testing.T) {
+		w := invite(admin, models.InviteRequest{Email: "new@example.com", Role: models.RoleManager})
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response models.InviteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		inviteClaims, err := authService.ValidateInviteToken(response.InviteToken)
+		assert.NoError(t, err)
+		assert.Equal(t, "tenant-a", inviteClaims.TenantID)
+		assert.Equal(t, models.RoleManager, inviteClaims.Role)
+		assert.Equal(t, "new@example.com", inviteClaims.Email)
+		assert.Equal(t, admin.UserID, inviteClaims.InvitedBy)
+	})
+
+	t.Run("non-admin", func(t *testing.T) {
+		manager := &models.Claims{UserID: primitive.NewObjectID().Hex(), Role: models.RoleManager, TenantID: "tenant-a"}
+
+		w := invite(manager, models.InviteRequest{Email: "new@example.com", Role: models.RoleViewer})
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("invalid role", func(t *testing.T) {
+		w := invite(admin, models.InviteRequest{Email: "new@example.com", Role: "user"})
+
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 }
 
+func TestAuthHandler_JWKS(t *testing.T) {
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	handler := NewAuthHandler(authService, new(MockUserCollection), newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+	w := httptest.NewRecorder()
+	handler.JWKS(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Cache-Control"), "max-age=")
+
+	var set auth.JWKSet
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&set))
+	assert.Equal(t, authService.JWKS(), set)
+	assert.NotEmpty(t, set.Keys)
+	assert.NotContains(t, w.Body.String(), `"d"`)
+
+	w = httptest.NewRecorder()
+	handler.JWKS(w, httptest.NewRequest("POST", "/.well-known/jwks.json", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
 func TestAuthHandler_GetProfile(t *testing.T) {
 	authService, err := auth.NewService()
 	if err != nil {
 		t.Fatalf("Failed to create auth service: %v", err)
 	}
 	mockUserCollection := new(MockUserCollection)
-	handler := NewAuthHandler(authService, db.UserCollection(mockUserCollection))
+	handler := NewAuthHandler(authService, db.UserCollection(mockUserCollection), newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
 
 	t.Run("successful profile retrieval", func(t *testing.T) {
 		userID := primitive.NewObjectID()
@@ -362,7 +747,7 @@ func TestAuthHandler_UpdateProfile(t *testing.T) {
 		t.Fatalf("Failed to create auth service: %v", err)
 	}
 	mockUserCollection := new(MockUserCollection)
-	handler := NewAuthHandler(authService, db.UserCollection(mockUserCollection))
+	handler := NewAuthHandler(authService, db.UserCollection(mockUserCollection), newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
 
 	t.Run("successful profile update", func(t *testing.T) {
 		userID := primitive.NewObjectID()
@@ -405,13 +790,196 @@ func TestAuthHandler_UpdateProfile(t *testing.T) {
 	})
 }
 
+func TestAuthHandler_Profile(t *testing.T) {
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	userID := primitive.NewObjectID()
+	claims := &models.Claims{UserID: userID.Hex(), Username: "testuser", Role: models.RoleViewer}
+
+	t.Run("GET returns profile", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		handler := NewAuthHandler(authService, mockUserCollection, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+		mockUserCollection.On("FindUserByID", mock.Anything, userID.Hex()).Return(&models.User{ID: userID, Username: "testuser"}, nil)
+
+		req := httptest.NewRequest("GET", "/api/auth/profile", nil)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, claims))
+		w := httptest.NewRecorder()
+
+		handler.Profile(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("email change is sent for verification", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		mailer := mail.NewMemorySender()
+		handler := NewAuthHandler(authService, mockUserCollection, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mailer, newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		user := &models.User{ID: userID, Username: "testuser", Email: "old@example.com"}
+		mockUserCollection.On("FindUserByID", mock.Anything, userID.Hex()).Return(user, nil)
+		mockUserCollection.On("FindUserByEmail", mock.Anything, "new@example.com").Return(nil, errors.New("not found"))
+		mockUserCollection.On("UpdateUser", mock.Anything, userID.Hex(), mock.MatchedBy(func(u models.User) bool {
+			return u.Email == "old@example.com"
+		})).Return(nil)
+
+		body, _ := json.Marshal(models.UpdateProfileRequest{Email: "new@example.com"})
+		req := httptest.NewRequest("PUT", "/api/auth/profile", bytes.NewBuffer(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, claims))
+		w := httptest.NewRecorder()
+
+		handler.Profile(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockUserCollection.AssertExpectations(t)
+		messages := mailer.Messages()
+		assert.Len(t, messages, 1)
+		assert.Equal(t, "new@example.com", messages[0].To)
+		assert.Contains(t, messages[0].Body, "/verify-email?token=")
+	})
+
+	t.Run("unsupported method", func(t *testing.T) {
+		handler := NewAuthHandler(authService, new(MockUserCollection), newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		req := httptest.NewRequest("DELETE", "/api/auth/profile", nil)
+		w := httptest.NewRecorder()
+
+		handler.Profile(w, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
+
+func TestAuthHandler_VerifyEmail(t *testing.T) {
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	userID := primitive.NewObjectID()
+	token, _, _ := authService.GenerateEmailChangeToken(models.EmailChangeClaims{
+		UserID:   userID.Hex(),
+		OldEmail: "old@example.com",
+		NewEmail: "new@example.com",
+	})
+
+	t.Run("applies the change", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		handler := NewAuthHandler(authService, mockUserCollection, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		mockUserCollection.On("FindUserByID", mock.Anything, userID.Hex()).Return(&models.User{ID: userID, Email: "old@example.com"}, nil)
+		mockUserCollection.On("FindUserByEmail", mock.Anything, "new@example.com").Return(nil, errors.New("not found"))
+		mockUserCollection.On("UpdateUser", mock.Anything, userID.Hex(), mock.MatchedBy(func(u models.User) bool {
+			return u.Email == "new@example.com"
+		})).Return(nil)
+
+		body, _ := json.Marshal(models.VerifyEmailRequest{Token: token})
+		w := httptest.NewRecorder()
+		handler.VerifyEmail(w, httptest.NewRequest("POST", "/api/auth/verify-email", bytes.NewBuffer(body)))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockUserCollection.AssertExpectations(t)
+	})
+
+	t.Run("stale token", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		handler := NewAuthHandler(authService, mockUserCollection, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		mockUserCollection.On("FindUserByID", mock.Anything, userID.Hex()).Return(&models.User{ID: userID, Email: "other@example.com"}, nil)
+
+		body, _ := json.Marshal(models.VerifyEmailRequest{Token: token})
+		w := httptest.NewRecorder()
+		handler.VerifyEmail(w, httptest.NewRequest("POST", "/api/auth/verify-email", bytes.NewBuffer(body)))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockUserCollection.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthHandler_PasswordResetFlow(t *testing.T) {
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	passwordHash, _ := authService.HashPassword("oldpassword")
+	user := &models.User{ID: primitive.NewObjectID(), Username: "testuser", Email: "test@example.com", PasswordHash: passwordHash, IsActive: true}
+
+	t.Run("unknown email answers the same and sends nothing", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		mailer := mail.NewMemorySender()
+		handler := NewAuthHandler(authService, mockUserCollection, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mailer, newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+		mockUserCollection.On("FindUserByEmail", mock.Anything, "nobody@example.com").Return(nil, errors.New("not found"))
+
+		body, _ := json.Marshal(models.ForgotPasswordRequest{Email: "nobody@example.com"})
+		w := httptest.NewRecorder()
+		handler.ForgotPassword(w, httptest.NewRequest("POST", "/api/auth/forgot-password", bytes.NewBuffer(body)))
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Empty(t, mailer.Messages())
+	})
+
+	t.Run("emailed token resets password once", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		mockRefreshTokens := new(MockRefreshTokenCollection)
+		mailer := mail.NewMemorySender()
+		handler := NewAuthHandler(authService, mockUserCollection, mockRefreshTokens, db.NewMemoryRevocationStore(), mailer, newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		stored := *user
+		mockUserCollection.On("FindUserByEmail", mock.Anything, user.Email).Return(&stored, nil)
+		mockUserCollection.On("FindUserByID", mock.Anything, user.ID.Hex()).Return(&stored, nil)
+		mockUserCollection.On("UpdateUser", mock.Anything, user.ID.Hex(), mock.AnythingOfType("models.User")).Return(nil)
+		mockRefreshTokens.On("RevokeUserRefreshTokens", mock.Anything, user.ID.Hex()).Return(nil)
+
+		body, _ := json.Marshal(models.ForgotPasswordRequest{Email: user.Email})
+		w := httptest.NewRecorder()
+		handler.ForgotPassword(w, httptest.NewRequest("POST", "/api/auth/forgot-password", bytes.NewBuffer(body)))
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		messages := mailer.Messages()
+		if !assert.Len(t, messages, 1) {
+			return
+		}
+		link := messages[0].Body[strings.Index(messages[0].Body, "token=")+len("token="):]
+		token, _ := url.QueryUnescape(strings.Fields(link)[0])
+
+		resetBody, _ := json.Marshal(models.ConfirmPasswordResetRequest{Token: token, NewPassword: "newpassword123"})
+		w = httptest.NewRecorder()
+		handler.ResetPassword(w, httptest.NewRequest("POST", "/api/auth/reset-password", bytes.NewBuffer(resetBody)))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, authService.CheckPassword("newpassword123", stored.PasswordHash))
+		mockRefreshTokens.AssertExpectations(t)
+
+		// The password hash changed, so the same token is now spent
+		w = httptest.NewRecorder()
+		handler.ResetPassword(w, httptest.NewRequest("POST", "/api/auth/reset-password", bytes.NewBuffer(resetBody)))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("weak password rejected", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		handler := NewAuthHandler(authService, mockUserCollection, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+		stored := *user
+		mockUserCollection.On("FindUserByID", mock.Anything, user.ID.Hex()).Return(&stored, nil)
+		token, _, _ := authService.GeneratePasswordResetToken(user)
+
+		for _, password := range []string{"short", "testuser-2024", "oldpassword"} {
+			body, _ := json.Marshal(models.ConfirmPasswordResetRequest{Token: token, NewPassword: password})
+			w := httptest.NewRecorder()
+			handler.ResetPassword(w, httptest.NewRequest("POST", "/api/auth/reset-password", bytes.NewBuffer(body)))
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, password)
+		}
+		mockUserCollection.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
 func TestAuthHandler_ChangePassword(t *testing.T) {
 	authService, err := auth.NewService()
 	if err != nil {
 		t.Fatalf("Failed to create auth service: %v", err)
 	}
 	mockUserCollection := new(MockUserCollection)
-	handler := NewAuthHandler(authService, db.UserCollection(mockUserCollection))
+	handler := NewAuthHandler(authService, db.UserCollection(mockUserCollection), newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
 
 	t.Run("successful password change", func(t *testing.T) {
 		userID := primitive.NewObjectID()
@@ -495,4 +1063,253 @@ func TestAuthHandler_ChangePassword(t *testing.T) {
 		assert.Equal(t, http.StatusUnauthorized, w.Code)
 		mockUserCollection.AssertExpectations(t)
 	})
+
+	t.Run("recent password rejected", func(t *testing.T) {
+		userID := primitive.NewObjectID()
+		user := &models.User{ID: userID, Username: "testuser"}
+		if err := authService.SetPassword(user, "previous-pass-1"); err != nil {
+			t.Fatalf("Failed to set password: %v", err)
+		}
+		if err := authService.SetPassword(user, "current-pass-2"); err != nil {
+			t.Fatalf("Failed to set password: %v", err)
+		}
+		users := new(MockUserCollection)
+		handler := NewAuthHandler(authService, users, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+		users.On("FindUserByID", mock.Anything, userID.Hex()).Return(user, nil)
+
+		body, _ := json.Marshal(map[string]string{"current_password": "current-pass-2", "new_password": "previous-pass-1"})
+		req := httptest.NewRequest("POST", "/api/auth/change-password", bytes.NewBuffer(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, &models.Claims{UserID: userID.Hex(), Username: "testuser"}))
+		w := httptest.NewRecorder()
+
+		handler.ChangePassword(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "used recently")
+		users.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthHandler_Refresh(t *testing.T) {
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+
+	user := &models.User{
+		ID:       primitive.NewObjectID(),
+		TenantID: "tenant-a",
+		Username: "testuser",
+		Role:     models.RoleOperator,
+		IsActive: true,
+	}
+	newStoredToken := func(raw string) *models.RefreshToken {
+		return &models.RefreshToken{
+			ID:        primitive.NewObjectID(),
+			UserID:    user.ID.Hex(),
+			TenantID:  user.TenantID,
+			FamilyID:  "family-1",
+			TokenHash: authService.HashRefreshToken(raw),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+	}
+	doRefresh := func(handler *AuthHandler, raw string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.RefreshRequest{RefreshToken: raw})
+		req := httptest.NewRequest("POST", "/api/auth/refresh", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		handler.Refresh(w, req)
+		return w
+	}
+
+	t.Run("successful rotation", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		mockRefreshTokens := new(MockRefreshTokenCollection)
+		handler := NewAuthHandler(authService, mockUserCollection, mockRefreshTokens, db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		stored := newStoredToken("old-token")
+		mockRefreshTokens.On("FindRefreshTokenByHash", mock.Anything, stored.TokenHash).Return(stored, nil)
+		mockRefreshTokens.On("MarkRefreshTokenUsed", mock.Anything, stored.ID.Hex()).Return(nil)
+		mockRefreshTokens.On("InsertRefreshToken", mock.Anything, mock.MatchedBy(func(tok models.RefreshToken) bool {
+			return tok.FamilyID == "family-1" && tok.UserID == user.ID.Hex() && tok.TokenHash != stored.TokenHash
+		})).Return(nil)
+		mockUserCollection.On("FindUserByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+
+		w := doRefresh(handler, "old-token")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.LoginResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		assert.NotEmpty(t, response.Token)
+		assert.NotEmpty(t, response.RefreshToken)
+		assert.NotEqual(t, "old-token", response.RefreshToken)
+		mockRefreshTokens.AssertExpectations(t)
+		mockUserCollection.AssertExpectations(t)
+	})
+
+	t.Run("reuse of rotated token revokes family", func(t *testing.T) {
+		mockRefreshTokens := new(MockRefreshTokenCollection)
+		handler := NewAuthHandler(authService, new(MockUserCollection), mockRefreshTokens, db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		stored := newStoredToken("used-token")
+		usedAt := time.Now().Add(-time.Minute)
+		stored.UsedAt = &usedAt
+		mockRefreshTokens.On("FindRefreshTokenByHash", mock.Anything, stored.TokenHash).Return(stored, nil)
+		mockRefreshTokens.On("RevokeRefreshTokenFamily", mock.Anything, "family-1").Return(nil)
+
+		w := doRefresh(handler, "used-token")
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		mockRefreshTokens.AssertExpectations(t)
+	})
+
+	t.Run("concurrent rotation revokes family", func(t *testing.T) {
+		mockUserCollection := new(MockUserCollection)
+		mockRefreshTokens := new(MockRefreshTokenCollection)
+		handler := NewAuthHandler(authService, mockUserCollection, mockRefreshTokens, db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		stored := newStoredToken("raced-token")
+		mockRefreshTokens.On("FindRefreshTokenByHash", mock.Anything, stored.TokenHash).Return(stored, nil)
+		mockRefreshTokens.On("MarkRefreshTokenUsed", mock.Anything, stored.ID.Hex()).Return(db.ErrRefreshTokenUsed)
+		mockRefreshTokens.On("RevokeRefreshTokenFamily", mock.Anything, "family-1").Return(nil)
+		mockUserCollection.On("FindUserByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+
+		w := doRefresh(handler, "raced-token")
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		mockRefreshTokens.AssertExpectations(t)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		mockRefreshTokens := new(MockRefreshTokenCollection)
+		handler := NewAuthHandler(authService, new(MockUserCollection), mockRefreshTokens, db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		stored := newStoredToken("expired-token")
+		stored.ExpiresAt = time.Now().Add(-time.Minute)
+		mockRefreshTokens.On("FindRefreshTokenByHash", mock.Anything, stored.TokenHash).Return(stored, nil)
+
+		w := doRefresh(handler, "expired-token")
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		mockRefreshTokens.AssertNotCalled(t, "MarkRefreshTokenUsed", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		mockRefreshTokens := new(MockRefreshTokenCollection)
+		handler := NewAuthHandler(authService, new(MockUserCollection), mockRefreshTokens, db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		mockRefreshTokens.On("FindRefreshTokenByHash", mock.Anything, mock.Anything).Return(nil, db.ErrRefreshTokenNotFound)
+
+		w := doRefresh(handler, "nope")
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		handler := NewAuthHandler(authService, new(MockUserCollection), new(MockRefreshTokenCollection), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		w := doRefresh(handler, "")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestAuthHandler_Logout(t *testing.T) {
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	user := &models.User{ID: primitive.NewObjectID(), Username: "testuser", Role: models.RoleViewer}
+	token, _ := authService.GenerateToken(user)
+	claims, _ := authService.ValidateToken(token)
+
+	t.Run("revokes access token", func(t *testing.T) {
+		store := db.NewMemoryRevocationStore()
+		handler := NewAuthHandler(authService, new(MockUserCollection), new(MockRefreshTokenCollection), store, mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		req := httptest.NewRequest("POST", "/api/auth/logout", nil)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, claims))
+		w := httptest.NewRecorder()
+
+		handler.Logout(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		revoked, _ := store.IsRevoked(context.Background(), claims.JTI, claims.UserID, time.Unix(claims.IssuedAt, 0))
+		assert.True(t, revoked)
+	})
+
+	t.Run("revokes supplied refresh token family", func(t *testing.T) {
+		mockRefreshTokens := new(MockRefreshTokenCollection)
+		handler := NewAuthHandler(authService, new(MockUserCollection), mockRefreshTokens, db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		stored := &models.RefreshToken{UserID: user.ID.Hex(), FamilyID: "family-1"}
+		mockRefreshTokens.On("FindRefreshTokenByHash", mock.Anything, authService.HashRefreshToken("raw-refresh")).Return(stored, nil)
+		mockRefreshTokens.On("RevokeRefreshTokenFamily", mock.Anything, "family-1").Return(nil)
+
+		body, _ := json.Marshal(models.LogoutRequest{RefreshToken: "raw-refresh"})
+		req := httptest.NewRequest("POST", "/api/auth/logout", bytes.NewBuffer(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, claims))
+		w := httptest.NewRecorder()
+
+		handler.Logout(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockRefreshTokens.AssertExpectations(t)
+	})
+
+	t.Run("ignores refresh token of another user", func(t *testing.T) {
+		mockRefreshTokens := new(MockRefreshTokenCollection)
+		handler := NewAuthHandler(authService, new(MockUserCollection), mockRefreshTokens, db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		stored := &models.RefreshToken{UserID: primitive.NewObjectID().Hex(), FamilyID: "family-2"}
+		mockRefreshTokens.On("FindRefreshTokenByHash", mock.Anything, mock.Anything).Return(stored, nil)
+
+		body, _ := json.Marshal(models.LogoutRequest{RefreshToken: "someone-elses"})
+		req := httptest.NewRequest("POST", "/api/auth/logout", bytes.NewBuffer(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, claims))
+		w := httptest.NewRecorder()
+
+		handler.Logout(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockRefreshTokens.AssertNotCalled(t, "RevokeRefreshTokenFamily", mock.Anything, mock.Anything)
+	})
+
+	t.Run("no user context", func(t *testing.T) {
+		handler := NewAuthHandler(authService, new(MockUserCollection), new(MockRefreshTokenCollection), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+
+		req := httptest.NewRequest("POST", "/api/auth/logout", nil)
+		w := httptest.NewRecorder()
+
+		handler.Logout(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestAuthHandler_LogoutAll(t *testing.T) {
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	user := &models.User{ID: primitive.NewObjectID(), Username: "testuser", Role: models.RoleViewer}
+	token, _ := authService.GenerateToken(user)
+	claims, _ := authService.ValidateToken(token)
+
+	store := db.NewMemoryRevocationStore()
+	mockRefreshTokens := new(MockRefreshTokenCollection)
+	handler := NewAuthHandler(authService, new(MockUserCollection), mockRefreshTokens, store, mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+	mockRefreshTokens.On("RevokeUserRefreshTokens", mock.Anything, user.ID.Hex()).Return(nil)
+
+	req := httptest.NewRequest("POST", "/api/auth/logout-all", nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, claims))
+	w := httptest.NewRecorder()
+
+	handler.LogoutAll(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockRefreshTokens.AssertExpectations(t)
+	revoked, _ := store.IsRevoked(context.Background(), "another-session", user.ID.Hex(), time.Unix(claims.IssuedAt, 0))
+	assert.True(t, revoked)
 }
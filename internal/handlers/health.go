@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/problem"
+)
+
+// healthCheckTimeout bounds each readiness check
+const healthCheckTimeout = 2 * time.Second
+
+// HealthCheck is a dependency that must be reachable for the service to be ready
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// HealthResponse is the body of the health endpoints
+type HealthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// HealthHandler serves liveness and readiness probes
+type HealthHandler struct {
+	checks []HealthCheck
+}
+
+// NewHealthHandler creates a health handler that is ready when all checks pass
+func NewHealthHandler(checks ...HealthCheck) *HealthHandler {
+	return &HealthHandler{checks: checks}
+}
+
+// Live answers 200 as long as the process serves requests
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	writeHealth(w, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// Ready runs every check concurrently and answers 200 when all pass, or 503
+// with the failures so that load balancers stop routing to the instance
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+	results := make(map[string]string, len(h.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+			result := "ok"
+			if err := check.Check(ctx); err != nil {
+				result = err.Error()
+				logging.FromContext(r.Context()).WithError(err).WithField("check", check.Name).Warn("Readiness check failed")
+			}
+			mu.Lock()
+			results[check.Name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	response := HealthResponse{Status: "ok", Checks: results}
+	status := http.StatusOK
+	for _, result := range results {
+		if result != "ok" {
+			response.Status, status = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	writeHealth(w, status, response)
+}
+
+// writeHealth writes a health response that caches and proxies must not store
+func writeHealth(w http.ResponseWriter, status int, response HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
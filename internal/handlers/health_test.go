@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthHandler(t *testing.T) {
+	mongoErr := error(nil)
+	handler := NewHealthHandler(
+		HealthCheck{Name: "mongo", Check: func(ctx context.Context) error { return mongoErr }},
+		HealthCheck{Name: "mqtt", Check: func(ctx context.Context) error { return nil }},
+	)
+	serve := func(serve http.HandlerFunc, method string) (*httptest.ResponseRecorder, HealthResponse) {
+		w := httptest.NewRecorder()
+		serve(w, httptest.NewRequest(method, "/health", nil))
+		var response HealthResponse
+		json.NewDecoder(w.Body).Decode(&response)
+		return w, response
+	}
+
+	t.Run("live", func(t *testing.T) {
+		w, response := serve(handler.Live, "GET")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "ok", response.Status)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	})
+
+	t.Run("ready when every check passes", func(t *testing.T) {
+		w, response := serve(handler.Ready, "GET")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, map[string]string{"mongo": "ok", "mqtt": "ok"}, response.Checks)
+	})
+
+	t.Run("unavailable when a check fails", func(t *testing.T) {
+		mongoErr = errors.New("server selection timeout")
+		defer func() { mongoErr = nil }()
+		w, response := serve(handler.Ready, "GET")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "unavailable", response.Status)
+		assert.Equal(t, "server selection timeout", response.Checks["mongo"])
+		assert.Equal(t, "ok", response.Checks["mqtt"])
+	})
+
+	t.Run("checks time out", func(t *testing.T) {
+		slow := NewHealthHandler(HealthCheck{Name: "mongo", Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}})
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		w := httptest.NewRecorder()
+		slow.Ready(w, httptest.NewRequest("GET", "/health/ready", nil).WithContext(ctx))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+
+	t.Run("only GET and HEAD", func(t *testing.T) {
+		w, _ := serve(handler.Ready, "POST")
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
@@ -0,0 +1,460 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ukydev/fleet-sustainability/internal/auth"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/middleware"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"github.com/ukydev/fleet-sustainability/internal/problem"
+)
+
+// MFAEnroll starts TOTP enrollment for the caller, identified by an access
+// token or by an enrollment challenge from a login that requires MFA
+func (h *AuthHandler) MFAEnroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// The body is optional for callers with an access token
+	var enrollReq models.MFAEnrollRequest
+	if body, err := io.ReadAll(r.Body); err == nil && len(body) > 0 {
+		if err := json.Unmarshal(body, &enrollReq); err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+			return
+		}
+	}
+
+	user, _, ok := h.mfaEnrollmentUser(w, r, enrollReq.MFAToken)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled {
+		problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "MFA is already enabled")
+		return
+	}
+
+	secret, err := h.authService.GenerateTOTPSecret()
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to generate MFA secret")
+		return
+	}
+	user.MFAPendingSecret = secret
+	if err := h.userCollection.UpdateUser(r.Context(), user.ID.Hex(), *user); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.MFAEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: h.authService.TOTPProvisioningURI(user.Email, secret),
+	})
+}
+
+// MFAActivate confirms enrollment with a code from the authenticator app and
+// returns the recovery codes. When enrollment was part of a login, the login
+// is completed as well.
+func (h *AuthHandler) MFAActivate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
+		return
+	}
+
+	var activateReq models.MFAActivateRequest
+	if err := json.Unmarshal(body, &activateReq); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if activateReq.Code == "" {
+		problem.InvalidField(w, r, "code", models.FieldRequired, "code is required")
+		return
+	}
+
+	user, fromLogin, ok := h.mfaEnrollmentUser(w, r, activateReq.MFAToken)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled {
+		problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "MFA is already enabled")
+		return
+	}
+	if user.MFAPendingSecret == "" {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeBadRequest, "No MFA enrollment in progress")
+		return
+	}
+	if !h.verifySecondFactor(w, r, user, user.MFAPendingSecret, activateReq.Code, "") {
+		return
+	}
+
+	codes, hashes, err := h.authService.GenerateRecoveryCodes()
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to generate recovery codes")
+		return
+	}
+	user.MFAEnabled = true
+	user.MFASecret = user.MFAPendingSecret
+	user.MFAPendingSecret = ""
+	user.MFARecoveryCodes = hashes
+	if err := h.userCollection.UpdateUser(r.Context(), user.ID.Hex(), *user); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update user")
+		return
+	}
+	recordAudit(r.Context(), h.auditLog, models.AuditEvent{
+		TenantID:  user.TenantID,
+		Action:    models.AuditMFAEnabled,
+		ActorID:   user.ID.Hex(),
+		TargetID:  user.ID.Hex(),
+		IPAddress: middleware.ClientIP(r),
+	})
+
+	response := models.MFAActivateResponse{RecoveryCodes: codes}
+	if fromLogin {
+		login, ok := h.loginTokens(w, r, user, activateReq.DeviceName)
+		if !ok {
+			return
+		}
+		response.Login = login
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// MFAVerify completes a two-step login with a TOTP code or an unused recovery code
+func (h *AuthHandler) MFAVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
+		return
+	}
+
+	var verifyReq models.MFAVerifyRequest
+	if err := json.Unmarshal(body, &verifyReq); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if verifyReq.MFAToken == "" || (verifyReq.Code == "") == (verifyReq.RecoveryCode == "") {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeValidation, "mfa_token and either code or recovery_code are required")
+		return
+	}
+
+	challenge, err := h.authService.ValidateMFAChallengeToken(verifyReq.MFAToken)
+	if err != nil || challenge.Purpose != auth.MFAPurposeVerify {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid or expired MFA token")
+		return
+	}
+
+	user, err := h.userCollection.FindUserByID(r.Context(), challenge.UserID)
+	if err != nil || !user.IsActive || !user.MFAEnabled {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid or expired MFA token")
+		return
+	}
+	if now := time.Now(); user.IsLocked(now) {
+		writeRetryAfter(w, user.LockedUntil.Sub(now))
+		problem.Error(w, r, http.StatusLocked, problem.CodeAccountLocked, "Account is temporarily locked")
+		return
+	}
+
+	if !h.verifySecondFactor(w, r, user, user.MFASecret, verifyReq.Code, verifyReq.RecoveryCode) {
+		return
+	}
+	// Persist the used time step or the consumed recovery code so neither can be replayed
+	if err := h.userCollection.UpdateUser(r.Context(), user.ID.Hex(), *user); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update user")
+		return
+	}
+
+	h.completeLogin(w, r, user, verifyReq.DeviceName)
+}
+
+// MFADisable turns off MFA for the caller unless their tenant requires it for their role
+func (h *AuthHandler) MFADisable(w http.ResponseWriter, r *http.Request) {
+	user, codeReq, ok := h.mfaManagedUser(w, r)
+	if !ok {
+		return
+	}
+
+	required, err := h.mfaRequired(r.Context(), user)
+	if err != nil {
+		problem.Error(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "Failed to load MFA policy")
+		return
+	}
+	if required {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeMFARequired, "MFA is required for your role by tenant policy")
+		return
+	}
+	if !h.verifySecondFactor(w, r, user, user.MFASecret, codeReq.Code, "") {
+		return
+	}
+
+	user.MFAEnabled = false
+	user.MFASecret = ""
+	user.MFAPendingSecret = ""
+	user.MFALastStep = 0
+	user.MFARecoveryCodes = nil
+	if err := h.userCollection.UpdateUser(r.Context(), user.ID.Hex(), *user); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update user")
+		return
+	}
+	recordAudit(r.Context(), h.auditLog, models.AuditEvent{
+		TenantID:  user.TenantID,
+		Action:    models.AuditMFADisabled,
+		ActorID:   user.ID.Hex(),
+		TargetID:  user.ID.Hex(),
+		IPAddress: middleware.ClientIP(r),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "MFA disabled"})
+}
+
+// MFARecoveryCodes replaces the caller's recovery codes with a fresh set
+func (h *AuthHandler) MFARecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, codeReq, ok := h.mfaManagedUser(w, r)
+	if !ok {
+		return
+	}
+	if !h.verifySecondFactor(w, r, user, user.MFASecret, codeReq.Code, "") {
+		return
+	}
+
+	codes, hashes, err := h.authService.GenerateRecoveryCodes()
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to generate recovery codes")
+		return
+	}
+	user.MFARecoveryCodes = hashes
+	if err := h.userCollection.UpdateUser(r.Context(), user.ID.Hex(), *user); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.MFAActivateResponse{RecoveryCodes: codes})
+}
+
+// MFAPolicy returns or replaces the caller's tenant MFA policy
+func (h *AuthHandler) MFAPolicy(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User context not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		policy, err := h.mfaPolicies.GetMFAPolicy(r.Context(), claims.TenantID)
+		if err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to load MFA policy")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(policy)
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
+			return
+		}
+		var policyReq models.MFAPolicy
+		if err := json.Unmarshal(body, &policyReq); err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+			return
+		}
+
+		roles := []models.Role{}
+		for _, role := range policyReq.RequiredRoles {
+			if !models.IsValidRole(role) {
+				problem.InvalidField(w, r, "required_roles", models.FieldInvalid, "Invalid role: "+string(role))
+				return
+			}
+			if !(&models.MFAPolicy{RequiredRoles: roles}).Requires(role) {
+				roles = append(roles, role)
+			}
+		}
+		policy := models.MFAPolicy{
+			TenantID:      claims.TenantID,
+			RequiredRoles: roles,
+			UpdatedAt:     time.Now(),
+			UpdatedBy:     claims.UserID,
+		}
+		if err := h.mfaPolicies.SetMFAPolicy(r.Context(), policy); err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update MFA policy")
+			return
+		}
+		recordAudit(r.Context(), h.auditLog, models.AuditEvent{
+			TenantID:  claims.TenantID,
+			Action:    models.AuditMFAPolicyUpdated,
+			ActorID:   claims.UserID,
+			IPAddress: middleware.ClientIP(r),
+			Details:   map[string]interface{}{"required_roles": roles},
+		})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(policy)
+	default:
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// writeMFAChallenge answers the password step of a login with an MFA challenge token
+func (h *AuthHandler) writeMFAChallenge(w http.ResponseWriter, r *http.Request, user *models.User, purpose string) {
+	token, expiresAt, err := h.authService.GenerateMFAChallengeToken(user.ID.Hex(), purpose)
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to generate MFA token")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.MFAChallengeResponse{
+		MFARequired:           purpose == auth.MFAPurposeVerify,
+		MFAEnrollmentRequired: purpose == auth.MFAPurposeEnroll,
+		MFAToken:              token,
+		ExpiresAt:             expiresAt,
+	})
+}
+
+// mfaRequired reports whether the user's tenant policy requires MFA for their role
+func (h *AuthHandler) mfaRequired(ctx context.Context, user *models.User) (bool, error) {
+	policy, err := h.mfaPolicies.GetMFAPolicy(ctx, user.TenantID)
+	if err != nil {
+		return false, err
+	}
+	return policy.Requires(user.Role), nil
+}
+
+// mfaEnrollmentUser resolves the enrolling user from the access token or,
+// without one, from an enrollment challenge token; fromLogin reports the
+// latter. On failure it writes the error response and returns false.
+func (h *AuthHandler) mfaEnrollmentUser(w http.ResponseWriter, r *http.Request, mfaToken string) (*models.User, bool, bool) {
+	userID := ""
+	fromLogin := false
+	if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
+		userID = claims.UserID
+	} else if mfaToken != "" {
+		challenge, err := h.authService.ValidateMFAChallengeToken(mfaToken)
+		if err != nil || challenge.Purpose != auth.MFAPurposeEnroll {
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid or expired MFA token")
+			return nil, false, false
+		}
+		userID = challenge.UserID
+		fromLogin = true
+	} else {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization header or mfa_token required")
+		return nil, false, false
+	}
+
+	user, err := h.userCollection.FindUserByID(r.Context(), userID)
+	if err != nil || !user.IsActive {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "User not found")
+		return nil, false, false
+	}
+	return user, fromLogin, true
+}
+
+// mfaManagedUser loads the authenticated caller and their MFA code for
+// changes to an enabled second factor. On failure it writes the error
+// response and returns false.
+func (h *AuthHandler) mfaManagedUser(w http.ResponseWriter, r *http.Request) (*models.User, *models.MFACodeRequest, bool) {
+	if r.Method != http.MethodPost {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return nil, nil, false
+	}
+
+	claims, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User context not found")
+		return nil, nil, false
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
+		return nil, nil, false
+	}
+	var codeReq models.MFACodeRequest
+	if err := json.Unmarshal(body, &codeReq); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+		return nil, nil, false
+	}
+	if codeReq.Code == "" {
+		problem.InvalidField(w, r, "code", models.FieldRequired, "code is required")
+		return nil, nil, false
+	}
+
+	user, err := h.userCollection.FindUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "User not found")
+		return nil, nil, false
+	}
+	if !user.MFAEnabled {
+		problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "MFA is not enabled")
+		return nil, nil, false
+	}
+	return user, &codeReq, true
+}
+
+// verifySecondFactor checks a TOTP code against secret, or a recovery code,
+// and records the used step or consumes the recovery code on the user; the
+// caller persists the user. Failures are throttled like failed passwords.
+// On failure it writes the error response and returns false.
+func (h *AuthHandler) verifySecondFactor(w http.ResponseWriter, r *http.Request, user *models.User, secret, code, recoveryCode string) bool {
+	clientIP := middleware.ClientIP(r)
+	throttleKeys := []string{"mfa:" + user.ID.Hex(), "ip:" + clientIP}
+	if wait := h.throttle.RetryAfter(throttleKeys...); wait > 0 {
+		writeRetryAfter(w, wait)
+		problem.Error(w, r, http.StatusTooManyRequests, problem.CodeTooManyAttempts, "Too many failed MFA attempts, try again later")
+		return false
+	}
+
+	valid := false
+	switch {
+	case code != "":
+		var step int64
+		if step, valid = h.authService.ValidateTOTPCode(secret, code, user.MFALastStep, time.Now()); valid {
+			user.MFALastStep = step
+		}
+	case recoveryCode != "":
+		hash := h.authService.HashRecoveryCode(recoveryCode)
+		for i, stored := range user.MFARecoveryCodes {
+			if stored == hash {
+				user.MFARecoveryCodes = append(user.MFARecoveryCodes[:i:i], user.MFARecoveryCodes[i+1:]...)
+				valid = true
+				break
+			}
+		}
+	}
+
+	if !valid {
+		h.throttle.RecordFailure(throttleKeys...)
+		h.recordFailedLogin(r, user, clientIP)
+		logging.FromContext(r.Context()).WithFields(log.Fields{"user_id": user.ID.Hex(), "ip": clientIP}).Warn("Invalid MFA code")
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidMFACode, "Invalid MFA code")
+		return false
+	}
+	h.throttle.Reset(throttleKeys[0])
+	return true
+}
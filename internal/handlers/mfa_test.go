@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/ukydev/fleet-sustainability/internal/auth"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/mail"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// postJSON sends a JSON body to an unauthenticated handler
+func postJSON(handler http.HandlerFunc, path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(body)
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", path, &buf))
+	return w
+}
+
+func TestAuthHandler_MFALogin(t *testing.T) {
+	authService, _ := auth.NewService()
+	passwordHash, _ := authService.HashPassword("password123")
+	secret, _ := authService.GenerateTOTPSecret()
+	_, recoveryHashes, _ := authService.GenerateRecoveryCodes()
+
+	newUser := func() *models.User {
+		return &models.User{
+			ID: primitive.NewObjectID(), TenantID: "tenant-a", Username: "testuser", PasswordHash: passwordHash,
+			Role: models.RoleViewer, IsActive: true, MFAEnabled: true, MFASecret: secret,
+			MFARecoveryCodes: append([]string(nil), recoveryHashes...),
+		}
+	}
+	challenge := func(t *testing.T, handler *AuthHandler) string {
+		w := postJSON(handler.Login, "/api/auth/login", models.LoginRequest{Username: "testuser", Password: "password123"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.MFAChallengeResponse
+		json.NewDecoder(w.Body).Decode(&response)
+		assert.True(t, response.MFARequired)
+		assert.NotEmpty(t, response.MFAToken)
+		return response.MFAToken
+	}
+
+	t.Run("password alone does not log in", func(t *testing.T) {
+		users := new(MockUserCollection)
+		handler := NewAuthHandler(authService, users, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+		users.On("FindUserByUsername", mock.Anything, "testuser").Return(newUser(), nil)
+
+		w := postJSON(handler.Login, "/api/auth/login", models.LoginRequest{Username: "testuser", Password: "password123"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "refresh_token")
+		users.AssertNotCalled(t, "UpdateLastLogin", mock.Anything, mock.Anything)
+	})
+
+	t.Run("TOTP code completes login and cannot be replayed", func(t *testing.T) {
+		users := new(MockUserCollection)
+		handler := NewAuthHandler(authService, users, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+		user := newUser()
+		users.On("FindUserByUsername", mock.Anything, "testuser").Return(user, nil)
+		users.On("FindUserByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+		users.On("UpdateUser", mock.Anything, user.ID.Hex(), mock.AnythingOfType("models.User")).Return(nil)
+		users.On("UpdateLastLogin", mock.Anything, user.ID.Hex()).Return(nil)
+		users.On("IncrementFailedLogins", mock.Anything, user.ID.Hex()).Return(1, nil)
+
+		token := challenge(t, handler)
+		code, _ := authService.GenerateTOTPCode(secret, time.Now())
+		w := postJSON(handler.MFAVerify, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: token, Code: code})
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.LoginResponse
+		json.NewDecoder(w.Body).Decode(&response)
+		assert.NotEmpty(t, response.Token)
+		assert.NotEmpty(t, response.RefreshToken)
+		assert.NotZero(t, user.MFALastStep)
+
+		w = postJSON(handler.MFAVerify, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: token, Code: code})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("recovery code is single use", func(t *testing.T) {
+		users := new(MockUserCollection)
+		handler := NewAuthHandler(authService, users, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+		codes, hashes, _ := authService.GenerateRecoveryCodes()
+		user := newUser()
+		user.MFARecoveryCodes = hashes
+		users.On("FindUserByUsername", mock.Anything, "testuser").Return(user, nil)
+		users.On("FindUserByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+		users.On("UpdateUser", mock.Anything, user.ID.Hex(), mock.AnythingOfType("models.User")).Return(nil)
+		users.On("UpdateLastLogin", mock.Anything, user.ID.Hex()).Return(nil)
+		users.On("IncrementFailedLogins", mock.Anything, user.ID.Hex()).Return(1, nil)
+
+		token := challenge(t, handler)
+		w := postJSON(handler.MFAVerify, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: token, RecoveryCode: codes[3]})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, user.MFARecoveryCodes, len(codes)-1)
+
+		w = postJSON(handler.MFAVerify, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: token, RecoveryCode: codes[3]})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("rejects enrollment challenge and bad requests", func(t *testing.T) {
+		handler := NewAuthHandler(authService, new(MockUserCollection), newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), db.NewMemoryAuditLog(), db.NewMemoryMFAPolicyStore(), newTenantStore())
+		enrollToken, _, _ := authService.GenerateMFAChallengeToken("user-id", auth.MFAPurposeEnroll)
+
+		w := postJSON(handler.MFAVerify, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: enrollToken, Code: "123456"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = postJSON(handler.MFAVerify, "/api/auth/mfa/verify", models.MFAVerifyRequest{MFAToken: enrollToken, Code: "123456", RecoveryCode: "abcde-fghij"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestAuthHandler_MFAEnrollmentRequiredByPolicy(t *testing.T) {
+	authService, _ := auth.NewService()
+	passwordHash, _ := authService.HashPassword("password123")
+	users := new(MockUserCollection)
+	policies := db.NewMemoryMFAPolicyStore()
+	policies.SetMFAPolicy(context.Background(), models.MFAPolicy{TenantID: "tenant-a", RequiredRoles: []models.Role{models.RoleAdmin, models.RoleManager}})
+	auditLog := db.NewMemoryAuditLog()
+	handler := NewAuthHandler(authService, users, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), auditLog, policies, newTenantStore())
+
+	user := &models.User{ID: primitive.NewObjectID(), TenantID: "tenant-a", Username: "testuser", Email: "test@example.com", PasswordHash: passwordHash, Role: models.RoleManager, IsActive: true}
+	users.On("FindUserByUsername", mock.Anything, "testuser").Return(user, nil)
+	users.On("FindUserByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+	users.On("UpdateUser", mock.Anything, user.ID.Hex(), mock.AnythingOfType("models.User")).Return(nil)
+	users.On("UpdateLastLogin", mock.Anything, user.ID.Hex()).Return(nil)
+
+	w := postJSON(handler.Login, "/api/auth/login", models.LoginRequest{Username: "testuser", Password: "password123"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var challenge models.MFAChallengeResponse
+	json.NewDecoder(w.Body).Decode(&challenge)
+	assert.True(t, challenge.MFAEnrollmentRequired)
+
+	w = postJSON(handler.MFAEnroll, "/api/auth/mfa/enroll", models.MFAEnrollRequest{MFAToken: challenge.MFAToken})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var enrollment models.MFAEnrollResponse
+	json.NewDecoder(w.Body).Decode(&enrollment)
+	assert.NotEmpty(t, enrollment.Secret)
+	assert.Contains(t, enrollment.ProvisioningURI, "otpauth://totp/")
+	assert.Equal(t, enrollment.Secret, user.MFAPendingSecret)
+
+	code, _ := authService.GenerateTOTPCode(enrollment.Secret, time.Now())
+	w = postJSON(handler.MFAActivate, "/api/auth/mfa/activate", models.MFAActivateRequest{MFAToken: challenge.MFAToken, Code: code})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var activation models.MFAActivateResponse
+	json.NewDecoder(w.Body).Decode(&activation)
+	assert.Len(t, activation.RecoveryCodes, 10)
+	if assert.NotNil(t, activation.Login) {
+		assert.NotEmpty(t, activation.Login.Token)
+	}
+	assert.True(t, user.MFAEnabled)
+	assert.Equal(t, enrollment.Secret, user.MFASecret)
+	assert.Empty(t, user.MFAPendingSecret)
+	assert.NotContains(t, user.MFARecoveryCodes, activation.RecoveryCodes[0])
+	assert.Equal(t, models.AuditMFAEnabled, auditLog.Events()[0].Action)
+
+	// The policy also keeps the user from turning MFA off again
+	claims := &models.Claims{UserID: user.ID.Hex(), TenantID: "tenant-a", Role: models.RoleManager}
+	next, _ := authService.GenerateTOTPCode(enrollment.Secret, time.Now().Add(30*time.Second))
+	w = httptest.NewRecorder()
+	handler.MFADisable(w, newUserAdminRequest("POST", "/api/auth/mfa/disable", models.MFACodeRequest{Code: next}, claims))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.True(t, user.MFAEnabled)
+}
+
+func TestAuthHandler_MFAPolicy(t *testing.T) {
+	authService, _ := auth.NewService()
+	policies := db.NewMemoryMFAPolicyStore()
+	auditLog := db.NewMemoryAuditLog()
+	handler := NewAuthHandler(authService, new(MockUserCollection), newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), auditLog, policies, newTenantStore())
+	admin := &models.Claims{UserID: "admin-id", TenantID: "tenant-a", Role: models.RoleAdmin}
+
+	w := httptest.NewRecorder()
+	handler.MFAPolicy(w, newUserAdminRequest("PUT", "/api/auth/mfa/policy", map[string]interface{}{"required_roles": []string{"admin", "superuser"}}, admin))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.MFAPolicy(w, newUserAdminRequest("PUT", "/api/auth/mfa/policy", map[string]interface{}{"tenant_id": "tenant-b", "required_roles": []string{"admin", "manager", "admin"}}, admin))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The policy always applies to the caller's own tenant
+	policy, _ := policies.GetMFAPolicy(context.Background(), "tenant-a")
+	assert.Equal(t, []models.Role{models.RoleAdmin, models.RoleManager}, policy.RequiredRoles)
+	assert.Equal(t, "admin-id", policy.UpdatedBy)
+	other, _ := policies.GetMFAPolicy(context.Background(), "tenant-b")
+	assert.Empty(t, other.RequiredRoles)
+	assert.Equal(t, models.AuditMFAPolicyUpdated, auditLog.Events()[0].Action)
+
+	w = httptest.NewRecorder()
+	handler.MFAPolicy(w, newUserAdminRequest("GET", "/api/auth/mfa/policy", nil, admin))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var fetched models.MFAPolicy
+	json.NewDecoder(w.Body).Decode(&fetched)
+	assert.True(t, fetched.Requires(models.RoleManager))
+}
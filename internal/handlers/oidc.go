@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ukydev/fleet-sustainability/internal/auth"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/middleware"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"github.com/ukydev/fleet-sustainability/internal/problem"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OIDCHandler handles single sign-on logins through an OpenID Connect
+// identity provider. Sessions are issued the same way as for password logins.
+type OIDCHandler struct {
+	auth     *AuthHandler
+	provider *auth.OIDCProvider
+}
+
+// NewOIDCHandler creates a single sign-on handler issuing sessions through authHandler
+func NewOIDCHandler(authHandler *AuthHandler, provider *auth.OIDCProvider) *OIDCHandler {
+	return &OIDCHandler{
+		auth:     authHandler,
+		provider: provider,
+	}
+}
+
+// Login starts a single sign-on login and returns the identity provider URL
+// to send the user to, along with a state token to keep for the callback
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	stateToken, state, err := h.auth.authService.GenerateOIDCStateToken()
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to start single sign-on")
+		return
+	}
+	authURL, err := h.provider.AuthCodeURL(r.Context(), state.State, state.Nonce, state.CodeVerifier)
+	if err != nil {
+		logging.FromContext(r.Context()).WithError(err).Error("Failed to reach identity provider")
+		problem.Error(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "Identity provider unavailable")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.OIDCLoginResponse{
+		AuthorizationURL: authURL,
+		StateToken:       stateToken,
+		ExpiresAt:        time.Unix(state.Exp, 0),
+	})
+}
+
+// Callback completes a single sign-on login with the code and state the
+// identity provider redirected back with. The account is provisioned on first
+// login and its role re-synced from the mapping rules on every login.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
+		return
+	}
+
+	var callbackReq models.OIDCCallbackRequest
+	if err := json.Unmarshal(body, &callbackReq); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if callbackReq.Code == "" || callbackReq.State == "" || callbackReq.StateToken == "" {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeValidation, "Code, state and state token are required")
+		return
+	}
+
+	state, err := h.auth.authService.ValidateOIDCStateToken(callbackReq.StateToken)
+	if err != nil || subtle.ConstantTimeCompare([]byte(state.State), []byte(callbackReq.State)) != 1 {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidToken, "Invalid or expired single sign-on state")
+		return
+	}
+
+	identity, err := h.provider.Exchange(r.Context(), callbackReq.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		logging.FromContext(r.Context()).WithError(err).Warn("Single sign-on failed")
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Single sign-on failed")
+		return
+	}
+
+	role, tenantID, err := h.provider.Config().MapClaims(identity.Claims)
+	if err != nil {
+		logging.FromContext(r.Context()).WithFields(log.Fields{"issuer": identity.Issuer, "subject": identity.Subject}).Warn("No single sign-on rule matches the account")
+		problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "Your account is not granted access")
+		return
+	}
+
+	user, ok := h.ssoUser(w, r, identity, role, tenantID)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if user.IsLocked(now) {
+		writeRetryAfter(w, user.LockedUntil.Sub(now))
+		problem.Error(w, r, http.StatusLocked, problem.CodeAccountLocked, "Account is temporarily locked")
+		return
+	}
+	if !user.IsActive {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeAccountDisabled, "Account is deactivated")
+		return
+	}
+
+	h.auth.finishLogin(w, r, user, callbackReq.DeviceName)
+}
+
+// ssoUser returns the user provisioned for the identity, creating it on first
+// login and syncing its role. On failure it writes the error response and returns false.
+func (h *OIDCHandler) ssoUser(w http.ResponseWriter, r *http.Request, identity *auth.OIDCIdentity, role models.Role, tenantID string) (*models.User, bool) {
+	user, err := h.auth.userCollection.FindUserByOIDCSubject(r.Context(), identity.Issuer, identity.Subject)
+	if errors.Is(err, db.ErrUserNotFound) {
+		return h.provisionUser(w, r, identity, role, tenantID)
+	}
+	if err != nil {
+		problem.Error(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "Failed to load user")
+		return nil, false
+	}
+
+	// Accounts never move between tenants through the identity provider
+	if user.TenantID != tenantID {
+		logging.FromContext(r.Context()).WithFields(log.Fields{"user_id": user.ID.Hex(), "tenant_id": user.TenantID, "mapped_tenant_id": tenantID}).Warn("Single sign-on mapped a user to another tenant")
+		problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "Your account is not granted access")
+		return nil, false
+	}
+	if user.Role != role {
+		previous := user.Role
+		user.Role = role
+		if err := h.auth.userCollection.UpdateUser(r.Context(), user.ID.Hex(), *user); err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update user")
+			return nil, false
+		}
+		recordAudit(r.Context(), h.auth.auditLog, models.AuditEvent{
+			TenantID:  user.TenantID,
+			Action:    models.AuditSSORoleSynced,
+			TargetID:  user.ID.Hex(),
+			IPAddress: middleware.ClientIP(r),
+			Details:   map[string]interface{}{"from": previous, "to": role},
+		})
+	}
+	return user, true
+}
+
+// provisionUser creates the local account for an identity provider account on its first login
+func (h *OIDCHandler) provisionUser(w http.ResponseWriter, r *http.Request, identity *auth.OIDCIdentity, role models.Role, tenantID string) (*models.User, bool) {
+	if identity.Email == "" || !identity.EmailVerified {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "The identity provider did not supply a verified email")
+		return nil, false
+	}
+	// Local accounts are never linked implicitly: whoever controls the IdP
+	// account could otherwise take over a password account with the same email
+	if _, err := h.auth.userCollection.FindUserByEmail(r.Context(), identity.Email); err == nil {
+		problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "An account with this email already exists")
+		return nil, false
+	}
+
+	username, err := h.availableUsername(r, identity)
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to create user")
+		return nil, false
+	}
+
+	now := time.Now()
+	user := models.User{
+		ID:          primitive.NewObjectID(),
+		TenantID:    tenantID,
+		Username:    username,
+		Email:       identity.Email,
+		Role:        role,
+		FirstName:   identity.GivenName,
+		LastName:    identity.FamilyName,
+		IsActive:    true,
+		OIDCIssuer:  identity.Issuer,
+		OIDCSubject: identity.Subject,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := h.auth.userCollection.InsertUser(r.Context(), user); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to create user")
+		return nil, false
+	}
+
+	logging.FromContext(r.Context()).WithFields(log.Fields{"user_id": user.ID.Hex(), "tenant_id": tenantID, "role": role}).Info("Provisioned single sign-on user")
+	recordAudit(r.Context(), h.auth.auditLog, models.AuditEvent{
+		TenantID:  tenantID,
+		Action:    models.AuditSSOUserProvisioned,
+		TargetID:  user.ID.Hex(),
+		IPAddress: middleware.ClientIP(r),
+		Details:   map[string]interface{}{"issuer": identity.Issuer, "subject": identity.Subject, "role": role},
+	})
+	return &user, true
+}
+
+// availableUsername derives an unused username from the preferred username or
+// the email, adding a random suffix when it is taken
+func (h *OIDCHandler) availableUsername(r *http.Request, identity *auth.OIDCIdentity) (string, error) {
+	base := identity.PreferredUsername
+	if h.auth.authService.ValidateUsername(base) != nil {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	username := base
+	for attempt := 0; attempt < 5; attempt++ {
+		if _, err := h.auth.userCollection.FindUserByUsername(r.Context(), username); errors.Is(err, db.ErrUserNotFound) {
+			return username, nil
+		} else if err != nil {
+			return "", err
+		}
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+		username = base + "-" + hex.EncodeToString(suffix)
+	}
+	return "", errors.New("no available username")
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/ukydev/fleet-sustainability/internal/auth"
+	"github.com/ukydev/fleet-sustainability/internal/auth/oidctest"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/mail"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOIDCHandler_Login(t *testing.T) {
+	authService, _ := auth.NewService()
+	idp := oidctest.NewProvider("fleet", "s3cret")
+	defer idp.Close()
+	provider := auth.NewOIDCProvider(auth.OIDCConfig{
+		Issuer:       idp.Issuer(),
+		ClientID:     "fleet",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost:3000/auth/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+		Rules: []auth.OIDCRule{
+			{Claim: "groups", Value: "fleet-admins", Role: models.RoleAdmin, Tenant: "tenant-a"},
+			{Claim: "groups", Value: "fleet-users", Role: models.RoleViewer, Tenant: "tenant-a"},
+		},
+	}, nil)
+
+	newHandler := func(users *MockUserCollection, auditLog db.AuditLog) *OIDCHandler {
+		authHandler := NewAuthHandler(authService, users, newMockRefreshTokenCollection(), db.NewMemoryRevocationStore(), mail.NewMemorySender(), newLoginThrottle(), auditLog, db.NewMemoryMFAPolicyStore(), newTenantStore())
+		return NewOIDCHandler(authHandler, provider)
+	}
+	// signIn runs the whole flow for an IdP account and returns the callback response
+	signIn := func(t *testing.T, handler *OIDCHandler, claims map[string]interface{}) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Login(w, httptest.NewRequest("GET", "/api/auth/oidc/login", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		var start models.OIDCLoginResponse
+		json.NewDecoder(w.Body).Decode(&start)
+
+		code, state, err := idp.Authorize(start.AuthorizationURL, claims)
+		assert.NoError(t, err)
+		return postJSON(handler.Callback, "/api/auth/oidc/callback", models.OIDCCallbackRequest{Code: code, State: state, StateToken: start.StateToken})
+	}
+	adminClaims := map[string]interface{}{
+		"sub": "idp-user-1", "email": "jane@example.com", "email_verified": true,
+		"preferred_username": "jane", "given_name": "Jane", "family_name": "Doe",
+		"groups": []string{"fleet-admins"},
+	}
+
+	t.Run("first login provisions the user", func(t *testing.T) {
+		users := new(MockUserCollection)
+		auditLog := db.NewMemoryAuditLog()
+		handler := newHandler(users, auditLog)
+		users.On("FindUserByOIDCSubject", mock.Anything, idp.Issuer(), "idp-user-1").Return(nil, db.ErrUserNotFound)
+		users.On("FindUserByEmail", mock.Anything, "jane@example.com").Return(nil, db.ErrUserNotFound)
+		users.On("FindUserByUsername", mock.Anything, "jane").Return(nil, db.ErrUserNotFound)
+		users.On("InsertUser", mock.Anything, mock.MatchedBy(func(u models.User) bool {
+			return u.Username == "jane" && u.Role == models.RoleAdmin && u.TenantID == "tenant-a" &&
+				u.OIDCSubject == "idp-user-1" && u.PasswordHash == "" && u.FirstName == "Jane"
+		})).Return(nil)
+		users.On("UpdateLastLogin", mock.Anything, mock.Anything).Return(nil)
+
+		w := signIn(t, handler, adminClaims)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response models.LoginResponse
+		json.NewDecoder(w.Body).Decode(&response)
+		assert.NotEmpty(t, response.Token)
+		assert.NotEmpty(t, response.RefreshToken)
+		claims, err := authService.ValidateToken(response.Token)
+		assert.NoError(t, err)
+		assert.Equal(t, models.RoleAdmin, claims.Role)
+		assert.Equal(t, "tenant-a", claims.TenantID)
+		assert.Equal(t, models.AuditSSOUserProvisioned, auditLog.Events()[0].Action)
+		users.AssertExpectations(t)
+	})
+
+	t.Run("later logins re-sync the role", func(t *testing.T) {
+		users := new(MockUserCollection)
+		auditLog := db.NewMemoryAuditLog()
+		handler := newHandler(users, auditLog)
+		user := &models.User{ID: primitive.NewObjectID(), TenantID: "tenant-a", Username: "jane", Role: models.RoleAdmin, IsActive: true, OIDCIssuer: idp.Issuer(), OIDCSubject: "idp-user-1"}
+		users.On("FindUserByOIDCSubject", mock.Anything, idp.Issuer(), "idp-user-1").Return(user, nil)
+		users.On("UpdateUser", mock.Anything, user.ID.Hex(), mock.MatchedBy(func(u models.User) bool { return u.Role == models.RoleViewer })).Return(nil)
+		users.On("UpdateLastLogin", mock.Anything, user.ID.Hex()).Return(nil)
+
+		claims := map[string]interface{}{"sub": "idp-user-1", "groups": []string{"fleet-users"}}
+		w := signIn(t, handler, claims)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, models.AuditSSORoleSynced, auditLog.Events()[0].Action)
+		users.AssertNotCalled(t, "InsertUser", mock.Anything, mock.Anything)
+	})
+
+	t.Run("accounts without a matching rule are denied", func(t *testing.T) {
+		users := new(MockUserCollection)
+		handler := newHandler(users, db.NewMemoryAuditLog())
+
+		w := signIn(t, handler, map[string]interface{}{"sub": "idp-user-2", "groups": []string{"contractors"}})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		users.AssertNotCalled(t, "InsertUser", mock.Anything, mock.Anything)
+	})
+
+	t.Run("existing local accounts are not linked", func(t *testing.T) {
+		users := new(MockUserCollection)
+		handler := newHandler(users, db.NewMemoryAuditLog())
+		users.On("FindUserByOIDCSubject", mock.Anything, idp.Issuer(), "idp-user-1").Return(nil, db.ErrUserNotFound)
+		users.On("FindUserByEmail", mock.Anything, "jane@example.com").Return(&models.User{ID: primitive.NewObjectID()}, nil)
+
+		w := signIn(t, handler, adminClaims)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		users.AssertNotCalled(t, "InsertUser", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unverified emails are not provisioned", func(t *testing.T) {
+		users := new(MockUserCollection)
+		handler := newHandler(users, db.NewMemoryAuditLog())
+		users.On("FindUserByOIDCSubject", mock.Anything, idp.Issuer(), "idp-user-3").Return(nil, db.ErrUserNotFound)
+
+		w := signIn(t, handler, map[string]interface{}{"sub": "idp-user-3", "email": "x@example.com", "groups": []string{"fleet-users"}})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("users mapped to another tenant are denied", func(t *testing.T) {
+		users := new(MockUserCollection)
+		handler := newHandler(users, db.NewMemoryAuditLog())
+		user := &models.User{ID: primitive.NewObjectID(), TenantID: "tenant-b", Role: models.RoleAdmin, IsActive: true}
+		users.On("FindUserByOIDCSubject", mock.Anything, idp.Issuer(), "idp-user-1").Return(user, nil)
+
+		w := signIn(t, handler, adminClaims)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("deactivated users cannot sign in", func(t *testing.T) {
+		users := new(MockUserCollection)
+		handler := newHandler(users, db.NewMemoryAuditLog())
+		user := &models.User{ID: primitive.NewObjectID(), TenantID: "tenant-a", Role: models.RoleAdmin, IsActive: false}
+		users.On("FindUserByOIDCSubject", mock.Anything, idp.Issuer(), "idp-user-1").Return(user, nil)
+
+		w := signIn(t, handler, adminClaims)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("callback state must match the state token", func(t *testing.T) {
+		handler := newHandler(new(MockUserCollection), db.NewMemoryAuditLog())
+		w := httptest.NewRecorder()
+		handler.Login(w, httptest.NewRequest("GET", "/api/auth/oidc/login", nil))
+		var start models.OIDCLoginResponse
+		json.NewDecoder(w.Body).Decode(&start)
+		code, _, _ := idp.Authorize(start.AuthorizationURL, adminClaims)
+
+		w = postJSON(handler.Callback, "/api/auth/oidc/callback", models.OIDCCallbackRequest{Code: code, State: "forged", StateToken: start.StateToken})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		// A state token from another login does not carry this login's code verifier
+		w = httptest.NewRecorder()
+		handler.Login(w, httptest.NewRequest("GET", "/api/auth/oidc/login", nil))
+		var other models.OIDCLoginResponse
+		json.NewDecoder(w.Body).Decode(&other)
+		otherState, _ := authService.ValidateOIDCStateToken(other.StateToken)
+		w = postJSON(handler.Callback, "/api/auth/oidc/callback", models.OIDCCallbackRequest{Code: code, State: otherState.State, StateToken: other.StateToken})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
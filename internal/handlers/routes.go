@@ -0,0 +1,10 @@
+package handlers
+
+import "net/http"
+
+// withID adapts a handler of one record to a route with an {id} segment
+func withID(handler func(http.ResponseWriter, *http.Request, string)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, r.PathValue("id"))
+	})
+}
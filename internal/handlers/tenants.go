@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/middleware"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"github.com/ukydev/fleet-sustainability/internal/problem"
+	"github.com/ukydev/fleet-sustainability/internal/router"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TenantHandler handles platform tenant administration requests
+type TenantHandler struct {
+	tenants  db.TenantStore
+	auditLog db.AuditLog
+}
+
+// NewTenantHandler creates a new tenant administration handler
+func NewTenantHandler(tenants db.TenantStore, auditLog db.AuditLog) *TenantHandler {
+	return &TenantHandler{
+		tenants:  tenants,
+		auditLog: auditLog,
+	}
+}
+
+// Routes registers the tenant administration endpoints
+func (h *TenantHandler) Routes(rt router.Routes) {
+	rt.Handle(http.MethodGet, "/tenants", http.HandlerFunc(h.ListTenants))
+	rt.Handle(http.MethodPost, "/tenants", http.HandlerFunc(h.CreateTenant))
+	rt.Handle(http.MethodGet, "/tenants/{id}", withID(h.GetTenant))
+	rt.Handle(http.MethodPut, "/tenants/{id}", withID(h.UpdateTenant))
+	rt.Handle(http.MethodPatch, "/tenants/{id}", withID(h.UpdateTenant))
+	rt.Handle(http.MethodDelete, "/tenants/{id}", withID(h.DeleteTenant))
+	rt.Handle(http.MethodPost, "/tenants/{id}/suspend", withID(func(w http.ResponseWriter, r *http.Request, id string) {
+		h.SetTenantStatus(w, r, id, models.TenantSuspended)
+	}))
+	rt.Handle(http.MethodPost, "/tenants/{id}/activate", withID(func(w http.ResponseWriter, r *http.Request, id string) {
+		h.SetTenantStatus(w, r, id, models.TenantActive)
+	}))
+}
+
+// ListTenants returns every tenant, optionally filtered by the status query parameter
+func (h *TenantHandler) ListTenants(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r); !ok {
+		return
+	}
+
+	status := models.TenantStatus(r.URL.Query().Get("status"))
+	if status != "" && status != models.TenantActive && status != models.TenantSuspended {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "status must be active or suspended")
+		return
+	}
+	tenants, err := h.tenants.ListTenants(r.Context(), status)
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to list tenants")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tenants)
+}
+
+// GetTenant returns a single tenant
+func (h *TenantHandler) GetTenant(w http.ResponseWriter, r *http.Request, id string) {
+	if _, ok := h.authorize(w, r); !ok {
+		return
+	}
+
+	tenant, ok := h.findTenant(w, r, id)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tenant)
+}
+
+// CreateTenant creates an active tenant. Settings not given take their defaults.
+func (h *TenantHandler) CreateTenant(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
+		return
+	}
+
+	var createReq models.CreateTenantRequest
+	if err := json.Unmarshal(body, &createReq); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	if createReq.ID == "" {
+		createReq.ID = primitive.NewObjectID().Hex()
+	}
+	tenant := models.NewTenant(createReq.ID, strings.TrimSpace(createReq.Name))
+	if createReq.Plan != "" {
+		tenant.Plan = createReq.Plan
+	}
+	if createReq.Timezone != "" {
+		tenant.Timezone = createReq.Timezone
+	}
+	if createReq.Currency != "" {
+		tenant.Currency = createReq.Currency
+	}
+	if createReq.Units != "" {
+		tenant.Units = createReq.Units
+	}
+	if createReq.AlertThresholds != nil {
+		tenant.AlertThresholds = *createReq.AlertThresholds
+	}
+	tenant.AllowedOrigins = createReq.AllowedOrigins
+	if err := tenant.Validate(); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+
+	if err := h.tenants.InsertTenant(r.Context(), tenant); err != nil {
+		if errors.Is(err, db.ErrTenantExists) {
+			problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "Tenant already exists")
+			return
+		}
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to create tenant")
+		return
+	}
+	middleware.AuditChange(r.Context(), tenant.ID, nil, tenant)
+
+	h.recordTenantEvent(r, claims, tenant.ID, models.AuditTenantCreated)
+	logging.FromContext(r.Context()).WithFields(log.Fields{"tenant_id": tenant.ID, "actor": claims.UserID}).Info("Created tenant")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tenant)
+}
+
+// UpdateTenant changes a tenant's name, plan and settings; its status only
+// changes through suspend and activate
+func (h *TenantHandler) UpdateTenant(w http.ResponseWriter, r *http.Request, id string) {
+	if _, ok := h.authorize(w, r); !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
+		return
+	}
+
+	var updateReq models.UpdateTenantRequest
+	if err := json.Unmarshal(body, &updateReq); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	before, ok := h.findTenant(w, r, id)
+	if !ok {
+		return
+	}
+	tenant := *before
+	if updateReq.Name != nil {
+		tenant.Name = strings.TrimSpace(*updateReq.Name)
+	}
+	if updateReq.Plan != nil {
+		tenant.Plan = *updateReq.Plan
+	}
+	if updateReq.Timezone != nil {
+		tenant.Timezone = *updateReq.Timezone
+	}
+	if updateReq.Currency != nil {
+		tenant.Currency = *updateReq.Currency
+	}
+	if updateReq.Units != nil {
+		tenant.Units = *updateReq.Units
+	}
+	if updateReq.AlertThresholds != nil {
+		tenant.AlertThresholds = *updateReq.AlertThresholds
+	}
+	if updateReq.AllowedOrigins != nil {
+		tenant.AllowedOrigins = *updateReq.AllowedOrigins
+	}
+	if err := tenant.Validate(); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+	tenant.UpdatedAt = time.Now()
+
+	if !h.saveTenant(w, r, tenant) {
+		return
+	}
+	middleware.AuditChange(r.Context(), id, before, tenant)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tenant)
+}
+
+// SetTenantStatus suspends or reactivates a tenant. Suspension refuses every
+// token and API key of the tenant; its data is kept.
+func (h *TenantHandler) SetTenantStatus(w http.ResponseWriter, r *http.Request, id string, status models.TenantStatus) {
+	claims, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	before, ok := h.findTenant(w, r, id)
+	if !ok {
+		return
+	}
+	tenant := *before
+	if tenant.Status != status {
+		now := time.Now()
+		tenant.Status = status
+		tenant.SuspendedAt = nil
+		if status == models.TenantSuspended {
+			tenant.SuspendedAt = &now
+		}
+		tenant.UpdatedAt = now
+		if !h.saveTenant(w, r, tenant) {
+			return
+		}
+		middleware.AuditChange(r.Context(), id, before, tenant)
+
+		action := models.AuditTenantActivated
+		if status == models.TenantSuspended {
+			action = models.AuditTenantSuspended
+		}
+		h.recordTenantEvent(r, claims, id, action)
+		logging.FromContext(r.Context()).WithFields(log.Fields{"tenant_id": id, "status": status, "actor": claims.UserID}).Warn("Changed tenant status")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tenant)
+}
+
+// DeleteTenant removes a suspended tenant. Active tenants must be suspended
+// first so that deletion is never a single accidental request.
+func (h *TenantHandler) DeleteTenant(w http.ResponseWriter, r *http.Request, id string) {
+	claims, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	tenant, ok := h.findTenant(w, r, id)
+	if !ok {
+		return
+	}
+	if tenant.IsActive() {
+		problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "Tenant must be suspended before it is deleted")
+		return
+	}
+
+	if err := h.tenants.DeleteTenant(r.Context(), id); err != nil {
+		if errors.Is(err, db.ErrTenantNotFound) {
+			problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "Tenant not found")
+			return
+		}
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to delete tenant")
+		return
+	}
+	middleware.AuditChange(r.Context(), id, tenant, nil)
+
+	h.recordTenantEvent(r, claims, id, models.AuditTenantDeleted)
+	logging.FromContext(r.Context()).WithFields(log.Fields{"tenant_id": id, "actor": claims.UserID}).Warn("Deleted tenant")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"id": id, "message": "Tenant deleted successfully"})
+}
+
+// findTenant loads a tenant, writing the error response when it cannot
+func (h *TenantHandler) findTenant(w http.ResponseWriter, r *http.Request, id string) (*models.Tenant, bool) {
+	tenant, err := h.tenants.FindTenantByID(r.Context(), id)
+	if errors.Is(err, db.ErrTenantNotFound) {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "Tenant not found")
+		return nil, false
+	}
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to load tenant")
+		return nil, false
+	}
+	return tenant, true
+}
+
+// saveTenant stores an updated tenant, writing the error response when it cannot
+func (h *TenantHandler) saveTenant(w http.ResponseWriter, r *http.Request, tenant models.Tenant) bool {
+	if err := h.tenants.UpdateTenant(r.Context(), tenant); err != nil {
+		if errors.Is(err, db.ErrTenantNotFound) {
+			problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "Tenant not found")
+			return false
+		}
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update tenant")
+		return false
+	}
+	return true
+}
+
+// recordTenantEvent adds a lifecycle event to the tenant's own audit trail,
+// so its admins can see what the platform did to their tenant
+func (h *TenantHandler) recordTenantEvent(r *http.Request, claims *models.Claims, tenantID, action string) {
+	recordAudit(r.Context(), h.auditLog, models.AuditEvent{
+		TenantID:  tenantID,
+		Action:    action,
+		ActorID:   claims.UserID,
+		TargetID:  tenantID,
+		IPAddress: middleware.ClientIP(r),
+	})
+}
+
+// authorize checks that the caller is a platform user allowed to manage tenants
+func (h *TenantHandler) authorize(w http.ResponseWriter, r *http.Request) (*models.Claims, bool) {
+	claims, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User context not found")
+		return nil, false
+	}
+	if claims.IsAPIKey() || !claims.HasPermission(models.PermManageTenants) {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeInsufficientPermissions, "Insufficient permissions")
+		return nil, false
+	}
+	return claims, true
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+)
+
+func TestTenantHandler(t *testing.T) {
+	tenants := db.NewMemoryTenantStore()
+	auditLog := db.NewMemoryAuditLog()
+	handler := NewTenantHandler(tenants, auditLog)
+	superAdmin := &models.Claims{UserID: "root-id", Role: models.RoleSuperAdmin}
+
+	serve := func(method, path string, body interface{}, claims *models.Claims) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest(method, path, body, claims))
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) models.Tenant {
+		var tenant models.Tenant
+		json.NewDecoder(w.Body).Decode(&tenant)
+		return tenant
+	}
+
+	t.Run("creates a tenant with defaults", func(t *testing.T) {
+		w := serve("POST", "/api/v1/tenants", models.CreateTenantRequest{ID: "acme", Name: "Acme", Currency: "EUR"}, superAdmin)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		created := decode(w)
+		assert.Equal(t, models.PlanFree, created.Plan)
+		assert.Equal(t, "EUR", created.Currency)
+		assert.Equal(t, models.DefaultAlertThresholds, created.AlertThresholds)
+		assert.True(t, created.IsActive())
+
+		events, _ := auditLog.Query(context.Background(), db.AuditQuery{TenantID: "acme"})
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, models.AuditTenantCreated, events[0].Action)
+		}
+
+		assert.Equal(t, http.StatusConflict, serve("POST", "/api/v1/tenants", models.CreateTenantRequest{ID: "acme", Name: "Again"}, superAdmin).Code)
+		w = serve("POST", "/api/v1/tenants", models.CreateTenantRequest{Name: "Generated"}, superAdmin)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Len(t, decode(w).ID, 24)
+	})
+
+	t.Run("validates settings", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, serve("POST", "/api/v1/tenants", models.CreateTenantRequest{ID: "bad", Name: "Bad", Timezone: "Nowhere/City"}, superAdmin).Code)
+		plan := models.Plan("gold")
+		assert.Equal(t, http.StatusBadRequest, serve("PATCH", "/api/v1/tenants/acme", models.UpdateTenantRequest{Plan: &plan}, superAdmin).Code)
+		origins := []string{"https://fleet.acme.com/dashboard"}
+		assert.Equal(t, http.StatusBadRequest, serve("PATCH", "/api/v1/tenants/acme", models.UpdateTenantRequest{AllowedOrigins: &origins}, superAdmin).Code)
+	})
+
+	t.Run("updates settings", func(t *testing.T) {
+		timezone := "Europe/Berlin"
+		thresholds := models.AlertThresholds{LowFuelPct: 20, LowBatteryPct: 15, HighEmissions: 40}
+		origins := []string{"https://fleet.acme.com"}
+		w := serve("PATCH", "/api/v1/tenants/acme", models.UpdateTenantRequest{Timezone: &timezone, AlertThresholds: &thresholds, AllowedOrigins: &origins}, superAdmin)
+		assert.Equal(t, http.StatusOK, w.Code)
+		updated := decode(w)
+		assert.Equal(t, "Europe/Berlin", updated.Timezone)
+		assert.Equal(t, "EUR", updated.Currency, "unset fields are kept")
+		assert.Equal(t, thresholds, updated.AlertThresholds)
+		assert.Equal(t, origins, updated.AllowedOrigins)
+
+		assert.Equal(t, http.StatusNotFound, serve("PUT", "/api/v1/tenants/unknown", models.UpdateTenantRequest{Timezone: &timezone}, superAdmin).Code)
+	})
+
+	t.Run("suspends, reactivates and deletes", func(t *testing.T) {
+		assert.Equal(t, http.StatusConflict, serve("DELETE", "/api/v1/tenants/acme", nil, superAdmin).Code, "active tenants cannot be deleted")
+
+		w := serve("POST", "/api/v1/tenants/acme/suspend", nil, superAdmin)
+		assert.Equal(t, http.StatusOK, w.Code)
+		suspended := decode(w)
+		assert.False(t, suspended.IsActive())
+		assert.NotNil(t, suspended.SuspendedAt)
+
+		w = serve("GET", "/api/v1/tenants?status=suspended", nil, superAdmin)
+		var listed []models.Tenant
+		json.NewDecoder(w.Body).Decode(&listed)
+		if assert.Len(t, listed, 1) {
+			assert.Equal(t, "acme", listed[0].ID)
+		}
+
+		w = serve("POST", "/api/v1/tenants/acme/activate", nil, superAdmin)
+		activated := decode(w)
+		assert.True(t, activated.IsActive())
+		serve("POST", "/api/v1/tenants/acme/suspend", nil, superAdmin)
+		assert.Equal(t, http.StatusOK, serve("DELETE", "/api/v1/tenants/acme", nil, superAdmin).Code)
+		assert.Equal(t, http.StatusNotFound, serve("GET", "/api/v1/tenants/acme", nil, superAdmin).Code)
+
+		events, _ := auditLog.Query(context.Background(), db.AuditQuery{TenantID: "acme"})
+		var actions []string
+		for _, event := range events {
+			actions = append(actions, event.Action)
+		}
+		assert.Equal(t, []string{models.AuditTenantDeleted, models.AuditTenantSuspended, models.AuditTenantActivated, models.AuditTenantSuspended, models.AuditTenantCreated}, actions)
+	})
+
+	t.Run("only super-admins manage tenants", func(t *testing.T) {
+		admin := &models.Claims{UserID: "admin-id", TenantID: "tenant-a", Role: models.RoleAdmin}
+		assert.Equal(t, http.StatusForbidden, serve("GET", "/api/v1/tenants", nil, admin).Code)
+		assert.Equal(t, http.StatusForbidden, serve("POST", "/api/v1/tenants/tenant-a/activate", nil, admin).Code)
+		apiKey := &models.Claims{APIKeyID: "key-id", TenantID: "tenant-a", Scopes: []string{models.ScopeVehiclesRead}}
+		assert.Equal(t, http.StatusForbidden, serve("GET", "/api/v1/tenants", nil, apiKey).Code)
+	})
+
+	t.Run("routes", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve("POST", "/api/v1/tenants/acme/archive", nil, superAdmin).Code)
+		assert.Equal(t, http.StatusMethodNotAllowed, serve("DELETE", "/api/v1/tenants", nil, superAdmin).Code)
+		assert.Equal(t, http.StatusBadRequest, serve("GET", "/api/v1/tenants?status=deleted", nil, superAdmin).Code)
+	})
+}
@@ -0,0 +1,464 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ukydev/fleet-sustainability/internal/auth"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/middleware"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"github.com/ukydev/fleet-sustainability/internal/problem"
+	"github.com/ukydev/fleet-sustainability/internal/router"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UserHandler handles tenant-scoped user administration requests
+type UserHandler struct {
+	authService    *auth.Service
+	userCollection db.UserCollection
+	refreshTokens  db.RefreshTokenCollection
+	revocations    db.RevocationStore
+	throttle       *auth.LoginThrottle
+	auditLog       db.AuditLog
+}
+
+// NewUserHandler creates a new user administration handler
+func NewUserHandler(authService *auth.Service, userCollection db.UserCollection, refreshTokens db.RefreshTokenCollection, revocations db.RevocationStore, throttle *auth.LoginThrottle, auditLog db.AuditLog) *UserHandler {
+	return &UserHandler{
+		authService:    authService,
+		userCollection: userCollection,
+		refreshTokens:  refreshTokens,
+		revocations:    revocations,
+		throttle:       throttle,
+		auditLog:       auditLog,
+	}
+}
+
+// Routes registers the user administration endpoints
+func (h *UserHandler) Routes(rt router.Routes) {
+	rt.Handle(http.MethodGet, "/users", http.HandlerFunc(h.ListUsers))
+	rt.Handle(http.MethodPost, "/users", http.HandlerFunc(h.CreateUser))
+	rt.Handle(http.MethodGet, "/users/{id}", withID(h.GetUser))
+	rt.Handle(http.MethodPut, "/users/{id}", withID(h.UpdateUser))
+	rt.Handle(http.MethodPatch, "/users/{id}", withID(h.UpdateUser))
+	rt.Handle(http.MethodDelete, "/users/{id}", withID(h.DeleteUser))
+	rt.Handle(http.MethodPost, "/users/{id}/password", withID(h.ResetPassword))
+	rt.Handle(http.MethodPost, "/users/{id}/unlock", withID(h.UnlockUser))
+}
+
+// ListUsers lists users of the caller's tenant, optionally filtered by role, is_active and q
+func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.authorize(w, r, models.PermViewUsers)
+	if !ok {
+		return
+	}
+
+	filter := db.UserQuery{TenantID: claims.TenantID}
+	query := r.URL.Query()
+	if role := query.Get("role"); role != "" {
+		if !models.IsValidRole(models.Role(role)) {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid role")
+			return
+		}
+		filter.Role = models.Role(role)
+	}
+	if active := query.Get("is_active"); active != "" {
+		switch active {
+		case "true", "false":
+			isActive := active == "true"
+			filter.Active = &isActive
+		default:
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "is_active must be 'true' or 'false'")
+			return
+		}
+	}
+	filter.Prefix = query.Get("q")
+
+	users, err := h.userCollection.FindUsers(r.Context(), filter)
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to query users")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// CreateUser creates a user directly in the caller's tenant
+func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	claims, ok := h.authorize(w, r, models.PermCreateUser)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
+		return
+	}
+
+	var createReq models.CreateUserRequest
+	if err := json.Unmarshal(body, &createReq); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	var invalid models.ValidationError
+	invalid.Check("username", h.authService.ValidateUsername(createReq.Username))
+	invalid.Check("email", h.authService.ValidateEmail(createReq.Email))
+	invalid.Check("password", h.authService.ValidatePassword(createReq.Password, createReq.Username, createReq.Email))
+	if !models.IsValidRole(createReq.Role) {
+		invalid.Add("role", models.FieldInvalid, "Invalid role")
+	}
+	if err := invalid.Err(); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+	if createReq.Role == models.RoleAdmin && claims.Role != models.RoleAdmin {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "Only admins can create admin accounts")
+		return
+	}
+
+	if _, err := h.userCollection.FindUserByUsername(r.Context(), createReq.Username); err == nil {
+		problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "Username already exists")
+		return
+	}
+	if _, err := h.userCollection.FindUserByEmail(r.Context(), createReq.Email); err == nil {
+		problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "Email already exists")
+		return
+	}
+
+	passwordHash, err := h.authService.HashPassword(createReq.Password)
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to hash password")
+		return
+	}
+
+	user := models.User{
+		ID:           primitive.NewObjectID(),
+		TenantID:     claims.TenantID,
+		Username:     createReq.Username,
+		Email:        createReq.Email,
+		PasswordHash: passwordHash,
+		Role:         createReq.Role,
+		FirstName:    createReq.FirstName,
+		LastName:     createReq.LastName,
+		IsActive:     true,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if err := h.userCollection.InsertUser(r.Context(), user); err != nil {
+		if errors.Is(err, db.ErrUserExists) {
+			problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "Username or email already exists")
+			return
+		}
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to create user")
+		return
+	}
+	middleware.AuditChange(r.Context(), user.ID.Hex(), nil, user)
+
+	logging.FromContext(r.Context()).WithFields(log.Fields{"tenant_id": claims.TenantID, "user_id": user.ID.Hex(), "role": user.Role, "actor": claims.UserID}).Info("Created user")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// GetUser returns a single user of the caller's tenant
+func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request, id string) {
+	claims, ok := h.authorize(w, r, models.PermViewUsers)
+	if !ok {
+		return
+	}
+
+	user, ok := h.findTenantUser(w, r, claims, id)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// UpdateUser updates profile fields, role or activation state of a user in the caller's tenant
+func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request, id string) {
+	claims, ok := h.authorize(w, r, models.PermUpdateUser)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Failed to read request body")
+		return
+	}
+
+	var updateReq models.UpdateUserRequest
+	if err := json.Unmarshal(body, &updateReq); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	user, ok := h.findTenantUser(w, r, claims, id)
+	if !ok {
+		return
+	}
+	if !h.canManage(w, r, claims, user) {
+		return
+	}
+
+	before := *user
+	revokeSessions := false
+	if updateReq.Role != nil && *updateReq.Role != user.Role {
+		if !claims.HasPermission(models.PermManageUsers) {
+			problem.Error(w, r, http.StatusForbidden, problem.CodeInsufficientPermissions, "Insufficient permissions to change roles")
+			return
+		}
+		if !models.IsValidRole(*updateReq.Role) {
+			problem.InvalidField(w, r, "role", models.FieldInvalid, "Invalid role")
+			return
+		}
+		revokeSessions = true
+	}
+	if updateReq.IsActive != nil && !*updateReq.IsActive && user.IsActive {
+		revokeSessions = true
+	}
+
+	// Refuse to leave the tenant without an active admin
+	losesAdmin := user.Role == models.RoleAdmin && user.IsActive &&
+		((updateReq.Role != nil && *updateReq.Role != models.RoleAdmin) ||
+			(updateReq.IsActive != nil && !*updateReq.IsActive))
+	if losesAdmin && !h.ensureAnotherAdmin(w, r, claims.TenantID) {
+		return
+	}
+
+	if updateReq.Email != nil && *updateReq.Email != user.Email {
+		if err := h.authService.ValidateEmail(*updateReq.Email); err != nil {
+			problem.InvalidField(w, r, "email", models.FieldInvalid, err.Error())
+			return
+		}
+		existingUser, err := h.userCollection.FindUserByEmail(r.Context(), *updateReq.Email)
+		if err == nil && existingUser.ID != user.ID {
+			problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "Email already exists")
+			return
+		}
+		user.Email = *updateReq.Email
+	}
+	if updateReq.FirstName != nil {
+		user.FirstName = *updateReq.FirstName
+	}
+	if updateReq.LastName != nil {
+		user.LastName = *updateReq.LastName
+	}
+	if updateReq.Role != nil {
+		user.Role = *updateReq.Role
+	}
+	if updateReq.IsActive != nil {
+		user.IsActive = *updateReq.IsActive
+	}
+
+	if err := h.userCollection.UpdateUser(r.Context(), id, *user); err != nil {
+		if errors.Is(err, db.ErrUserExists) {
+			problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "Email already exists")
+			return
+		}
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to update user")
+		return
+	}
+	middleware.AuditChange(r.Context(), id, before, user)
+	// Role and activation are baked into issued tokens, so force a fresh login
+	if revokeSessions {
+		h.revokeSessions(r, id)
+	}
+
+	logging.FromContext(r.Context()).WithFields(log.Fields{"tenant_id": claims.TenantID, "user_id": id, "actor": claims.UserID}).Info("Updated user")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// DeleteUser deletes a user of the caller's tenant
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request, id string) {
+	claims, ok := h.authorize(w, r, models.PermDeleteUser)
+	if !ok {
+		return
+	}
+
+	user, ok := h.findTenantUser(w, r, claims, id)
+	if !ok {
+		return
+	}
+	if user.Role == models.RoleAdmin && user.IsActive && !h.ensureAnotherAdmin(w, r, claims.TenantID) {
+		return
+	}
+
+	if err := h.userCollection.DeleteUser(r.Context(), id); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to delete user")
+		return
+	}
+	middleware.AuditChange(r.Context(), id, user, nil)
+	h.revokeSessions(r, id)
+
+	logging.FromContext(r.Context()).WithFields(log.Fields{"tenant_id": claims.TenantID, "user_id": id, "actor": claims.UserID}).Info("Deleted user")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"id": id, "message": "User deleted successfully"})
+}
+
+// ResetPassword sets a new password for a user of the caller's tenant and signs them out everywhere
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request, id string) {
+	claims, ok := h.authorize(w, r, models.PermUpdateUser)
+	if !ok {
+		return
+	}
+
+	var resetReq models.ResetPasswordRequest
+	if body, err := io.ReadAll(r.Body); err == nil && len(body) > 0 {
+		if err := json.Unmarshal(body, &resetReq); err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Invalid JSON")
+			return
+		}
+	}
+
+	user, ok := h.findTenantUser(w, r, claims, id)
+	if !ok {
+		return
+	}
+	if !h.canManage(w, r, claims, user) {
+		return
+	}
+
+	response := models.ResetPasswordResponse{Message: "Password reset successfully"}
+	newPassword := resetReq.NewPassword
+	if newPassword == "" {
+		generated, err := h.authService.GenerateTemporaryPassword()
+		if err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to generate password")
+			return
+		}
+		newPassword = generated
+		response.TemporaryPassword = generated
+	} else if err := h.authService.ValidatePassword(newPassword, user.Username, user.Email); err != nil {
+		problem.InvalidField(w, r, "new_password", models.FieldInvalid, err.Error())
+		return
+	}
+
+	if !setUserPassword(w, r, h.authService, h.userCollection, user, newPassword) {
+		return
+	}
+	middleware.AuditTarget(r.Context(), id)
+	h.revokeSessions(r, id)
+
+	logging.FromContext(r.Context()).WithFields(log.Fields{"tenant_id": claims.TenantID, "user_id": id, "actor": claims.UserID}).Info("Reset user password")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// UnlockUser lifts a login lockout of a user in the caller's tenant
+func (h *UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request, id string) {
+	claims, ok := h.authorize(w, r, models.PermManageUsers)
+	if !ok {
+		return
+	}
+
+	user, ok := h.findTenantUser(w, r, claims, id)
+	if !ok {
+		return
+	}
+
+	if err := h.userCollection.UnlockUser(r.Context(), id); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to unlock user")
+		return
+	}
+	h.throttle.Reset("user:" + strings.ToLower(user.Username))
+	middleware.AuditTarget(r.Context(), id)
+
+	recordAudit(r.Context(), h.auditLog, models.AuditEvent{
+		TenantID:  claims.TenantID,
+		Action:    models.AuditAccountUnlocked,
+		ActorID:   claims.UserID,
+		TargetID:  id,
+		IPAddress: middleware.ClientIP(r),
+		Details:   map[string]interface{}{"reason": "admin unlock", "was_locked": user.IsLocked(time.Now())},
+	})
+	logging.FromContext(r.Context()).WithFields(log.Fields{"tenant_id": claims.TenantID, "user_id": id, "actor": claims.UserID}).Info("Unlocked user")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"id": id, "message": "User unlocked successfully"})
+}
+
+// authorize checks that the caller belongs to a tenant and holds the given permission
+func (h *UserHandler) authorize(w http.ResponseWriter, r *http.Request, action string) (*models.Claims, bool) {
+	claims, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User context not found")
+		return nil, false
+	}
+	if !claims.HasPermission(action) {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeInsufficientPermissions, "Insufficient permissions")
+		return nil, false
+	}
+	if claims.TenantID == "" {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "Caller is not bound to a tenant")
+		return nil, false
+	}
+	return claims, true
+}
+
+// findTenantUser loads a user and hides users of other tenants behind a 404.
+// Storage errors answer 500 so that an outage does not look like a missing user.
+func (h *UserHandler) findTenantUser(w http.ResponseWriter, r *http.Request, claims *models.Claims, id string) (*models.User, bool) {
+	if !primitive.IsValidObjectID(id) {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidID, "Invalid user ID")
+		return nil, false
+	}
+	user, err := h.userCollection.FindUserByID(r.Context(), id)
+	if err != nil && !errors.Is(err, db.ErrUserNotFound) {
+		logging.FromContext(r.Context()).WithError(err).WithField("user_id", id).Error("Failed to find user")
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to find user")
+		return nil, false
+	}
+	if err != nil || user.TenantID != claims.TenantID {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "User not found")
+		return nil, false
+	}
+	return user, true
+}
+
+// canManage prevents non-admins from modifying admin accounts
+func (h *UserHandler) canManage(w http.ResponseWriter, r *http.Request, claims *models.Claims, target *models.User) bool {
+	if target.Role == models.RoleAdmin && claims.Role != models.RoleAdmin {
+		problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "Only admins can modify admin accounts")
+		return false
+	}
+	return true
+}
+
+// ensureAnotherAdmin verifies the tenant keeps at least one other active admin
+func (h *UserHandler) ensureAnotherAdmin(w http.ResponseWriter, r *http.Request, tenantID string) bool {
+	active := true
+	count, err := h.userCollection.CountUsers(r.Context(), db.UserQuery{
+		TenantID: tenantID,
+		Role:     models.RoleAdmin,
+		Active:   &active,
+	})
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to count admins")
+		return false
+	}
+	if count <= 1 {
+		problem.Error(w, r, http.StatusConflict, problem.CodeConflict, "Cannot remove the last admin of a tenant")
+		return false
+	}
+	return true
+}
+
+// revokeSessions signs a user out everywhere; failures are logged since the change itself succeeded
+func (h *UserHandler) revokeSessions(r *http.Request, userID string) {
+	if err := revokeUserSessions(r.Context(), h.authService, h.revocations, h.refreshTokens, userID); err != nil {
+		logging.FromContext(r.Context()).WithError(err).WithField("user_id", userID).Error("Failed to revoke user sessions")
+	}
+}
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/ukydev/fleet-sustainability/internal/auth"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/middleware"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"github.com/ukydev/fleet-sustainability/internal/router"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newUserAdminRequest builds a request carrying the given caller's claims
+func newUserAdminRequest(method, path string, body interface{}, claims *models.Claims) *http.Request {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	return req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, claims))
+}
+
+// routed returns a router serving the endpoints of handler under /api/v1
+func routed(handler interface{ Routes(router.Routes) }) *router.Router {
+	rt := router.New("/api/v1")
+	handler.Routes(rt)
+	return rt
+}
+
+// newUserHandlerWithRevocation returns a handler whose session revocation always succeeds
+func newUserHandlerWithRevocation(authService *auth.Service, users *MockUserCollection) *UserHandler {
+	refreshTokens := new(MockRefreshTokenCollection)
+	refreshTokens.On("RevokeUserRefreshTokens", mock.Anything, mock.Anything).Return(nil).Maybe()
+	return NewUserHandler(authService, users, refreshTokens, db.NewMemoryRevocationStore(), newLoginThrottle(), db.NewMemoryAuditLog())
+}
+
+func TestUserHandler_ListUsers(t *testing.T) {
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	admin := &models.Claims{UserID: primitive.NewObjectID().Hex(), Role: models.RoleAdmin, TenantID: "tenant-a"}
+
+	t.Run("scopes query to caller tenant with filters", func(t *testing.T) {
+		mockUsers := new(MockUserCollection)
+		handler := newUserHandlerWithRevocation(authService, mockUsers)
+
+		active := true
+		mockUsers.On("FindUsers", mock.Anything, db.UserQuery{TenantID: "tenant-a", Role: models.RoleViewer, Active: &active, Prefix: "al"}).
+			Return([]models.User{{Username: "alice", TenantID: "tenant-a", Role: models.RoleViewer}}, nil)
+
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("GET", "/api/v1/users?role=viewer&is_active=true&q=al", nil, admin))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var users []models.User
+		json.Unmarshal(w.Body.Bytes(), &users)
+		assert.Len(t, users, 1)
+		assert.Equal(t, "alice", users[0].Username)
+		mockUsers.AssertExpectations(t)
+	})
+
+	t.Run("invalid role filter", func(t *testing.T) {
+		handler := newUserHandlerWithRevocation(authService, new(MockUserCollection))
+
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("GET", "/api/v1/users?role=superuser", nil, admin))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("viewer is forbidden", func(t *testing.T) {
+		handler := newUserHandlerWithRevocation(authService, new(MockUserCollection))
+		viewer := &models.Claims{UserID: primitive.NewObjectID().Hex(), Role: models.RoleViewer, TenantID: "tenant-a"}
+
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("GET", "/api/v1/users", nil, viewer))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestUserHandler_CreateUser(t *testing.T) {
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	manager := &models.Claims{UserID: primitive.NewObjectID().Hex(), Role: models.RoleManager, TenantID: "tenant-a"}
+
+	t.Run("creates user in caller tenant", func(t *testing.T) {
+		mockUsers := new(MockUserCollection)
+		handler := newUserHandlerWithRevocation(authService, mockUsers)
+
+		mockUsers.On("FindUserByUsername", mock.Anything, "newop").Return(nil, errors.New("not found"))
+		mockUsers.On("FindUserByEmail", mock.Anything, "newop@example.com").Return(nil, errors.New("not found"))
+		mockUsers.On("InsertUser", mock.Anything, mock.MatchedBy(func(u models.User) bool {
+			return u.TenantID == "tenant-a" && u.Role == models.RoleOperator && u.IsActive
+		})).Return(nil)
+
+		body := models.CreateUserRequest{Username: "newop", Email: "newop@example.com", Password: "password123", Role: models.RoleOperator}
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("POST", "/api/v1/users", body, manager))
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		mockUsers.AssertExpectations(t)
+	})
+
+	t.Run("manager cannot create admin", func(t *testing.T) {
+		handler := newUserHandlerWithRevocation(authService, new(MockUserCollection))
+
+		body := models.CreateUserRequest{Username: "boss", Email: "boss@example.com", Password: "password123", Role: models.RoleAdmin}
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("POST", "/api/v1/users", body, manager))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestUserHandler_GetUser(t *testing.T) {
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	admin := &models.Claims{UserID: primitive.NewObjectID().Hex(), Role: models.RoleAdmin, TenantID: "tenant-a"}
+
+	t.Run("user of another tenant is not found", func(t *testing.T) {
+		mockUsers := new(MockUserCollection)
+		handler := newUserHandlerWithRevocation(authService, mockUsers)
+
+		other := &models.User{ID: primitive.NewObjectID(), TenantID: "tenant-b", Role: models.RoleViewer}
+		mockUsers.On("FindUserByID", mock.Anything, other.ID.Hex()).Return(other, nil)
+
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("GET", "/api/v1/users/"+other.ID.Hex(), nil, admin))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("missing user is not found", func(t *testing.T) {
+		mockUsers := new(MockUserCollection)
+		handler := newUserHandlerWithRevocation(authService, mockUsers)
+
+		id := primitive.NewObjectID().Hex()
+		mockUsers.On("FindUserByID", mock.Anything, id).Return(nil, db.ErrUserNotFound)
+
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("GET", "/api/v1/users/"+id, nil, admin))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("storage error is not a 404", func(t *testing.T) {
+		mockUsers := new(MockUserCollection)
+		handler := newUserHandlerWithRevocation(authService, mockUsers)
+
+		id := primitive.NewObjectID().Hex()
+		mockUsers.On("FindUserByID", mock.Anything, id).Return(nil, errors.New("server selection timeout"))
+
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("GET", "/api/v1/users/"+id, nil, admin))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		handler := newUserHandlerWithRevocation(authService, new(MockUserCollection))
+
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("GET", "/api/v1/users/abc", nil, admin))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestUserHandler_UpdateUser(t *testing.T) {
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	admin := &models.Claims{UserID: primitive.NewObjectID().Hex(), Role: models.RoleAdmin, TenantID: "tenant-a"}
+	manager := &models.Claims{UserID: primitive.NewObjectID().Hex(), Role: models.RoleManager, TenantID: "tenant-a"}
+	active := true
+	adminCount := db.UserQuery{TenantID: "tenant-a", Role: models.RoleAdmin, Active: &active}
+
+	t.Run("changes role and revokes sessions", func(t *testing.T) {
+		mockUsers := new(MockUserCollection)
+		refreshTokens := new(MockRefreshTokenCollection)
+		handler := NewUserHandler(authService, mockUsers, refreshTokens, db.NewMemoryRevocationStore(), newLoginThrottle(), db.NewMemoryAuditLog())
+
+		target := &models.User{ID: primitive.NewObjectID(), TenantID: "tenant-a", Role: models.RoleViewer, IsActive: true}
+		mockUsers.On("FindUserByID", mock.Anything, target.ID.Hex()).Return(target, nil)
+		mockUsers.On("UpdateUser", mock.Anything, target.ID.Hex(), mock.MatchedBy(func(u models.User) bool {
+			return u.Role == models.RoleOperator
+		})).Return(nil)
+		refreshTokens.On("RevokeUserRefreshTokens", mock.Anything, target.ID.Hex()).Return(nil)
+
+		role := models.RoleOperator
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("PATCH", "/api/v1/users/"+target.ID.Hex(), models.UpdateUserRequest{Role: &role}, admin))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockUsers.AssertExpectations(t)
+		refreshTokens.AssertExpectations(t)
+	})
+
+	t.Run("cannot demote last admin", func(t *testing.T) {
+		mockUsers := new(MockUserCollection)
+		handler := newUserHandlerWithRevocation(authService, mockUsers)
+
+		target := &models.User{ID: primitive.NewObjectID(), TenantID: "tenant-a", Role: models.RoleAdmin, IsActive: true}
+		mockUsers.On("FindUserByID", mock.Anything, target.ID.Hex()).Return(target, nil)
+		mockUsers.On("CountUsers", mock.Anything, adminCount).Return(int64(1), nil)
+
+		role := models.RoleViewer
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("PUT", "/api/v1/users/"+target.ID.Hex(), models.UpdateUserRequest{Role: &role}, admin))
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		mockUsers.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("cannot deactivate last admin", func(t *testing.T) {
+		mockUsers := new(MockUserCollection)
+		handler := newUserHandlerWithRevocation(authService, mockUsers)
+
+		target := &models.User{ID: primitive.NewObjectID(), TenantID: "tenant-a", Role: models.RoleAdmin, IsActive: true}
+		mockUsers.On("FindUserByID", mock.Anything, target.ID.Hex()).Return(target, nil)
+		mockUsers.On("CountUsers", mock.Anything, adminCount).Return(int64(1), nil)
+
+		inactive := false
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("PATCH", "/api/v1/users/"+target.ID.Hex(), models.UpdateUserRequest{IsActive: &inactive}, admin))
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("manager cannot change roles", func(t *testing.T) {
+		mockUsers := new(MockUserCollection)
+		handler := newUserHandlerWithRevocation(authService, mockUsers)
+
+		target := &models.User{ID: primitive.NewObjectID(), TenantID: "tenant-a", Role: models.RoleViewer, IsActive: true}
+		mockUsers.On("FindUserByID", mock.Anything, target.ID.Hex()).Return(target, nil)
+
+		role := models.RoleOperator
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("PATCH", "/api/v1/users/"+target.ID.Hex(), models.UpdateUserRequest{Role: &role}, manager))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("manager can deactivate operator", func(t *testing.T) {
+		mockUsers := new(MockUserCollection)
+		handler := newUserHandlerWithRevocation(authService, mockUsers)
+
+		target := &models.User{ID: primitive.NewObjectID(), TenantID: "tenant-a", Role: models.RoleOperator, IsActive: true}
+		mockUsers.On("FindUserByID", mock.Anything, target.ID.Hex()).Return(target, nil)
+		mockUsers.On("UpdateUser", mock.Anything, target.ID.Hex(), mock.MatchedBy(func(u models.User) bool {
+			return !u.IsActive
+		})).Return(nil)
+
+		inactive := false
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("PATCH", "/api/v1/users/"+target.ID.Hex(), models.UpdateUserRequest{IsActive: &inactive}, manager))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockUsers.AssertExpectations(t)
+	})
+}
+
+func TestUserHandler_DeleteUser(t *testing.T) {
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	admin := &models.Claims{UserID: primitive.NewObjectID().Hex(), Role: models.RoleAdmin, TenantID: "tenant-a"}
+
+	t.Run("deletes user", func(t *testing.T) {
+		mockUsers := new(MockUserCollection)
+		handler := newUserHandlerWithRevocation(authService, mockUsers)
+
+		target := &models.User{ID: primitive.NewObjectID(), TenantID: "tenant-a", Role: models.RoleViewer, IsActive: true}
+		mockUsers.On("FindUserByID", mock.Anything, target.ID.Hex()).Return(target, nil)
+		mockUsers.On("DeleteUser", mock.Anything, target.ID.Hex()).Return(nil)
+
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("DELETE", "/api/v1/users/"+target.ID.Hex(), nil, admin))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockUsers.AssertExpectations(t)
+	})
+
+	t.Run("manager cannot delete", func(t *testing.T) {
+		handler := newUserHandlerWithRevocation(authService, new(MockUserCollection))
+		manager := &models.Claims{UserID: primitive.NewObjectID().Hex(), Role: models.RoleManager, TenantID: "tenant-a"}
+
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("DELETE", "/api/v1/users/"+primitive.NewObjectID().Hex(), nil, manager))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestUserHandler_ResetPassword(t *testing.T) {
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	admin := &models.Claims{UserID: primitive.NewObjectID().Hex(), Role: models.RoleAdmin, TenantID: "tenant-a"}
+
+	mockUsers := new(MockUserCollection)
+	handler := newUserHandlerWithRevocation(authService, mockUsers)
+
+	target := &models.User{ID: primitive.NewObjectID(), TenantID: "tenant-a", Role: models.RoleOperator, IsActive: true, PasswordHash: "old"}
+	mockUsers.On("FindUserByID", mock.Anything, target.ID.Hex()).Return(target, nil)
+	var saved models.User
+	mockUsers.On("UpdateUser", mock.Anything, target.ID.Hex(), mock.AnythingOfType("models.User")).
+		Run(func(args mock.Arguments) { saved = args.Get(2).(models.User) }).Return(nil)
+
+	w := httptest.NewRecorder()
+	routed(handler).ServeHTTP(w, newUserAdminRequest("POST", "/api/v1/users/"+target.ID.Hex()+"/password", nil, admin))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response models.ResetPasswordResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NotEmpty(t, response.TemporaryPassword)
+	assert.True(t, authService.CheckPassword(response.TemporaryPassword, saved.PasswordHash))
+}
+
+func TestUserHandler_UnlockUser(t *testing.T) {
+	authService, err := auth.NewService()
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	admin := &models.Claims{UserID: primitive.NewObjectID().Hex(), Role: models.RoleAdmin, TenantID: "tenant-a"}
+
+	t.Run("admin unlocks user", func(t *testing.T) {
+		mockUsers := new(MockUserCollection)
+		auditLog := db.NewMemoryAuditLog()
+		throttle := newLoginThrottle()
+		handler := NewUserHandler(authService, mockUsers, new(MockRefreshTokenCollection), db.NewMemoryRevocationStore(), throttle, auditLog)
+
+		lockedUntil := time.Now().Add(time.Hour)
+		target := &models.User{ID: primitive.NewObjectID(), TenantID: "tenant-a", Username: "Locked", Role: models.RoleOperator, LockedUntil: &lockedUntil}
+		mockUsers.On("FindUserByID", mock.Anything, target.ID.Hex()).Return(target, nil)
+		mockUsers.On("UnlockUser", mock.Anything, target.ID.Hex()).Return(nil)
+		for i := 0; i < 10; i++ {
+			throttle.RecordFailure("user:locked")
+		}
+
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("POST", "/api/v1/users/"+target.ID.Hex()+"/unlock", nil, admin))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockUsers.AssertExpectations(t)
+		assert.Zero(t, throttle.RetryAfter("user:locked"))
+		events := auditLog.Events()
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, models.AuditAccountUnlocked, events[0].Action)
+			assert.Equal(t, admin.UserID, events[0].ActorID)
+		}
+	})
+
+	t.Run("manager cannot unlock", func(t *testing.T) {
+		handler := newUserHandlerWithRevocation(authService, new(MockUserCollection))
+		manager := &models.Claims{UserID: primitive.NewObjectID().Hex(), Role: models.RoleManager, TenantID: "tenant-a"}
+
+		w := httptest.NewRecorder()
+		routed(handler).ServeHTTP(w, newUserAdminRequest("POST", "/api/v1/users/"+primitive.NewObjectID().Hex()+"/unlock", nil, manager))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
@@ -0,0 +1,58 @@
+// Package logging carries a request-scoped logger in the context, so that
+// every log line of a request or MQTT message shares its correlation ID.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader is the header a request ID is read from and echoed in
+const RequestIDHeader = "X-Request-ID"
+
+// loggerKey is the context key for the request-scoped logger
+type loggerKey struct{}
+
+// requestIDPattern restricts propagated request IDs to values safe in log lines
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// NewRequestID returns a random 128-bit correlation ID
+func NewRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ValidRequestID reports whether a request ID sent by a client can be kept
+func ValidRequestID(id string) bool {
+	return requestIDPattern.MatchString(id)
+}
+
+// WithLogger returns ctx carrying logger
+func WithLogger(ctx context.Context, logger *log.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// WithFields returns ctx whose logger has the given fields added
+func WithFields(ctx context.Context, fields log.Fields) context.Context {
+	return WithLogger(ctx, FromContext(ctx).WithFields(fields))
+}
+
+// FromContext returns the logger of ctx, or the standard logger when ctx has
+// none, e.g. in background jobs
+func FromContext(ctx context.Context) *log.Entry {
+	if logger, ok := ctx.Value(loggerKey{}).(*log.Entry); ok {
+		return logger
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// RequestID returns the correlation ID logged with ctx, if it has one
+func RequestID(ctx context.Context) string {
+	id, _ := FromContext(ctx).Data["request_id"].(string)
+	return id
+}
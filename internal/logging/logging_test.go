@@ -0,0 +1,31 @@
+package logging
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromContext(t *testing.T) {
+	ctx := context.Background()
+	assert.NotNil(t, FromContext(ctx), "contexts without a logger use the standard logger")
+	assert.Empty(t, RequestID(ctx))
+
+	ctx = WithLogger(ctx, log.WithField("request_id", "req-1"))
+	ctx = WithFields(ctx, log.Fields{"tenant_id": "tenant-a"})
+	assert.Equal(t, "req-1", RequestID(ctx))
+	assert.Equal(t, "tenant-a", FromContext(ctx).Data["tenant_id"])
+}
+
+func TestRequestID(t *testing.T) {
+	id := NewRequestID()
+	assert.Len(t, id, 32)
+	assert.NotEqual(t, id, NewRequestID())
+	assert.True(t, ValidRequestID(id))
+	assert.True(t, ValidRequestID("trace-abc.123:4"))
+	assert.False(t, ValidRequestID(""))
+	assert.False(t, ValidRequestID("line\nbreak"))
+	assert.False(t, ValidRequestID(string(make([]byte, 129))))
+}
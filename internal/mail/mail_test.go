@@ -0,0 +1,68 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.out")
+	sender := NewFileSender(path, "fleet@example.com")
+
+	assert.NoError(t, sender.Send(context.Background(), Message{To: "a@example.com", Subject: "First", Body: "line one\nline two"}))
+	assert.NoError(t, sender.Send(context.Background(), Message{To: "b@example.com", Subject: "Second", Body: "hello"}))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	content := string(data)
+	assert.Contains(t, content, "From: fleet@example.com\r\n")
+	assert.Contains(t, content, "To: a@example.com\r\n")
+	assert.Contains(t, content, "Subject: Second\r\n")
+	assert.Contains(t, content, "line one\r\nline two")
+	assert.Equal(t, 2, strings.Count(content, "MIME-Version"))
+}
+
+func TestMemorySender(t *testing.T) {
+	sender := NewMemorySender()
+	assert.NoError(t, sender.Send(context.Background(), Message{To: "a@example.com", Subject: "Hi"}))
+
+	messages := sender.Messages()
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "a@example.com", messages[0].To)
+}
+
+func TestNewSenderFromEnv(t *testing.T) {
+	t.Run("defaults to log", func(t *testing.T) {
+		t.Setenv("MAIL_TRANSPORT", "")
+		sender, err := NewSenderFromEnv()
+		assert.NoError(t, err)
+		assert.IsType(t, &LogSender{}, sender)
+	})
+
+	t.Run("smtp requires host", func(t *testing.T) {
+		t.Setenv("MAIL_TRANSPORT", "smtp")
+		t.Setenv("SMTP_HOST", "")
+		_, err := NewSenderFromEnv()
+		assert.Error(t, err)
+	})
+
+	t.Run("smtp", func(t *testing.T) {
+		t.Setenv("MAIL_TRANSPORT", "smtp")
+		t.Setenv("SMTP_HOST", "localhost")
+		t.Setenv("SMTP_PORT", "1025")
+		sender, err := NewSenderFromEnv()
+		assert.NoError(t, err)
+		assert.Equal(t, "localhost:1025", sender.(*SMTPSender).Addr)
+	})
+
+	t.Run("unknown transport", func(t *testing.T) {
+		t.Setenv("MAIL_TRANSPORT", "pigeon")
+		_, err := NewSenderFromEnv()
+		assert.Error(t, err)
+	})
+}
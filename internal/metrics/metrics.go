@@ -0,0 +1,49 @@
+// Package metrics declares the service's Prometheus collectors. They are
+// registered with the default registry, which promhttp.Handler serves on
+// /metrics together with the Go runtime and process collectors.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DefaultBuckets are latency histogram buckets in seconds, from 5ms to 10s
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var (
+	// HTTPRequestDuration is the latency of API requests by the route pattern
+	// that served them, so that IDs in paths do not create new series
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fleet_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by route pattern, method and status code.",
+		Buckets: DefaultBuckets,
+	}, []string{"route", "method", "code"})
+
+	// TelemetryIngested counts telemetry records received per source (http,
+	// mqtt) and outcome (stored, invalid, rejected, error)
+	TelemetryIngested = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fleet_telemetry_ingested_total",
+		Help: "Telemetry records received by source and outcome.",
+	}, []string{"source", "outcome"})
+
+	// StreamClients is the number of live telemetry subscribers per transport (sse, ws)
+	StreamClients = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fleet_stream_clients",
+		Help: "Connected live telemetry clients by transport.",
+	}, []string{"transport"})
+
+	// BroadcastsDropped counts telemetry events skipped because a subscriber
+	// was too slow to keep up
+	BroadcastsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fleet_stream_broadcasts_dropped_total",
+		Help: "Telemetry events not delivered to a live client because its buffer was full.",
+	}, []string{"transport"})
+
+	// MongoCommandDuration is the latency of MongoDB commands
+	MongoCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fleet_mongo_command_duration_seconds",
+		Help:    "Latency of MongoDB commands by command name and outcome.",
+		Buckets: DefaultBuckets,
+	}, []string{"command", "outcome"})
+)
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectors_Lint(t *testing.T) {
+	for _, collector := range []prometheus.Collector{HTTPRequestDuration, TelemetryIngested, StreamClients, BroadcastsDropped, MongoCommandDuration} {
+		problems, err := testutil.CollectAndLint(collector)
+		require.NoError(t, err)
+		assert.Empty(t, problems)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	TelemetryIngested.WithLabelValues("http", `quoted "outcome"`).Inc()
+	HTTPRequestDuration.WithLabelValues("/api/v1/vehicles", "GET", "200").Observe(0.05)
+
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	assert.Contains(t, body, "# TYPE fleet_http_request_duration_seconds histogram")
+	assert.Contains(t, body, `fleet_http_request_duration_seconds_bucket{code="200",method="GET",route="/api/v1/vehicles",le="+Inf"} 1`)
+	assert.Contains(t, body, `fleet_telemetry_ingested_total{outcome="quoted \"outcome\"",source="http"} 1`)
+	assert.Contains(t, body, "go_goroutines ", "runtime metrics are exposed too")
+}
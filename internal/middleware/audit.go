@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+)
+
+// auditContextKey is the request context key for the audit record of a request
+const auditContextKey contextKey = "audit"
+
+// auditWriteTimeout bounds recording an audit event after the response is written
+const auditWriteTimeout = 5 * time.Second
+
+// auditRecord collects what a handler reports about the change it made
+type auditRecord struct {
+	mu      sync.Mutex
+	targets []string
+	before  map[string]interface{}
+	after   map[string]interface{}
+	details map[string]interface{}
+}
+
+// AuditMiddleware records every mutating API call to the audit log
+type AuditMiddleware struct {
+	auditLog db.AuditLog
+}
+
+// NewAuditMiddleware creates a middleware recording API calls to auditLog
+func NewAuditMiddleware(auditLog db.AuditLog) *AuditMiddleware {
+	return &AuditMiddleware{auditLog: auditLog}
+}
+
+// Audit records POST, PUT, PATCH and DELETE requests once the handler has
+// finished, with the caller, route, response status and client IP plus the
+// targets and changes the handler reported through AuditTarget, AuditChange
+// and AuditDetail. It must run after Authenticate.
+func (m *AuditMiddleware) Audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		record := &auditRecord{}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), auditContextKey, record)))
+
+		event := models.AuditEvent{
+			Action:    models.AuditAPIRequest,
+			Method:    r.Method,
+			Route:     r.URL.Path,
+			Status:    recorder.status,
+			IPAddress: getClientIP(r),
+		}
+		if claims, ok := GetUserFromContext(r.Context()); ok {
+			event.TenantID = claims.TenantID
+			event.ActorID = claims.UserID
+			if claims.IsAPIKey() {
+				event.ActorID = "apikey:" + claims.APIKeyID
+			}
+		}
+		record.mu.Lock()
+		event.TargetIDs = record.targets
+		event.Before = record.before
+		event.After = record.after
+		event.Details = record.details
+		record.mu.Unlock()
+
+		// The client may already be gone; the record must still be written
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), auditWriteTimeout)
+		defer cancel()
+		if err := m.auditLog.Record(ctx, event); err != nil {
+			logging.FromContext(r.Context()).WithError(err).WithFields(log.Fields{"method": r.Method, "route": r.URL.Path}).Error("Failed to record API call in audit log")
+		}
+	})
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+// WriteHeader records the status code
+func (s *statusRecorder) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.status = code
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Flush lets streaming handlers such as SSE flush through the recorder
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades take over the connection, recorded as 101
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	s.status, s.wroteHeader = http.StatusSwitchingProtocols, true
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// auditRecordFrom returns the audit record of the request, if it is being audited
+func auditRecordFrom(ctx context.Context) (*auditRecord, bool) {
+	record, ok := ctx.Value(auditContextKey).(*auditRecord)
+	return record, ok
+}
+
+// AuditTarget adds the IDs of the resources the request acts on to its audit record
+func AuditTarget(ctx context.Context, ids ...string) {
+	if record, ok := auditRecordFrom(ctx); ok {
+		record.mu.Lock()
+		record.targets = append(record.targets, ids...)
+		record.mu.Unlock()
+	}
+}
+
+// AuditChange adds a changed resource to the audit record of the request. before
+// is nil for creations and after is nil for deletions; for updates only the
+// fields that differ are kept. Values are recorded in their JSON form, so
+// fields hidden from JSON, such as password hashes, never reach the log.
+func AuditChange(ctx context.Context, id string, before, after interface{}) {
+	record, ok := auditRecordFrom(ctx)
+	if !ok {
+		return
+	}
+	beforeFields, afterFields := jsonFields(before), jsonFields(after)
+	if beforeFields != nil && afterFields != nil {
+		for key, value := range beforeFields {
+			if other, ok := afterFields[key]; ok && reflect.DeepEqual(value, other) {
+				delete(beforeFields, key)
+				delete(afterFields, key)
+			}
+		}
+	}
+
+	record.mu.Lock()
+	defer record.mu.Unlock()
+	record.targets = append(record.targets, id)
+	record.before = beforeFields
+	record.after = afterFields
+}
+
+// AuditDetail adds a free-form value, such as the number of deleted records, to the audit record of the request
+func AuditDetail(ctx context.Context, key string, value interface{}) {
+	if record, ok := auditRecordFrom(ctx); ok {
+		record.mu.Lock()
+		if record.details == nil {
+			record.details = map[string]interface{}{}
+		}
+		record.details[key] = value
+		record.mu.Unlock()
+	}
+}
+
+// jsonFields returns the JSON object form of v, or nil when v is nil or not an object
+func jsonFields(v interface{}) map[string]interface{} {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+)
+
+func TestAuditMiddleware_Audit(t *testing.T) {
+	claims := &models.Claims{UserID: "user-1", Username: "alice", TenantID: "tenant-a", Role: models.RoleAdmin}
+	withClaims := func(r *http.Request, claims *models.Claims) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), UserContextKey, claims))
+	}
+
+	t.Run("records writes with caller, route, status and changes", func(t *testing.T) {
+		auditLog := db.NewMemoryAuditLog()
+		before := models.Vehicle{Make: "Volvo", Model: "FH16", Year: 2020, Status: "active"}
+		after := models.Vehicle{Make: "Volvo", Model: "FH16", Year: 2021, Status: "inactive"}
+		handler := NewAuditMiddleware(auditLog).Audit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			AuditChange(r.Context(), "vehicle-1", before, &after)
+			AuditDetail(r.Context(), "reason", "sold")
+			w.WriteHeader(http.StatusAccepted)
+		}))
+
+		proxies, _ := ParseTrustedProxies("192.0.2.1, 10.0.0.0/8")
+		SetTrustedProxies(proxies)
+		t.Cleanup(func() { SetTrustedProxies(nil) })
+		req := withClaims(httptest.NewRequest("PUT", "/api/vehicles/vehicle-1", nil), claims)
+		req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		events := auditLog.Events()
+		assert.Len(t, events, 1)
+		event := events[0]
+		assert.Equal(t, models.AuditAPIRequest, event.Action)
+		assert.Equal(t, "tenant-a", event.TenantID)
+		assert.Equal(t, "user-1", event.ActorID)
+		assert.Equal(t, "PUT", event.Method)
+		assert.Equal(t, "/api/vehicles/vehicle-1", event.Route)
+		assert.Equal(t, http.StatusAccepted, event.Status)
+		assert.Equal(t, "203.0.113.7", event.IPAddress)
+		assert.Equal(t, []string{"vehicle-1"}, event.TargetIDs)
+		// Only the changed fields are kept
+		assert.Equal(t, map[string]interface{}{"year": float64(2020), "status": "active"}, event.Before)
+		assert.Equal(t, map[string]interface{}{"year": float64(2021), "status": "inactive"}, event.After)
+		assert.Equal(t, "sold", event.Details["reason"])
+	})
+
+	t.Run("deletions keep the whole record without hidden fields", func(t *testing.T) {
+		auditLog := db.NewMemoryAuditLog()
+		user := &models.User{Username: "bob", PasswordHash: "secret-hash", MFASecret: "totp-secret"}
+		handler := NewAuditMiddleware(auditLog).Audit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			AuditChange(r.Context(), "user-2", user, nil)
+		}))
+
+		handler.ServeHTTP(httptest.NewRecorder(), withClaims(httptest.NewRequest("DELETE", "/api/users/user-2", nil), claims))
+
+		event := auditLog.Events()[0]
+		assert.Equal(t, http.StatusOK, event.Status)
+		assert.Equal(t, "bob", event.Before["username"])
+		assert.NotContains(t, event.Before, "password_hash")
+		assert.NotContains(t, event.Before, "mfa_secret")
+		assert.Nil(t, event.After)
+	})
+
+	t.Run("API key callers are identified by key", func(t *testing.T) {
+		auditLog := db.NewMemoryAuditLog()
+		handler := NewAuditMiddleware(auditLog).Audit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		}))
+
+		keyClaims := &models.Claims{TenantID: "tenant-a", APIKeyID: "key-1", Scopes: []string{models.ScopeTelemetryWrite}}
+		handler.ServeHTTP(httptest.NewRecorder(), withClaims(httptest.NewRequest("DELETE", "/api/trips", nil), keyClaims))
+
+		event := auditLog.Events()[0]
+		assert.Equal(t, "apikey:key-1", event.ActorID)
+		assert.Equal(t, http.StatusForbidden, event.Status)
+	})
+
+	t.Run("reads are not recorded", func(t *testing.T) {
+		auditLog := db.NewMemoryAuditLog()
+		handlerCalled := false
+		handler := NewAuditMiddleware(auditLog).Audit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlerCalled = true
+			// Annotations outside an audited request are ignored
+			AuditTarget(r.Context(), "trip-1")
+		}))
+
+		handler.ServeHTTP(httptest.NewRecorder(), withClaims(httptest.NewRequest("GET", "/api/trips", nil), claims))
+
+		assert.True(t, handlerCalled)
+		assert.Empty(t, auditLog.Events())
+	})
+}
@@ -2,13 +2,21 @@ package middleware
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/ukydev/fleet-sustainability/internal/auth"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
 	"github.com/ukydev/fleet-sustainability/internal/models"
+	"github.com/ukydev/fleet-sustainability/internal/problem"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // contextKey is a custom type for context keys to avoid collisions
@@ -19,19 +27,29 @@ const (
 	UserContextKey contextKey = "user"
 )
 
-// AuthMiddleware provides JWT authentication middleware
+// apiKeyTouchInterval limits how often an API key's last-used time is written
+const apiKeyTouchInterval = time.Minute
+
+// AuthMiddleware provides JWT and API key authentication middleware
 type AuthMiddleware struct {
 	authService *auth.Service
+	revocations db.RevocationStore
+	apiKeys     db.APIKeyStore
+	tenants     db.TenantStore
 }
 
 // NewAuthMiddleware creates a new authentication middleware
-func NewAuthMiddleware(authService *auth.Service) *AuthMiddleware {
+func NewAuthMiddleware(authService *auth.Service, revocations db.RevocationStore, apiKeys db.APIKeyStore, tenants db.TenantStore) *AuthMiddleware {
 	return &AuthMiddleware{
 		authService: authService,
+		revocations: revocations,
+		apiKeys:     apiKeys,
+		tenants:     tenants,
 	}
 }
 
-// Authenticate validates JWT tokens and adds user context
+// Authenticate validates JWT tokens or API keys and adds user context. API
+// keys are accepted via X-API-Key or "Authorization: ApiKey <key>".
 func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Skip authentication for certain endpoints
@@ -40,23 +58,180 @@ func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		if key := apiKeyFromRequest(r); key != "" {
+			claims, status, message := m.authenticateAPIKey(r.Context(), key)
+			if claims == nil {
+				problem.Error(w, r, status, problem.CodeFor(status), message)
+				return
+			}
+			if status, message := CheckTenant(r.Context(), m.tenants, claims.TenantID); status != http.StatusOK {
+				problem.Error(w, r, status, problem.CodeFor(status), message)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+			return
+		}
+
 		// Extract token from Authorization header
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization header required")
 			return
 		}
 
 		// Validate token
 		claims, err := m.authService.ValidateToken(authHeader)
 		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid token")
+			return
+		}
+
+		// Reject tokens revoked by logout; fail closed if the store is unreachable
+		revoked, err := m.revocations.IsRevoked(r.Context(), claims.JTI, claims.UserID, time.Unix(claims.IssuedAt, 0))
+		if err != nil {
+			problem.Error(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "Failed to verify token")
+			return
+		}
+		if revoked {
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeTokenRevoked, "Token has been revoked")
+			return
+		}
+		if status, message := CheckTenant(r.Context(), m.tenants, claims.TenantID); status != http.StatusOK {
+			problem.Error(w, r, status, problem.CodeFor(status), message)
+			return
+		}
+
+        // Add user context to request (includes tenant scope)
+		next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+	})
+}
+
+// withClaims adds the caller to ctx, its logger and its trace span and
+// confines its data queries to the caller's tenant
+func withClaims(ctx context.Context, claims *models.Claims) context.Context {
+	ctx = context.WithValue(ctx, UserContextKey, claims)
+	ctx = logCaller(ctx, claims)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("tenant.id", claims.TenantID))
+	return db.WithTenant(ctx, claims.TenantID)
+}
+
+// authenticateAPIKey resolves an API key to claims carrying its tenant and
+// scopes. On failure it returns nil claims with the status and message to send.
+func (m *AuthMiddleware) authenticateAPIKey(ctx context.Context, key string) (*models.Claims, int, string) {
+	prefix, err := m.authService.ParseAPIKey(key)
+	if err != nil {
+		return nil, http.StatusUnauthorized, "Invalid API key"
+	}
+	stored, err := m.apiKeys.FindAPIKeyByPrefix(ctx, prefix)
+	if errors.Is(err, db.ErrAPIKeyNotFound) {
+		return nil, http.StatusUnauthorized, "Invalid API key"
+	}
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, "Failed to verify API key"
+	}
+
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(stored.SecretHash), []byte(m.authService.HashAPIKey(key))) != 1 || !stored.IsActive(now) {
+		return nil, http.StatusUnauthorized, "Invalid API key"
+	}
+
+	if stored.LastUsedAt == nil || now.Sub(*stored.LastUsedAt) > apiKeyTouchInterval {
+		if err := m.apiKeys.TouchAPIKey(ctx, stored.ID.Hex(), now); err != nil {
+			logging.FromContext(ctx).WithError(err).WithField("api_key_id", stored.ID.Hex()).Warn("Failed to record API key use")
+		}
+	}
+
+	claims := &models.Claims{
+		Username: "apikey:" + stored.Name,
+		TenantID: stored.TenantID,
+		IssuedAt: stored.CreatedAt.Unix(),
+		APIKeyID: stored.ID.Hex(),
+		Scopes:   stored.Scopes,
+	}
+	if stored.ExpiresAt != nil {
+		claims.Exp = stored.ExpiresAt.Unix()
+	}
+	return claims, http.StatusOK, ""
+}
+
+// CheckTenant refuses credentials of unknown or suspended tenants, failing
+// closed if the tenant store is unreachable. Platform accounts carry no
+// tenant. It returns http.StatusOK, or the status and message to send.
+func CheckTenant(ctx context.Context, tenants db.TenantStore, tenantID string) (int, string) {
+	if tenantID == "" {
+		return http.StatusOK, ""
+	}
+	tenant, err := tenants.FindTenantByID(ctx, tenantID)
+	if errors.Is(err, db.ErrTenantNotFound) {
+		return http.StatusForbidden, "Tenant not found"
+	}
+	if err != nil {
+		return http.StatusServiceUnavailable, "Failed to verify tenant"
+	}
+	if !tenant.IsActive() {
+		return http.StatusForbidden, "Tenant is suspended"
+	}
+	return http.StatusOK, ""
+}
+
+// apiKeyFromRequest returns the API key sent with the request, if any
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if scheme, key, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "ApiKey") {
+		return strings.TrimSpace(key)
+	}
+	return ""
+}
+
+// TokenFromQuery lets clients that cannot set headers, such as browser
+// EventSource and WebSocket connections, send their bearer token in the
+// access_token query parameter of a GET request
+func TokenFromQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		token := query.Get("access_token")
+		if r.Method == http.MethodGet && token != "" {
+			// Keep the token out of handlers and logs that see the URL
+			query.Del("access_token")
+			r = r.Clone(r.Context())
+			r.URL.RawQuery = query.Encode()
+			r.RequestURI = r.URL.RequestURI()
+			if r.Header.Get("Authorization") == "" {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AuthenticateOptional validates credentials only when the request carries
+// them; anonymous requests pass through without user context
+func (m *AuthMiddleware) AuthenticateOptional(next http.Handler) http.Handler {
+	authenticated := m.Authenticate(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" && r.Header.Get("X-API-Key") == "" {
+			next.ServeHTTP(w, r)
 			return
 		}
+		authenticated.ServeHTTP(w, r)
+	})
+}
 
-        // Add user context to request (includes tenant)
-        ctx := context.WithValue(r.Context(), UserContextKey, claims)
-		next.ServeHTTP(w, r.WithContext(ctx))
+// RequireUser middleware rejects API keys on endpoints that act on the caller's own account
+func (m *AuthMiddleware) RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(UserContextKey).(*models.Claims)
+		if !ok {
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User context not found")
+			return
+		}
+		if claims.IsAPIKey() {
+			problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "API keys cannot access this endpoint")
+			return
+		}
+		next.ServeHTTP(w, r)
 	})
 }
 
@@ -66,12 +241,12 @@ func (m *AuthMiddleware) RequireRole(requiredRole models.Role) func(http.Handler
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			claims, ok := r.Context().Value(UserContextKey).(*models.Claims)
 			if !ok {
-				http.Error(w, "User context not found", http.StatusUnauthorized)
+				problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User context not found")
 				return
 			}
 
 			if claims.Role != requiredRole && claims.Role != models.RoleAdmin {
-				http.Error(w, "Insufficient permissions", http.StatusForbidden)
+				problem.Error(w, r, http.StatusForbidden, problem.CodeInsufficientPermissions, "Insufficient permissions")
 				return
 			}
 
@@ -86,17 +261,12 @@ func (m *AuthMiddleware) RequirePermission(requiredAction string) func(http.Hand
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			claims, ok := r.Context().Value(UserContextKey).(*models.Claims)
 			if !ok {
-				http.Error(w, "User context not found", http.StatusUnauthorized)
+				problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "User context not found")
 				return
 			}
 
-			// Create a temporary user object to check permissions
-			user := &models.User{
-				Role: claims.Role,
-			}
-
-			if !user.HasPermission(requiredAction) {
-				http.Error(w, "Insufficient permissions", http.StatusForbidden)
+			if !claims.HasPermission(requiredAction) {
+				problem.Error(w, r, http.StatusForbidden, problem.CodeInsufficientPermissions, "Insufficient permissions")
 				return
 			}
 
@@ -105,6 +275,24 @@ func (m *AuthMiddleware) RequirePermission(requiredAction string) func(http.Hand
 	}
 }
 
+// MethodPermissions maps HTTP methods of a route to the permission they require
+type MethodPermissions map[string]string
+
+// RequireMethodPermissions middleware checks the permission required by the
+// request method; methods missing from the table are rejected
+func (m *AuthMiddleware) RequireMethodPermissions(permissions MethodPermissions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requiredAction, ok := permissions[r.Method]
+			if !ok {
+				problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+				return
+			}
+			m.RequirePermission(requiredAction)(next).ServeHTTP(w, r)
+		})
+	}
+}
+
 // GetUserFromContext extracts user claims from request context
 func GetUserFromContext(ctx context.Context) (*models.Claims, bool) {
 	claims, ok := ctx.Value(UserContextKey).(*models.Claims)
@@ -115,9 +303,9 @@ func GetUserFromContext(ctx context.Context) (*models.Claims, bool) {
 func shouldSkipAuth(path string) bool {
 	// Skip auth for login and register endpoints
 	skipPaths := []string{
-		"/api/auth/login",
-		"/api/auth/register",
-		"/api/auth/refresh",
+		"/api/v1/auth/login",
+		"/api/v1/auth/register",
+		"/api/v1/auth/refresh",
 		"/health",
 		"/metrics",
 	}
@@ -130,75 +318,93 @@ func shouldSkipAuth(path string) bool {
 	return false
 }
 
-// RateLimitMiddleware provides basic rate limiting
-type RateLimitMiddleware struct {
-	requests map[string][]int64 // IP -> timestamps
-	mu       sync.RWMutex       // Mutex for thread-safe access
-}
-
-// NewRateLimitMiddleware creates a new rate limiting middleware
-func NewRateLimitMiddleware() *RateLimitMiddleware {
-	return &RateLimitMiddleware{
-		requests: make(map[string][]int64),
-	}
-}
-
-// RateLimit applies rate limiting based on IP address
-func (m *RateLimitMiddleware) RateLimit(maxRequests int, windowSeconds int) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get client IP
-			clientIP := getClientIP(r)
-
-			// Clean old requests outside the window
-			now := time.Now().Unix()
-			windowStart := now - int64(windowSeconds)
-
-			// Use write lock for map operations
-			m.mu.Lock()
-
-			if timestamps, exists := m.requests[clientIP]; exists {
-				var validTimestamps []int64
-				for _, ts := range timestamps {
-					if ts >= windowStart {
-						validTimestamps = append(validTimestamps, ts)
-					}
-				}
-				m.requests[clientIP] = validTimestamps
+// trustedProxies are the networks of reverse proxies whose forwarding
+// headers are believed; see SetTrustedProxies
+var trustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses a comma-separated list of IP addresses and CIDR
+// ranges, such as the TRUSTED_PROXIES setting
+func ParseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
 			}
-
-			// Check if rate limit exceeded
-			if len(m.requests[clientIP]) >= maxRequests {
-				m.mu.Unlock()
-				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
-				return
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
 			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
 
-			// Add current request
-			m.requests[clientIP] = append(m.requests[clientIP], now)
-
-			// Release lock
-			m.mu.Unlock()
+// SetTrustedProxies sets the reverse proxies whose X-Forwarded-For and
+// X-Real-IP headers ClientIP believes. It is meant to be called once at startup.
+func SetTrustedProxies(networks []*net.IPNet) {
+	trustedProxies = networks
+}
 
-			next.ServeHTTP(w, r)
-		})
-	}
+// ClientIP returns the client IP address for a request
+func ClientIP(r *http.Request) string {
+	return getClientIP(r)
 }
 
-// getClientIP extracts the client IP from the request
+// getClientIP extracts the client IP from the request. Forwarding headers
+// are only used when the request comes from a trusted proxy; the client is
+// then the last address in X-Forwarded-For that is not a trusted proxy.
 func getClientIP(r *http.Request) string {
-	// Check for forwarded headers first
-	if ip := r.Header.Get("X-Forwarded-For"); ip != "" {
-		return strings.Split(ip, ",")[0]
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
 	}
-	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+	if !isTrustedProxy(ip) {
 		return ip
 	}
 
-	// Fall back to remote address
-	ip := r.RemoteAddr
-	if colonIndex := strings.LastIndex(ip, ":"); colonIndex != -1 {
-		ip = ip[:colonIndex]
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			ip = hop
+			if !isTrustedProxy(hop) {
+				return hop
+			}
+		}
+		return ip
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
 	}
 	return ip
 }
+
+// isTrustedProxy reports whether ip belongs to a trusted proxy
+func isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -5,16 +5,18 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/ukydev/fleet-sustainability/internal/auth"
+	"github.com/ukydev/fleet-sustainability/internal/db"
 	"github.com/ukydev/fleet-sustainability/internal/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestAuthMiddleware_Authenticate(t *testing.T) {
 	authService, _ := auth.NewService()
-	middleware := NewAuthMiddleware(authService)
+	middleware := NewAuthMiddleware(authService, db.NewMemoryRevocationStore(), db.NewMemoryAPIKeyStore(), db.NewMemoryTenantStore())
 
 	// Test successful authentication
 	t.Run("valid token", func(t *testing.T) {
@@ -76,7 +78,7 @@ func TestAuthMiddleware_Authenticate(t *testing.T) {
 
 	// Test skip auth paths
 	t.Run("skip auth path", func(t *testing.T) {
-		req := httptest.NewRequest("POST", "/api/auth/login", nil)
+		req := httptest.NewRequest("POST", "/api/v1/auth/login", nil)
 		w := httptest.NewRecorder()
 
 		handlerCalled := false
@@ -90,9 +92,243 @@ func TestAuthMiddleware_Authenticate(t *testing.T) {
 	})
 }
 
+func TestAuthMiddleware_Authenticate_Revoked(t *testing.T) {
+	authService, _ := auth.NewService()
+	user := &models.User{
+		ID:       primitive.NewObjectID(),
+		Username: "testuser",
+		Role:     models.RoleAdmin,
+	}
+
+	serve := func(m *AuthMiddleware, token string) (int, bool) {
+		req := httptest.NewRequest("GET", "/api/telemetry", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handlerCalled := false
+		m.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlerCalled = true
+		})).ServeHTTP(w, req)
+		return w.Code, handlerCalled
+	}
+
+	t.Run("revoked token", func(t *testing.T) {
+		store := db.NewMemoryRevocationStore()
+		middleware := NewAuthMiddleware(authService, store, db.NewMemoryAPIKeyStore(), db.NewMemoryTenantStore())
+		token, _ := authService.GenerateToken(user)
+		claims, _ := authService.ValidateToken(token)
+
+		code, called := serve(middleware, token)
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, called)
+
+		store.RevokeToken(context.Background(), claims.JTI, time.Unix(claims.Exp, 0))
+
+		code, called = serve(middleware, token)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.False(t, called)
+	})
+
+	t.Run("user-wide revocation", func(t *testing.T) {
+		store := db.NewMemoryRevocationStore()
+		middleware := NewAuthMiddleware(authService, store, db.NewMemoryAPIKeyStore(), db.NewMemoryTenantStore())
+		token, _ := authService.GenerateToken(user)
+
+		store.RevokeUserTokens(context.Background(), user.ID.Hex(), time.Now(), time.Now().Add(time.Hour))
+
+		code, called := serve(middleware, token)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.False(t, called)
+	})
+}
+
+func TestAuthMiddleware_Authenticate_Tenant(t *testing.T) {
+	authService, _ := auth.NewService()
+	ctx := context.Background()
+	tenants := db.NewMemoryTenantStore()
+	tenant := models.NewTenant("tenant-a", "Tenant A")
+	tenants.InsertTenant(ctx, tenant)
+	apiKeys := db.NewMemoryAPIKeyStore()
+	middleware := NewAuthMiddleware(authService, db.NewMemoryRevocationStore(), apiKeys, tenants)
+
+	serve := func(header, value string) int {
+		req := httptest.NewRequest("GET", "/api/vehicles", nil)
+		req.Header.Set(header, value)
+		w := httptest.NewRecorder()
+		middleware.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, req)
+		return w.Code
+	}
+	token := func(tenantID string) string {
+		token, _ := authService.GenerateToken(&models.User{ID: primitive.NewObjectID(), Username: "testuser", Role: models.RoleAdmin, TenantID: tenantID})
+		return "Bearer " + token
+	}
+	key, prefix, hash, _ := authService.GenerateAPIKey()
+	apiKeys.InsertAPIKey(ctx, models.APIKey{ID: primitive.NewObjectID(), TenantID: "tenant-a", Name: "gateway", Prefix: prefix, SecretHash: hash, Scopes: []string{models.ScopeVehiclesRead}, CreatedAt: time.Now()})
+
+	assert.Equal(t, http.StatusOK, serve("Authorization", token("tenant-a")))
+	assert.Equal(t, http.StatusOK, serve("X-API-Key", key))
+	assert.Equal(t, http.StatusOK, serve("Authorization", token("")), "platform accounts have no tenant")
+	assert.Equal(t, http.StatusForbidden, serve("Authorization", token("tenant-missing")))
+
+	tenant.Status = models.TenantSuspended
+	tenants.UpdateTenant(ctx, tenant)
+	assert.Equal(t, http.StatusForbidden, serve("Authorization", token("tenant-a")))
+	assert.Equal(t, http.StatusForbidden, serve("X-API-Key", key))
+}
+
+func TestAuthMiddleware_Authenticate_TenantScope(t *testing.T) {
+	authService, _ := auth.NewService()
+	tenants := db.NewMemoryTenantStore()
+	tenants.InsertTenant(context.Background(), models.NewTenant("tenant-a", "Tenant A"))
+	middleware := NewAuthMiddleware(authService, db.NewMemoryRevocationStore(), db.NewMemoryAPIKeyStore(), tenants)
+
+	scope := func(tenantID string) (string, bool) {
+		token, _ := authService.GenerateToken(&models.User{ID: primitive.NewObjectID(), Username: "testuser", Role: models.RoleViewer, TenantID: tenantID})
+		req := httptest.NewRequest("GET", "/api/vehicles", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		var scoped string
+		var ok bool
+		middleware.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scoped, ok = db.TenantFromContext(r.Context())
+		})).ServeHTTP(httptest.NewRecorder(), req)
+		return scoped, ok
+	}
+
+	scoped, ok := scope("tenant-a")
+	assert.True(t, ok)
+	assert.Equal(t, "tenant-a", scoped)
+	scoped, ok = scope("")
+	assert.True(t, ok, "platform accounts are confined to records without a tenant")
+	assert.Empty(t, scoped)
+}
+
+func TestTokenFromQuery(t *testing.T) {
+	var query string
+	serve := func(method, target, authHeader string) string {
+		req := httptest.NewRequest(method, target, nil)
+		if authHeader != "" {
+			req.Header.Set("Authorization", authHeader)
+		}
+		var got string
+		TokenFromQuery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Get("Authorization")
+			query = r.URL.RawQuery
+		})).ServeHTTP(httptest.NewRecorder(), req)
+		return got
+	}
+
+	assert.Equal(t, "Bearer abc", serve("GET", "/api/telemetry/stream?access_token=abc&vehicle=v1", ""))
+	assert.Equal(t, "vehicle=v1", query, "the token is not passed on in the URL")
+	assert.Equal(t, "Bearer header", serve("GET", "/api/telemetry/stream?access_token=abc", "Bearer header"), "headers win")
+	assert.Empty(t, serve("POST", "/api/telemetry/stream?access_token=abc", ""), "only for reads")
+	assert.Empty(t, serve("GET", "/api/telemetry/stream", ""))
+}
+
+func TestAuthMiddleware_AuthenticateOptional(t *testing.T) {
+	authService, _ := auth.NewService()
+	middleware := NewAuthMiddleware(authService, db.NewMemoryRevocationStore(), db.NewMemoryAPIKeyStore(), db.NewMemoryTenantStore())
+	user := &models.User{ID: primitive.NewObjectID(), Username: "testuser", Role: models.RoleViewer}
+	token, _ := authService.GenerateToken(user)
+
+	serve := func(authHeader string) (int, *models.Claims) {
+		req := httptest.NewRequest("POST", "/api/auth/mfa/enroll", nil)
+		if authHeader != "" {
+			req.Header.Set("Authorization", authHeader)
+		}
+		w := httptest.NewRecorder()
+		var claims *models.Claims
+		middleware.AuthenticateOptional(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ = GetUserFromContext(r.Context())
+		})).ServeHTTP(w, req)
+		return w.Code, claims
+	}
+
+	code, claims := serve("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, claims)
+
+	code, claims = serve("Bearer " + token)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.NotNil(t, claims) {
+		assert.Equal(t, user.ID.Hex(), claims.UserID)
+	}
+
+	code, _ = serve("Bearer invalid")
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestAuthMiddleware_Authenticate_APIKey(t *testing.T) {
+	authService, _ := auth.NewService()
+	store := db.NewMemoryAPIKeyStore()
+	tenants := db.NewMemoryTenantStore()
+	tenants.InsertTenant(context.Background(), models.NewTenant("tenant-a", "Tenant A"))
+	middleware := NewAuthMiddleware(authService, db.NewMemoryRevocationStore(), store, tenants)
+
+	issue := func(scopes []string, expiresAt *time.Time) (string, models.APIKey) {
+		key, prefix, hash, _ := authService.GenerateAPIKey()
+		stored := models.APIKey{ID: primitive.NewObjectID(), TenantID: "tenant-a", Name: "gateway", Prefix: prefix, SecretHash: hash, Scopes: scopes, ExpiresAt: expiresAt, CreatedAt: time.Now()}
+		store.InsertAPIKey(context.Background(), stored)
+		return key, stored
+	}
+	serve := func(header, value string) (int, *models.Claims) {
+		req := httptest.NewRequest("POST", "/api/telemetry", nil)
+		req.Header.Set(header, value)
+		w := httptest.NewRecorder()
+		var claims *models.Claims
+		middleware.Authenticate(middleware.RequirePermission(models.PermCreateTelemetry)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ = GetUserFromContext(r.Context())
+		}))).ServeHTTP(w, req)
+		return w.Code, claims
+	}
+
+	key, stored := issue([]string{models.ScopeTelemetryWrite}, nil)
+
+	code, claims := serve("X-API-Key", key)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.NotNil(t, claims) {
+		assert.Equal(t, stored.ID.Hex(), claims.APIKeyID)
+		assert.Equal(t, "tenant-a", claims.TenantID)
+		assert.Empty(t, claims.UserID)
+	}
+	found, _ := store.FindAPIKeyByPrefix(context.Background(), stored.Prefix)
+	assert.NotNil(t, found.LastUsedAt, "use is tracked")
+
+	code, _ = serve("Authorization", "ApiKey "+key)
+	assert.Equal(t, http.StatusOK, code)
+
+	// Scopes are enforced by the permission middleware
+	readOnly, _ := issue([]string{models.ScopeVehiclesRead}, nil)
+	code, _ = serve("X-API-Key", readOnly)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	// Tampered, expired and revoked keys are rejected
+	code, _ = serve("X-API-Key", key+"x")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	expiredAt := time.Now().Add(-time.Minute)
+	expired, _ := issue([]string{models.ScopeTelemetryWrite}, &expiredAt)
+	code, _ = serve("X-API-Key", expired)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	store.RevokeAPIKey(context.Background(), "tenant-a", stored.ID.Hex(), time.Now())
+	code, _ = serve("X-API-Key", key)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestAuthMiddleware_RequireUser(t *testing.T) {
+	middleware := &AuthMiddleware{}
+	serve := func(claims *models.Claims) int {
+		req := httptest.NewRequest("POST", "/api/auth/logout", nil)
+		req = req.WithContext(context.WithValue(req.Context(), UserContextKey, claims))
+		w := httptest.NewRecorder()
+		middleware.RequireUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve(&models.Claims{UserID: "user-id", Role: models.RoleViewer}))
+	assert.Equal(t, http.StatusForbidden, serve(&models.Claims{APIKeyID: "key-id", Scopes: []string{models.ScopeTelemetryRead}}))
+}
+
 func TestAuthMiddleware_RequireRole(t *testing.T) {
 	authService, _ := auth.NewService()
-	middleware := NewAuthMiddleware(authService)
+	middleware := NewAuthMiddleware(authService, db.NewMemoryRevocationStore(), db.NewMemoryAPIKeyStore(), db.NewMemoryTenantStore())
 
 	// Test admin can access manager endpoint
 	t.Run("admin accessing manager endpoint", func(t *testing.T) {
@@ -146,7 +382,7 @@ func TestAuthMiddleware_RequireRole(t *testing.T) {
 
 func TestAuthMiddleware_RequirePermission(t *testing.T) {
 	authService, _ := auth.NewService()
-	middleware := NewAuthMiddleware(authService)
+	middleware := NewAuthMiddleware(authService, db.NewMemoryRevocationStore(), db.NewMemoryAPIKeyStore(), db.NewMemoryTenantStore())
 
 	// Test admin can access any permission
 	t.Run("admin accessing any permission", func(t *testing.T) {
@@ -221,49 +457,45 @@ func TestAuthMiddleware_RequirePermission(t *testing.T) {
 	})
 }
 
-func TestRateLimitMiddleware(t *testing.T) {
-	middleware := NewRateLimitMiddleware()
+func TestAuthMiddleware_RequireMethodPermissions(t *testing.T) {
+	authService, _ := auth.NewService()
+	middleware := NewAuthMiddleware(authService, db.NewMemoryRevocationStore(), db.NewMemoryAPIKeyStore(), db.NewMemoryTenantStore())
+	permissions := MethodPermissions{
+		http.MethodGet:    models.PermViewVehicles,
+		http.MethodDelete: models.PermDeleteVehicle,
+	}
 
-	t.Run("rate limit not exceeded", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/api/test", nil)
-		req.RemoteAddr = "192.168.1.1:12345"
-		w := httptest.NewRecorder()
+	tests := []struct {
+		name     string
+		role     models.Role
+		method   string
+		expected int
+	}{
+		{"viewer can read", models.RoleViewer, http.MethodGet, http.StatusOK},
+		{"viewer cannot delete", models.RoleViewer, http.MethodDelete, http.StatusForbidden},
+		{"manager can delete", models.RoleManager, http.MethodDelete, http.StatusOK},
+		{"unlisted method rejected", models.RoleAdmin, http.MethodPatch, http.StatusMethodNotAllowed},
+	}
 
-		handlerCalled := false
-		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			handlerCalled = true
-		})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &models.User{ID: primitive.NewObjectID(), Username: "user", Role: tt.role}
+			token, _ := authService.GenerateToken(user)
 
-		rateLimitHandler := middleware.RateLimit(5, 60)(handler)
-		rateLimitHandler.ServeHTTP(w, req)
-		assert.True(t, handlerCalled)
-		assert.Equal(t, http.StatusOK, w.Code)
-	})
+			req := httptest.NewRequest(tt.method, "/api/vehicles", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
 
-	t.Run("rate limit exceeded", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/api/test", nil)
-		req.RemoteAddr = "192.168.1.2:12345"
-		w := httptest.NewRecorder()
+			handlerCalled := false
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerCalled = true
+			})
 
-		handlerCalled := false
-		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			handlerCalled = true
+			middleware.Authenticate(middleware.RequireMethodPermissions(permissions)(handler)).ServeHTTP(w, req)
+			assert.Equal(t, tt.expected, w.Code)
+			assert.Equal(t, tt.expected == http.StatusOK, handlerCalled)
 		})
-
-		rateLimitHandler := middleware.RateLimit(1, 60)(handler)
-
-		// First request should succeed
-		rateLimitHandler.ServeHTTP(w, req)
-		assert.True(t, handlerCalled)
-		assert.Equal(t, http.StatusOK, w.Code)
-
-		// Second request should be rate limited
-		w = httptest.NewRecorder()
-		handlerCalled = false
-		rateLimitHandler.ServeHTTP(w, req)
-		assert.False(t, handlerCalled)
-		assert.Equal(t, http.StatusTooManyRequests, w.Code)
-	})
+	}
 }
 
 func TestGetUserFromContext(t *testing.T) {
@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ukydev/fleet-sustainability/internal/auth"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"github.com/ukydev/fleet-sustainability/internal/problem"
+)
+
+// CORSPolicy is the cross-origin policy shared by the REST, SSE and WebSocket
+// endpoints
+type CORSPolicy struct {
+	// AllowedOrigins are exact origins such as https://fleet.example.com,
+	// subdomain wildcards such as https://*.example.com, or "*" for any origin
+	AllowedOrigins   []string
+	AllowCredentials bool
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	MaxAge           time.Duration // how long browsers may cache a preflight
+}
+
+// DefaultCORSPolicy allows the methods and headers the API uses and exposes
+// the rate limit, request ID and pagination headers. It allows no origins.
+var DefaultCORSPolicy = CORSPolicy{
+	AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions},
+	AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key", "X-Request-ID"},
+	ExposedHeaders: []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After", "X-Request-ID", "Link", "X-Next-Cursor"},
+	MaxAge:         10 * time.Minute,
+}
+
+// CORS applies a CORSPolicy, extended by the origins active tenants allow
+type CORS struct {
+	policy    CORSPolicy
+	anyOrigin bool
+	origins   map[string]bool
+	wildcards []string // scheme://. prefix and host suffix of *.domain origins, joined by '*'
+
+	tenants       db.TenantStore
+	refresh       time.Duration
+	mu            sync.Mutex
+	tenantOrigins map[string]bool
+	loadedAt      time.Time
+}
+
+// NewCORS creates a CORS policy. When tenants is not nil the origins of active
+// tenants are allowed too; they are reloaded at most once per refresh.
+func NewCORS(policy CORSPolicy, tenants db.TenantStore, refresh time.Duration) (*CORS, error) {
+	c := &CORS{
+		policy:  policy,
+		origins: make(map[string]bool),
+		tenants: tenants,
+		refresh: refresh,
+	}
+	for _, origin := range policy.AllowedOrigins {
+		switch {
+		case origin == "*":
+			c.anyOrigin = true
+		case strings.Count(origin, "*") > 1:
+			return nil, fmt.Errorf("invalid CORS origin %q", origin)
+		case strings.Contains(origin, "://*."):
+			if !models.ValidOrigin(strings.Replace(origin, "://*.", "://", 1)) {
+				return nil, fmt.Errorf("invalid CORS origin %q", origin)
+			}
+			c.wildcards = append(c.wildcards, origin)
+		case models.ValidOrigin(origin) && !strings.Contains(origin, "*"):
+			c.origins[origin] = true
+		default:
+			return nil, fmt.Errorf("invalid CORS origin %q", origin)
+		}
+	}
+	if c.anyOrigin && policy.AllowCredentials {
+		return nil, fmt.Errorf("CORS credentials cannot be allowed for any origin")
+	}
+	return c, nil
+}
+
+// AllowOrigin reports whether the request may be made from its origin.
+// Requests without an Origin header do not come from a browser page and are
+// allowed; the WebSocket upgrader uses this as its origin check.
+func (c *CORS) AllowOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || c.allowed(r, origin)
+}
+
+// allowed reports whether origin is on the allowlist or allowed by a tenant
+func (c *CORS) allowed(r *http.Request, origin string) bool {
+	if c.anyOrigin || c.origins[origin] {
+		return true
+	}
+	for _, pattern := range c.wildcards {
+		prefix, suffix, _ := strings.Cut(pattern, "*")
+		if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) && len(origin) > len(prefix)+len(suffix) {
+			return true
+		}
+	}
+	return c.tenantOrigin(r, origin)
+}
+
+// tenantOrigin reports whether an active tenant allows origin
+func (c *CORS) tenantOrigin(r *http.Request, origin string) bool {
+	if c.tenants == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tenantOrigins == nil || time.Since(c.loadedAt) >= c.refresh {
+		// Failed loads also wait for the next refresh, keeping the last index
+		c.loadedAt = time.Now()
+		tenants, err := c.tenants.ListTenants(r.Context(), models.TenantActive)
+		if err != nil {
+			logging.FromContext(r.Context()).WithError(err).Warn("Failed to load tenant CORS origins")
+		} else {
+			c.tenantOrigins = make(map[string]bool)
+			for _, tenant := range tenants {
+				for _, allowed := range tenant.AllowedOrigins {
+					c.tenantOrigins[allowed] = true
+				}
+			}
+		}
+	}
+	return c.tenantOrigins[origin]
+}
+
+// Handler adds CORS headers for allowed origins and answers preflight
+// requests: 204 for allowed origins, 403 otherwise. Other requests from
+// origins that are not allowed are served without CORS headers, so browsers
+// do not expose the response.
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !c.allowed(r, origin) {
+			if preflight {
+				logging.FromContext(r.Context()).WithFields(log.Fields{"origin": origin, "path": r.URL.Path}).Debug("CORS origin not allowed")
+				problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "Origin not allowed")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if c.anyOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.policy.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.policy.AllowedMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.policy.AllowedHeaders, ", "))
+			if c.policy.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(c.policy.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if len(c.policy.ExposedHeaders) > 0 {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.policy.ExposedHeaders, ", "))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CORSPolicyFromEnv returns defaults configured by CORS_ALLOWED_ORIGINS,
+// CORS_ALLOW_CREDENTIALS, CORS_EXPOSED_HEADERS and CORS_MAX_AGE. Without
+// CORS_ALLOWED_ORIGINS the origin of APP_BASE_URL (default
+// http://localhost:3000) is allowed, plus http://127.0.0.1:3000 in development.
+func CORSPolicyFromEnv(defaults CORSPolicy) (CORSPolicy, error) {
+	policy := defaults
+	if v := os.Getenv("CORS_ALLOWED_ORIGINS"); v != "" {
+		policy.AllowedOrigins = splitList(v)
+	} else {
+		baseURL := strings.TrimRight(os.Getenv("APP_BASE_URL"), "/")
+		if baseURL == "" {
+			baseURL = "http://localhost:3000"
+		}
+		if scheme, rest, ok := strings.Cut(baseURL, "://"); ok {
+			host, _, _ := strings.Cut(rest, "/")
+			policy.AllowedOrigins = []string{scheme + "://" + host}
+		}
+		if auth.IsDevelopment() {
+			policy.AllowedOrigins = append(policy.AllowedOrigins, "http://127.0.0.1:3000")
+		}
+	}
+	if v := os.Getenv("CORS_ALLOW_CREDENTIALS"); v != "" {
+		allow, err := strconv.ParseBool(v)
+		if err != nil {
+			return CORSPolicy{}, fmt.Errorf("invalid CORS_ALLOW_CREDENTIALS %q", v)
+		}
+		policy.AllowCredentials = allow
+	}
+	if v, ok := os.LookupEnv("CORS_EXPOSED_HEADERS"); ok {
+		policy.ExposedHeaders = splitList(v)
+	}
+	if v := os.Getenv("CORS_MAX_AGE"); v != "" {
+		maxAge, err := time.ParseDuration(v)
+		if err != nil || maxAge < 0 {
+			return CORSPolicy{}, fmt.Errorf("invalid CORS_MAX_AGE %q", v)
+		}
+		policy.MaxAge = maxAge
+	}
+	return policy, nil
+}
+
+// splitList splits a comma-separated list, dropping blank entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+)
+
+func TestCORS_Handler(t *testing.T) {
+	tenants := db.NewMemoryTenantStore()
+	policy := DefaultCORSPolicy
+	policy.AllowedOrigins = []string{"https://fleet.example.com", "https://*.fleet.example.com"}
+	policy.AllowCredentials = true
+	cors, err := NewCORS(policy, tenants, 0)
+	assert.NoError(t, err)
+	handler := cors.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	serve := func(method, origin string, preflight bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/vehicles", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("preflight from an allowed origin", func(t *testing.T) {
+		w := serve("OPTIONS", "https://fleet.example.com", true)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "https://fleet.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "PATCH")
+		assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Authorization")
+		assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+		assert.Contains(t, w.Header().Values("Vary"), "Origin")
+		assert.Empty(t, w.Body.String(), "preflights do not reach the handler")
+	})
+
+	t.Run("preflight from another origin is refused", func(t *testing.T) {
+		w := serve("OPTIONS", "https://evil.example.net", true)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("requests from allowed origins expose headers", func(t *testing.T) {
+		w := serve("GET", "https://eu.fleet.example.com", false)
+		assert.Equal(t, "ok", w.Body.String())
+		assert.Equal(t, "https://eu.fleet.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), "RateLimit-Remaining")
+	})
+
+	t.Run("requests from other origins get no CORS headers", func(t *testing.T) {
+		for _, origin := range []string{"https://evil.example.net", "https://fleet.example.com.evil.net", "http://fleet.example.com", "https://.fleet.example.com"} {
+			w := serve("GET", origin, false)
+			assert.Equal(t, "ok", w.Body.String())
+			assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), origin)
+		}
+	})
+
+	t.Run("requests without an origin pass through", func(t *testing.T) {
+		w := serve("GET", "", false)
+		assert.Equal(t, "ok", w.Body.String())
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("active tenants allow their own origins", func(t *testing.T) {
+		acme := models.NewTenant("acme", "Acme")
+		acme.AllowedOrigins = []string{"https://dashboard.acme.com"}
+		tenants.InsertTenant(context.Background(), acme)
+		suspended := models.NewTenant("globex", "Globex")
+		suspended.AllowedOrigins = []string{"https://globex.com"}
+		suspended.Status = models.TenantSuspended
+		tenants.InsertTenant(context.Background(), suspended)
+
+		assert.Equal(t, http.StatusNoContent, serve("OPTIONS", "https://dashboard.acme.com", true).Code)
+		assert.Equal(t, http.StatusForbidden, serve("OPTIONS", "https://globex.com", true).Code)
+	})
+}
+
+func TestCORS_AnyOrigin(t *testing.T) {
+	policy := DefaultCORSPolicy
+	policy.AllowedOrigins = []string{"*"}
+	cors, err := NewCORS(policy, nil, time.Minute)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/api/vehicles", nil)
+	req.Header.Set("Origin", "https://anywhere.example.com")
+	assert.True(t, cors.AllowOrigin(req))
+	w := httptest.NewRecorder()
+	cors.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, req)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	policy.AllowCredentials = true
+	_, err = NewCORS(policy, nil, time.Minute)
+	assert.Error(t, err, "credentials cannot be combined with any origin")
+}
+
+func TestNewCORS_InvalidOrigin(t *testing.T) {
+	for _, origin := range []string{"fleet.example.com", "https://fleet.example.com/app", "https://fleet.*.com"} {
+		policy := DefaultCORSPolicy
+		policy.AllowedOrigins = []string{origin}
+		_, err := NewCORS(policy, nil, time.Minute)
+		assert.Error(t, err, origin)
+	}
+}
+
+func TestCORS_AllowOrigin(t *testing.T) {
+	policy := DefaultCORSPolicy
+	policy.AllowedOrigins = []string{"http://localhost:3000"}
+	cors, _ := NewCORS(policy, nil, time.Minute)
+
+	req := httptest.NewRequest("GET", "/api/telemetry/ws", nil)
+	assert.True(t, cors.AllowOrigin(req), "non-browser clients send no origin")
+	req.Header.Set("Origin", "http://localhost:3000")
+	assert.True(t, cors.AllowOrigin(req))
+	req.Header.Set("Origin", "http://localhost:4000")
+	assert.False(t, cors.AllowOrigin(req))
+}
+
+func TestCORSPolicyFromEnv(t *testing.T) {
+	t.Run("defaults to the app origin", func(t *testing.T) {
+		t.Setenv("APP_ENV", "production")
+		t.Setenv("APP_BASE_URL", "https://fleet.example.com/app/")
+		policy, err := CORSPolicyFromEnv(DefaultCORSPolicy)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"https://fleet.example.com"}, policy.AllowedOrigins)
+		assert.False(t, policy.AllowCredentials)
+	})
+
+	t.Run("development also allows the loopback address", func(t *testing.T) {
+		t.Setenv("APP_ENV", "development")
+		t.Setenv("APP_BASE_URL", "")
+		policy, err := CORSPolicyFromEnv(DefaultCORSPolicy)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"http://localhost:3000", "http://127.0.0.1:3000"}, policy.AllowedOrigins)
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, https://*.b.example.com")
+		t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+		t.Setenv("CORS_EXPOSED_HEADERS", "X-Request-ID")
+		t.Setenv("CORS_MAX_AGE", "1h")
+		policy, err := CORSPolicyFromEnv(DefaultCORSPolicy)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"https://a.example.com", "https://*.b.example.com"}, policy.AllowedOrigins)
+		assert.True(t, policy.AllowCredentials)
+		assert.Equal(t, []string{"X-Request-ID"}, policy.ExposedHeaders)
+		assert.Equal(t, time.Hour, policy.MaxAge)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		t.Setenv("CORS_MAX_AGE", "forever")
+		_, err := CORSPolicyFromEnv(DefaultCORSPolicy)
+		assert.Error(t, err)
+	})
+}
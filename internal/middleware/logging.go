@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestLogContextKey is the request context key for the request's log record
+const requestLogContextKey contextKey = "request_log"
+
+// requestLog collects the caller of a request for its access log line, since
+// authentication runs inside the logging middleware
+type requestLog struct {
+	mu     sync.Mutex
+	claims *models.Claims
+}
+
+// RequestLogger assigns every request a correlation ID, taken from an
+// X-Request-ID header when it is well-formed and generated otherwise, and
+// echoes it in the response. Handlers log through logging.FromContext, which
+// adds the request ID, the trace ID when Tracing runs first and, once
+// authenticated, the tenant and user. When the request is done one line with
+// its method, route, status, latency and caller is logged. Like Metrics it
+// must wrap the ServeMux itself.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := r.Header.Get(logging.RequestIDHeader)
+		if !logging.ValidRequestID(requestID) {
+			requestID = logging.NewRequestID()
+		}
+		w.Header().Set(logging.RequestIDHeader, requestID)
+
+		record := &requestLog{}
+		logger := log.WithField("request_id", requestID)
+		if span := trace.SpanContextFromContext(r.Context()); span.IsValid() {
+			logger = logger.WithField("trace_id", span.TraceID().String())
+		}
+		ctx := logging.WithLogger(r.Context(), logger)
+		ctx = context.WithValue(ctx, requestLogContextKey, record)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		// The mux records the matched pattern on the request it is given
+		req := r.WithContext(ctx)
+		next.ServeHTTP(recorder, req)
+		// Hand the pattern on to outer middleware, as the mux does
+		r.Pattern = req.Pattern
+
+		fields := log.Fields{
+			"method":     r.Method,
+			"route":      req.Pattern,
+			"path":       r.URL.Path,
+			"status":     recorder.status,
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip":  getClientIP(r),
+		}
+		record.mu.Lock()
+		if claims := record.claims; claims != nil {
+			for key, value := range callerFields(claims) {
+				fields[key] = value
+			}
+		}
+		record.mu.Unlock()
+
+		entry := logging.FromContext(ctx).WithFields(fields)
+		switch {
+		case recorder.status >= http.StatusInternalServerError:
+			entry.Error("Request failed")
+		case strings.HasPrefix(r.URL.Path, "/health/") || r.URL.Path == "/metrics":
+			// Probes and scrapes would drown everything else
+			entry.Debug("Request handled")
+		default:
+			entry.Info("Request handled")
+		}
+	})
+}
+
+// callerFields are the log fields identifying the caller
+func callerFields(claims *models.Claims) log.Fields {
+	fields := log.Fields{"tenant_id": claims.TenantID}
+	if claims.IsAPIKey() {
+		fields["api_key_id"] = claims.APIKeyID
+	} else {
+		fields["user_id"] = claims.UserID
+	}
+	return fields
+}
+
+// logCaller adds the caller to the logger of ctx and to the request's access
+// log line
+func logCaller(ctx context.Context, claims *models.Claims) context.Context {
+	if record, ok := ctx.Value(requestLogContextKey).(*requestLog); ok {
+		record.mu.Lock()
+		record.claims = claims
+		record.mu.Unlock()
+	}
+	return logging.WithFields(ctx, callerFields(claims))
+}
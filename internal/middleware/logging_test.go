@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+)
+
+func TestRequestLogger(t *testing.T) {
+	hook := logtest.NewGlobal()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/things/", func(w http.ResponseWriter, r *http.Request) {
+		// Authentication adds the caller to the request's logger
+		ctx := withClaims(r.Context(), &models.Claims{UserID: "user-1", TenantID: "tenant-a", Role: models.RoleAdmin})
+		logging.FromContext(ctx).Info("Created thing")
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/api/devices", func(w http.ResponseWriter, r *http.Request) {
+		withClaims(r.Context(), &models.Claims{APIKeyID: "key-1", TenantID: "tenant-a"})
+		http.Error(w, "Failed to store telemetry", http.StatusInternalServerError)
+	})
+	handler := RequestLogger(mux)
+
+	serve := func(path, requestID string) *httptest.ResponseRecorder {
+		hook.Reset()
+		req := httptest.NewRequest("POST", path, nil)
+		if requestID != "" {
+			req.Header.Set("X-Request-ID", requestID)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("logs handler lines and the request with one ID", func(t *testing.T) {
+		w := serve("/api/things/42", "")
+		requestID := w.Header().Get("X-Request-ID")
+		assert.Len(t, requestID, 32)
+		if assert.Len(t, hook.Entries, 2) {
+			inside, done := hook.Entries[0], hook.Entries[1]
+			assert.Equal(t, requestID, inside.Data["request_id"])
+			assert.Equal(t, "tenant-a", inside.Data["tenant_id"])
+			assert.Equal(t, requestID, done.Data["request_id"])
+			assert.Equal(t, "/api/things/", done.Data["route"])
+			assert.Equal(t, "/api/things/42", done.Data["path"])
+			assert.Equal(t, http.StatusCreated, done.Data["status"])
+			assert.Equal(t, "user-1", done.Data["user_id"])
+			assert.Equal(t, "tenant-a", done.Data["tenant_id"])
+			assert.Contains(t, done.Data, "latency_ms")
+		}
+	})
+
+	t.Run("propagates well-formed request IDs", func(t *testing.T) {
+		w := serve("/api/things/42", "upstream-7f3a")
+		assert.Equal(t, "upstream-7f3a", w.Header().Get("X-Request-ID"))
+		assert.Equal(t, "upstream-7f3a", hook.LastEntry().Data["request_id"])
+
+		w = serve("/api/things/42", "bad id\twith tab")
+		assert.NotEqual(t, "bad id\twith tab", w.Header().Get("X-Request-ID"))
+	})
+
+	t.Run("server errors are logged as errors with the API key", func(t *testing.T) {
+		serve("/api/devices", "")
+		entry := hook.LastEntry()
+		assert.Equal(t, "Request failed", entry.Message)
+		assert.Equal(t, "key-1", entry.Data["api_key_id"])
+		assert.NotContains(t, entry.Data, "user_id")
+	})
+}
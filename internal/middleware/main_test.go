@@ -0,0 +1,13 @@
+package middleware
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain runs the package tests in development mode so auth.NewService
+// signs with an in-memory key instead of requiring JWT_KEYS_DIR
+func TestMain(m *testing.M) {
+	os.Setenv("APP_ENV", "development")
+	os.Exit(m.Run())
+}
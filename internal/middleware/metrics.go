@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ukydev/fleet-sustainability/internal/metrics"
+)
+
+// Metrics records the latency of every request in
+// metrics.HTTPRequestDuration. It must wrap the ServeMux itself: the route
+// label is the pattern the mux matched, so item IDs in paths do not create
+// new series, and requests no route matched are labelled "unmatched".
+// Methods outside the standard ones are labelled "other" for the same reason.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestDuration.WithLabelValues(route, methodLabel(r.Method), strconv.Itoa(recorder.status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// standardMethods are the methods of RFC 9110 and PATCH
+var standardMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodConnect: true,
+	http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// methodLabel bounds the method label: the server accepts any token as a
+// method, and every distinct one would be a series kept forever
+func methodLabel(method string) string {
+	if standardMethods[method] {
+		return method
+	}
+	return "other"
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/things/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			http.Error(w, "Thing not found", http.StatusNotFound)
+			return
+		}
+		_, flushes := w.(http.Flusher)
+		assert.True(t, flushes, "streaming handlers can still flush")
+	})
+	handler := Metrics(mux)
+
+	served := observations(metrics.HTTPRequestDuration, "/api/things/", "GET", "200")
+	missing := observations(metrics.HTTPRequestDuration, "/api/things/", "DELETE", "404")
+	unmatched := observations(metrics.HTTPRequestDuration, "unmatched", "GET", "404")
+	other := observations(metrics.HTTPRequestDuration, "/api/things/", "other", "200")
+
+	for _, path := range []string{"/api/things/1", "/api/things/2"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/api/things/3", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/elsewhere", nil))
+	for _, method := range []string{"FOO1", "FOO2", "get"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/api/things/4", nil))
+	}
+
+	assert.Equal(t, served+2, observations(metrics.HTTPRequestDuration, "/api/things/", "GET", "200"), "IDs share the route's series")
+	assert.Equal(t, missing+1, observations(metrics.HTTPRequestDuration, "/api/things/", "DELETE", "404"))
+	assert.Equal(t, unmatched+1, observations(metrics.HTTPRequestDuration, "unmatched", "GET", "404"))
+	assert.Equal(t, other+3, observations(metrics.HTTPRequestDuration, "/api/things/", "other", "200"), "unknown methods share one series")
+	assert.False(t, metrics.HTTPRequestDuration.DeleteLabelValues("/api/things/", "FOO1", "200"), "no series per method token")
+}
+
+// observations returns the number of observations in the series of vec with
+// the given label values
+func observations(vec *prometheus.HistogramVec, labels ...string) uint64 {
+	var m dto.Metric
+	vec.WithLabelValues(labels...).(prometheus.Histogram).Write(&m)
+	return m.GetHistogram().GetSampleCount()
+}
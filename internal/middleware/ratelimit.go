@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/problem"
+)
+
+// RateLimitPolicy is the budget of a group of routes. Each enabled limit is a
+// separate token bucket and a request must fit in all of them.
+type RateLimitPolicy struct {
+	Tenant db.RateLimit // shared by every caller of a tenant
+	Caller db.RateLimit // per API key or user, per client IP for anonymous callers
+}
+
+// RateLimiter enforces a rate limit policy per group of routes
+type RateLimiter struct {
+	store    db.RateLimitStore
+	policies map[string]RateLimitPolicy
+	group    func(*http.Request) string
+}
+
+// NewRateLimiter creates a rate limiter keeping its buckets in store. group
+// names the policy a request draws from; requests of groups without a policy
+// are not limited.
+func NewRateLimiter(store db.RateLimitStore, policies map[string]RateLimitPolicy, group func(*http.Request) string) *RateLimiter {
+	return &RateLimiter{
+		store:    store,
+		policies: policies,
+		group:    group,
+	}
+}
+
+// rateLimitBucket is one bucket a request draws from
+type rateLimitBucket struct {
+	key   string
+	limit db.RateLimit
+}
+
+// Limit rejects requests over budget with 429 and Retry-After, and reports
+// the tightest bucket in RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset
+// and RateLimit-Policy headers. It must run after authentication so callers
+// are keyed by tenant, API key or user rather than IP.
+func (l *RateLimiter) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		group := l.group(r)
+		policy, ok := l.policies[group]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		var tightest *db.RateLimitResult
+		var tightestLimit db.RateLimit
+		var retryAfter time.Duration
+		for _, bucket := range rateLimitBuckets(r, group, policy) {
+			result, err := l.store.Take(r.Context(), bucket.key, bucket.limit, now)
+			if err != nil {
+				// Fail open: an unreachable store must not take the API down
+				logging.FromContext(r.Context()).WithError(err).WithField("bucket", bucket.key).Warn("Failed to apply rate limit")
+				continue
+			}
+			if tightest == nil || result.Remaining < tightest.Remaining || !result.Allowed {
+				tightest, tightestLimit = &result, bucket.limit
+			}
+			if !result.Allowed {
+				// Later buckets keep their tokens for requests that fit
+				retryAfter = result.RetryAfter
+				break
+			}
+		}
+
+		if tightest != nil {
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(tightestLimit.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(tightest.ResetAfter)))
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", tightestLimit.Requests, ceilSeconds(tightestLimit.Period), tightestLimit.Burst))
+		}
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+			logging.FromContext(r.Context()).WithFields(log.Fields{"group": group, "path": r.URL.Path}).Debug("Rate limit exceeded")
+			problem.Error(w, r, http.StatusTooManyRequests, problem.CodeRateLimited, "Rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitBuckets returns the buckets of policy a request draws from, the
+// caller's before the tenant's so one noisy caller cannot drain its tenant
+func rateLimitBuckets(r *http.Request, group string, policy RateLimitPolicy) []rateLimitBucket {
+	var buckets []rateLimitBucket
+	claims, authenticated := GetUserFromContext(r.Context())
+	if policy.Caller.Enabled() {
+		caller := "ip:" + ClientIP(r)
+		switch {
+		case authenticated && claims.IsAPIKey():
+			caller = "apikey:" + claims.APIKeyID
+		case authenticated && claims.UserID != "":
+			caller = "user:" + claims.UserID
+		}
+		buckets = append(buckets, rateLimitBucket{key: group + ":" + caller, limit: policy.Caller})
+	}
+	if policy.Tenant.Enabled() && authenticated && claims.TenantID != "" {
+		buckets = append(buckets, rateLimitBucket{key: group + ":tenant:" + claims.TenantID, limit: policy.Tenant})
+	}
+	return buckets
+}
+
+// ceilSeconds rounds d up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ParseRateLimit parses "<requests>/<period>[,<burst>]", e.g. "100/1m" or
+// "10/1s,50". The burst defaults to the number of requests; "off" is no limit.
+func ParseRateLimit(value string) (db.RateLimit, error) {
+	value = strings.TrimSpace(value)
+	if value == "off" || value == "0" {
+		return db.RateLimit{}, nil
+	}
+	rate, burst, hasBurst := strings.Cut(value, ",")
+	requests, period, ok := strings.Cut(rate, "/")
+	if !ok {
+		return db.RateLimit{}, fmt.Errorf("invalid rate limit %q", value)
+	}
+	limit := db.RateLimit{}
+	var err error
+	if limit.Requests, err = strconv.Atoi(strings.TrimSpace(requests)); err != nil || limit.Requests <= 0 {
+		return db.RateLimit{}, fmt.Errorf("invalid rate limit %q", value)
+	}
+	if limit.Period, err = time.ParseDuration(strings.TrimSpace(period)); err != nil || limit.Period <= 0 {
+		return db.RateLimit{}, fmt.Errorf("invalid rate limit %q", value)
+	}
+	limit.Burst = limit.Requests
+	if hasBurst {
+		if limit.Burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil || limit.Burst <= 0 {
+			return db.RateLimit{}, fmt.Errorf("invalid rate limit %q", value)
+		}
+	}
+	return limit, nil
+}
+
+// RateLimitPoliciesFromEnv returns defaults with the limits overridden by
+// RATE_LIMIT_<GROUP>_TENANT and RATE_LIMIT_<GROUP>_CALLER. Invalid values are
+// logged and the default is kept.
+func RateLimitPoliciesFromEnv(defaults map[string]RateLimitPolicy) map[string]RateLimitPolicy {
+	policies := make(map[string]RateLimitPolicy, len(defaults))
+	for group, policy := range defaults {
+		prefix := "RATE_LIMIT_" + strings.ToUpper(group) + "_"
+		policy.Tenant = envRateLimit(prefix+"TENANT", policy.Tenant)
+		policy.Caller = envRateLimit(prefix+"CALLER", policy.Caller)
+		policies[group] = policy
+	}
+	return policies
+}
+
+// envRateLimit reads a rate limit environment variable
+func envRateLimit(name string, fallback db.RateLimit) db.RateLimit {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	limit, err := ParseRateLimit(v)
+	if err != nil {
+		log.WithError(err).WithField("variable", name).Warn("Ignoring invalid rate limit")
+		return fallback
+	}
+	return limit
+}
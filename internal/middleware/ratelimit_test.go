@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+)
+
+// failingRateLimitStore fails every lookup, like an unreachable database
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(ctx context.Context, key string, limit db.RateLimit, now time.Time) (db.RateLimitResult, error) {
+	return db.RateLimitResult{}, errors.New("unreachable")
+}
+
+func TestRateLimiter_Limit(t *testing.T) {
+	policies := map[string]RateLimitPolicy{
+		"ingest": {Tenant: db.RateLimit{Requests: 3, Period: time.Minute, Burst: 3}, Caller: db.RateLimit{Requests: 2, Period: time.Minute, Burst: 2}},
+		"read":   {Caller: db.RateLimit{Requests: 1, Period: time.Minute, Burst: 1}},
+	}
+	group := func(r *http.Request) string {
+		if r.Method == http.MethodPost {
+			return "ingest"
+		}
+		return r.URL.Query().Get("group")
+	}
+	limiter := NewRateLimiter(db.NewMemoryRateLimitStore(), policies, group)
+	handler := limiter.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(method, target, remoteAddr string, claims *models.Claims) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = remoteAddr
+		if claims != nil {
+			req = req.WithContext(context.WithValue(req.Context(), UserContextKey, claims))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	device := &models.Claims{APIKeyID: "key-1", TenantID: "tenant-a"}
+	otherDevice := &models.Claims{APIKeyID: "key-2", TenantID: "tenant-a"}
+	user := &models.Claims{UserID: "user-1", TenantID: "tenant-a", Role: models.RoleViewer}
+
+	t.Run("callers have their own budget", func(t *testing.T) {
+		w := serve("POST", "/api/telemetry", "192.0.2.1:1234", device)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+		assert.Equal(t, "2;w=60;burst=2", w.Header().Get("RateLimit-Policy"))
+
+		assert.Equal(t, http.StatusOK, serve("POST", "/api/telemetry", "192.0.2.1:1234", device).Code)
+		w = serve("POST", "/api/telemetry", "192.0.2.1:1234", device)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "30", w.Header().Get("Retry-After"))
+		assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	})
+
+	t.Run("the tenant budget is shared", func(t *testing.T) {
+		w := serve("POST", "/api/telemetry", "192.0.2.1:1234", otherDevice)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "3", w.Header().Get("RateLimit-Limit"), "the tenant bucket is the tightest")
+		assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, http.StatusTooManyRequests, serve("POST", "/api/telemetry", "192.0.2.1:1234", otherDevice).Code)
+	})
+
+	t.Run("route groups have separate budgets", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve("GET", "/api/vehicles?group=read", "192.0.2.1:1234", user).Code)
+		assert.Equal(t, http.StatusTooManyRequests, serve("GET", "/api/vehicles?group=read", "192.0.2.1:1234", user).Code)
+		w := serve("GET", "/api/vehicles?group=unlimited", "192.0.2.1:1234", user)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	})
+
+	t.Run("anonymous callers are limited by IP", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve("GET", "/api/auth/login?group=read", "198.51.100.1:1234", nil).Code)
+		assert.Equal(t, http.StatusTooManyRequests, serve("GET", "/api/auth/login?group=read", "198.51.100.1:5678", nil).Code)
+		assert.Equal(t, http.StatusOK, serve("GET", "/api/auth/login?group=read", "198.51.100.2:1234", nil).Code)
+	})
+
+	t.Run("store failures let requests through", func(t *testing.T) {
+		failing := NewRateLimiter(failingRateLimitStore{}, policies, group).Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		w := httptest.NewRecorder()
+		failing.ServeHTTP(w, httptest.NewRequest("GET", "/api/vehicles?group=read", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestParseRateLimit(t *testing.T) {
+	limit, err := ParseRateLimit("100/1m")
+	assert.NoError(t, err)
+	assert.Equal(t, db.RateLimit{Requests: 100, Period: time.Minute, Burst: 100}, limit)
+
+	limit, err = ParseRateLimit(" 10/1s, 50 ")
+	assert.NoError(t, err)
+	assert.Equal(t, db.RateLimit{Requests: 10, Period: time.Second, Burst: 50}, limit)
+
+	limit, err = ParseRateLimit("off")
+	assert.NoError(t, err)
+	assert.False(t, limit.Enabled())
+
+	for _, invalid := range []string{"100", "x/1m", "100/forever", "100/1m,0", "-1/1s"} {
+		_, err := ParseRateLimit(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRateLimitPoliciesFromEnv(t *testing.T) {
+	defaults := map[string]RateLimitPolicy{
+		"ingest": {Caller: db.RateLimit{Requests: 10, Period: time.Second, Burst: 10}},
+	}
+	t.Setenv("RATE_LIMIT_INGEST_TENANT", "100/1s,200")
+	t.Setenv("RATE_LIMIT_INGEST_CALLER", "lots")
+
+	policies := RateLimitPoliciesFromEnv(defaults)
+	assert.Equal(t, db.RateLimit{Requests: 100, Period: time.Second, Burst: 200}, policies["ingest"].Tenant)
+	assert.Equal(t, defaults["ingest"].Caller, policies["ingest"].Caller, "invalid values keep the default")
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.0.2.1, 2001:db8::/32")
+	assert.NoError(t, err)
+	_, err = ParseTrustedProxies("10.0.0.0/8, proxy.internal")
+	assert.Error(t, err)
+
+	clientIP := func(remoteAddr, forwardedFor, realIP string) string {
+		req := httptest.NewRequest("GET", "/api/vehicles", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		if realIP != "" {
+			req.Header.Set("X-Real-IP", realIP)
+		}
+		return ClientIP(req)
+	}
+
+	// Without trusted proxies forwarding headers are ignored
+	assert.Equal(t, "198.51.100.9", clientIP("198.51.100.9:1234", "203.0.113.7", "203.0.113.8"))
+
+	SetTrustedProxies(proxies)
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+	assert.Equal(t, "198.51.100.9", clientIP("198.51.100.9:1234", "203.0.113.7", ""), "untrusted peers cannot spoof")
+	assert.Equal(t, "203.0.113.7", clientIP("192.0.2.1:1234", "203.0.113.7", ""))
+	assert.Equal(t, "203.0.113.7", clientIP("10.1.2.3:1234", "6.6.6.6, 203.0.113.7, 10.0.0.5", ""), "spoofed hops left of the client are skipped")
+	assert.Equal(t, "10.0.0.4", clientIP("10.1.2.3:1234", "10.0.0.4, 10.0.0.5", ""), "all hops trusted")
+	assert.Equal(t, "203.0.113.8", clientIP("192.0.2.1:1234", "", "203.0.113.8"))
+	assert.Equal(t, "2001:db9::1", clientIP("[2001:db8::2]:443", "2001:db9::1", ""))
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+	hook := logtest.NewGlobal()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/things/{id}", func(w http.ResponseWriter, r *http.Request) {
+		withClaims(r.Context(), &models.Claims{UserID: "user-1", TenantID: "tenant-a"})
+		logging.FromContext(r.Context()).Info("Loading thing")
+		if r.PathValue("id") == "broken" {
+			http.Error(w, "Failed to load thing", http.StatusInternalServerError)
+		}
+	})
+	handler := Tracing(RequestLogger(mux))
+
+	t.Run("continues the caller's trace", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/things/42", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := recorder.Ended()
+		if assert.Len(t, spans, 1) {
+			span := spans[0]
+			assert.Equal(t, "GET /api/things/{id}", span.Name())
+			assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+			assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+			assert.Contains(t, span.Attributes(), attribute.String("http.route", "/api/things/{id}"))
+			assert.Contains(t, span.Attributes(), attribute.Int("http.response.status_code", http.StatusOK))
+			assert.Contains(t, span.Attributes(), attribute.String("tenant.id", "tenant-a"))
+			assert.Equal(t, codes.Unset, span.Status().Code)
+		}
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", hook.Entries[0].Data["trace_id"], "log lines carry the trace ID")
+	})
+
+	t.Run("marks server errors", func(t *testing.T) {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/things/broken", nil))
+
+		spans := recorder.Ended()
+		span := spans[len(spans)-1]
+		assert.False(t, span.Parent().IsValid(), "requests without trace context start a new trace")
+		assert.Equal(t, codes.Error, span.Status().Code)
+	})
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// API key scopes, each granting a fixed set of permission actions
+const (
+	ScopeTelemetryRead    = "telemetry:read"
+	ScopeTelemetryWrite   = "telemetry:write"
+	ScopeVehiclesRead     = "vehicles:read"
+	ScopeVehiclesWrite    = "vehicles:write"
+	ScopeTripsRead        = "trips:read"
+	ScopeTripsWrite       = "trips:write"
+	ScopeMaintenanceRead  = "maintenance:read"
+	ScopeMaintenanceWrite = "maintenance:write"
+	ScopeCostsRead        = "costs:read"
+	ScopeCostsWrite       = "costs:write"
+	ScopeAlertsRead       = "alerts:read"
+	ScopeMetricsRead      = "metrics:read"
+)
+
+// ScopePermissions is the policy table of actions granted to each API key scope.
+// API keys never manage users or other keys.
+var ScopePermissions = map[string][]string{
+	ScopeTelemetryRead:    {PermViewTelemetry},
+	ScopeTelemetryWrite:   {PermCreateTelemetry},
+	ScopeVehiclesRead:     {PermViewVehicles},
+	ScopeVehiclesWrite:    {PermCreateVehicle, PermUpdateVehicle},
+	ScopeTripsRead:        {PermViewTrips},
+	ScopeTripsWrite:       {PermCreateTrip, PermUpdateTrip},
+	ScopeMaintenanceRead:  {PermViewMaintenance},
+	ScopeMaintenanceWrite: {PermCreateMaintenance, PermUpdateMaintenance},
+	ScopeCostsRead:        {PermViewCosts},
+	ScopeCostsWrite:       {PermCreateCost, PermUpdateCost},
+	ScopeAlertsRead:       {PermViewAlerts},
+	ScopeMetricsRead:      {PermViewMetrics},
+}
+
+// scopePermissionSet indexes ScopePermissions for constant-time lookups
+var scopePermissionSet = func() map[string]map[string]bool {
+	sets := make(map[string]map[string]bool, len(ScopePermissions))
+	for scope, actions := range ScopePermissions {
+		sets[scope] = make(map[string]bool, len(actions))
+		for _, action := range actions {
+			sets[scope][action] = true
+		}
+	}
+	return sets
+}()
+
+// IsValidScope checks if an API key scope is known
+func IsValidScope(scope string) bool {
+	_, ok := ScopePermissions[scope]
+	return ok
+}
+
+// APIKey is a long-lived tenant credential for devices and integrations. Only
+// the prefix is stored in the clear; the secret is kept as a SHA-256 hash.
+type APIKey struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID   string             `bson:"tenant_id" json:"tenant_id"`
+	Name       string             `bson:"name" json:"name"`
+	Prefix     string             `bson:"prefix" json:"prefix"`
+	SecretHash string             `bson:"secret_hash" json:"-"`
+	Scopes     []string           `bson:"scopes" json:"scopes"`
+	CreatedBy  string             `bson:"created_by" json:"created_by"`
+	ExpiresAt  *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time         `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// IsActive reports whether the key can authenticate at the given time
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// CreateAPIKeyRequest represents a request to issue an API key
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateAPIKeyResponse returns the new key; the full key is only shown once
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit event actions
+const (
+	AuditAccountLocked      = "account_locked"
+	AuditAccountUnlocked    = "account_unlocked"
+	AuditMFAEnabled         = "mfa_enabled"
+	AuditMFADisabled        = "mfa_disabled"
+	AuditMFAPolicyUpdated   = "mfa_policy_updated"
+	AuditAPIKeyCreated      = "api_key_created"
+	AuditAPIKeyRevoked      = "api_key_revoked"
+	AuditSSOUserProvisioned = "sso_user_provisioned"
+	AuditSSORoleSynced      = "sso_role_synced"
+	AuditAPIRequest         = "api_request"
+	AuditTenantCreated      = "tenant_created"
+	AuditTenantSuspended    = "tenant_suspended"
+	AuditTenantActivated    = "tenant_activated"
+	AuditTenantDeleted      = "tenant_deleted"
+)
+
+// AuditEvent records a security-relevant action or a mutating API call for
+// later review. Events of a tenant form a hash chain: each carries the hash of
+// its predecessor, so editing or removing an entry breaks every later hash.
+type AuditEvent struct {
+	ID        primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	TenantID  string                 `bson:"tenant_id" json:"tenant_id"`
+	Seq       int64                  `bson:"seq" json:"seq"`
+	Action    string                 `bson:"action" json:"action"`
+	ActorID   string                 `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	TargetID  string                 `bson:"target_id,omitempty" json:"target_id,omitempty"`
+	TargetIDs []string               `bson:"target_ids,omitempty" json:"target_ids,omitempty"`
+	Method    string                 `bson:"method,omitempty" json:"method,omitempty"`
+	Route     string                 `bson:"route,omitempty" json:"route,omitempty"`
+	Status    int                    `bson:"status,omitempty" json:"status,omitempty"`
+	IPAddress string                 `bson:"ip_address,omitempty" json:"ip_address,omitempty"`
+	Details   map[string]interface{} `bson:"details,omitempty" json:"details,omitempty"`
+	Before    map[string]interface{} `bson:"before,omitempty" json:"before,omitempty"`
+	After     map[string]interface{} `bson:"after,omitempty" json:"after,omitempty"`
+	CreatedAt time.Time              `bson:"created_at" json:"created_at"`
+	PrevHash  string                 `bson:"prev_hash" json:"prev_hash"`
+	Hash      string                 `bson:"hash" json:"hash"`
+}
+
+// AuditChainStatus is the result of verifying a tenant's audit hash chain
+type AuditChainStatus struct {
+	TenantID string `json:"tenant_id"`
+	Entries  int64  `json:"entries"`
+	Valid    bool   `json:"valid"`
+	HeadHash string `json:"head_hash,omitempty"`
+	// BrokenAt is the sequence number of the first entry that does not verify
+	BrokenAt int64  `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
@@ -24,3 +24,18 @@ type Cost struct {
 	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
 }
+
+// Validate checks that a cost record has the fields required to create or update it
+func (c *Cost) Validate() error {
+	var invalid ValidationError
+	if c.VehicleID == "" {
+		invalid.Add("vehicle_id", FieldRequired, "vehicle_id is required")
+	}
+	if c.Category == "" {
+		invalid.Add("category", FieldRequired, "category is required")
+	}
+	if c.Amount <= 0 {
+		invalid.Add("amount", FieldOutOfRange, "amount must be positive")
+	}
+	return invalid.Err()
+}
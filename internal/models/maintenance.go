@@ -26,3 +26,16 @@ type Maintenance struct {
 	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
 }
+
+// Validate checks that a maintenance record has the fields required to
+// create or update it
+func (m *Maintenance) Validate() error {
+	var invalid ValidationError
+	if m.VehicleID == "" {
+		invalid.Add("vehicle_id", FieldRequired, "vehicle_id is required")
+	}
+	if m.ServiceType == "" {
+		invalid.Add("service_type", FieldRequired, "service_type is required")
+	}
+	return invalid.Err()
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// OIDCLoginResponse starts a single sign-on login. The client sends the user
+// to AuthorizationURL and keeps StateToken for the callback.
+type OIDCLoginResponse struct {
+	AuthorizationURL string    `json:"authorization_url"`
+	StateToken       string    `json:"state_token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+// OIDCCallbackRequest completes a single sign-on login with the parameters the
+// identity provider redirected back with
+type OIDCCallbackRequest struct {
+	Code       string `json:"code"`
+	State      string `json:"state"`
+	StateToken string `json:"state_token"`
+	DeviceName string `json:"device_name,omitempty"`
+}
+
+// OIDCStateClaims represents the claims of a signed single sign-on login state token
+type OIDCStateClaims struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	Exp          int64  `json:"exp"`
+}
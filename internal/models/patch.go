@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+// MergePatch applies a JSON merge patch (RFC 7396) to dst, a pointer to a
+// record. Members of the patch replace those of the record, objects are
+// merged recursively and null removes a member, which clears the field to its
+// zero value. Members the patch leaves out keep their values.
+func MergePatch(dst interface{}, patch []byte) error {
+	var changes interface{}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return err
+	}
+	if _, ok := changes.(map[string]interface{}); !ok {
+		return errors.New("merge patch must be a JSON object")
+	}
+	current, err := json.Marshal(dst)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(current, &doc); err != nil {
+		return err
+	}
+	merged, err := json.Marshal(mergeValues(doc, changes))
+	if err != nil {
+		return err
+	}
+	// Decode into a cleared record so that removed members become zero values
+	record := reflect.ValueOf(dst).Elem()
+	record.Set(reflect.Zero(record.Type()))
+	return json.Unmarshal(merged, dst)
+}
+
+// mergeValues returns doc with patch applied
+func mergeValues(doc, patch interface{}) interface{} {
+	changes, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	target, ok := doc.(map[string]interface{})
+	if !ok {
+		target = map[string]interface{}{}
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(target, name)
+		} else {
+			target[name] = mergeValues(target[name], value)
+		}
+	}
+	return target
+}
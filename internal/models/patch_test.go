@@ -0,0 +1,75 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMergePatch(t *testing.T) {
+	id := primitive.NewObjectID()
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	trip := Trip{
+		ID:            id,
+		VehicleID:     "truck-1",
+		StartTime:     start,
+		StartLocation: Location{Lat: 51.5, Lon: -0.1},
+		Distance:      12.5,
+		Notes:         "Keys at reception",
+		Status:        "planned",
+	}
+
+	patch := `{"status":"completed","notes":null,"distance":0,"start_location":{"lon":2.35}}`
+	if err := MergePatch(&trip, []byte(patch)); err != nil {
+		t.Fatalf("MergePatch failed: %v", err)
+	}
+	if trip.Status != "completed" {
+		t.Errorf("Status = %q, want completed", trip.Status)
+	}
+	if trip.Notes != "" {
+		t.Errorf("Notes = %q, want it cleared by null", trip.Notes)
+	}
+	if trip.Distance != 0 {
+		t.Errorf("Distance = %v, want explicit 0", trip.Distance)
+	}
+	if trip.StartLocation != (Location{Lat: 51.5, Lon: 2.35}) {
+		t.Errorf("StartLocation = %+v, want objects merged", trip.StartLocation)
+	}
+	if trip.ID != id || trip.VehicleID != "truck-1" || !trip.StartTime.Equal(start) {
+		t.Errorf("members missing from the patch changed: %+v", trip)
+	}
+
+	for _, invalid := range []string{`not json`, `[1,2]`, `"status"`} {
+		if err := MergePatch(&trip, []byte(invalid)); err == nil {
+			t.Errorf("MergePatch(%s) succeeded, want error", invalid)
+		}
+	}
+}
+
+func TestRecords_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		record interface{ Validate() error }
+		want   string
+	}{
+		{"trip", &Trip{VehicleID: "v1", StartTime: time.Now()}, ""},
+		{"trip without vehicle", &Trip{StartTime: time.Now()}, "vehicle_id is required"},
+		{"trip without start", &Trip{VehicleID: "v1"}, "start_time is required"},
+		{"maintenance", &Maintenance{VehicleID: "v1", ServiceType: "inspection"}, ""},
+		{"maintenance without service type", &Maintenance{VehicleID: "v1"}, "service_type is required"},
+		{"cost", &Cost{VehicleID: "v1", Category: "fuel", Amount: 10}, ""},
+		{"cost without category", &Cost{VehicleID: "v1", Amount: 10}, "category is required"},
+		{"cost without amount", &Cost{VehicleID: "v1", Category: "fuel"}, "amount must be positive"},
+	}
+	for _, tt := range tests {
+		err := tt.record.Validate()
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("%s: Validate() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
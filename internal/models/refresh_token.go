@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefreshToken represents a persisted refresh token. Only a hash of the token
+// is stored; the raw value is handed to the client once and never kept.
+//
+// Tokens issued from the same login share a FamilyID. Every refresh rotates
+// the token within its family, so presenting a token that has already been
+// used means it was copied, and the whole family is revoked.
+type RefreshToken struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     string             `bson:"user_id" json:"user_id"`
+	TenantID   string             `bson:"tenant_id" json:"tenant_id"`
+	FamilyID   string             `bson:"family_id" json:"family_id"`
+	TokenHash  string             `bson:"token_hash" json:"-"`
+	DeviceName string             `bson:"device_name,omitempty" json:"device_name,omitempty"`
+	UserAgent  string             `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	IPAddress  string             `bson:"ip_address,omitempty" json:"ip_address,omitempty"`
+	ExpiresAt  time.Time          `bson:"expires_at" json:"expires_at"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	UsedAt     *time.Time         `bson:"used_at,omitempty" json:"used_at,omitempty"`
+	RevokedAt  *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+// RefreshRequest represents a request to exchange a refresh token for a new token pair
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	DeviceName   string `json:"device_name,omitempty"`
+}
+
+// IsExpired reports whether the refresh token is past its expiry time.
+func (t *RefreshToken) IsExpired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
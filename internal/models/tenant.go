@@ -0,0 +1,169 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TenantStatus is the lifecycle state of a tenant
+type TenantStatus string
+
+const (
+	// TenantActive tenants can sign in and use the API
+	TenantActive TenantStatus = "active"
+	// TenantSuspended tenants keep their data but every credential is refused
+	TenantSuspended TenantStatus = "suspended"
+)
+
+// Plan is the subscription plan of a tenant
+type Plan string
+
+const (
+	PlanFree       Plan = "free"
+	PlanPro        Plan = "pro"
+	PlanEnterprise Plan = "enterprise"
+)
+
+// UnitSystem selects how distances, speeds and volumes are shown to a tenant
+type UnitSystem string
+
+const (
+	UnitsMetric   UnitSystem = "metric"
+	UnitsImperial UnitSystem = "imperial"
+)
+
+// AlertThresholds are the telemetry values at which alerts are raised
+type AlertThresholds struct {
+	// LowFuelPct and LowBatteryPct raise an alert at or below the given level
+	LowFuelPct    float64 `bson:"low_fuel_pct" json:"low_fuel_pct"`
+	LowBatteryPct float64 `bson:"low_battery_pct" json:"low_battery_pct"`
+	// HighEmissions raises an alert at or above the given emissions reading
+	HighEmissions float64 `bson:"high_emissions" json:"high_emissions"`
+}
+
+// DefaultAlertThresholds apply to tenants that do not configure their own
+var DefaultAlertThresholds = AlertThresholds{LowFuelPct: 10, LowBatteryPct: 10, HighEmissions: 50}
+
+// tenantIDPattern restricts tenant IDs to values safe in URLs and log lines
+var tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// currencyPattern matches ISO 4217 currency codes
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Tenant is an organisation whose users, vehicles and records are isolated
+// from other tenants. Its ID is the tenant_id stored on every other record.
+// AllowedOrigins are browser origins allowed by CORS in addition to the
+// global allowlist, e.g. the tenant's own dashboard domain.
+type Tenant struct {
+	ID              string          `bson:"_id" json:"id"`
+	Name            string          `bson:"name" json:"name"`
+	Plan            Plan            `bson:"plan" json:"plan"`
+	Timezone        string          `bson:"timezone" json:"timezone"`
+	Currency        string          `bson:"currency" json:"currency"`
+	Units           UnitSystem      `bson:"units" json:"units"`
+	AlertThresholds AlertThresholds `bson:"alert_thresholds" json:"alert_thresholds"`
+	AllowedOrigins  []string        `bson:"allowed_origins,omitempty" json:"allowed_origins,omitempty"`
+	Status          TenantStatus    `bson:"status" json:"status"`
+	SuspendedAt     *time.Time      `bson:"suspended_at,omitempty" json:"suspended_at,omitempty"`
+	CreatedAt       time.Time       `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time       `bson:"updated_at" json:"updated_at"`
+}
+
+// NewTenant returns an active tenant with the default settings
+func NewTenant(id, name string) Tenant {
+	now := time.Now()
+	return Tenant{
+		ID:              id,
+		Name:            name,
+		Plan:            PlanFree,
+		Timezone:        "UTC",
+		Currency:        "USD",
+		Units:           UnitsMetric,
+		AlertThresholds: DefaultAlertThresholds,
+		Status:          TenantActive,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+}
+
+// IsActive reports whether the tenant's users and API keys may use the API
+func (t *Tenant) IsActive() bool {
+	return t.Status == TenantActive
+}
+
+// Validate checks the tenant's identity and settings
+func (t *Tenant) Validate() error {
+	var invalid ValidationError
+	if !tenantIDPattern.MatchString(t.ID) {
+		invalid.Add("id", FieldInvalid, "id must be 1-64 letters, digits, '-' or '_'")
+	}
+	if name := strings.TrimSpace(t.Name); name == "" || len(name) > 100 {
+		invalid.Add("name", FieldInvalid, "name is required and must be at most 100 characters")
+	}
+	switch t.Plan {
+	case PlanFree, PlanPro, PlanEnterprise:
+	default:
+		invalid.Add("plan", FieldInvalid, fmt.Sprintf("plan must be one of %s, %s, %s", PlanFree, PlanPro, PlanEnterprise))
+	}
+	if _, err := time.LoadLocation(t.Timezone); err != nil || t.Timezone == "" || t.Timezone == "Local" {
+		invalid.Add("timezone", FieldInvalid, "timezone must be an IANA time zone such as Europe/Berlin")
+	}
+	if !currencyPattern.MatchString(t.Currency) {
+		invalid.Add("currency", FieldInvalid, "currency must be an ISO 4217 code such as EUR")
+	}
+	if t.Units != UnitsMetric && t.Units != UnitsImperial {
+		invalid.Add("units", FieldInvalid, fmt.Sprintf("units must be %s or %s", UnitsMetric, UnitsImperial))
+	}
+	thresholds := t.AlertThresholds
+	if thresholds.LowFuelPct < 0 || thresholds.LowFuelPct > 100 ||
+		thresholds.LowBatteryPct < 0 || thresholds.LowBatteryPct > 100 ||
+		thresholds.HighEmissions < 0 {
+		invalid.Add("alert_thresholds", FieldOutOfRange, "alert thresholds must be percentages between 0 and 100 and non-negative emissions")
+	}
+	for _, origin := range t.AllowedOrigins {
+		if !ValidOrigin(origin) {
+			invalid.Add("allowed_origins", FieldInvalid, fmt.Sprintf("allowed origin %q must be a scheme and host such as https://fleet.example.com", origin))
+		}
+	}
+	if t.Status != TenantActive && t.Status != TenantSuspended {
+		invalid.Add("status", FieldInvalid, fmt.Sprintf("status must be %s or %s", TenantActive, TenantSuspended))
+	}
+	return invalid.Err()
+}
+
+// ValidOrigin reports whether origin is a bare http(s) origin: a scheme, a
+// host and an optional port, without path, query or trailing slash
+func ValidOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	return origin == u.Scheme+"://"+u.Host
+}
+
+// CreateTenantRequest creates a tenant. ID is generated when empty and the
+// settings not given take their defaults.
+type CreateTenantRequest struct {
+	ID              string           `json:"id,omitempty"`
+	Name            string           `json:"name"`
+	Plan            Plan             `json:"plan,omitempty"`
+	Timezone        string           `json:"timezone,omitempty"`
+	Currency        string           `json:"currency,omitempty"`
+	Units           UnitSystem       `json:"units,omitempty"`
+	AlertThresholds *AlertThresholds `json:"alert_thresholds,omitempty"`
+	AllowedOrigins  []string         `json:"allowed_origins,omitempty"`
+}
+
+// UpdateTenantRequest changes a tenant's settings; nil fields are left unchanged
+type UpdateTenantRequest struct {
+	Name            *string          `json:"name,omitempty"`
+	Plan            *Plan            `json:"plan,omitempty"`
+	Timezone        *string          `json:"timezone,omitempty"`
+	Currency        *string          `json:"currency,omitempty"`
+	Units           *UnitSystem      `json:"units,omitempty"`
+	AlertThresholds *AlertThresholds `json:"alert_thresholds,omitempty"`
+	AllowedOrigins  *[]string        `json:"allowed_origins,omitempty"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import "testing"
+
+func TestTenant_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Tenant)
+		valid  bool
+	}{
+		{"defaults", func(*Tenant) {}, true},
+		{"custom settings", func(t *Tenant) {
+			t.Plan, t.Timezone, t.Currency, t.Units = PlanEnterprise, "Europe/Berlin", "EUR", UnitsImperial
+		}, true},
+		{"id with spaces", func(t *Tenant) { t.ID = "acme fleet" }, false},
+		{"empty id", func(t *Tenant) { t.ID = "" }, false},
+		{"blank name", func(t *Tenant) { t.Name = "  " }, false},
+		{"unknown plan", func(t *Tenant) { t.Plan = "gold" }, false},
+		{"unknown timezone", func(t *Tenant) { t.Timezone = "Mars/Olympus" }, false},
+		{"local timezone", func(t *Tenant) { t.Timezone = "Local" }, false},
+		{"lowercase currency", func(t *Tenant) { t.Currency = "eur" }, false},
+		{"unknown units", func(t *Tenant) { t.Units = "furlongs" }, false},
+		{"threshold above 100", func(t *Tenant) { t.AlertThresholds.LowFuelPct = 120 }, false},
+		{"negative emissions threshold", func(t *Tenant) { t.AlertThresholds.HighEmissions = -1 }, false},
+		{"allowed origins", func(t *Tenant) {
+			t.AllowedOrigins = []string{"https://fleet.acme.com", "http://localhost:3000"}
+		}, true},
+		{"origin with path", func(t *Tenant) { t.AllowedOrigins = []string{"https://fleet.acme.com/"} }, false},
+		{"origin without scheme", func(t *Tenant) { t.AllowedOrigins = []string{"fleet.acme.com"} }, false},
+		{"unknown status", func(t *Tenant) { t.Status = "deleted" }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant := NewTenant("acme-fleet", "Acme Fleet")
+			tt.modify(&tenant)
+			if err := tenant.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestTenant_IsActive(t *testing.T) {
+	tenant := NewTenant("acme-fleet", "Acme Fleet")
+	if !tenant.IsActive() {
+		t.Error("new tenants should be active")
+	}
+	tenant.Status = TenantSuspended
+	if tenant.IsActive() {
+		t.Error("suspended tenants should not be active")
+	}
+}
+
+func TestPlatformPermissions(t *testing.T) {
+	superAdmin := &User{Role: RoleSuperAdmin}
+	if !superAdmin.HasPermission(PermManageTenants) {
+		t.Error("super-admins should manage tenants")
+	}
+	if superAdmin.HasPermission(PermViewVehicles) {
+		t.Error("super-admins should not see tenant data")
+	}
+	if IsValidRole(RoleSuperAdmin) {
+		t.Error("superadmin must not be assignable as a tenant role")
+	}
+	for role := range RolePermissions {
+		if (&User{Role: role}).HasPermission(PermManageTenants) {
+			t.Errorf("tenant role %s should not manage tenants", role)
+		}
+	}
+}
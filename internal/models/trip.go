@@ -26,3 +26,15 @@ type Trip struct {
 	CreatedAt          time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt          time.Time          `json:"updated_at" bson:"updated_at"`
 }
+
+// Validate checks that a trip has the fields required to create or update it
+func (t *Trip) Validate() error {
+	var invalid ValidationError
+	if t.VehicleID == "" {
+		invalid.Add("vehicle_id", FieldRequired, "vehicle_id is required")
+	}
+	if t.StartTime.IsZero() {
+		invalid.Add("start_time", FieldRequired, "start_time is required")
+	}
+	return invalid.Err()
+}
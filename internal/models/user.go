@@ -17,39 +17,228 @@ const (
 	RoleOperator Role = "operator"
 	// RoleViewer is a read-only viewer.
 	RoleViewer   Role = "viewer"
+	// RoleSuperAdmin operates the platform: it manages tenants but belongs to
+	// none and cannot see tenant data. It is not a tenant role, so it can only
+	// be granted in the database, never through the API.
+	RoleSuperAdmin Role = "superadmin"
 )
 
 // User represents a user in the system
 type User struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-    TenantID     string             `bson:"tenant_id" json:"tenant_id"`
-	Username     string             `bson:"username" json:"username"`
-	Email        string             `bson:"email" json:"email"`
-	PasswordHash string             `bson:"password_hash" json:"-"`
-	Role         Role               `bson:"role" json:"role"`
-	FirstName    string             `bson:"first_name" json:"first_name"`
-	LastName     string             `bson:"last_name" json:"last_name"`
-	IsActive     bool               `bson:"is_active" json:"is_active"`
-	LastLogin    *time.Time         `bson:"last_login,omitempty" json:"last_login,omitempty"`
-	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+	ID                  primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID            string             `bson:"tenant_id" json:"tenant_id"`
+	Username            string             `bson:"username" json:"username"`
+	Email               string             `bson:"email" json:"email"`
+	PasswordHash        string             `bson:"password_hash" json:"-"`
+	PasswordHistory     []string           `bson:"password_history,omitempty" json:"-"`
+	Role                Role               `bson:"role" json:"role"`
+	FirstName           string             `bson:"first_name" json:"first_name"`
+	LastName            string             `bson:"last_name" json:"last_name"`
+	IsActive            bool               `bson:"is_active" json:"is_active"`
+	LastLogin           *time.Time         `bson:"last_login,omitempty" json:"last_login,omitempty"`
+	FailedLoginAttempts int                `bson:"failed_login_attempts" json:"failed_login_attempts"`
+	LockedUntil         *time.Time         `bson:"locked_until,omitempty" json:"locked_until,omitempty"`
+	MFAEnabled          bool               `bson:"mfa_enabled" json:"mfa_enabled"`
+	MFASecret           string             `bson:"mfa_secret,omitempty" json:"-"`
+	MFAPendingSecret    string             `bson:"mfa_pending_secret,omitempty" json:"-"`
+	MFALastStep         int64              `bson:"mfa_last_step,omitempty" json:"-"`
+	MFARecoveryCodes    []string           `bson:"mfa_recovery_codes,omitempty" json:"-"`
+	OIDCIssuer          string             `bson:"oidc_issuer,omitempty" json:"-"`
+	OIDCSubject         string             `bson:"oidc_subject,omitempty" json:"-"`
+	CreatedAt           time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt           time.Time          `bson:"updated_at" json:"updated_at"`
 }
 
 // LoginRequest represents a login request
 type LoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	DeviceName string `json:"device_name,omitempty"`
 }
 
-// RegisterRequest represents a user registration request
+// RegisterRequest represents a user registration request. Role and tenant are
+// never taken from the client: they come from InviteToken, or from a freshly
+// created tenant when open registration is enabled.
 type RegisterRequest struct {
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+	Password    string `json:"password"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	InviteToken string `json:"invite_token,omitempty"`
+	// TenantName names the new tenant in open registration; it defaults to the username
+	TenantName string `json:"tenant_name,omitempty"`
+}
+
+// InviteRequest represents an admin's request to invite a user into their tenant
+type InviteRequest struct {
+	Email string `json:"email"`
+	Role  Role   `json:"role"`
+}
+
+// InviteResponse carries a signed invitation token
+type InviteResponse struct {
+	InviteToken string    `json:"invite_token"`
+	Email       string    `json:"email"`
+	Role        Role      `json:"role"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// InviteClaims represents the claims of a signed invitation token
+type InviteClaims struct {
+	TenantID  string `json:"tenant_id"`
+	Role      Role   `json:"role"`
+	Email     string `json:"email"`
+	InvitedBy string `json:"invited_by"`
+	Exp       int64  `json:"exp"`
+}
+
+// UpdateProfileRequest represents a user updating their own profile. A new
+// email only takes effect once confirmed through the emailed verification link.
+type UpdateProfileRequest struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+}
+
+// EmailChangeClaims represents the claims of a signed email verification token
+type EmailChangeClaims struct {
+	UserID   string `json:"user_id"`
+	OldEmail string `json:"old_email"`
+	NewEmail string `json:"new_email"`
+	Exp      int64  `json:"exp"`
+}
+
+// VerifyEmailRequest confirms a pending email change
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// ForgotPasswordRequest asks for a password reset link to be emailed
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// PasswordResetClaims represents the claims of a signed password reset token
+type PasswordResetClaims struct {
+	UserID              string `json:"user_id"`
+	PasswordFingerprint string `json:"pwd"`
+	Exp                 int64  `json:"exp"`
+}
+
+// ConfirmPasswordResetRequest sets a new password using an emailed reset token
+type ConfirmPasswordResetRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// LogoutRequest represents a logout request. The refresh token is optional;
+// when given, its whole token family is revoked along with the access token.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// CreateUserRequest represents an administrator creating a user in their tenant
+type CreateUserRequest struct {
 	Username  string `json:"username"`
 	Email     string `json:"email"`
 	Password  string `json:"password"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	Role      Role   `json:"role"`
-    TenantID  string `json:"tenant_id"`
+}
+
+// UpdateUserRequest represents an administrative update of a user; nil fields are left unchanged
+type UpdateUserRequest struct {
+	Email     *string `json:"email,omitempty"`
+	FirstName *string `json:"first_name,omitempty"`
+	LastName  *string `json:"last_name,omitempty"`
+	Role      *Role   `json:"role,omitempty"`
+	IsActive  *bool   `json:"is_active,omitempty"`
+}
+
+// ResetPasswordRequest represents an admin-initiated password reset. When
+// NewPassword is empty a temporary password is generated and returned once.
+type ResetPasswordRequest struct {
+	NewPassword string `json:"new_password,omitempty"`
+}
+
+// ResetPasswordResponse carries the generated temporary password, if any
+type ResetPasswordResponse struct {
+	Message           string `json:"message"`
+	TemporaryPassword string `json:"temporary_password,omitempty"`
+}
+
+// MFAChallengeResponse is returned by login instead of tokens when a second factor is needed
+type MFAChallengeResponse struct {
+	MFARequired           bool      `json:"mfa_required,omitempty"`
+	MFAEnrollmentRequired bool      `json:"mfa_enrollment_required,omitempty"`
+	MFAToken              string    `json:"mfa_token"`
+	ExpiresAt             time.Time `json:"expires_at"`
+}
+
+// MFAChallengeClaims represents the claims of a signed MFA challenge token
+type MFAChallengeClaims struct {
+	UserID  string `json:"user_id"`
+	Purpose string `json:"purpose"`
+	Exp     int64  `json:"exp"`
+}
+
+// MFAVerifyRequest completes a two-step login with a TOTP or recovery code
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+	DeviceName   string `json:"device_name,omitempty"`
+}
+
+// MFAEnrollRequest starts TOTP enrollment; MFAToken is only needed when
+// enrolling from a login that requires it, without an access token.
+type MFAEnrollRequest struct {
+	MFAToken string `json:"mfa_token,omitempty"`
+}
+
+// MFAEnrollResponse carries the pending TOTP secret and its provisioning URI
+type MFAEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFAActivateRequest confirms enrollment with a code from the authenticator app
+type MFAActivateRequest struct {
+	MFAToken   string `json:"mfa_token,omitempty"`
+	Code       string `json:"code"`
+	DeviceName string `json:"device_name,omitempty"`
+}
+
+// MFAActivateResponse returns the recovery codes, shown once, and login tokens
+// when enrollment completed a login
+type MFAActivateResponse struct {
+	RecoveryCodes []string       `json:"recovery_codes"`
+	Login         *LoginResponse `json:"login,omitempty"`
+}
+
+// MFACodeRequest proves possession of the second factor for sensitive MFA changes
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+// MFAPolicy is a tenant's policy on which roles must use two-factor authentication
+type MFAPolicy struct {
+	TenantID      string    `bson:"_id" json:"tenant_id"`
+	RequiredRoles []Role    `bson:"required_roles" json:"required_roles"`
+	UpdatedAt     time.Time `bson:"updated_at" json:"updated_at"`
+	UpdatedBy     string    `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+}
+
+// Requires reports whether the policy requires MFA for the role
+func (p *MFAPolicy) Requires(role Role) bool {
+	for _, r := range p.RequiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
 }
 
 // LoginResponse represents a successful login response
@@ -65,7 +254,40 @@ type Claims struct {
 	Username string `json:"username"`
 	Role     Role   `json:"role"`
     TenantID string `json:"tenant_id"`
+	JTI      string `json:"jti,omitempty"`
+	IssuedAt int64  `json:"iat"`
 	Exp      int64  `json:"exp"`
+	// APIKeyID and Scopes are set instead of a user and role when the caller authenticated with an API key
+	APIKeyID string   `json:"api_key_id,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+}
+
+// IsAPIKey reports whether the claims belong to an API key rather than a user session
+func (c *Claims) IsAPIKey() bool {
+	return c.APIKeyID != ""
+}
+
+// HasPermission checks the action against the API key scopes or, for users, the role policy
+func (c *Claims) HasPermission(action string) bool {
+	if c.IsAPIKey() {
+		for _, scope := range c.Scopes {
+			if scopePermissionSet[scope][action] {
+				return true
+			}
+		}
+		return false
+	}
+	return rolePermissionSet[c.Role][action]
+}
+
+// IsLocked reports whether the account is locked out at the given time
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
+// IsSSO reports whether the user signs in through an OpenID Connect identity provider
+func (u *User) IsSSO() bool {
+	return u.OIDCSubject != ""
 }
 
 // IsValidRole checks if a role is valid
@@ -78,22 +300,114 @@ func IsValidRole(role Role) bool {
 	}
 }
 
+// Permission actions checked by HasPermission and the RequirePermission middleware
+const (
+	PermViewTelemetry     = "view_telemetry"
+	PermCreateTelemetry   = "create_telemetry"
+	PermDeleteTelemetry   = "delete_telemetry"
+	PermViewVehicles      = "view_vehicles"
+	PermCreateVehicle     = "create_vehicle"
+	PermUpdateVehicle     = "update_vehicle"
+	PermDeleteVehicle     = "delete_vehicle"
+	PermViewTrips         = "view_trips"
+	PermCreateTrip        = "create_trip"
+	PermUpdateTrip        = "update_trip"
+	PermDeleteTrip        = "delete_trip"
+	PermViewMaintenance   = "view_maintenance"
+	PermCreateMaintenance = "create_maintenance"
+	PermUpdateMaintenance = "update_maintenance"
+	PermDeleteMaintenance = "delete_maintenance"
+	PermViewCosts         = "view_costs"
+	PermCreateCost        = "create_cost"
+	PermUpdateCost        = "update_cost"
+	PermDeleteCost        = "delete_cost"
+	PermViewAlerts        = "view_alerts"
+	PermViewMetrics       = "view_metrics"
+	PermViewUsers         = "view_users"
+	PermCreateUser        = "create_user"
+	PermUpdateUser        = "update_user"
+	PermDeleteUser        = "delete_user"
+	PermManageUsers       = "manage_users"
+	PermManageAPIKeys     = "manage_api_keys"
+	PermViewAudit         = "view_audit"
+
+	// PermManageTenants creates, updates, suspends and deletes tenants. It is
+	// a platform permission, not part of AllPermissions.
+	PermManageTenants = "manage_tenants"
+)
+
+// AllPermissions lists every known permission action
+var AllPermissions = []string{
+	PermViewTelemetry, PermCreateTelemetry, PermDeleteTelemetry,
+	PermViewVehicles, PermCreateVehicle, PermUpdateVehicle, PermDeleteVehicle,
+	PermViewTrips, PermCreateTrip, PermUpdateTrip, PermDeleteTrip,
+	PermViewMaintenance, PermCreateMaintenance, PermUpdateMaintenance, PermDeleteMaintenance,
+	PermViewCosts, PermCreateCost, PermUpdateCost, PermDeleteCost,
+	PermViewAlerts, PermViewMetrics,
+	PermViewUsers, PermCreateUser, PermUpdateUser, PermDeleteUser, PermManageUsers,
+	PermManageAPIKeys, PermViewAudit,
+}
+
+// readOnlyPermissions are the fleet data views granted to every role
+var readOnlyPermissions = []string{
+	PermViewTelemetry, PermViewVehicles, PermViewTrips, PermViewMaintenance,
+	PermViewCosts, PermViewAlerts, PermViewMetrics,
+}
+
+// RolePermissions is the policy table of actions granted to each role
+var RolePermissions = map[Role][]string{
+	RoleAdmin:   AllPermissions,
+	RoleManager: without(AllPermissions, PermDeleteUser, PermManageUsers, PermViewAudit),
+	RoleOperator: append(append([]string{}, readOnlyPermissions...),
+		PermCreateTelemetry,
+		PermCreateTrip, PermUpdateTrip,
+		PermCreateMaintenance, PermUpdateMaintenance,
+	),
+	RoleViewer: readOnlyPermissions,
+}
+
+// PlatformPermissions is the policy table of actions outside any tenant
+var PlatformPermissions = map[Role][]string{
+	RoleSuperAdmin: {PermManageTenants},
+}
+
+// rolePermissionSet indexes RolePermissions and PlatformPermissions for constant-time lookups
+var rolePermissionSet = func() map[Role]map[string]bool {
+	sets := make(map[Role]map[string]bool, len(RolePermissions)+len(PlatformPermissions))
+	for role, actions := range PlatformPermissions {
+		sets[role] = make(map[string]bool, len(actions))
+		for _, action := range actions {
+			sets[role][action] = true
+		}
+	}
+	for role, actions := range RolePermissions {
+		sets[role] = make(map[string]bool, len(actions))
+		for _, action := range actions {
+			sets[role][action] = true
+		}
+	}
+	return sets
+}()
+
+// without returns a copy of actions minus the excluded ones
+func without(actions []string, excluded ...string) []string {
+	result := make([]string, 0, len(actions))
+	for _, action := range actions {
+		skip := false
+		for _, e := range excluded {
+			if action == e {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			result = append(result, action)
+		}
+	}
+	return result
+}
+
 // HasPermission checks if a user has permission for a specific action
 func (u *User) HasPermission(action string) bool {
-	switch u.Role {
-	case RoleAdmin:
-		return true
-	case RoleManager:
-		return action != "delete_user" && action != "manage_users"
-	case RoleOperator:
-		return action == "view_telemetry" || action == "view_vehicles" ||
-			action == "create_trip" || action == "update_trip" ||
-			action == "create_maintenance" || action == "update_maintenance"
-	case RoleViewer:
-		return action == "view_telemetry" || action == "view_vehicles" ||
-			action == "view_trips" || action == "view_maintenance" ||
-			action == "view_costs"
-	default:
-		return false
-	}
+	return rolePermissionSet[u.Role][action]
 }
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"testing"
 	"time"
 )
@@ -60,6 +61,9 @@ func TestUser_HasPermission(t *testing.T) {
 		{"operator can update trip", operator, "update_trip", true},
 		{"operator can create maintenance", operator, "create_maintenance", true},
 		{"operator can update maintenance", operator, "update_maintenance", true},
+		{"operator can view trips", operator, "view_trips", true},
+		{"operator can view costs", operator, "view_costs", true},
+		{"operator cannot delete vehicle", operator, "delete_vehicle", false},
 		{"operator cannot delete user", operator, "delete_user", false},
 		{"operator cannot manage users", operator, "manage_users", false},
 
@@ -72,6 +76,9 @@ func TestUser_HasPermission(t *testing.T) {
 		{"viewer cannot create trip", viewer, "create_trip", false},
 		{"viewer cannot update trip", viewer, "update_trip", false},
 		{"viewer cannot delete user", viewer, "delete_user", false},
+		{"viewer cannot delete vehicle", viewer, "delete_vehicle", false},
+		{"viewer cannot delete telemetry", viewer, "delete_telemetry", false},
+		{"unknown role has no permissions", &User{Role: "ghost"}, "view_telemetry", false},
 	}
 
 	for _, tt := range tests {
@@ -85,6 +92,45 @@ func TestUser_HasPermission(t *testing.T) {
 	}
 }
 
+func TestRolePermissions_Policy(t *testing.T) {
+	known := make(map[string]bool, len(AllPermissions))
+	for _, action := range AllPermissions {
+		known[action] = true
+	}
+
+	for role, actions := range RolePermissions {
+		if !IsValidRole(role) {
+			t.Errorf("policy table contains invalid role %q", role)
+		}
+		for _, action := range actions {
+			if !known[action] {
+				t.Errorf("role %s is granted unknown action %q", role, action)
+			}
+		}
+	}
+
+	// Admins hold everything; every other role is a subset of the one above it
+	hierarchy := []Role{RoleAdmin, RoleManager, RoleOperator, RoleViewer}
+	for _, action := range AllPermissions {
+		if !(&User{Role: RoleAdmin}).HasPermission(action) {
+			t.Errorf("admin lacks %q", action)
+		}
+		for i := 1; i < len(hierarchy); i++ {
+			lower, higher := &User{Role: hierarchy[i]}, &User{Role: hierarchy[i-1]}
+			if lower.HasPermission(action) && !higher.HasPermission(action) {
+				t.Errorf("%s has %q but %s does not", lower.Role, action, higher.Role)
+			}
+		}
+	}
+
+	// Viewers are read-only
+	for _, action := range RolePermissions[RoleViewer] {
+		if !strings.HasPrefix(action, "view_") {
+			t.Errorf("viewer is granted non-read action %q", action)
+		}
+	}
+}
+
 func TestUser_StructFields(t *testing.T) {
 	now := time.Now()
 	user := &User{
@@ -132,3 +178,33 @@ func TestUser_StructFields(t *testing.T) {
 		t.Errorf("Expected UpdatedAt to be set, got %v", user.UpdatedAt)
 	}
 }
+
+func TestClaims_HasPermission_APIKeyScopes(t *testing.T) {
+	known := make(map[string]bool, len(AllPermissions))
+	for _, action := range AllPermissions {
+		known[action] = true
+	}
+	for scope, actions := range ScopePermissions {
+		for _, action := range actions {
+			if !known[action] {
+				t.Errorf("scope %s grants unknown action %q", scope, action)
+			}
+		}
+	}
+
+	key := &Claims{APIKeyID: "key-id", TenantID: "tenant-a", Role: RoleAdmin, Scopes: []string{ScopeTelemetryWrite, ScopeVehiclesRead}}
+	if !key.HasPermission(PermCreateTelemetry) || !key.HasPermission(PermViewVehicles) {
+		t.Error("API key lacks the permissions of its scopes")
+	}
+	// Only scopes count for keys, never a role
+	for _, action := range []string{PermViewTelemetry, PermCreateVehicle, PermManageUsers, PermManageAPIKeys} {
+		if key.HasPermission(action) {
+			t.Errorf("API key has unscoped permission %q", action)
+		}
+	}
+
+	user := &Claims{UserID: "user-id", Role: RoleViewer}
+	if !user.HasPermission(PermViewVehicles) || user.HasPermission(PermCreateTelemetry) {
+		t.Error("user claims should follow the role policy")
+	}
+}
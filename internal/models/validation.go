@@ -0,0 +1,52 @@
+package models
+
+import "strings"
+
+// Codes of field validation failures
+const (
+	FieldRequired   = "required"
+	FieldInvalid    = "invalid"
+	FieldOutOfRange = "out_of_range"
+)
+
+// FieldError describes why one field of a request is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request, so clients can
+// report all of them at once
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Add records an invalid field
+func (e *ValidationError) Add(field, code, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Check records field as invalid with the message of err, when err is set
+func (e *ValidationError) Check(field string, err error) {
+	if err != nil {
+		e.Add(field, FieldInvalid, err.Error())
+	}
+}
+
+// Err returns e, or nil when every field is valid
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Error joins the messages of the invalid fields
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Message
+	}
+	return strings.Join(messages, "; ")
+}
@@ -17,3 +17,32 @@ type Vehicle struct {
 	Status          string             `bson:"status" json:"status"` // "active" or "inactive"
 	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
 }
+
+// Validate checks the fields required to create a vehicle
+func (v *Vehicle) Validate() error {
+	var invalid ValidationError
+	switch v.Type {
+	case "ICE", "EV":
+	case "":
+		invalid.Add("type", FieldRequired, "type is required")
+	default:
+		invalid.Add("type", FieldInvalid, "type must be 'ICE' or 'EV'")
+	}
+	switch v.Status {
+	case "active", "inactive":
+	case "":
+		invalid.Add("status", FieldRequired, "status is required")
+	default:
+		invalid.Add("status", FieldInvalid, "status must be 'active' or 'inactive'")
+	}
+	if v.Make == "" {
+		invalid.Add("make", FieldRequired, "make is required")
+	}
+	if v.Model == "" {
+		invalid.Add("model", FieldRequired, "model is required")
+	}
+	if v.Year < 1900 || v.Year > 2030 {
+		invalid.Add("year", FieldOutOfRange, "year must be between 1900 and 2030")
+	}
+	return invalid.Err()
+}
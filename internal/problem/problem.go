@@ -0,0 +1,132 @@
+// Package problem writes error responses as RFC 9457 problem details
+// (application/problem+json). Every problem carries a stable code clients can
+// branch on instead of matching messages, the invalid fields of validation
+// failures and the request ID to quote when reporting it.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+)
+
+// ContentType is the media type of problem details
+const ContentType = "application/problem+json"
+
+// Stable error codes. Clients may rely on them; details may change.
+const (
+	CodeBadRequest              = "bad_request"
+	CodeInvalidBody             = "invalid_body" // the body could not be read
+	CodeInvalidJSON             = "invalid_json"
+	CodeInvalidID               = "invalid_id"
+	CodeInvalidParameter        = "invalid_parameter" // a malformed query parameter
+	CodeValidation              = "validation_failed" // see the errors member
+	CodeUnauthorized            = "unauthorized"
+	CodeInvalidCredentials      = "invalid_credentials"
+	CodeInvalidToken            = "invalid_token"
+	CodeTokenRevoked            = "token_revoked"
+	CodeMFARequired             = "mfa_required"
+	CodeInvalidMFACode          = "invalid_mfa_code"
+	CodeAccountLocked           = "account_locked"
+	CodeAccountDisabled         = "account_disabled"
+	CodeTooManyAttempts         = "too_many_attempts"
+	CodeForbidden               = "forbidden"
+	CodeInsufficientPermissions = "insufficient_permissions"
+	CodeNotFound                = "not_found"
+	CodeMethodNotAllowed        = "method_not_allowed"
+	CodeConflict                = "conflict"
+	CodeRateLimited             = "rate_limited"
+	CodeInternal                = "internal_error"
+	CodeUnavailable             = "unavailable"
+)
+
+// Problem is an RFC 9457 problem details object with the code, request_id
+// and errors extension members
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	Code      string              `json:"code"`
+	RequestID string              `json:"request_id,omitempty"`
+	Errors    []models.FieldError `json:"errors,omitempty"`
+}
+
+// New returns a problem titled after its status
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Write writes p as the response to r, adding the request path and ID
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	p.Instance = r.URL.Path
+	p.RequestID = logging.RequestID(r.Context())
+	h := w.Header()
+	// Drop headers set for the response that failed, as http.Error does
+	h.Del("Content-Length")
+	h.Set("Content-Type", ContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Error writes a problem with status, code and detail. It replaces
+// http.Error.
+func Error(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	Write(w, r, New(status, code, detail))
+}
+
+// CodeFor returns the generic code of status, for errors that come with a
+// status but no code of their own
+func CodeFor(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// Validation writes a 400 validation_failed problem. When err is a
+// *models.ValidationError every invalid field is listed.
+func Validation(w http.ResponseWriter, r *http.Request, err error) {
+	p := New(http.StatusBadRequest, CodeValidation, err.Error())
+	var invalid *models.ValidationError
+	if errors.As(err, &invalid) {
+		p.Errors = invalid.Fields
+	}
+	Write(w, r, p)
+}
+
+// InvalidField writes a 400 validation_failed problem for a single field
+func InvalidField(w http.ResponseWriter, r *http.Request, field, code, message string) {
+	invalid := &models.ValidationError{}
+	invalid.Add(field, code, message)
+	Validation(w, r, invalid)
+}
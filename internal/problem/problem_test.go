@@ -0,0 +1,65 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ukydev/fleet-sustainability/internal/logging"
+	"github.com/ukydev/fleet-sustainability/internal/models"
+)
+
+func TestError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/trips/abc", nil)
+	r = r.WithContext(logging.WithFields(r.Context(), log.Fields{"request_id": "req-1"}))
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Length", "42")
+
+	Error(w, r, http.StatusNotFound, CodeNotFound, "Trip not found")
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Header().Get("Content-Length"))
+	assert.JSONEq(t, `{
+		"type": "about:blank",
+		"title": "Not Found",
+		"status": 404,
+		"detail": "Trip not found",
+		"instance": "/api/trips/abc",
+		"code": "not_found",
+		"request_id": "req-1"
+	}`, w.Body.String())
+}
+
+func TestValidation(t *testing.T) {
+	invalid := &models.ValidationError{}
+	invalid.Add("name", models.FieldRequired, "name is required")
+	invalid.Add("year", models.FieldOutOfRange, "year must be between 1900 and 2030")
+	w := httptest.NewRecorder()
+
+	Validation(w, httptest.NewRequest(http.MethodPost, "/api/vehicles", nil), invalid.Err())
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var p Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, CodeValidation, p.Code)
+	assert.Equal(t, "name is required; year must be between 1900 and 2030", p.Detail)
+	assert.Equal(t, invalid.Fields, p.Errors)
+
+	// Plain errors carry no field details
+	w = httptest.NewRecorder()
+	Validation(w, httptest.NewRequest(http.MethodPost, "/", nil), errors.New("bad input"))
+	assert.NotContains(t, w.Body.String(), `"errors"`)
+}
+
+func TestCodeFor(t *testing.T) {
+	assert.Equal(t, CodeForbidden, CodeFor(http.StatusForbidden))
+	assert.Equal(t, CodeUnavailable, CodeFor(http.StatusServiceUnavailable))
+	assert.Equal(t, CodeInternal, CodeFor(http.StatusBadGateway))
+	assert.Equal(t, CodeBadRequest, CodeFor(http.StatusTeapot))
+}
@@ -0,0 +1,369 @@
+// Package query parses the list parameters shared by the collection
+// endpoints into a db.Query: field filters, from/to ranges, multi-field sort,
+// sparse fieldsets and page sizes. Results are paged with opaque keyset
+// cursors, so pages stay stable while records are inserted.
+package query
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// DefaultPageSize is the page size when page_size is not given
+	DefaultPageSize = 100
+	// MaxPageSize caps page_size
+	MaxPageSize = 1000
+)
+
+// NextCursorHeader carries the cursor of the next page
+const NextCursorHeader = "X-Next-Cursor"
+
+// cursorKey signs the cursors issued by Page, so clients cannot forge the
+// values a page follows. It is random unless SetCursorKey is called.
+var cursorKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// SetCursorKey sets the key that signs cursors. Instances behind one load
+// balancer need the same key to accept each other's cursors.
+func SetCursorKey(key []byte) {
+	cursorKey = key
+}
+
+// cursorValueTypes are the BSON types a cursor may carry: scalars that
+// compare as values, never documents, arrays, code or patterns
+var cursorValueTypes = map[bsontype.Type]bool{
+	bsontype.Double:     true,
+	bsontype.String:     true,
+	bsontype.ObjectID:   true,
+	bsontype.Boolean:    true,
+	bsontype.DateTime:   true,
+	bsontype.Null:       true,
+	bsontype.Int32:      true,
+	bsontype.Int64:      true,
+	bsontype.Decimal128: true,
+}
+
+// Kind is the type of the values a filter matches
+type Kind int
+
+const (
+	// String matches values as given
+	String Kind = iota
+	// ObjectID matches hex ObjectIDs
+	ObjectID
+	// Int matches integers
+	Int
+)
+
+// Filter maps a query parameter to a document field. Comma-separated values
+// match any of them. A filter on vehicle_id selects the records of those
+// vehicles, see db.Query.
+type Filter struct {
+	Field string
+	Kind  Kind
+}
+
+// Spec describes the list parameters a collection accepts
+type Spec struct {
+	Filters map[string]Filter // by query parameter
+	Sorts   []string          // fields clients may sort by, besides id
+	// DefaultSort is the sort when none is given, e.g. "-start_time"
+	DefaultSort string
+	// TimeRange tells whether from and to bound the time of the records
+	TimeRange bool
+}
+
+// List is a parsed list request
+type List struct {
+	// Query selects the page. Its sort always ends with _id, so the order is
+	// total, and it fetches one record more than a page, which tells whether
+	// another page follows.
+	Query    db.Query
+	PageSize int
+	Fields   []string // JSON fields to return, all when empty
+	sort     string   // canonical sort parameter, bound into cursors
+}
+
+// cursor is the decoded form of a page cursor: the sort it was issued for
+// and the sort values of the last record of the previous page
+type cursor struct {
+	Sort   string          `bson:"s"`
+	Values []bson.RawValue `bson:"v"`
+}
+
+// Parse parses the list parameters of values. Its errors are meant for the
+// client.
+func Parse(spec Spec, values url.Values) (*List, error) {
+	list := &List{PageSize: DefaultPageSize}
+	q := &list.Query
+
+	for param, filter := range spec.Filters {
+		raw := values.Get(param)
+		if raw == "" {
+			continue
+		}
+		var matches []interface{}
+		var given []string
+		for _, value := range strings.Split(raw, ",") {
+			value = strings.TrimSpace(value)
+			parsed, err := filter.parse(value)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s", param)
+			}
+			matches = append(matches, parsed)
+			given = append(given, value)
+		}
+		if filter.Field == "vehicle_id" {
+			q.VehicleIDs = given
+			continue
+		}
+		if q.Match == nil {
+			q.Match = map[string][]interface{}{}
+		}
+		q.Match[filter.Field] = matches
+	}
+
+	if spec.TimeRange {
+		for param, bound := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+			raw := values.Get(param)
+			if raw == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid '%s' time format", param)
+			}
+			*bound = t
+		}
+	}
+
+	if err := list.parseSort(spec, values.Get("sort")); err != nil {
+		return nil, err
+	}
+
+	if raw := values.Get("page_size"); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < 1 {
+			return nil, errors.New("Invalid page_size")
+		}
+		list.PageSize = min(size, MaxPageSize)
+	}
+
+	if raw := values.Get("fields"); raw != "" {
+		for _, field := range strings.Split(raw, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				list.Fields = append(list.Fields, field)
+			}
+		}
+	}
+
+	if raw := values.Get("cursor"); raw != "" {
+		if err := list.after(raw); err != nil {
+			return nil, err
+		}
+	}
+	q.Limit = list.PageSize + 1
+	return list, nil
+}
+
+// parse converts a filter value to the type stored in the field
+func (f Filter) parse(value string) (interface{}, error) {
+	switch f.Kind {
+	case ObjectID:
+		return primitive.ObjectIDFromHex(value)
+	case Int:
+		return strconv.Atoi(value)
+	default:
+		return value, nil
+	}
+}
+
+// parseSort parses a comma-separated sort such as "-start_time,vehicle_id",
+// where a leading - sorts descending
+func (l *List) parseSort(spec Spec, raw string) error {
+	if raw == "" {
+		raw = spec.DefaultSort
+	}
+	seen := map[string]bool{}
+	var keys []string
+	for _, key := range strings.Split(raw, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		descending := false
+		field := strings.TrimPrefix(key, "+")
+		if strings.HasPrefix(field, "-") {
+			descending, field = true, field[1:]
+		}
+		if !sortable(spec, field) {
+			return fmt.Errorf("Invalid sort field %q", field)
+		}
+		if field == "id" {
+			field = "_id"
+		}
+		if seen[field] {
+			return fmt.Errorf("Duplicate sort field %q", key)
+		}
+		seen[field] = true
+		l.Query.Sort = append(l.Query.Sort, db.SortKey{Field: field, Descending: descending})
+		keys = append(keys, key)
+	}
+	if !seen["_id"] {
+		descending := false
+		if len(l.Query.Sort) > 0 {
+			descending = l.Query.Sort[len(l.Query.Sort)-1].Descending
+		}
+		l.Query.Sort = append(l.Query.Sort, db.SortKey{Field: "_id", Descending: descending})
+	}
+	l.sort = strings.Join(keys, ",")
+	return nil
+}
+
+// sortable reports whether clients may sort by field
+func sortable(spec Spec, field string) bool {
+	if field == "id" {
+		return true
+	}
+	for _, allowed := range spec.Sorts {
+		if allowed == field {
+			return true
+		}
+	}
+	return false
+}
+
+// sign returns the MAC of a cursor
+func sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, cursorKey)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// after restricts the query to records following the cursor in sort order
+func (l *List) after(raw string) error {
+	signed, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil || len(signed) <= sha256.Size {
+		return errors.New("Invalid cursor")
+	}
+	data, sum := signed[:len(signed)-sha256.Size], signed[len(signed)-sha256.Size:]
+	if !hmac.Equal(sum, sign(data)) {
+		return errors.New("Invalid cursor")
+	}
+	var c cursor
+	if err := bson.Unmarshal(data, &c); err != nil || c.Sort != l.sort || len(c.Values) != len(l.Query.Sort) {
+		return errors.New("Invalid cursor")
+	}
+	values := make([]interface{}, len(c.Values))
+	for i, raw := range c.Values {
+		if !cursorValueTypes[raw.Type] {
+			return errors.New("Invalid cursor")
+		}
+		if err := raw.Unmarshal(&values[i]); err != nil {
+			return errors.New("Invalid cursor")
+		}
+		if dt, ok := values[i].(primitive.DateTime); ok {
+			values[i] = dt.Time().UTC()
+		}
+	}
+	l.Query.After = values
+	return nil
+}
+
+// Page returns the first page of records, fetched with the query of l, and
+// the cursor of the next page, or "" when this is the last one
+func Page[T any](l *List, records []T) ([]T, string, error) {
+	if len(records) <= l.PageSize {
+		return records, "", nil
+	}
+	records = records[:l.PageSize]
+	doc, err := bson.Marshal(records[len(records)-1])
+	if err != nil {
+		return nil, "", err
+	}
+	c := cursor{Sort: l.sort}
+	for _, key := range l.Query.Sort {
+		value, err := bson.Raw(doc).LookupErr(key.Field)
+		if err != nil {
+			return nil, "", fmt.Errorf("cursor field %s: %w", key.Field, err)
+		}
+		c.Values = append(c.Values, value)
+	}
+	data, err := bson.Marshal(c)
+	if err != nil {
+		return nil, "", err
+	}
+	return records, base64.RawURLEncoding.EncodeToString(append(data, sign(data)...)), nil
+}
+
+// Write writes a page of records as a JSON array reduced to the requested
+// fields. When another page follows, its cursor is sent in X-Next-Cursor and
+// as a Link header with rel="next".
+func Write[T any](w http.ResponseWriter, r *http.Request, l *List, records []T) error {
+	page, next, err := Page(l, records)
+	if err != nil {
+		return err
+	}
+	if page == nil {
+		page = []T{}
+	}
+	body, err := l.encode(page)
+	if err != nil {
+		return err
+	}
+	if next != "" {
+		nextURL := *r.URL
+		params := nextURL.Query()
+		params.Set("cursor", next)
+		nextURL.RawQuery = params.Encode()
+		w.Header().Set(NextCursorHeader, next)
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", nextURL.RequestURI()))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(body)
+	return err
+}
+
+// encode marshals records, keeping only the requested fields and the id
+func (l *List) encode(records interface{}) ([]byte, error) {
+	data, err := json.Marshal(records)
+	if err != nil || len(l.Fields) == 0 {
+		return append(data, '\n'), err
+	}
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	sparse := make([]map[string]json.RawMessage, len(items))
+	for i, item := range items {
+		sparse[i] = map[string]json.RawMessage{}
+		for _, field := range append([]string{"id"}, l.Fields...) {
+			if value, ok := item[field]; ok {
+				sparse[i][field] = value
+			}
+		}
+	}
+	data, err = json.Marshal(sparse)
+	return append(data, '\n'), err
+}
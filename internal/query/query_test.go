@@ -0,0 +1,178 @@
+package query
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ukydev/fleet-sustainability/internal/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type record struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	Status    string             `bson:"status" json:"status"`
+	StartTime time.Time          `bson:"start_time" json:"start_time"`
+	Notes     string             `bson:"notes" json:"notes"`
+}
+
+var spec = Spec{
+	Filters: map[string]Filter{
+		"status":     {Field: "status"},
+		"vehicle_id": {Field: "vehicle_id", Kind: ObjectID},
+		"year":       {Field: "year", Kind: Int},
+	},
+	Sorts:       []string{"status", "start_time"},
+	DefaultSort: "-start_time",
+	TimeRange:   true,
+}
+
+func TestParse(t *testing.T) {
+	vehicleID := primitive.NewObjectID()
+	values := url.Values{
+		"status":     {"planned, completed"},
+		"vehicle_id": {vehicleID.Hex()},
+		"year":       {"2022"},
+		"from":       {"2024-01-01T00:00:00Z"},
+		"sort":       {"status,-start_time"},
+		"page_size":  {"5000"},
+		"fields":     {"status,notes"},
+	}
+	list, err := Parse(spec, values)
+	require.NoError(t, err)
+	assert.Equal(t, db.Query{
+		VehicleIDs: []string{vehicleID.Hex()},
+		From:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Match: map[string][]interface{}{
+			"status": {"planned", "completed"},
+			"year":   {2022},
+		},
+		Sort:  []db.SortKey{{Field: "status"}, {Field: "start_time", Descending: true}, {Field: "_id", Descending: true}},
+		Limit: MaxPageSize + 1,
+	}, list.Query)
+	assert.Equal(t, MaxPageSize, list.PageSize, "page_size is capped")
+	assert.Equal(t, []string{"status", "notes"}, list.Fields)
+
+	list, err = Parse(spec, url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, []db.SortKey{{Field: "start_time", Descending: true}, {Field: "_id", Descending: true}}, list.Query.Sort)
+	assert.Equal(t, DefaultPageSize, list.PageSize)
+	assert.Equal(t, DefaultPageSize+1, list.Query.Limit)
+
+	list, err = Parse(Spec{}, url.Values{"to": {"2024-01-01T00:00:00Z"}})
+	require.NoError(t, err)
+	assert.True(t, list.Query.To.IsZero(), "the collection has no time range")
+	assert.Equal(t, []db.SortKey{{Field: "_id"}}, list.Query.Sort)
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := map[string]string{
+		"vehicle_id=nope":      "Invalid vehicle_id",
+		"year=old":             "Invalid year",
+		"from=yesterday":       "Invalid 'from' time format",
+		"sort=notes":           `Invalid sort field "notes"`,
+		"sort=status,-status":  `Duplicate sort field "-status"`,
+		"page_size=0":          "Invalid page_size",
+		"cursor=!!":            "Invalid cursor",
+		"cursor=AAAA":          "Invalid cursor",
+		"sort=status&cursor=x": "Invalid cursor",
+	}
+	for rawQuery, want := range tests {
+		values, _ := url.ParseQuery(rawQuery)
+		_, err := Parse(spec, values)
+		assert.EqualError(t, err, want, rawQuery)
+	}
+}
+
+func TestPage_Cursor(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []record{
+		{ID: primitive.NewObjectID(), Status: "planned", StartTime: start.Add(2 * time.Hour)},
+		{ID: primitive.NewObjectID(), Status: "planned", StartTime: start.Add(time.Hour)},
+		{ID: primitive.NewObjectID(), Status: "planned", StartTime: start},
+	}
+	list, err := Parse(spec, url.Values{"page_size": {"2"}, "sort": {"status,-start_time"}})
+	require.NoError(t, err)
+
+	page, next, err := Page(list, records)
+	require.NoError(t, err)
+	assert.Equal(t, records[:2], page)
+	require.NotEmpty(t, next)
+
+	// The cursor continues after the last record of the page
+	list, err = Parse(spec, url.Values{"page_size": {"2"}, "sort": {"status,-start_time"}, "cursor": {next}})
+	require.NoError(t, err)
+	last := records[1]
+	assert.Equal(t, []interface{}{"planned", last.StartTime, last.ID}, list.Query.After)
+
+	_, err = Parse(spec, url.Values{"sort": {"-start_time"}, "cursor": {next}})
+	assert.EqualError(t, err, "Invalid cursor", "cursors are bound to their sort")
+
+	page, next, err = Page(list, records[2:])
+	require.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.Empty(t, next)
+}
+
+func TestParse_ForgedCursor(t *testing.T) {
+	signed := func(c cursor) string {
+		data, err := bson.Marshal(c)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(append(data, sign(data)...))
+	}
+	value := func(v interface{}) bson.RawValue {
+		kind, data, err := bson.MarshalValue(v)
+		require.NoError(t, err)
+		return bson.RawValue{Type: kind, Value: data}
+	}
+	id := value(primitive.NewObjectID())
+
+	valid := signed(cursor{Sort: "-start_time", Values: []bson.RawValue{value(time.Now()), id}})
+	list, err := Parse(spec, url.Values{"cursor": {valid}})
+	require.NoError(t, err)
+	assert.Len(t, list.Query.After, 2)
+
+	// Cursors signed with another key are rejected
+	data, _ := base64.RawURLEncoding.DecodeString(valid)
+	data[len(data)-1] ^= 1
+	_, err = Parse(spec, url.Values{"cursor": {base64.RawURLEncoding.EncodeToString(data)}})
+	assert.EqualError(t, err, "Invalid cursor")
+
+	// Operators cannot be smuggled in as values, even in signed cursors
+	for _, v := range []interface{}{
+		bson.D{{Key: "$ne", Value: nil}},
+		bson.A{"a"},
+		primitive.Regex{Pattern: ".*"},
+		primitive.JavaScript("sleep(1000)"),
+	} {
+		_, err = Parse(spec, url.Values{"cursor": {signed(cursor{Sort: "-start_time", Values: []bson.RawValue{value(v), id}})}})
+		assert.EqualError(t, err, "Invalid cursor", "%#v", v)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	records := []record{
+		{ID: primitive.NewObjectID(), Status: "planned", Notes: "a"},
+		{ID: primitive.NewObjectID(), Status: "completed", Notes: "b"},
+	}
+	r := httptest.NewRequest("GET", "/api/trips?status=planned,completed&page_size=1&fields=status", nil)
+	list, err := Parse(spec, r.URL.Query())
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	require.NoError(t, Write(w, r, list, records))
+	assert.JSONEq(t, `[{"id":"`+records[0].ID.Hex()+`","status":"planned"}]`, w.Body.String())
+	next := w.Header().Get(NextCursorHeader)
+	require.NotEmpty(t, next)
+	assert.Equal(t, `</api/trips?cursor=`+next+`&fields=status&page_size=1&status=planned%2Ccompleted>; rel="next"`, w.Header().Get("Link"))
+
+	w = httptest.NewRecorder()
+	require.NoError(t, Write[record](w, r, list, nil))
+	assert.Equal(t, "[]\n", w.Body.String())
+	assert.Empty(t, w.Header().Get("Link"))
+}
@@ -0,0 +1,176 @@
+// Package router routes a versioned HTTP API such as /api/v1. Requests are
+// matched by path pattern first, where {name} segments are read back with
+// r.PathValue, and then by method. Unknown paths and methods are answered
+// with problem details, 405s listing the allowed methods in Allow.
+package router
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ukydev/fleet-sustainability/internal/problem"
+)
+
+// Routes is where handlers register their endpoints. Router implements it;
+// callers may wrap it to apply per-route middleware.
+type Routes interface {
+	Handle(method, pattern string, handler http.Handler)
+}
+
+// Route is a registered method and pattern, relative to the router's prefix
+type Route struct {
+	Method  string
+	Pattern string
+}
+
+// Router routes requests under its prefix
+type Router struct {
+	*table
+	middleware []func(http.Handler) http.Handler // wrapped around handlers registered through this Router
+}
+
+// table is shared by a Router and the routers derived from it by With
+type table struct {
+	prefix string
+	mux    *http.ServeMux
+	paths  map[string]*path
+	use    []func(http.Handler) http.Handler
+}
+
+// path dispatches the requests matching one pattern by method
+type path struct {
+	methods map[string]http.Handler
+}
+
+// New returns a router serving the API under prefix, e.g. "/api/v1"
+func New(prefix string) *Router {
+	t := &table{prefix: prefix, mux: http.NewServeMux(), paths: map[string]*path{}}
+	t.mux.HandleFunc(prefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "Not found")
+	})
+	return &Router{table: t}
+}
+
+// Prefix returns the path the router serves under
+func (rt *Router) Prefix() string {
+	return rt.prefix
+}
+
+// Use adds middleware that sees every request before it is routed, such as
+// CORS, which must answer preflight requests for any route
+func (rt *Router) Use(middleware ...func(http.Handler) http.Handler) {
+	rt.use = append(rt.use, middleware...)
+}
+
+// With returns a router registering on the same routes whose handlers are
+// wrapped in middleware, the first being the outermost
+func (rt *Router) With(middleware ...func(http.Handler) http.Handler) *Router {
+	combined := append(append([]func(http.Handler) http.Handler{}, rt.middleware...), middleware...)
+	return &Router{table: rt.table, middleware: combined}
+}
+
+// Handle routes method requests for pattern, relative to the prefix, to
+// handler. Registering a method twice for a pattern panics.
+func (rt *Router) Handle(method, pattern string, handler http.Handler) {
+	for i := len(rt.middleware) - 1; i >= 0; i-- {
+		handler = rt.middleware[i](handler)
+	}
+	p, ok := rt.paths[pattern]
+	if !ok {
+		p = &path{methods: map[string]http.Handler{}}
+		rt.paths[pattern] = p
+		rt.mux.Handle(rt.prefix+pattern, p)
+	}
+	if _, exists := p.methods[method]; exists {
+		panic("router: duplicate route " + method + " " + pattern)
+	}
+	p.methods[method] = handler
+}
+
+// HandleFunc routes method requests for pattern to handler
+func (rt *Router) HandleFunc(method, pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	rt.Handle(method, pattern, http.HandlerFunc(handler))
+}
+
+// Routes returns the registered routes ordered by pattern and method
+func (rt *Router) Routes() []Route {
+	var routes []Route
+	for pattern, p := range rt.paths {
+		for method := range p.methods {
+			routes = append(routes, Route{Method: method, Pattern: pattern})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// ServeHTTP routes r. The matched pattern, including the prefix, is left in
+// r.Pattern for the metrics, logging and tracing middleware.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rt.mux.ServeHTTP(w, req)
+		r.Pattern = req.Pattern
+	})
+	for i := len(rt.use) - 1; i >= 0; i-- {
+		handler = rt.use[i](handler)
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// Alias serves requests under prefix, such as the unversioned /api of
+// earlier releases, as if they had been sent under the router's prefix. The
+// responses are marked with a Deprecation header.
+func (rt *Router) Alias(prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := *r.URL
+		u.Path = rt.prefix + strings.TrimPrefix(r.URL.Path, prefix)
+		u.RawPath = ""
+		req := r.Clone(r.Context())
+		req.URL = &u
+		req.RequestURI = u.RequestURI()
+		w.Header().Set("Deprecation", "true")
+		rt.ServeHTTP(w, req)
+		r.Pattern = req.Pattern
+	})
+}
+
+// ServeHTTP dispatches by method. HEAD falls back to GET, and OPTIONS
+// requests that no middleware answered get the allowed methods.
+func (p *path) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, ok := p.methods[r.Method]
+	if !ok && r.Method == http.MethodHead {
+		handler, ok = p.methods[http.MethodGet]
+	}
+	if ok {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Allow", p.allow())
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+}
+
+// allow lists the methods of p for the Allow header
+func (p *path) allow() string {
+	methods := make([]string, 0, len(p.methods)+2)
+	for method := range p.methods {
+		methods = append(methods, method)
+	}
+	if _, ok := p.methods[http.MethodGet]; ok {
+		if _, ok := p.methods[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	methods = append(methods, http.MethodOptions)
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
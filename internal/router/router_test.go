@@ -0,0 +1,135 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ukydev/fleet-sustainability/internal/problem"
+)
+
+func echo(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", name)
+		w.Write([]byte(r.PathValue("id")))
+	}
+}
+
+func TestRouter_Routing(t *testing.T) {
+	rt := New("/api/v1")
+	rt.HandleFunc(http.MethodGet, "/trips", echo("list"))
+	rt.HandleFunc(http.MethodPost, "/trips", echo("create"))
+	rt.HandleFunc(http.MethodGet, "/trips/{id}", echo("get"))
+	rt.HandleFunc(http.MethodPost, "/trips/{id}/close", echo("close"))
+
+	tests := []struct {
+		method, path string
+		status       int
+		handler, id  string
+	}{
+		{"GET", "/api/v1/trips", http.StatusOK, "list", ""},
+		{"POST", "/api/v1/trips", http.StatusOK, "create", ""},
+		{"HEAD", "/api/v1/trips", http.StatusOK, "list", ""},
+		{"GET", "/api/v1/trips/abc", http.StatusOK, "get", "abc"},
+		{"POST", "/api/v1/trips/abc/close", http.StatusOK, "close", "abc"},
+		{"DELETE", "/api/v1/trips/abc", http.StatusMethodNotAllowed, "", ""},
+		{"GET", "/api/v1/trips/abc/other", http.StatusNotFound, "", ""},
+		{"GET", "/api/v1/unknown", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		assert.Equal(t, tt.status, w.Code, tt.method+" "+tt.path)
+		assert.Equal(t, tt.handler, w.Header().Get("X-Handler"), tt.method+" "+tt.path)
+		if tt.handler != "" && tt.method != "HEAD" {
+			assert.Equal(t, tt.id, w.Body.String())
+		}
+		if tt.status >= 400 {
+			assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestRouter_MethodNotAllowed(t *testing.T) {
+	rt := New("/api/v1")
+	rt.HandleFunc(http.MethodGet, "/trips/{id}", echo("get"))
+	rt.HandleFunc(http.MethodPatch, "/trips/{id}", echo("patch"))
+
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/trips/abc", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS, PATCH", w.Header().Get("Allow"))
+	var p problem.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, problem.CodeMethodNotAllowed, p.Code)
+
+	w = httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/api/v1/trips/abc", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS, PATCH", w.Header().Get("Allow"))
+}
+
+func TestRouter_Middleware(t *testing.T) {
+	var calls []string
+	mark := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	rt := New("/api/v1")
+	rt.Use(mark("use"))
+	rt.HandleFunc(http.MethodGet, "/open", echo("open"))
+	rt.With(mark("outer"), mark("inner")).HandleFunc(http.MethodGet, "/closed", echo("closed"))
+
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/closed", nil))
+	assert.Equal(t, []string{"use", "outer", "inner"}, calls)
+
+	calls = nil
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/open", nil))
+	assert.Equal(t, []string{"use"}, calls, "With does not affect other routes")
+
+	// Middleware added by Use also sees requests no route matches
+	calls = nil
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodOptions, "/api/v1/nowhere", nil))
+	assert.Equal(t, []string{"use"}, calls)
+}
+
+func TestRouter_PatternAndRoutes(t *testing.T) {
+	rt := New("/api/v1")
+	rt.HandleFunc(http.MethodGet, "/trips/{id}", echo("get"))
+	rt.With().HandleFunc(http.MethodDelete, "/trips/{id}", echo("delete"))
+	rt.HandleFunc(http.MethodGet, "/alerts", echo("alerts"))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/trips/abc", nil)
+	rt.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "/api/v1/trips/{id}", r.Pattern)
+
+	assert.Equal(t, []Route{
+		{Method: "GET", Pattern: "/alerts"},
+		{Method: "DELETE", Pattern: "/trips/{id}"},
+		{Method: "GET", Pattern: "/trips/{id}"},
+	}, rt.Routes())
+	assert.Panics(t, func() { rt.HandleFunc(http.MethodGet, "/alerts", echo("again")) })
+}
+
+func TestRouter_Alias(t *testing.T) {
+	rt := New("/api/v1")
+	rt.HandleFunc(http.MethodGet, "/trips/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RequestURI()))
+	})
+	legacy := rt.Alias("/api")
+
+	r := httptest.NewRequest(http.MethodGet, "/api/trips/abc?fields=status", nil)
+	w := httptest.NewRecorder()
+	legacy.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/api/v1/trips/abc?fields=status", w.Body.String())
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.Equal(t, "/api/v1/trips/{id}", r.Pattern)
+}
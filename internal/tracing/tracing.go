@@ -0,0 +1,98 @@
+// Package tracing sets up OpenTelemetry tracing and W3C trace context
+// propagation for HTTP requests, MQTT messages and MongoDB operations.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of this service's spans
+const instrumentationName = "github.com/ukydev/fleet-sustainability"
+
+// defaultServiceName is the service name when OTEL_SERVICE_NAME is not set
+const defaultServiceName = "fleet-sustainability"
+
+// Setup installs the W3C trace context propagator and a tracer provider
+// exporting to the exporter named by OTEL_TRACES_EXPORTER: "otlp" (OTLP over
+// HTTP, configured by the standard OTEL_EXPORTER_OTLP_* variables), "stdout"
+// for local runs, or "none", the default, which propagates trace context
+// without recording spans. Sampling follows OTEL_TRACES_SAMPLER. The returned
+// function flushes and stops the exporter.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch name := strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER")); name {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "stdout", "console":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unsupported OTEL_TRACES_EXPORTER %q", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("trace exporter error: %w", err)
+	}
+
+	res := resource.Default()
+	if os.Getenv("OTEL_SERVICE_NAME") == "" {
+		res, err = resource.Merge(res, resource.NewSchemaless(attribute.String("service.name", defaultServiceName)))
+		if err != nil {
+			return nil, fmt.Errorf("trace resource error: %w", err)
+		}
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of the service's spans
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start starts an internal span as a child of the span in ctx
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// End ends span, marking it failed when *err is set. It is meant to be
+// deferred with a pointer to a named error result.
+func End(span trace.Span, err *error) {
+	if err != nil && *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
+
+// ExtractProperties returns ctx continuing the trace described by the
+// traceparent and tracestate entries of props, the shape of MQTT v5 user
+// properties
+func ExtractProperties(ctx context.Context, props map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(props))
+}
+
+// InjectProperties returns the trace context of ctx as traceparent and
+// tracestate entries, for publishers that attach them to MQTT messages
+func InjectProperties(ctx context.Context) map[string]string {
+	props := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, props)
+	return props
+}
@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestSetup(t *testing.T) {
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+
+	for _, exporter := range []string{"", "none", "stdout"} {
+		t.Setenv("OTEL_TRACES_EXPORTER", exporter)
+		shutdown, err := Setup(context.Background())
+		if assert.NoError(t, err, exporter) {
+			assert.NoError(t, shutdown(context.Background()))
+		}
+	}
+	assert.Contains(t, otel.GetTextMapPropagator().Fields(), "traceparent")
+
+	t.Setenv("OTEL_TRACES_EXPORTER", "zipkin")
+	_, err := Setup(context.Background())
+	assert.Error(t, err)
+}
+
+func TestProperties(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator()) })
+
+	props := map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	ctx := ExtractProperties(context.Background(), props)
+	assert.Equal(t, props, InjectProperties(ctx), "trace context survives a round trip")
+
+	assert.Empty(t, InjectProperties(ExtractProperties(context.Background(), nil)))
+}
+
+func TestEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	store := func(fail bool) (err error) {
+		_, span := Start(context.Background(), "store")
+		defer End(span, &err)
+		if fail {
+			return errors.New("disk full")
+		}
+		return nil
+	}
+	store(false)
+	store(true)
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, codes.Unset, spans[0].Status().Code)
+		assert.Equal(t, codes.Error, spans[1].Status().Code)
+		assert.Equal(t, "disk full", spans[1].Status().Description)
+	}
+}
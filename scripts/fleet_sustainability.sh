@@ -533,7 +533,7 @@ start_fleet_sustainability() {
     ensure_admin_user
     
     # Test login API (backend is now on port 8081 via Docker)
-    LOGIN_RESPONSE=$(curl -s -X POST http://localhost:8081/api/auth/login \
+    LOGIN_RESPONSE=$(curl -s -X POST http://localhost:8081/api/v1/auth/login \
         -H "Content-Type: application/json" \
         -d '{"username": "admin", "password": "admin123"}')
     
@@ -788,7 +788,7 @@ clear_database() {
 
     # Get admin token for API calls
     print_status "5. Getting admin authentication token..."
-    LOGIN_RESPONSE=$(curl -s -X POST http://localhost:8081/api/auth/login \
+    LOGIN_RESPONSE=$(curl -s -X POST http://localhost:8081/api/v1/auth/login \
         -H "Content-Type: application/json" \
         -d '{"username": "admin", "password": "admin123"}')
     
@@ -801,8 +801,10 @@ clear_database() {
     # Extract token more reliably using jq if available, otherwise use grep
     if command -v jq >/dev/null 2>&1; then
         TOKEN=$(echo "$LOGIN_RESPONSE" | jq -r '.token')
+        TENANT_ID=$(echo "$LOGIN_RESPONSE" | jq -r '.user.tenant_id // empty')
     else
         TOKEN=$(echo "$LOGIN_RESPONSE" | grep -o '"token":"[^"]*"' | cut -d'"' -f4)
+        TENANT_ID=$(echo "$LOGIN_RESPONSE" | grep -o '"tenant_id":"[^"]*"' | head -1 | cut -d'"' -f4)
     fi
     
     if [ -z "$TOKEN" ]; then
@@ -837,7 +839,7 @@ clear_database() {
 
     # Clear telemetry data to prevent old data from affecting metrics
     print_status "6. Clearing telemetry data..."
-    TELE_CODE=$(curl -s -o /dev/null -w '%{http_code}' -X DELETE -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/telemetry || echo 000)
+    TELE_CODE=$(curl -s -o /dev/null -w '%{http_code}' -X DELETE -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/v1/telemetry || echo 000)
     if [ "$TELE_CODE" = "200" ] || [ "$TELE_CODE" = "204" ]; then
         print_status "   Telemetry data cleared successfully (API)"
     else
@@ -867,20 +869,30 @@ clear_database() {
 
     # Clear vehicles by listing and deleting individually (bulk delete not supported)
     print_status "7. Clearing vehicles..."
-    LIST=$(curl -s -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/vehicles)
+    # The list is paged: follow X-Next-Cursor until the last page
     IDS=()
-    if command -v jq >/dev/null 2>&1; then
-        while IFS= read -r id; do [ -n "$id" ] && IDS+=("$id"); done < <(echo "$LIST" | jq -r '.[]? | .id // empty')
-    else
-        while IFS= read -r id; do [ -n "$id" ] && IDS+=("$id"); done < <(echo "$LIST" | grep -o '"id":"[a-f0-9]\{24\}"' | cut -d '"' -f4)
-    fi
+    CURSOR=""
+    while :; do
+        URL="http://localhost:8081/api/v1/vehicles?page_size=1000&fields=id"
+        [ -n "$CURSOR" ] && URL="$URL&cursor=$CURSOR"
+        HEADERS=$(mktemp)
+        LIST=$(curl -s -D "$HEADERS" -H "Authorization: Bearer $TOKEN" "$URL")
+        if command -v jq >/dev/null 2>&1; then
+            while IFS= read -r id; do [ -n "$id" ] && IDS+=("$id"); done < <(echo "$LIST" | jq -r '.[]? | .id // empty')
+        else
+            while IFS= read -r id; do [ -n "$id" ] && IDS+=("$id"); done < <(echo "$LIST" | grep -o '"id":"[a-f0-9]\{24\}"' | cut -d '"' -f4)
+        fi
+        CURSOR=$(grep -i '^X-Next-Cursor:' "$HEADERS" | cut -d' ' -f2 | tr -d '\r\n')
+        rm -f "$HEADERS"
+        [ -z "$CURSOR" ] && break
+    done
     TOTAL=${#IDS[@]}
     if [ "$TOTAL" -gt 0 ]; then
         CNT=0
         for id in "${IDS[@]}"; do
             CNT=$((CNT+1))
             progress_print "   Deleting vehicles:" "$CNT" "$TOTAL"
-            curl -s -X DELETE -H "Authorization: Bearer $TOKEN" "http://localhost:8081/api/vehicles/$id" >/dev/null 2>&1 || true
+            curl -s -X DELETE -H "Authorization: Bearer $TOKEN" "http://localhost:8081/api/v1/vehicles/$id" >/dev/null 2>&1 || true
         done
         progress_done "   Deleting vehicles:" "$CNT" "$TOTAL"
         print_status "   Vehicles cleared: $CNT"
@@ -890,7 +902,7 @@ clear_database() {
 
     # Clear telemetry (API or DB fallback)
     print_status "8. Clearing telemetry data..."
-    TELE_CODE=$(curl -s -o /dev/null -w '%{http_code}' -X DELETE -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/telemetry || echo 000)
+    TELE_CODE=$(curl -s -o /dev/null -w '%{http_code}' -X DELETE -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/v1/telemetry || echo 000)
     if [ "$TELE_CODE" = "200" ] || [ "$TELE_CODE" = "204" ]; then
         print_status "   Telemetry data cleared successfully (API)"
     else
@@ -911,7 +923,7 @@ clear_database() {
 
     # Clear trips using API DELETE endpoint
     print_status "8. Clearing trips..."
-    TRIPS_RESPONSE=$(curl -s -X DELETE -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/trips)
+    TRIPS_RESPONSE=$(curl -s -X DELETE -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/v1/trips)
     if echo "$TRIPS_RESPONSE" | grep -q "deleted successfully"; then
         print_status "   Trips cleared successfully"
     else
@@ -920,7 +932,7 @@ clear_database() {
 
     # Clear maintenance using API DELETE endpoint
     print_status "9. Clearing maintenance records..."
-    MAINTENANCE_RESPONSE=$(curl -s -X DELETE -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/maintenance)
+    MAINTENANCE_RESPONSE=$(curl -s -X DELETE -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/v1/maintenance)
     if echo "$MAINTENANCE_RESPONSE" | grep -q "deleted successfully"; then
         print_status "   Maintenance records cleared successfully"
     else
@@ -929,7 +941,7 @@ clear_database() {
 
     # Clear costs using API DELETE endpoint
     print_status "10. Clearing cost records..."
-    COSTS_RESPONSE=$(curl -s -X DELETE -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/costs)
+    COSTS_RESPONSE=$(curl -s -X DELETE -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/v1/costs)
     if echo "$COSTS_RESPONSE" | grep -q "deleted successfully"; then
         print_status "   Cost records cleared successfully"
     else
@@ -1026,7 +1038,7 @@ populate_database() {
 
     # Get admin token for API calls
     print_status "2. Getting admin authentication token..."
-    LOGIN_RESPONSE=$(curl -s -m 5 -X POST http://localhost:8081/api/auth/login \
+    LOGIN_RESPONSE=$(curl -s -m 5 -X POST http://localhost:8081/api/v1/auth/login \
         -H "Content-Type: application/json" \
         -d '{"username": "admin", "password": "admin123"}')
     
@@ -1039,8 +1051,10 @@ populate_database() {
     # Extract token more reliably using jq if available, otherwise use grep
     if command -v jq >/dev/null 2>&1; then
         TOKEN=$(echo "$LOGIN_RESPONSE" | jq -r '.token')
+        TENANT_ID=$(echo "$LOGIN_RESPONSE" | jq -r '.user.tenant_id // empty')
     else
         TOKEN=$(echo "$LOGIN_RESPONSE" | grep -o '"token":"[^"]*"' | cut -d'"' -f4)
+        TENANT_ID=$(echo "$LOGIN_RESPONSE" | grep -o '"tenant_id":"[^"]*"' | head -1 | cut -d'"' -f4)
     fi
     
     if [ -z "$TOKEN" ]; then
@@ -1079,7 +1093,7 @@ populate_database() {
     export NO_STATIONARY=1
 
     # Sanity check API reachability
-    API_CODE=$(curl -s -o /dev/null -w '%{http_code}' -m 5 -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/vehicles)
+    API_CODE=$(curl -s -o /dev/null -w '%{http_code}' -m 5 -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/v1/vehicles)
     if [ "$API_CODE" != "200" ]; then
         print_warning "   API health check failed (HTTP $API_CODE). Telemetry import may retry auth on 401."
     fi
@@ -1232,7 +1246,7 @@ populate_database() {
 {"type":"EV","make":"Tesla","model":"Model 3","year":2023,"status":"active","current_location":{"lat":$V_LAT,"lon":$V_LON}}
 JSON
 )
-        RESP=$(curl -s -X POST http://localhost:8081/api/vehicles \
+        RESP=$(curl -s -X POST http://localhost:8081/api/v1/vehicles \
             -H "Content-Type: application/json" \
             -H "Authorization: Bearer $TOKEN" \
             -d "$VEHICLE_BODY")
@@ -1309,7 +1323,7 @@ v['current_location']={'lat': float('$V_LAT'), 'lon': float('$V_LON')}
 print(json.dumps(v))
 PY
 )
-            HTTP_CODE=$(curl -s -o /dev/null -w '%{http_code}' -X POST http://localhost:8081/api/vehicles \
+            HTTP_CODE=$(curl -s -o /dev/null -w '%{http_code}' -X POST http://localhost:8081/api/v1/vehicles \
             -H "Content-Type: application/json" \
             -H "Authorization: Bearer $TOKEN" \
                 -d "$VEHICLE_BODY")
@@ -1321,7 +1335,7 @@ PY
         progress_done "   Creating vehicles:" "$CREATED" "$TOTAL_VEH"
         print_status "   Vehicles created: total=$CREATED (EV=$EV_CREATED, ICE=$ICE_CREATED)"
         # Refresh vehicle list and extract IDs and types for subsequent data creation
-    VEHICLES_RESPONSE=$(curl -s -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/vehicles)
+    VEHICLES_RESPONSE=$(curl -s -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/v1/vehicles)
         if command -v jq >/dev/null 2>&1; then
             while read -r id type; do
                 [ -n "$id" ] && VEHICLE_IDS+=("$id") && VEHICLE_TYPES+=("$type")
@@ -1581,7 +1595,7 @@ PY
                 if [ "$VEHICLE_TYPE" = "EV" ]; then EM=0; else EM=$((SPEED/2)); fi
                 ISO_TS=$(date -u -r $ts +%Y-%m-%dT%H:%M:%SZ)
                 TELEMETRY_DATA="{\"vehicle_id\": \"$vid\", \"timestamp\": \"$ISO_TS\", \"location\": {\"lat\": $LAT, \"lon\": $LON}, \"speed\": $SPEED, \"fuel_level\": $FUEL_LEVEL, \"battery_level\": $BATTERY_LEVEL, \"emissions\": $EM, \"type\": \"$VEHICLE_TYPE\", \"status\": \"active\" }"
-                CODE=$(curl -s -m 5 -o /tmp/tele_body.$$ -w '%{http_code}' -X POST http://localhost:8081/api/telemetry \
+                CODE=$(curl -s -m 5 -o /tmp/tele_body.$$ -w '%{http_code}' -X POST http://localhost:8081/api/v1/telemetry \
                     -H "Content-Type: application/json" -H "Authorization: Bearer $TOKEN" -d "$TELEMETRY_DATA")
                 if [ "$CODE" -ge 200 ] && [ "$CODE" -lt 300 ]; then
                     TELE_POSTED=$((TELE_POSTED+1))
@@ -1602,7 +1616,7 @@ PY
                     # On 401, refresh token once and retry immediately
                     if [ "$CODE" = "401" ]; then
                         get_token
-                        RT_CODE=$(curl -s -m 5 -o /tmp/tele_body.$$ -w '%{http_code}' -X POST http://localhost:8081/api/telemetry \
+                        RT_CODE=$(curl -s -m 5 -o /tmp/tele_body.$$ -w '%{http_code}' -X POST http://localhost:8081/api/v1/telemetry \
                             -H "Content-Type: application/json" -H "Authorization: Bearer $TOKEN" -d "$TELEMETRY_DATA")
                         if [ "$RT_CODE" -ge 200 ] && [ "$RT_CODE" -lt 300 ]; then
                             TELE_POSTED=$((TELE_POSTED+1))
@@ -1634,7 +1648,7 @@ PY
                 TRIP_CREATED=$((TRIP_CREATED+1))
                 progress_print "   Trips:" "$TRIP_CREATED" "$TRIP_TOTAL"
                 # ... existing trip body ...
-            RESPONSE=$(curl -s -X POST http://localhost:8081/api/trips \
+            RESPONSE=$(curl -s -X POST http://localhost:8081/api/v1/trips \
                 -H "Content-Type: application/json" \
                 -H "Authorization: Bearer $TOKEN" \
                 -d "$TRIP_DATA")
@@ -1656,7 +1670,7 @@ PY
                 MAINT_CREATED=$((MAINT_CREATED+1))
                 progress_print "   Maintenance:" "$MAINT_CREATED" "$MAINT_TOTAL"
                 # ... existing maintenance body ...
-            RESPONSE=$(curl -s -X POST http://localhost:8081/api/maintenance \
+            RESPONSE=$(curl -s -X POST http://localhost:8081/api/v1/maintenance \
                 -H "Content-Type: application/json" \
                 -H "Authorization: Bearer $TOKEN" \
                 -d "$MAINT_DATA")
@@ -1678,7 +1692,7 @@ PY
                 COST_CREATED=$((COST_CREATED+1))
                 progress_print "   Costs:" "$COST_CREATED" "$COST_TOTAL"
                 # ... existing cost body ...
-            RESPONSE=$(curl -s -X POST http://localhost:8081/api/costs \
+            RESPONSE=$(curl -s -X POST http://localhost:8081/api/v1/costs \
                 -H "Content-Type: application/json" \
                 -H "Authorization: Bearer $TOKEN" \
                 -d "$COST_DATA")
@@ -1782,7 +1796,7 @@ ensure_admin_user() {
     sleep 2
     
     # Try to login first to check if admin exists
-    LOGIN_RESPONSE=$(curl -s -X POST http://localhost:8081/api/auth/login \
+    LOGIN_RESPONSE=$(curl -s -X POST http://localhost:8081/api/v1/auth/login \
         -H "Content-Type: application/json" \
         -d '{"username": "admin", "password": "admin123"}')
     
@@ -1796,7 +1810,7 @@ ensure_admin_user() {
     
     # Admin doesn't exist, create it
     print_status "   Creating admin user..."
-    REGISTER_RESPONSE=$(curl -s -X POST http://localhost:8081/api/auth/register \
+    REGISTER_RESPONSE=$(curl -s -X POST http://localhost:8081/api/v1/auth/register \
         -H "Content-Type: application/json" \
         -d '{"username": "admin", "password": "admin123", "email": "admin@fleet.com", "first_name": "Admin", "last_name": "User", "role": "admin"}')
     
@@ -1807,20 +1821,20 @@ ensure_admin_user() {
         print_warning "   Failed to create admin user, trying alternative method..."
         
         # Try creating other test users as well
-        curl -s -X POST http://localhost:8081/api/auth/register \
+        curl -s -X POST http://localhost:8081/api/v1/auth/register \
             -H "Content-Type: application/json" \
             -d '{"username": "manager", "password": "manager123", "email": "manager@fleet.com", "first_name": "Manager", "last_name": "User", "role": "manager"}' > /dev/null 2>&1
         
-        curl -s -X POST http://localhost:8081/api/auth/register \
+        curl -s -X POST http://localhost:8081/api/v1/auth/register \
             -H "Content-Type: application/json" \
             -d '{"username": "operator", "password": "operator123", "email": "operator@fleet.com", "first_name": "Operator", "last_name": "User", "role": "operator"}' > /dev/null 2>&1
         
-        curl -s -X POST http://localhost:8081/api/auth/register \
+        curl -s -X POST http://localhost:8081/api/v1/auth/register \
             -H "Content-Type: application/json" \
             -d '{"username": "viewer", "password": "viewer123", "email": "viewer@fleet.com", "first_name": "Viewer", "last_name": "User", "role": "viewer"}' > /dev/null 2>&1
         
         # Try login again
-        LOGIN_RESPONSE=$(curl -s -X POST http://localhost:8081/api/auth/login \
+        LOGIN_RESPONSE=$(curl -s -X POST http://localhost:8081/api/v1/auth/login \
             -H "Content-Type: application/json" \
             -d '{"username": "admin", "password": "admin123"}')
         
@@ -1838,7 +1852,7 @@ ensure_admin_user() {
 # Helper: get auth token
 get_token() {
     local resp
-    resp=$(curl -s -m 5 -X POST http://localhost:8081/api/auth/login \
+    resp=$(curl -s -m 5 -X POST http://localhost:8081/api/v1/auth/login \
         -H "Content-Type: application/json" \
         -d '{"username": "admin", "password": "admin123"}') || resp=""
     if command -v jq >/dev/null 2>&1; then
@@ -1874,7 +1888,7 @@ start_simulator() {
 
     # Ensure admin user and get token
     ensure_admin_user
-    LOGIN_RESPONSE=$(curl -s -X POST http://localhost:8081/api/auth/login \
+    LOGIN_RESPONSE=$(curl -s -X POST http://localhost:8081/api/v1/auth/login \
         -H "Content-Type: application/json" \
         -d '{"username":"admin","password":"admin123"}')
     if command -v jq >/dev/null 2>&1; then
@@ -1992,7 +2006,7 @@ start_simulator() {
         {
             env \
                 SIM_AUTH_TOKEN="$TOKEN" \
-                API_BASE_URL="http://localhost:8081/api" \
+                API_BASE_URL="http://localhost:8081/api/v1" \
                 SIM_TICK_SECONDS="$SIM_TICK_SECONDS" \
                 FLEET_SIZE="$FLEET_SIZE" \
                 SIM_SNAP_TO_ROAD="$SIM_SNAP_TO_ROAD" \
@@ -2001,7 +2015,8 @@ start_simulator() {
                 SIM_EXTRA_CITIES="${SIM_EXTRA_CITIES:-}" \
                 SIM_USE_MQTT="${SIM_USE_MQTT:-1}" \
                 MQTT_BROKER_URL="${MQTT_BROKER_URL:-tcp://localhost:1883}" \
-                MQTT_TELEMETRY_TOPIC="${MQTT_TELEMETRY_TOPIC:-fleet/telemetry}" \
+                MQTT_TELEMETRY_TOPIC="${MQTT_TELEMETRY_TOPIC:-tenants/+/telemetry}" \
+                SIM_TENANT_ID="${SIM_TENANT_ID:-$TENANT_ID}" \
                 OSRM_BASE_URL="$OSRM_URL" \
                 $SIM_RUN_CMD
         } > simulator.out 2>&1 &
@@ -2009,7 +2024,7 @@ start_simulator() {
         {
             env \
                 SIM_AUTH_TOKEN="$TOKEN" \
-                API_BASE_URL="http://localhost:8081/api" \
+                API_BASE_URL="http://localhost:8081/api/v1" \
                 SIM_TICK_SECONDS="$SIM_TICK_SECONDS" \
                 FLEET_SIZE="$FLEET_SIZE" \
                 SIM_SNAP_TO_ROAD="$SIM_SNAP_TO_ROAD" \
@@ -2018,7 +2033,8 @@ start_simulator() {
                 SIM_EXTRA_CITIES="${SIM_EXTRA_CITIES:-}" \
                 SIM_USE_MQTT="${SIM_USE_MQTT:-1}" \
                 MQTT_BROKER_URL="${MQTT_BROKER_URL:-tcp://localhost:1883}" \
-                MQTT_TELEMETRY_TOPIC="${MQTT_TELEMETRY_TOPIC:-fleet/telemetry}" \
+                MQTT_TELEMETRY_TOPIC="${MQTT_TELEMETRY_TOPIC:-tenants/+/telemetry}" \
+                SIM_TENANT_ID="${SIM_TENANT_ID:-$TENANT_ID}" \
                 $SIM_RUN_CMD
         } > simulator.out 2>&1 &
     fi
@@ -2243,7 +2259,7 @@ auto_fix() {
         sleep 1
     done
     ensure_admin_user || { print_error "Auto-fix aborted: backend/admin not ready"; return 1; }
-    LOGIN_RESPONSE=$(curl -s -X POST http://localhost:8081/api/auth/login \
+    LOGIN_RESPONSE=$(curl -s -X POST http://localhost:8081/api/v1/auth/login \
         -H "Content-Type: application/json" \
         -d '{"username":"admin","password":"admin123"}')
     if command -v jq >/dev/null 2>&1; then
@@ -2306,7 +2322,7 @@ PY
 {"type":"ICE","make":"Toyota","model":"Camry","year":2023,"status":"active","current_location":{"lat":$V_LAT,"lon":$V_LON}}
 JSON
 )
-    CODE=$(curl -s -o /dev/null -w '%{http_code}' -X POST http://localhost:8081/api/vehicles \
+    CODE=$(curl -s -o /dev/null -w '%{http_code}' -X POST http://localhost:8081/api/v1/vehicles \
         -H "Content-Type: application/json" -H "Authorization: Bearer $TOKEN" \
         -d "$VEHICLE_BODY")
     if [ "$CODE" -ge 200 ] && [ "$CODE" -lt 300 ]; then
@@ -2332,7 +2348,7 @@ PY
 {"type":"EV","make":"Tesla","model":"Model 3","year":2023,"status":"active","current_location":{"lat":$V_LAT,"lon":$V_LON}}
 JSON
 )
-    CODE=$(curl -s -o /dev/null -w '%{http_code}' -X POST http://localhost:8081/api/vehicles \
+    CODE=$(curl -s -o /dev/null -w '%{http_code}' -X POST http://localhost:8081/api/v1/vehicles \
         -H "Content-Type: application/json" -H "Authorization: Bearer $TOKEN" \
         -d "$VEHICLE_BODY")
     if [ "$CODE" -ge 200 ] && [ "$CODE" -lt 300 ]; then
@@ -2346,7 +2362,7 @@ JSON
     print_status "Seeding commute-style telemetry for graphs..."
     VEHICLE_IDS=()
     VEHICLE_TYPES=()
-    VEHICLES_RESPONSE=$(curl -s -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/vehicles)
+    VEHICLES_RESPONSE=$(curl -s -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/v1/vehicles)
     if command -v jq >/dev/null 2>&1; then
         while read -r id type; do
             [ -n "$id" ] && VEHICLE_IDS+=("$id") && VEHICLE_TYPES+=("$type")
@@ -2547,7 +2563,7 @@ PY
             if [ "$VEHICLE_TYPE" = "EV" ]; then EM=0; else EM=$((SPEED/2)); fi
             ISO_TS=$(date -u -r $ts +%Y-%m-%dT%H:%M:%SZ)
             TELEMETRY_DATA="{\"vehicle_id\": \"$vid\", \"timestamp\": \"$ISO_TS\", \"location\": {\"lat\": $LAT, \"lon\": $LON}, \"speed\": $SPEED, \"fuel_level\": $FUEL_LEVEL, \"battery_level\": $BATTERY_LEVEL, \"emissions\": $EM, \"type\": \"$VEHICLE_TYPE\", \"status\": \"active\" }"
-            CODE=$(curl -s -m 5 -o /dev/null -w '%{http_code}' -X POST http://localhost:8081/api/telemetry \
+            CODE=$(curl -s -m 5 -o /dev/null -w '%{http_code}' -X POST http://localhost:8081/api/v1/telemetry \
                 -H "Content-Type: application/json" -H "Authorization: Bearer $TOKEN" -d "$TELEMETRY_DATA")
             TELE_ATTEMPTED=$((TELE_ATTEMPTED+1))
             if [ "$CODE" -ge 200 ] && [ "$CODE" -lt 300 ]; then
@@ -2734,7 +2750,7 @@ PY
                 if [ "$VEHICLE_TYPE" = "EV" ]; then EM=0; else EM=$((SPEED/2)); fi
                 ISO_TS=$(date -u -r $ts +%Y-%m-%dT%H:%M:%SZ)
                 TELEMETRY_DATA="{\"vehicle_id\": \"$vid\", \"timestamp\": \"$ISO_TS\", \"location\": {\"lat\": $LAT, \"lon\": $LON}, \"speed\": $SPEED, \"fuel_level\": $FUEL_LEVEL, \"battery_level\": $BATTERY_LEVEL, \"emissions\": $EM, \"type\": \"$VEHICLE_TYPE\", \"status\": \"active\" }"
-                CODE=$(curl -s -m 5 -o /dev/null -w '%{http_code}' -X POST http://localhost:8081/api/telemetry \
+                CODE=$(curl -s -m 5 -o /dev/null -w '%{http_code}' -X POST http://localhost:8081/api/v1/telemetry \
                     -H "Content-Type: application/json" -H "Authorization: Bearer $TOKEN" -d "$TELEMETRY_DATA")
                 ATTEMPTED=$((ATTEMPTED+1))
                 if [ "$CODE" -ge 200 ] && [ "$CODE" -lt 300 ]; then
@@ -2773,7 +2789,7 @@ PY
     progress_print "   Verifying telemetry:" "$ATTEMPTS" "$MAX_ATTEMPTS"
     while [ $ATTEMPTS -lt $MAX_ATTEMPTS ]; do
         FROM=$(date -u -v-30S +%Y-%m-%dT%H:%M:%SZ 2>/dev/null || date -u -d '30 seconds ago' +%Y-%m-%dT%H:%M:%SZ)
-        RESP=$(curl -s -H "Authorization: Bearer $TOKEN" "http://localhost:8081/api/telemetry?from=$FROM")
+        RESP=$(curl -s -H "Authorization: Bearer $TOKEN" "http://localhost:8081/api/v1/telemetry?from=$FROM&page_size=1000")
         if command -v jq >/dev/null 2>&1; then
             SEEN=$(echo "$RESP" | jq -r '.[].vehicle_id' | awk 'NF' | sort | uniq | wc -l | tr -d ' ')
         else
@@ -2797,7 +2813,7 @@ PY
     # Get fresh vehicle list after verification
     VEHICLE_IDS=()
     VEHICLE_TYPES=()
-    VEHICLES_RESPONSE=$(curl -s -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/vehicles)
+    VEHICLES_RESPONSE=$(curl -s -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/v1/vehicles)
     if command -v jq >/dev/null 2>&1; then
         while read -r id type; do
             [ -n "$id" ] && VEHICLE_IDS+=("$id") && VEHICLE_TYPES+=("$type")
@@ -2899,7 +2915,7 @@ PY
 JSON
 )
             
-            CODE=$(curl -s -o /dev/null -w '%{http_code}' -X POST http://localhost:8081/api/trips \
+            CODE=$(curl -s -o /dev/null -w '%{http_code}' -X POST http://localhost:8081/api/v1/trips \
                 -H "Content-Type: application/json" \
                 -H "Authorization: Bearer $TOKEN" \
                 -d "$TRIP_DATA")
@@ -2977,7 +2993,7 @@ PY
 JSON
 )
             
-            CODE=$(curl -s -o /dev/null -w '%{http_code}' -X POST http://localhost:8081/api/maintenance \
+            CODE=$(curl -s -o /dev/null -w '%{http_code}' -X POST http://localhost:8081/api/v1/maintenance \
                 -H "Content-Type: application/json" \
                 -H "Authorization: Bearer $TOKEN" \
                 -d "$MAINT_DATA")
@@ -3058,7 +3074,7 @@ PY
 JSON
 )
             
-            CODE=$(curl -s -o /dev/null -w '%{http_code}' -X POST http://localhost:8081/api/costs \
+            CODE=$(curl -s -o /dev/null -w '%{http_code}' -X POST http://localhost:8081/api/v1/costs \
                 -H "Content-Type: application/json" \
                 -H "Authorization: Bearer $TOKEN" \
                 -d "$COST_DATA")
@@ -3074,16 +3090,16 @@ JSON
 
     # 8) Prune any vehicles without telemetry to keep fleet tab clean
     print_status "Pruning vehicles without telemetry..."
-    VEH_LIST=$(curl -s -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/vehicles)
+    VEH_LIST=$(curl -s -H "Authorization: Bearer $TOKEN" http://localhost:8081/api/v1/vehicles)
     TO_DELETE=0
     if command -v jq >/dev/null 2>&1; then
         while read -r vid; do
             [ -z "$vid" ] && continue
             # Check if there is at least one telemetry record
-            TJSON=$(curl -s -H "Authorization: Bearer $TOKEN" "http://localhost:8081/api/telemetry?vehicle_id=$vid&limit=1&sort=desc")
+            TJSON=$(curl -s -H "Authorization: Bearer $TOKEN" "http://localhost:8081/api/v1/telemetry?vehicle_id=$vid&limit=1&sort=desc")
             HAS=$(echo "$TJSON" | jq -r 'length')
             if [ "$HAS" = "0" ] || [ -z "$HAS" ]; then
-                CODE=$(curl -s -o /dev/null -w '%{http_code}' -X DELETE -H "Authorization: Bearer $TOKEN" "http://localhost:8081/api/vehicles/$vid")
+                CODE=$(curl -s -o /dev/null -w '%{http_code}' -X DELETE -H "Authorization: Bearer $TOKEN" "http://localhost:8081/api/v1/vehicles/$vid")
                 if [ "$CODE" -ge 200 ] && [ "$CODE" -lt 300 ]; then TO_DELETE=$((TO_DELETE+1)); fi
             fi
         done < <(echo "$VEH_LIST" | jq -r '.[]? | .id // empty')